@@ -3,7 +3,10 @@ package main
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -11,12 +14,16 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/plumber/plumber/internal/agent/client"
 	"github.com/plumber/plumber/internal/agent/executor"
+	"github.com/plumber/plumber/internal/agent/update"
+	"github.com/plumber/plumber/pkg/agentupdate"
 )
 
 const (
@@ -24,9 +31,22 @@ const (
 	agentConfigFile = "agent.json"
 )
 
+// 注册时服务端不可达（如正在重启）的重试次数和间隔
+const (
+	registerAttempts      = 5
+	registerRetryInterval = 5 * time.Second
+)
+
+// Version 构建时通过 -ldflags "-X main.Version=..." 注入
+var Version = "dev"
+
 var (
 	configPath = flag.String("config", "agent.json", "Path to agent configuration file")
 	workDir    = flag.String("workdir", "/tmp", "Default working directory")
+	joinToken  = flag.String("join", "", "Join token used to register this agent (writes config to --config)")
+	joinServer = flag.String("server", "", "Server address used with --join")
+	joinName   = flag.String("name", "", "Agent name used with --join (defaults to hostname)")
+	joinCACert = flag.String("ca-cert", "", "CA certificate file to trust when joining an https server")
 )
 
 // AgentConfig Agent配置文件结构
@@ -34,11 +54,29 @@ type AgentConfig struct {
 	ID         string `json:"id"`
 	Token      string `json:"token"`
 	ServerAddr string `json:"server_addr"`
+	CACert     string `json:"ca_cert,omitempty"`   // 服务端内置CA证书（PEM），启用mTLS时由服务端生成
+	CertFile   string `json:"cert_file,omitempty"` // 客户端证书路径，默认与配置文件同目录
+	KeyFile    string `json:"key_file,omitempty"`  // 客户端私钥路径
+
+	DisableTerminal bool `json:"disable_terminal,omitempty"` // 禁止通过服务端打开本机终端
+
+	UpdatePublicKey   string `json:"update_public_key,omitempty"`   // 服务端自更新签名公钥，未配置时不自更新
+	DisableSelfUpdate bool   `json:"disable_self_update,omitempty"` // 忽略服务端下发的自更新
+
+	ContainerSocket string `json:"container_socket,omitempty"` // Docker或Podman的socket路径，为空时自动探测
 }
 
 func main() {
 	flag.Parse()
 
+	// 使用加入令牌自助注册，生成配置文件
+	if *joinToken != "" {
+		if err := joinServerWithToken(); err != nil {
+			log.Fatalf("Failed to join server: %v", err)
+		}
+		log.Printf("Joined server, config written to %s", *configPath)
+	}
+
 	// 加载配置文件
 	config, err := loadConfig(*configPath)
 	if err != nil {
@@ -51,7 +89,7 @@ func main() {
 		log.Fatalf("Invalid agent ID in config: %v", err)
 	}
 
-	log.Printf("Agent ID: %s", agentID)
+	log.Printf("Agent ID: %s, Version: %s", agentID, Version)
 	log.Printf("Server: %s", config.ServerAddr)
 
 	// 获取主机名和IP
@@ -65,17 +103,53 @@ func main() {
 		log.Fatalf("Failed to get IP: %v", err)
 	}
 
+	// 配置mTLS（服务端地址为https且下发了CA证书时）
+	var tlsConfig *tls.Config
+	var certManager *client.CertManager
+	if strings.HasPrefix(config.ServerAddr, "https://") && config.CACert != "" {
+		tlsConfig, certManager, err = setupTLS(config, *configPath)
+		if err != nil {
+			log.Fatalf("Failed to setup TLS: %v", err)
+		}
+	}
+
 	// 创建客户端
-	agentClient := client.NewClient(config.ServerAddr, agentID, config.Token)
+	agentClient := client.NewClient(config.ServerAddr, agentID, config.Token, tlsConfig)
+	agentClient.SetTerminalEnabled(!config.DisableTerminal)
+
+	// 检查上一次自更新，新版本多次启动失败时在这里恢复原二进制
+	updater, updateState := setupUpdater(config)
+	if updater != nil {
+		agentClient.SetUpdater(updater)
+	}
+
+	// 首次启动或证书即将过期时申请客户端证书
+	if certManager != nil && certManager.NeedsRenewal() {
+		if err := agentClient.Enroll(certManager); err != nil {
+			log.Fatalf("Failed to enroll client certificate: %v", err)
+		}
+	}
 
 	// 注册Agent
-	if err := agentClient.Register(hostname, ip); err != nil {
+	if err := register(agentClient, hostname, ip); err != nil {
+		// 只有服务端拒绝新版本时才回滚；网络错误时退出重启，由Resume的启动次数决定是否回滚
+		var rpcErr *client.RPCError
+		if updateState != nil && updateState.Status != agentupdate.StatusRolledBack && errors.As(err, &rpcErr) {
+			log.Printf("Failed to register after update: %v", err)
+			if err := updater.Rollback(updateState, "failed to register: "+err.Error()); err != nil {
+				log.Printf("Failed to roll back update: %v", err)
+			}
+		}
 		log.Fatalf("Failed to register agent: %v", err)
 	}
 	log.Printf("Agent registered successfully")
+	if updateState != nil {
+		reportUpdate(agentClient, updater, updateState)
+	}
 
 	// 创建执行器
 	exec := executor.NewExecutor(*workDir)
+	exec.Register("container", executor.NewContainerPlugin(executor.NewDockerRuntime(config.ContainerSocket)))
 
 	// 启动心跳
 	ctx, cancel := context.WithCancel(context.Background())
@@ -84,6 +158,11 @@ func main() {
 	go agentClient.StartHeartbeat(ctx, 1*time.Second)
 	log.Printf("Heartbeat started")
 
+	if certManager != nil {
+		go agentClient.StartCertRenewal(ctx, certManager, time.Hour)
+		log.Printf("Certificate renewal started")
+	}
+
 	// 启动任务轮询
 	go agentClient.StartTaskPolling(ctx, exec, 500*time.Millisecond)
 	log.Printf("Task polling started")
@@ -124,6 +203,144 @@ func loadConfig(path string) (*AgentConfig, error) {
 	return &config, nil
 }
 
+// setupUpdater 创建自更新器并检查上一次自更新的结果，未启用自更新时返回nil
+func setupUpdater(config *AgentConfig) (*update.Updater, *update.State) {
+	if config.DisableSelfUpdate || config.UpdatePublicKey == "" {
+		return nil, nil
+	}
+	publicKey, err := agentupdate.ParsePublicKey(config.UpdatePublicKey)
+	if err != nil {
+		log.Printf("Self-update disabled: invalid update_public_key: %v", err)
+		return nil, nil
+	}
+	updater, err := update.New(Version, publicKey)
+	if err != nil {
+		log.Printf("Self-update disabled: %v", err)
+		return nil, nil
+	}
+	state, err := updater.Resume()
+	if err != nil {
+		log.Printf("Failed to resume update: %v", err)
+	}
+	return updater, state
+}
+
+// register 注册Agent，网络错误时重试，服务端返回错误时立即返回
+func register(agentClient *client.Client, hostname, ip string) error {
+	var err error
+	for attempt := 1; attempt <= registerAttempts; attempt++ {
+		err = agentClient.Register(hostname, ip, Version)
+		var rpcErr *client.RPCError
+		if err == nil || errors.As(err, &rpcErr) {
+			return err
+		}
+		log.Printf("Failed to register (attempt %d/%d): %v", attempt, registerAttempts, err)
+		if attempt < registerAttempts {
+			time.Sleep(registerRetryInterval)
+		}
+	}
+	return err
+}
+
+// reportUpdate 注册成功后确认新版本或上报回滚结果
+func reportUpdate(agentClient *client.Client, updater *update.Updater, state *update.State) {
+	status, message := agentupdate.StatusSuccess, ""
+	if state.Status == agentupdate.StatusRolledBack {
+		status, message = agentupdate.StatusRolledBack, state.Message
+		log.Printf("Update to %s was rolled back: %s", state.ToVersion, state.Message)
+	} else {
+		log.Printf("Updated from %s to %s", state.FromVersion, state.ToVersion)
+	}
+
+	if err := agentClient.ReportUpdate(state.FromVersion, state.ToVersion, status, message); err != nil {
+		log.Printf("Failed to report update result: %v", err)
+	}
+	if status == agentupdate.StatusSuccess {
+		updater.Confirm()
+	} else {
+		updater.Clear()
+	}
+}
+
+// joinServerWithToken 使用加入令牌注册并写入配置文件
+func joinServerWithToken() error {
+	if *joinServer == "" {
+		return fmt.Errorf("--server is required with --join")
+	}
+
+	if _, err := os.Stat(*configPath); err == nil {
+		return fmt.Errorf("config file %s already exists, remove it to join again", *configPath)
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return fmt.Errorf("failed to get hostname: %w", err)
+	}
+
+	ip, err := getOutboundIP()
+	if err != nil {
+		log.Printf("Failed to get IP: %v", err)
+	}
+
+	var tlsConfig *tls.Config
+	if *joinCACert != "" {
+		caPEM, err := os.ReadFile(*joinCACert)
+		if err != nil {
+			return fmt.Errorf("failed to read CA certificate: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return fmt.Errorf("invalid CA certificate: %s", *joinCACert)
+		}
+		tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12, RootCAs: pool}
+	}
+
+	data, err := client.Join(strings.TrimRight(*joinServer, "/"), tlsConfig, *joinToken, *joinName, hostname, ip)
+	if err != nil {
+		return err
+	}
+
+	// 配置文件包含Agent令牌，仅允许当前用户读取
+	return os.WriteFile(*configPath, data, 0600)
+}
+
+// setupTLS 构建客户端TLS配置：信任系统根证书及服务端CA，并按需出示客户端证书
+func setupTLS(config *AgentConfig, configPath string) (*tls.Config, *client.CertManager, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM([]byte(config.CACert)) {
+		return nil, nil, fmt.Errorf("invalid ca_cert in config")
+	}
+
+	dir := filepath.Dir(configPath)
+	certFile := config.CertFile
+	if certFile == "" {
+		certFile = filepath.Join(dir, "agent.crt")
+	}
+	keyFile := config.KeyFile
+	if keyFile == "" {
+		keyFile = filepath.Join(dir, "agent.key")
+	}
+
+	certManager := client.NewCertManager(certFile, keyFile)
+	if err := certManager.Load(); err != nil {
+		log.Printf("Ignoring existing client certificate: %v", err)
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:           tls.VersionTLS12,
+		RootCAs:              pool,
+		GetClientCertificate: certManager.GetClientCertificate,
+	}
+
+	return tlsConfig, certManager, nil
+}
+
 // getOutboundIP 获取公网IPv4地址
 func getOutboundIP() (string, error) {
 	// 尝试多个公共IP查询服务（仅IPv4）
@@ -2,11 +2,15 @@ package main
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
@@ -14,6 +18,7 @@ import (
 	"time"
 
 	"github.com/plumber/plumber/pkg/jsonrpc"
+	"github.com/plumber/plumber/pkg/taskconfig"
 )
 
 const (
@@ -23,8 +28,10 @@ const (
 type Config struct {
 	ServerURL string `json:"server_url"`
 	Username  string `json:"username"`
-	Password  string `json:"password"`
-	Token     string `json:"token"`
+	Password  string `json:"password,omitempty"`
+	Token     string `json:"token,omitempty"`
+	Refresh   string `json:"refresh_token,omitempty"` // 刷新令牌，访问令牌过期时优先用它续期
+	APIToken  string `json:"api_token,omitempty"` // 个人API令牌，设置后不再使用用户名密码登录
 }
 
 var (
@@ -42,8 +49,24 @@ func main() {
 	setConfigURL := setConfigCmd.String("url", "", "Plumber server URL")
 	setConfigUser := setConfigCmd.String("user", "", "Username")
 	setConfigPassword := setConfigCmd.String("password", "", "Password")
+	setConfigToken := setConfigCmd.String("token", "", "Personal API token (instead of user/password)")
 
 	taskCmd := flag.NewFlagSet("task", flag.ExitOnError)
+	taskOffline := taskCmd.Bool("offline", false, "Only check syntax and step settings, without contacting the server (validate)")
+
+	auditCmd := flag.NewFlagSet("audit", flag.ExitOnError)
+	auditUser := auditCmd.String("user", "", "Filter by username")
+	auditMethod := auditCmd.String("method", "", "Filter by method name prefix, e.g. plumber.agent.")
+	auditTask := auditCmd.String("task", "", "Filter by task ID")
+	auditAgent := auditCmd.String("agent", "", "Filter by agent ID")
+	auditResult := auditCmd.String("result", "", "Filter by result: success/error/denied")
+	auditSince := auditCmd.Duration("since", 24*time.Hour, "Show entries newer than this duration")
+	auditLimit := auditCmd.Int("limit", 50, "Maximum number of entries")
+
+	artifactCmd := flag.NewFlagSet("artifact", flag.ExitOnError)
+	artifactName := artifactCmd.String("name", "", "Artifact name (upload, default: file name; list: filter by name)")
+	artifactOutput := artifactCmd.String("o", "", "Output file (download, default: artifact name)")
+	artifactExecution := artifactCmd.String("execution", "", "Filter by execution ID (list)")
 
 	if len(os.Args) < 2 {
 		printUsage()
@@ -53,11 +76,11 @@ func main() {
 	switch os.Args[1] {
 	case "set-config":
 		setConfigCmd.Parse(os.Args[2:])
-		handleSetConfig(*setConfigURL, *setConfigUser, *setConfigPassword)
+		handleSetConfig(*setConfigURL, *setConfigUser, *setConfigPassword, *setConfigToken)
 
 	case "task":
 		if len(os.Args) < 3 {
-			fmt.Println("Usage: plumber-cli task <list|run|info>")
+			fmt.Println("Usage: plumber-cli task <list|run|info|validate>")
 			os.Exit(1)
 		}
 
@@ -77,6 +100,13 @@ func main() {
 				os.Exit(1)
 			}
 			handleTaskInfo(os.Args[3])
+		case "validate":
+			file := parseArgs(taskCmd, os.Args[3:])
+			if file == "" {
+				fmt.Println("Usage: plumber-cli task validate <file> [--offline]")
+				os.Exit(1)
+			}
+			handleTaskValidate(file, *taskOffline)
 		default:
 			fmt.Printf("Unknown task command: %s\n", os.Args[2])
 			os.Exit(1)
@@ -96,6 +126,45 @@ func main() {
 			os.Exit(1)
 		}
 
+	case "artifact":
+		if len(os.Args) < 3 {
+			fmt.Println("Usage: plumber-cli artifact <upload|download|list>")
+			os.Exit(1)
+		}
+
+		arg := parseArgs(artifactCmd, os.Args[3:])
+		switch os.Args[2] {
+		case "upload":
+			if arg == "" {
+				fmt.Println("Usage: plumber-cli artifact upload <file> [--name <name>]")
+				os.Exit(1)
+			}
+			handleArtifactUpload(arg, *artifactName)
+		case "download":
+			if arg == "" {
+				fmt.Println("Usage: plumber-cli artifact download <artifact_id> [-o <file>]")
+				os.Exit(1)
+			}
+			handleArtifactDownload(arg, *artifactOutput)
+		case "list":
+			handleArtifactList(*artifactExecution, *artifactName)
+		default:
+			fmt.Printf("Unknown artifact command: %s\n", os.Args[2])
+			os.Exit(1)
+		}
+
+	case "audit":
+		auditCmd.Parse(os.Args[2:])
+		handleAudit(map[string]interface{}{
+			"username": *auditUser,
+			"method":   *auditMethod,
+			"task_id":  *auditTask,
+			"agent_id": *auditAgent,
+			"result":   *auditResult,
+			"since":    time.Now().Add(-*auditSince).Format(time.RFC3339),
+			"limit":    *auditLimit,
+		})
+
 	default:
 		printUsage()
 		os.Exit(1)
@@ -106,42 +175,67 @@ func printUsage() {
 	fmt.Println("Plumber CLI - Task orchestration and distribution tool")
 	fmt.Println("\nUsage:")
 	fmt.Println("  plumber-cli set-config --url <server_url> --user <username> --password <password>")
+	fmt.Println("  plumber-cli set-config --url <server_url> --token <api_token>")
 	fmt.Println("  plumber-cli task list")
 	fmt.Println("  plumber-cli task run <task_id>")
 	fmt.Println("  plumber-cli task info <task_id>")
+	fmt.Println("  plumber-cli task validate <file> [--offline]")
 	fmt.Println("  plumber-cli agent list")
+	fmt.Println("  plumber-cli artifact upload <file> [--name <name>]")
+	fmt.Println("  plumber-cli artifact download <artifact_id> [-o <file>]")
+	fmt.Println("  plumber-cli artifact list [--execution <execution_id>] [--name <name>]")
+	fmt.Println("  plumber-cli audit [--user <username>] [--method <prefix>] [--task <task_id>] [--agent <agent_id>] [--result <result>] [--since 24h] [--limit 50]")
 }
 
-func handleSetConfig(url, username, password string) {
+func handleSetConfig(url, username, password, apiToken string) {
 	// 设置 URL
 	if url != "" {
 		config.ServerURL = url
 	}
 
+	if config.ServerURL == "" {
+		fmt.Println("Error: Server URL is required. Use --url to specify it.")
+		os.Exit(1)
+	}
+
+	// 使用个人API令牌时不保存密码
+	if apiToken != "" {
+		config.APIToken = apiToken
+		config.Username = ""
+		config.Password = ""
+		config.Token = ""
+		config.Refresh = ""
+
+		if err := saveConfig(); err != nil {
+			fmt.Printf("Failed to save config: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Println("API token saved successfully")
+		return
+	}
+
 	// 用户名和密码是必需的
 	if username == "" || password == "" {
-		fmt.Println("Error: Username and password are required")
+		fmt.Println("Error: Username and password (or --token) are required")
 		fmt.Println("Usage: plumber-cli set-config --url <server_url> --user <username> --password <password>")
+		fmt.Println("       plumber-cli set-config --url <server_url> --token <api_token>")
 		os.Exit(1)
 	}
 
 	// 保存用户名和密码（用于后续自动登录）
 	config.Username = username
 	config.Password = password
-
-	// 验证配置并获取 token
-	if config.ServerURL == "" {
-		fmt.Println("Error: Server URL is required. Use --url to specify it.")
-		os.Exit(1)
-	}
+	config.APIToken = ""
 
 	fmt.Printf("Logging in as %s...\n", username)
-	obtainedToken, err := loginAndGetToken(config.ServerURL, username, password)
+	tokens, err := loginAndGetToken(config.ServerURL, username, password)
 	if err != nil {
 		fmt.Printf("Login failed: %v\n", err)
 		os.Exit(1)
 	}
-	config.Token = obtainedToken
+	config.Token = tokens.Token
+	config.Refresh = tokens.RefreshToken
 	fmt.Println("Login successful!")
 
 	// 保存配置
@@ -153,84 +247,95 @@ func handleSetConfig(url, username, password string) {
 	fmt.Println("Configuration saved successfully")
 }
 
-func loginAndGetToken(serverURL, username, password string) (string, error) {
+// tokenPair 登录或刷新返回的令牌
+type tokenPair struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+func loginAndGetToken(serverURL, username, password string) (*tokenPair, error) {
+	return requestTokens(serverURL, "plumber.user.login", map[string]string{
+		"username": username,
+		"password": password,
+	})
+}
+
+func refreshAccessToken(serverURL, refreshToken string) (*tokenPair, error) {
+	return requestTokens(serverURL, "plumber.user.refresh", map[string]string{
+		"refresh_token": refreshToken,
+	})
+}
+
+// requestTokens 调用无需认证的登录/刷新方法获取令牌
+func requestTokens(serverURL, method string, params interface{}) (*tokenPair, error) {
 	// 构建 URL，处理尾部斜杠
 	if serverURL[len(serverURL)-1] == '/' {
 		serverURL = serverURL[:len(serverURL)-1]
 	}
 	url := serverURL + "/api/rpc"
 
-	// 构建登录请求
-	loginParams := map[string]string{
-		"username": username,
-		"password": password,
-	}
-	paramsBytes, err := json.Marshal(loginParams)
+	paramsBytes, err := json.Marshal(params)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	req := jsonrpc.Request{
 		JSONRPC: "2.0",
-		Method:  "plumber.user.login",
+		Method:  method,
 		Params:  paramsBytes,
 		ID:      1,
 	}
 
 	body, err := json.Marshal(req)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	// 发送 HTTP 请求
 	httpReq, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	httpReq.Header.Set("Content-Type", "application/json")
 
 	client := &http.Client{Timeout: 30 * time.Second}
 	resp, err := client.Do(httpReq)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	// 解析响应
 	bodyBytes, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("failed to read response: %w", err)
+		return nil, fmt.Errorf("failed to read response: %w", err)
 	}
 
 	var rpcResp jsonrpc.Response
 	if err := json.Unmarshal(bodyBytes, &rpcResp); err != nil {
-		return "", fmt.Errorf("failed to parse response: %w", err)
+		return nil, fmt.Errorf("failed to parse response: %w", err)
 	}
 
 	if rpcResp.Error != nil {
-		return "", fmt.Errorf("login error: %s", rpcResp.Error.Message)
+		return nil, fmt.Errorf("login error: %s", rpcResp.Error.Message)
 	}
 
 	// 提取 token
 	resultBytes, err := json.Marshal(rpcResp.Result)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	var loginResult struct {
-		Token    string `json:"token"`
-		Username string `json:"username"`
-		UserID   string `json:"user_id"`
-	}
-	if err := json.Unmarshal(resultBytes, &loginResult); err != nil {
-		return "", fmt.Errorf("failed to parse login result: %w", err)
+	var tokens tokenPair
+	if err := json.Unmarshal(resultBytes, &tokens); err != nil {
+		return nil, fmt.Errorf("failed to parse login result: %w", err)
 	}
 
-	if loginResult.Token == "" {
-		return "", fmt.Errorf("no token returned from server")
+	if tokens.Token == "" {
+		return nil, fmt.Errorf("no token returned from server")
 	}
 
-	return loginResult.Token, nil
+	return &tokens, nil
 }
 
 func handleTaskList() {
@@ -479,6 +584,63 @@ func handleTaskInfo(taskID string) {
 	}
 }
 
+// handleTaskValidate 先在本地检查语法和步骤参数，通过后由服务端检查引用的Agent
+func handleTaskValidate(path string, offline bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Printf("Failed to read %s: %v\n", path, err)
+		os.Exit(1)
+	}
+
+	result := taskconfig.Validate(string(data))
+	if len(result.Errors) > 0 {
+		printConfigErrors(path, result.Errors)
+		os.Exit(1)
+	}
+	if offline || config.ServerURL == "" {
+		fmt.Printf("%s: %d step(s), syntax OK (agent references not checked)\n", path, len(result.Config.Steps))
+		return
+	}
+
+	checkConfig()
+	response, err := callRPC("plumber.task.validate", map[string]string{"config": string(data)})
+	if err != nil {
+		fmt.Printf("Failed to validate task: %v\n", err)
+		os.Exit(1)
+	}
+
+	var validation struct {
+		Valid  bool              `json:"valid"`
+		Steps  int               `json:"steps"`
+		Errors taskconfig.Errors `json:"errors"`
+	}
+	if err := json.Unmarshal(response, &validation); err != nil {
+		fmt.Printf("Failed to parse response: %v\n", err)
+		os.Exit(1)
+	}
+	if !validation.Valid {
+		printConfigErrors(path, validation.Errors)
+		os.Exit(1)
+	}
+	fmt.Printf("%s: %d step(s), OK\n", path, validation.Steps)
+}
+
+// printConfigErrors 按 文件:行:列: 信息 的格式输出配置错误
+func printConfigErrors(path string, errors taskconfig.Errors) {
+	for _, e := range errors {
+		message := e.Message
+		if e.Step > 0 {
+			message = fmt.Sprintf("step %d: %s", e.Step, message)
+		}
+		if e.Line > 0 {
+			fmt.Printf("%s:%d:%d: %s\n", path, e.Line, e.Column, message)
+		} else {
+			fmt.Printf("%s: %s\n", path, message)
+		}
+	}
+	fmt.Printf("%d error(s)\n", len(errors))
+}
+
 func handleAgentList() {
 	checkConfig()
 
@@ -513,7 +675,276 @@ func handleAgentList() {
 	w.Flush()
 }
 
+// parseArgs 解析子命令参数，位置参数可以在选项之前或之后，返回第一个位置参数
+func parseArgs(fs *flag.FlagSet, args []string) string {
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		return ""
+	}
+	arg := fs.Arg(0)
+	fs.Parse(fs.Args()[1:])
+	return arg
+}
+
+func handleArtifactUpload(path, name string) {
+	checkConfig()
+
+	f, err := os.Open(path)
+	if err != nil {
+		fmt.Printf("Failed to open file: %v\n", err)
+		os.Exit(1)
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil || !stat.Mode().IsRegular() {
+		fmt.Printf("Not a regular file: %s\n", path)
+		os.Exit(1)
+	}
+	if name == "" {
+		name = filepath.Base(path)
+	}
+
+	query := url.Values{"name": {name}}
+	req, err := newArtifactRequest("POST", "/api/artifacts?"+query.Encode(), f)
+	if err != nil {
+		fmt.Printf("Failed to create request: %v\n", err)
+		os.Exit(1)
+	}
+	req.ContentLength = stat.Size()
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	resp := doArtifactRequest(req)
+	defer resp.Body.Close()
+
+	var artifact struct {
+		ID     string `json:"id"`
+		Name   string `json:"name"`
+		Size   int64  `json:"size"`
+		SHA256 string `json:"sha256"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&artifact); err != nil {
+		fmt.Printf("Failed to parse response: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Uploaded %s\n", artifact.Name)
+	fmt.Printf("  ID:     %s\n", artifact.ID)
+	fmt.Printf("  Size:   %d bytes\n", artifact.Size)
+	fmt.Printf("  SHA256: %s\n", artifact.SHA256)
+}
+
+func handleArtifactDownload(id, output string) {
+	checkConfig()
+
+	query := url.Values{"id": {id}}
+	req, err := newArtifactRequest("GET", "/api/artifacts?"+query.Encode(), nil)
+	if err != nil {
+		fmt.Printf("Failed to create request: %v\n", err)
+		os.Exit(1)
+	}
+
+	resp := doArtifactRequest(req)
+	defer resp.Body.Close()
+
+	if output == "" {
+		_, params, _ := mime.ParseMediaType(resp.Header.Get("Content-Disposition"))
+		output = filepath.Base(params["filename"])
+		if output == "" || output == "." || output == "/" {
+			output = id
+		}
+	}
+
+	// 先写入临时文件，校验摘要后再重命名，避免留下不完整的文件
+	tmp, err := os.CreateTemp(filepath.Dir(output), ".plumber-download-*")
+	if err != nil {
+		fmt.Printf("Failed to create file: %v\n", err)
+		os.Exit(1)
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, hash), resp.Body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fmt.Printf("Download failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	digest := hex.EncodeToString(hash.Sum(nil))
+	if expected := resp.Header.Get("X-Checksum-SHA256"); expected != "" && expected != digest {
+		fmt.Printf("Checksum mismatch: got %s, expected %s\n", digest, expected)
+		os.Exit(1)
+	}
+	if err := os.Rename(tmp.Name(), output); err != nil {
+		fmt.Printf("Failed to save file: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Downloaded %s (%d bytes, sha256 %s)\n", output, n, digest)
+}
+
+func handleArtifactList(executionID, name string) {
+	checkConfig()
+
+	result, err := callRPC("plumber.artifact.list", map[string]interface{}{
+		"execution_id": executionID,
+		"name":         name,
+	})
+	if err != nil {
+		fmt.Printf("Failed to list artifacts: %v\n", err)
+		os.Exit(1)
+	}
+
+	var response struct {
+		Artifacts []struct {
+			ID          string    `json:"id"`
+			Name        string    `json:"name"`
+			Size        int64     `json:"size"`
+			SHA256      string    `json:"sha256"`
+			ExecutionID string    `json:"execution_id"`
+			StepName    string    `json:"step_name"`
+			Username    string    `json:"username"`
+			CreatedAt   time.Time `json:"created_at"`
+		} `json:"artifacts"`
+		Total int64 `json:"total"`
+	}
+
+	if err := json.Unmarshal(result, &response); err != nil {
+		fmt.Printf("Failed to parse response: %v\n", err)
+		os.Exit(1)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tSIZE\tSOURCE\tSHA256\tCREATED")
+	for _, artifact := range response.Artifacts {
+		source := "execution=" + artifact.ExecutionID
+		if artifact.StepName != "" {
+			source += " step=" + artifact.StepName
+		}
+		if artifact.ExecutionID == "" {
+			source = "user=" + artifact.Username
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\n",
+			artifact.ID, artifact.Name, artifact.Size, source, artifact.SHA256[:12],
+			artifact.CreatedAt.Local().Format("2006-01-02 15:04:05"))
+	}
+	w.Flush()
+
+	fmt.Printf("\nShowing %d of %d artifacts\n", len(response.Artifacts), response.Total)
+}
+
+// newArtifactRequest 创建制品上传下载请求
+// 这些接口不是JSON-RPC，令牌过期时无法自动重试，使用密码登录时先续期访问令牌
+func newArtifactRequest(method, path string, body io.Reader) (*http.Request, error) {
+	bearer := config.APIToken
+	if bearer == "" {
+		refreshToken()
+		bearer = config.Token
+	}
+
+	req, err := http.NewRequest(method, strings.TrimSuffix(config.ServerURL, "/")+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+bearer)
+	return req, nil
+}
+
+// doArtifactRequest 发送制品请求，非200响应时退出
+func doArtifactRequest(req *http.Request) *http.Response {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		fmt.Printf("Request failed: %v\n", err)
+		os.Exit(1)
+	}
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		fmt.Printf("Request failed: %s: %s\n", resp.Status, strings.TrimSpace(string(message)))
+		os.Exit(1)
+	}
+	return resp
+}
+
+func handleAudit(params map[string]interface{}) {
+	checkConfig()
+
+	result, err := callRPC("plumber.audit.list", params)
+	if err != nil {
+		fmt.Printf("Failed to list audit logs: %v\n", err)
+		os.Exit(1)
+	}
+
+	var response struct {
+		Entries []struct {
+			CreatedAt   time.Time `json:"created_at"`
+			Username    string    `json:"username"`
+			Via         string    `json:"via"`
+			Method      string    `json:"method"`
+			TaskID      string    `json:"task_id"`
+			AgentID     string    `json:"agent_id"`
+			ExecutionID string    `json:"execution_id"`
+			TargetID    string    `json:"target_id"`
+			Result      string    `json:"result"`
+			Error       string    `json:"error"`
+			ClientIP    string    `json:"client_ip"`
+		} `json:"entries"`
+		Total int64 `json:"total"`
+	}
+
+	if err := json.Unmarshal(result, &response); err != nil {
+		fmt.Printf("Failed to parse response: %v\n", err)
+		os.Exit(1)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tUSER\tMETHOD\tTARGET\tRESULT\tCLIENT IP")
+	for _, entry := range response.Entries {
+		user := entry.Username
+		if user == "" {
+			user = "-"
+		}
+
+		var targets []string
+		if entry.TaskID != "" {
+			targets = append(targets, "task="+entry.TaskID)
+		}
+		if entry.AgentID != "" {
+			targets = append(targets, "agent="+entry.AgentID)
+		}
+		if entry.ExecutionID != "" {
+			targets = append(targets, "execution="+entry.ExecutionID)
+		}
+		if entry.TargetID != "" {
+			targets = append(targets, "id="+entry.TargetID)
+		}
+		target := strings.Join(targets, " ")
+		if target == "" {
+			target = "-"
+		}
+
+		status := entry.Result
+		if entry.Error != "" {
+			status += ": " + entry.Error
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			entry.CreatedAt.Local().Format("2006-01-02 15:04:05"),
+			user, entry.Method, target, status, entry.ClientIP)
+	}
+	w.Flush()
+
+	fmt.Printf("\nShowing %d of %d entries\n", len(response.Entries), response.Total)
+}
+
 func callRPC(method string, params interface{}) (json.RawMessage, error) {
+	return doCallRPC(method, params, false)
+}
+
+func doCallRPC(method string, params interface{}, retried bool) (json.RawMessage, error) {
 	paramsBytes, err := json.Marshal(params)
 	if err != nil {
 		return nil, err
@@ -544,7 +975,11 @@ func callRPC(method string, params interface{}) (json.RawMessage, error) {
 	}
 
 	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Authorization", "Bearer "+config.Token)
+	bearer := config.Token
+	if config.APIToken != "" {
+		bearer = config.APIToken
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+bearer)
 
 	client := &http.Client{Timeout: 30 * time.Second}
 	resp, err := client.Do(httpReq)
@@ -565,12 +1000,12 @@ func callRPC(method string, params interface{}) (json.RawMessage, error) {
 	}
 
 	if rpcResp.Error != nil {
-		// 如果是认证错误，尝试刷新 token 并重试
-		if strings.Contains(rpcResp.Error.Message, "token") || strings.Contains(rpcResp.Error.Message, "expired") {
+		// 使用密码登录时，认证失败则重新登录并重试一次；API令牌无法刷新
+		if rpcResp.Error.Code == jsonrpc.Unauthenticated && config.APIToken == "" && !retried {
 			fmt.Println("Token expired, refreshing...")
 			refreshToken()
 			// 重试请求
-			return callRPC(method, params)
+			return doCallRPC(method, params, true)
 		}
 		return nil, fmt.Errorf("RPC error: %s", rpcResp.Error.Message)
 	}
@@ -619,6 +1054,11 @@ func checkConfig() {
 		os.Exit(1)
 	}
 
+	// 使用个人API令牌时无需登录
+	if config.APIToken != "" {
+		return
+	}
+
 	if config.Username == "" || config.Password == "" {
 		fmt.Println("Error: Username and password not set. Please run 'plumber-cli set-config' first.")
 		os.Exit(1)
@@ -631,14 +1071,27 @@ func checkConfig() {
 }
 
 func refreshToken() {
+	// 优先使用刷新令牌续期，失败（会话过期或被吊销）时再用密码重新登录
+	if config.Refresh != "" {
+		if tokens, err := refreshAccessToken(config.ServerURL, config.Refresh); err == nil {
+			saveTokens(tokens)
+			return
+		}
+	}
+
 	fmt.Printf("Logging in as %s...\n", config.Username)
-	token, err := loginAndGetToken(config.ServerURL, config.Username, config.Password)
+	tokens, err := loginAndGetToken(config.ServerURL, config.Username, config.Password)
 	if err != nil {
 		fmt.Printf("Login failed: %v\n", err)
 		fmt.Println("Please run 'plumber-cli set-config' to update your credentials.")
 		os.Exit(1)
 	}
-	config.Token = token
+	saveTokens(tokens)
+}
+
+func saveTokens(tokens *tokenPair) {
+	config.Token = tokens.Token
+	config.Refresh = tokens.RefreshToken
 
 	// 保存新的 token
 	if err := saveConfig(); err != nil {
@@ -2,17 +2,25 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"github.com/plumber/plumber/internal/server/agentdist"
 	"github.com/plumber/plumber/internal/server/api"
+	"github.com/plumber/plumber/internal/server/artifacts"
 	"github.com/plumber/plumber/internal/server/config"
+	"github.com/plumber/plumber/internal/server/pki"
+	"github.com/plumber/plumber/internal/server/relay"
+	"github.com/plumber/plumber/internal/server/secrets"
+	"github.com/plumber/plumber/internal/server/sshdial"
 	"github.com/plumber/plumber/internal/server/storage"
 	"github.com/plumber/plumber/internal/server/webssh"
 	"github.com/plumber/plumber/pkg/auth"
@@ -36,11 +44,24 @@ func main() {
 	}
 	defer store.Close()
 
+	// 用户表为空时根据配置创建第一个管理员
+	if err := api.EnsureAdminUser(context.Background(), store, cfg.Auth.AdminUsername, cfg.Auth.AdminPassword); err != nil {
+		log.Fatalf("Failed to bootstrap admin user: %v", err)
+	}
+
 	// 初始化JWT管理器
 	jwtManager := auth.NewJWTManager(
 		cfg.Auth.JWTSecret,
-		time.Duration(cfg.Auth.TokenExpiration)*time.Hour,
+		time.Duration(cfg.Auth.AccessTokenMinutes)*time.Minute,
 	)
+	for _, key := range cfg.Auth.JWTKeys {
+		jwtManager.AddKey(key.ID, key.Secret)
+	}
+	if cfg.Auth.JWTKeyID != "" {
+		if err := jwtManager.SetSigningKey(cfg.Auth.JWTKeyID); err != nil {
+			log.Fatalf("Invalid auth config: %v", err)
+		}
+	}
 
 	// 设置服务器地址（用于 agent 配置文件中的 server_addr）
 	exportEndpoint := cfg.Server.ExportEndpoint
@@ -52,28 +73,102 @@ func main() {
 		}
 	}
 
+	// 初始化内置CA（仅启用TLS时）
+	var ca *pki.CA
+	if cfg.TLS.Enabled {
+		ca, err = pki.LoadOrCreateCA(cfg.TLS.CADir, time.Duration(cfg.TLS.CertValidityDays)*24*time.Hour)
+		if err != nil {
+			log.Fatalf("Failed to initialize CA: %v", err)
+		}
+	}
+
+	// 初始化SSH凭据加密主密钥，并加密历史明文凭据/轮换到当前主密钥
+	keyring, err := newKeyring(cfg)
+	if err != nil {
+		log.Fatalf("Invalid encryption config: %v", err)
+	}
+	if _, err := secrets.MigrateCredentials(context.Background(), store, keyring); err != nil {
+		log.Fatalf("Failed to migrate agent credentials: %v", err)
+	}
+
+	// 初始化SSH连接器（WebSSH和部署共用）
+	dialer, err := sshdial.New(store, keyring, sshdial.Options{
+		HostKeyPolicy:  cfg.SSH.HostKeyPolicy,
+		KnownHostsFile: cfg.SSH.KnownHostsFile,
+		Timeout:        time.Duration(cfg.SSH.TimeoutSeconds) * time.Second,
+	})
+	if err != nil {
+		log.Fatalf("Invalid ssh config: %v", err)
+	}
+
+	// Agent终端会话撮合（浏览器与回连的Agent配对）
+	broker := relay.NewBroker()
+
+	// 上次运行时未完成的部署任务已中断
+	if n, err := store.FailInterruptedDeployJobs(context.Background(), "interrupted by server restart"); err != nil {
+		log.Printf("Failed to mark interrupted deploy jobs: %v", err)
+	} else if n > 0 {
+		log.Printf("Marked %d interrupted deploy jobs as failed", n)
+	}
+
+	// 离线部署使用的Agent二进制仓库
+	binaries, err := agentdist.NewStore(cfg.Deploy.BinaryDir)
+	if err != nil {
+		log.Fatalf("Failed to initialize agent binary store: %v", err)
+	}
+	// Agent自更新签名密钥，公钥写入 agent.json
+	signer, err := agentdist.LoadOrCreateSigner(cfg.Deploy.SigningKeyFile)
+	if err != nil {
+		log.Fatalf("Failed to load agent update signing key: %v", err)
+	}
+
+	// 任务制品仓库（upload/download步骤）
+	artifactStore, err := artifacts.NewStore(cfg.Artifacts.Dir)
+	if err != nil {
+		log.Fatalf("Failed to initialize artifact store: %v", err)
+	}
+
 	// 初始化JSON-RPC路由器
 	router := jsonrpc.NewRouter()
-	api.RegisterAllMethods(router, store, jwtManager, cfg.Auth.AdminUsername, cfg.Auth.AdminPassword, cfg.Auth.AgentToken, exportEndpoint)
+	api.RegisterAllMethods(router, store, jwtManager, time.Duration(cfg.Auth.TokenExpiration)*time.Hour, exportEndpoint, ca, keyring, dialer, broker, artifactStore, api.DeployOptions{
+		Binaries:       binaries,
+		Signer:         signer,
+		VerifyTimeout:  time.Duration(cfg.Deploy.VerifyTimeoutSeconds) * time.Second,
+		MaxParallelism: cfg.Deploy.MaxParallelism,
+	})
 
 	// 创建HTTP处理器
-	apiHandler := api.NewHandler(router, store, jwtManager, cfg.Auth.AgentToken)
+	apiHandler := api.NewHandler(router, store, jwtManager, cfg.TLS.Enabled && cfg.TLS.RequireAgentCert)
 
 	// 创建 RESTful API 处理器
-	restHandler := api.NewRestHandler(store, cfg.Auth.AgentToken, exportEndpoint)
+	restHandler := api.NewRestHandler(store, ca)
 
 	// 创建 WebSSH 处理器
-	encryptionKey := []byte{}
-	if cfg.Auth.EncryptionKey != "" {
-		encryptionKey = []byte(cfg.Auth.EncryptionKey)
-	}
-	websshHandler := webssh.NewWebSSHHandler(store, encryptionKey)
+	websshHandler := webssh.NewWebSSHHandler(store, dialer, broker, apiHandler, webssh.Options{
+		AllowedOrigins: cfg.WebSSH.AllowedOrigins,
+		IdleTimeout:    time.Duration(cfg.WebSSH.IdleTimeoutMinutes) * time.Minute,
+		MaxDuration:    time.Duration(cfg.WebSSH.MaxSessionMinutes) * time.Minute,
+		RecordingDir:   cfg.WebSSH.RecordingDir,
+		MaxUpload:      int64(cfg.WebSSH.MaxUploadMB) << 20,
+		MaxDownload:    int64(cfg.WebSSH.MaxDownloadMB) << 20,
+	})
+
+	// 创建制品上传下载处理器
+	artifactHandler := api.NewArtifactHandler(apiHandler, store, artifactStore, int64(cfg.Artifacts.MaxUploadMB)<<20)
 
 	// 创建路由
 	mux := http.NewServeMux()
 	mux.Handle("/api/rpc", apiHandler)
 	mux.Handle("/api/webssh", websshHandler)
-	mux.HandleFunc("/api/agent/config/", restHandler.GetAgentConfig)
+	mux.HandleFunc("/api/webssh/recording", websshHandler.ServeRecording)
+	mux.HandleFunc("/api/webssh/sftp", websshHandler.ServeSFTP)
+	mux.HandleFunc("/api/agent/terminal", websshHandler.ServeAgentTerminal)
+	mux.Handle("/api/agent/binaries", api.NewAgentBinaryHandler(apiHandler, binaries, int64(cfg.Deploy.MaxBinaryMB)<<20))
+	mux.Handle("/api/agent/update", api.NewAgentUpdateHandler(apiHandler, binaries))
+	mux.Handle("/api/artifacts", artifactHandler)
+	mux.HandleFunc("/api/agent/artifacts", artifactHandler.ServeAgent)
+	mux.HandleFunc("/api/pki/ca.crt", restHandler.GetCACert)
+	mux.HandleFunc("/api/pki/crl", restHandler.GetCRL)
 
 	// 健康检查端点
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
@@ -92,16 +187,43 @@ func main() {
 	}
 
 	// 启动服务器
-	go func() {
-		log.Printf("Plumber Server starting on %s", addr)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Server error: %v", err)
+	if cfg.TLS.Enabled {
+		certFile, keyFile, err := resolveServerCert(cfg, ca)
+		if err != nil {
+			log.Fatalf("Failed to prepare server certificate: %v", err)
+		}
+
+		// 客户端证书可选：浏览器和CLI不携带证书，Agent接口是否强制由Handler决定
+		srv.TLSConfig = &tls.Config{
+			MinVersion: tls.VersionTLS12,
+			ClientAuth: tls.VerifyClientCertIfGiven,
+			ClientCAs:  ca.Pool(),
 		}
-	}()
+
+		go func() {
+			log.Printf("Plumber Server starting on %s (TLS)", addr)
+			if err := srv.ListenAndServeTLS(certFile, keyFile); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Server error: %v", err)
+			}
+		}()
+	} else {
+		go func() {
+			log.Printf("Plumber Server starting on %s", addr)
+			if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Server error: %v", err)
+			}
+		}()
+	}
 
 	// 启动Agent心跳检查
 	go startHeartbeatChecker(store)
 
+	// 清理过期的终端录像
+	go websshHandler.StartRecordingRetention(time.Duration(cfg.WebSSH.RecordingRetention) * 24 * time.Hour)
+
+	// 清理过期的任务制品
+	go artifactHandler.StartRetention(time.Duration(cfg.Artifacts.RetentionDays) * 24 * time.Hour)
+
 	// 等待中断信号
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -119,6 +241,39 @@ func main() {
 	log.Println("Server exited")
 }
 
+// newKeyring 根据配置创建加密主密钥集合，encryption_key作为default密钥
+func newKeyring(cfg *config.Config) (*secrets.Keyring, error) {
+	keys := make(map[string][]byte)
+	if cfg.Auth.EncryptionKey != "" {
+		keys[secrets.DefaultKeyID] = []byte(cfg.Auth.EncryptionKey)
+	}
+	for _, key := range cfg.Auth.EncryptionKeys {
+		keys[key.ID] = []byte(key.Key)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("auth.encryption_key is required")
+	}
+	return secrets.NewKeyring(cfg.Auth.EncryptionKeyID, keys)
+}
+
+// resolveServerCert 获取服务端证书路径，未配置时由内置CA签发
+func resolveServerCert(cfg *config.Config, ca *pki.CA) (string, string, error) {
+	if cfg.TLS.CertFile != "" && cfg.TLS.KeyFile != "" {
+		return cfg.TLS.CertFile, cfg.TLS.KeyFile, nil
+	}
+
+	hosts := cfg.TLS.Hosts
+	if len(hosts) == 0 {
+		hosts = []string{"localhost", "127.0.0.1"}
+	}
+	if u, err := url.Parse(cfg.Server.ExportEndpoint); err == nil && u.Hostname() != "" {
+		hosts = append(hosts, u.Hostname())
+	}
+
+	log.Printf("Using server certificate issued by built-in CA for %v", hosts)
+	return ca.EnsureServerCert(cfg.TLS.CADir, hosts)
+}
+
 // startHeartbeatChecker 启动心跳检查器
 func startHeartbeatChecker(store storage.Storage) {
 	ticker := time.NewTicker(30 * time.Second)
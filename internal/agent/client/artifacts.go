@@ -0,0 +1,252 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/plumber/plumber/internal/agent/executor"
+	"github.com/plumber/plumber/pkg/models"
+)
+
+// stepTimeout 单个步骤的执行超时时间，不含执行前后的制品传输；服务端据此和传输时限计算等待步骤完成的时间
+const stepTimeout = models.MaxStepTimeout
+
+// registerPlugins 注册需要访问服务端的步骤类型
+func (c *Client) registerPlugins(exec *executor.Executor) {
+	exec.Register("upload", executor.PluginFunc(c.receiveArtifact))
+	exec.Register("download", executor.PluginFunc(c.sendArtifact))
+}
+
+// runTask 下载步骤引用的制品，按步骤类型执行，成功后收集制品。
+// 执行前后的制品传输共用 models.MaxStepTransferTime 的时限，不占用步骤的执行时间
+func (c *Client) runTask(exec *executor.Executor, info *TaskInfo) *executor.ExecuteResult {
+	step := &executor.Step{
+		ID:      info.StepID,
+		Type:    info.Type,
+		WorkDir: exec.WorkDir(info.Path),
+		Command: info.Command,
+		Spec:    info.Spec,
+	}
+
+	transferCtx, cancel := context.WithTimeout(context.Background(), models.MaxStepTransferTime)
+	defer cancel()
+
+	var prepared string
+	if len(step.Spec.Use) > 0 {
+		output, err := c.fetchUsedArtifacts(transferCtx, step)
+		if err != nil {
+			return &executor.ExecuteResult{ExitCode: 1, Output: output + err.Error(), Error: err}
+		}
+		prepared = output
+	}
+
+	result := exec.RunWithTimeout(step, stepTimeout)
+	result.Output = prepared + result.Output
+
+	if result.ExitCode == 0 && len(step.Spec.Collect) > 0 {
+		output, err := c.collectArtifacts(transferCtx, step)
+		result.Output += output
+		if err != nil {
+			result.ExitCode = 1
+			result.Error = err
+			result.Output += err.Error()
+		}
+	}
+	return result
+}
+
+// transferResult 将文件传输的结果转换为执行结果
+func transferResult(output string, err error) *executor.ExecuteResult {
+	if err != nil {
+		return executor.Failed(err)
+	}
+	return executor.Succeeded(output)
+}
+
+// receiveArtifact 执行upload步骤，将制品写入Dest
+func (c *Client) receiveArtifact(ctx context.Context, step *executor.Step) *executor.ExecuteResult {
+	spec := step.Spec
+	mode, err := executor.ParseFileMode(spec.Mode)
+	if err != nil {
+		return executor.Failed(err)
+	}
+	return transferResult(c.fetchArtifact(ctx, step.ID, spec.ArtifactID, spec.Size, spec.SHA256, executor.ResolvePath(step.WorkDir, spec.Dest), mode, spec.Owner))
+}
+
+// sendArtifact 执行download步骤，服务端使用步骤中配置的制品名称
+func (c *Client) sendArtifact(ctx context.Context, step *executor.Step) *executor.ExecuteResult {
+	return transferResult(c.uploadArtifact(ctx, step.ID, executor.ResolvePath(step.WorkDir, step.Spec.Src), ""))
+}
+
+// fetchUsedArtifacts 将use_artifacts引用的制品下载到工作目录，文件名为制品名称
+func (c *Client) fetchUsedArtifacts(ctx context.Context, step *executor.Step) (string, error) {
+	var output strings.Builder
+	seen := make(map[string]bool)
+	for _, artifact := range step.Spec.Use {
+		if seen[artifact.Name] {
+			return output.String(), fmt.Errorf("multiple artifacts named %s", artifact.Name)
+		}
+		seen[artifact.Name] = true
+
+		line, err := c.fetchArtifact(ctx, step.ID, artifact.ID, artifact.Size, artifact.SHA256, filepath.Join(step.WorkDir, artifact.Name), 0644, "")
+		if err != nil {
+			return output.String(), fmt.Errorf("failed to fetch artifact %s: %w", artifact.Name, err)
+		}
+		output.WriteString(line)
+	}
+	return output.String(), nil
+}
+
+// collectArtifacts 上传工作目录中匹配artifacts的文件，制品名称为文件名
+func (c *Client) collectArtifacts(ctx context.Context, step *executor.Step) (string, error) {
+	var files []string
+	seen := make(map[string]string)
+	for _, pattern := range step.Spec.Collect {
+		matches, err := filepath.Glob(executor.ResolvePath(step.WorkDir, pattern))
+		if err != nil {
+			return "", fmt.Errorf("invalid artifacts pattern %q: %w", pattern, err)
+		}
+		for _, match := range matches {
+			if stat, err := os.Stat(match); err != nil || !stat.Mode().IsRegular() {
+				continue
+			}
+			name := filepath.Base(match)
+			if other, ok := seen[name]; ok {
+				if other == match {
+					continue
+				}
+				return "", fmt.Errorf("artifacts %s and %s have the same file name", other, match)
+			}
+			seen[name] = match
+			files = append(files, match)
+		}
+	}
+	if len(files) == 0 {
+		return "", fmt.Errorf("no files matched artifacts %v", step.Spec.Collect)
+	}
+
+	var output strings.Builder
+	for _, file := range files {
+		line, err := c.uploadArtifact(ctx, step.ID, file, filepath.Base(file))
+		if err != nil {
+			return output.String(), fmt.Errorf("failed to collect %s: %w", file, err)
+		}
+		output.WriteString(line)
+	}
+	return output.String(), nil
+}
+
+// fetchArtifact 下载制品，校验大小和摘要并设置权限后原子替换目标文件
+func (c *Client) fetchArtifact(ctx context.Context, stepID, artifactID string, size int64, sha string, dest string, mode os.FileMode, owner string) (string, error) {
+	query := url.Values{"step_id": {stepID}, "artifact_id": {artifactID}}
+	resp, err := c.artifactRequest(ctx, http.MethodGet, query, nil, 0)
+	if err != nil {
+		return "", fmt.Errorf("failed to download artifact: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var n int64
+	var digest string
+	err = executor.WriteFile(dest, mode, owner, func(f *os.File) error {
+		hash := sha256.New()
+		var err error
+		n, err = io.Copy(io.MultiWriter(f, hash), io.LimitReader(resp.Body, size+1))
+		if err != nil {
+			return fmt.Errorf("failed to download artifact: %w", err)
+		}
+		if n != size {
+			return fmt.Errorf("size mismatch: got %d bytes, expected %d", n, size)
+		}
+		digest = hex.EncodeToString(hash.Sum(nil))
+		if digest != sha {
+			return fmt.Errorf("checksum mismatch: got %s, expected %s", digest, sha)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("wrote %s (%d bytes, mode %#o, sha256 %s)\n", dest, n, mode, digest), nil
+}
+
+// uploadArtifact 上传本机文件，服务端保存为关联到本次执行的制品；name为空时使用download步骤配置的名称
+func (c *Client) uploadArtifact(ctx context.Context, stepID, src, name string) (string, error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	if !stat.Mode().IsRegular() {
+		return "", fmt.Errorf("%s is not a regular file", src)
+	}
+
+	query := url.Values{"step_id": {stepID}}
+	if name != "" {
+		query.Set("name", name)
+	}
+	hash := sha256.New()
+	resp, err := c.artifactRequest(ctx, http.MethodPost, query, io.TeeReader(f, hash), stat.Size())
+	if err != nil {
+		return "", fmt.Errorf("failed to upload artifact: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var artifact struct {
+		ID     string `json:"id"`
+		Name   string `json:"name"`
+		Size   int64  `json:"size"`
+		SHA256 string `json:"sha256"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&artifact); err != nil {
+		return "", fmt.Errorf("invalid server response: %w", err)
+	}
+	if digest := hex.EncodeToString(hash.Sum(nil)); digest != artifact.SHA256 {
+		return "", fmt.Errorf("checksum mismatch: sent %s, server stored %s", digest, artifact.SHA256)
+	}
+
+	return fmt.Sprintf("collected %s as artifact %s (id %s, %d bytes, sha256 %s)\n",
+		src, artifact.Name, artifact.ID, artifact.Size, artifact.SHA256), nil
+}
+
+// artifactRequest 请求服务端制品接口，传输时间受ctx限制，非200响应作为错误返回
+func (c *Client) artifactRequest(ctx context.Context, method string, query url.Values, body io.Reader, size int64) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.serverURL+"/api/agent/artifacts?"+query.Encode(), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+	req.Header.Set("X-Agent-ID", c.agentID.String())
+	req.Header.Set("X-Agent-Token", c.agentToken)
+
+	// 传输大文件时不受客户端默认超时限制
+	httpClient := *c.httpClient
+	httpClient.Timeout = 0
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	return resp, nil
+}
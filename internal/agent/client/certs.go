@@ -0,0 +1,170 @@
+package client
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// CertManager 管理Agent的mTLS客户端证书
+// 私钥只在本地生成和保存，证书到期前通过 plumber.agent.enrollCert 自动续期
+type CertManager struct {
+	certFile string
+	keyFile  string
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+// NewCertManager 创建证书管理器
+func NewCertManager(certFile, keyFile string) *CertManager {
+	return &CertManager{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+}
+
+// Load 从磁盘加载证书，文件不存在时不报错（等待首次申请）
+func (m *CertManager) Load() error {
+	if _, err := os.Stat(m.certFile); os.IsNotExist(err) {
+		return nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(m.certFile, m.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load client certificate: %w", err)
+	}
+
+	m.mu.Lock()
+	m.cert = &cert
+	m.mu.Unlock()
+	return nil
+}
+
+// GetClientCertificate 供 tls.Config 使用，证书缺失或已过期时不出示证书，以便回退到令牌认证
+func (m *CertManager) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.cert == nil || m.cert.Leaf == nil || time.Now().After(m.cert.Leaf.NotAfter) {
+		return &tls.Certificate{}, nil
+	}
+	return m.cert, nil
+}
+
+// NeedsRenewal 证书不存在或剩余有效期不足三分之一时需要续期
+func (m *CertManager) NeedsRenewal() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.cert == nil || m.cert.Leaf == nil {
+		return true
+	}
+
+	leaf := m.cert.Leaf
+	lifetime := leaf.NotAfter.Sub(leaf.NotBefore)
+	return time.Until(leaf.NotAfter) < lifetime/3
+}
+
+// Enroll 生成新私钥和CSR，向服务端申请证书并保存
+func (c *Client) Enroll(m *CertManager) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	csrDER, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: c.agentID.String()},
+	}, key)
+	if err != nil {
+		return fmt.Errorf("failed to create CSR: %w", err)
+	}
+
+	params := map[string]string{
+		"csr": string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrDER})),
+	}
+
+	result, err := c.callRPC("plumber.agent.enrollCert", params)
+	if err != nil {
+		return err
+	}
+
+	var response struct {
+		Certificate string `json:"certificate"`
+	}
+	if err := json.Unmarshal(result, &response); err != nil {
+		return err
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("failed to marshal key: %w", err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+
+	cert, err := tls.X509KeyPair([]byte(response.Certificate), keyPEM)
+	if err != nil {
+		return fmt.Errorf("invalid certificate from server: %w", err)
+	}
+
+	// 先写私钥再写证书，均通过临时文件原子替换
+	if err := writeFileAtomic(m.keyFile, keyPEM, 0600); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(m.certFile, []byte(response.Certificate), 0644); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	m.cert = &cert
+	m.mu.Unlock()
+
+	// 已建立的连接握手时未携带新证书，关闭后重新握手
+	c.httpClient.CloseIdleConnections()
+
+	log.Printf("[TLS] Client certificate issued, expires at %s",
+		cert.Leaf.NotAfter.Format("2006-01-02 15:04:05"))
+	return nil
+}
+
+// StartCertRenewal 定期检查证书有效期并自动续期
+func (c *Client) StartCertRenewal(ctx context.Context, m *CertManager, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !m.NeedsRenewal() {
+				continue
+			}
+			if err := c.Enroll(m); err != nil {
+				log.Printf("[TLS] Certificate renewal failed: %v", err)
+			}
+		}
+	}
+}
+
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, perm); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	return nil
+}
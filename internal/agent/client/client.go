@@ -3,57 +3,139 @@ package client
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
+	"runtime"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/plumber/plumber/internal/agent/executor"
+	"github.com/plumber/plumber/internal/agent/update"
+	"github.com/plumber/plumber/pkg/agentupdate"
 	"github.com/plumber/plumber/pkg/jsonrpc"
 )
 
 // Client Agent客户端
 type Client struct {
-	serverURL  string
-	agentID    uuid.UUID
-	agentToken string
-	httpClient *http.Client
+	serverURL       string
+	agentID         uuid.UUID
+	agentToken      string
+	httpClient      *http.Client
+	tlsConfig       *tls.Config
+	terminalEnabled bool
+	terminals       sync.Map // 正在处理的终端会话ID，避免重复连回
+
+	updater       *update.Updater
+	updateMu      sync.Mutex
+	updating      bool      // 正在自更新
+	failedVersion string    // 最近一次自更新失败的版本
+	failedAt      time.Time // 最近一次自更新失败的时间
+
+	taskMu   sync.Mutex
+	draining bool           // 自更新等待重启，不再领取新任务
+	tasks    sync.WaitGroup // 执行中的任务
 }
 
 // NewClient 创建新的Agent客户端
-func NewClient(serverURL string, agentID uuid.UUID, agentToken string) *Client {
+// tlsConfig 为nil时使用默认传输配置
+func NewClient(serverURL string, agentID uuid.UUID, agentToken string, tlsConfig *tls.Config) *Client {
+	httpClient := &http.Client{
+		Timeout: 30 * time.Second,
+	}
+	if tlsConfig != nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsConfig
+		httpClient.Transport = transport
+	}
+
 	return &Client{
-		serverURL:  serverURL,
-		agentID:    agentID,
-		agentToken: agentToken,
-		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
-		},
+		serverURL:       serverURL,
+		agentID:         agentID,
+		agentToken:      agentToken,
+		httpClient:      httpClient,
+		tlsConfig:       tlsConfig,
+		terminalEnabled: true,
 	}
 }
 
-// Register 注册Agent
-func (c *Client) Register(hostname, ip string) error {
+// Register 注册Agent，同时上报版本和平台，服务端据此判断是否需要升级
+func (c *Client) Register(hostname, ip, version string) error {
 	params := map[string]string{
 		"agent_id": c.agentID.String(),
 		"hostname": hostname,
 		"ip":       ip,
+		"version":  version,
+		"os":       runtime.GOOS,
+		"arch":     runtime.GOARCH,
 	}
 
 	_, err := c.callRPC("plumber.agent.register", params)
 	return err
 }
 
+// Join 使用加入令牌向服务端自助注册，返回服务端生成的 agent.json 内容
+func Join(serverURL string, tlsConfig *tls.Config, joinToken, name, hostname, ip string) ([]byte, error) {
+	c := NewClient(serverURL, uuid.Nil, "", tlsConfig)
+
+	params := map[string]string{
+		"join_token": joinToken,
+		"name":       name,
+		"hostname":   hostname,
+		"ip":         ip,
+	}
+
+	result, err := c.callRPC("plumber.agent.join", params)
+	if err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		AgentID string `json:"agent_id"`
+		Config  string `json:"config"`
+	}
+	if err := json.Unmarshal(result, &response); err != nil {
+		return nil, err
+	}
+
+	if response.Config == "" {
+		return nil, fmt.Errorf("server returned empty config")
+	}
+
+	return []byte(response.Config), nil
+}
+
 // Heartbeat 发送心跳
 func (c *Client) Heartbeat() error {
 	params := map[string]string{
 		"agent_id": c.agentID.String(),
 	}
 
-	_, err := c.callRPC("plumber.agent.heartbeat", params)
-	return err
+	result, err := c.callRPC("plumber.agent.heartbeat", params)
+	if err != nil {
+		return err
+	}
+
+	// 心跳响应中携带等待本Agent连回的终端请求和自更新信息
+	var response struct {
+		Terminals []TerminalRequest  `json:"terminals"`
+		Update    *agentupdate.Offer `json:"update"`
+	}
+	if err := json.Unmarshal(result, &response); err != nil {
+		return err
+	}
+	for _, req := range response.Terminals {
+		if _, loaded := c.terminals.LoadOrStore(req.SessionID, true); !loaded {
+			go c.serveTerminal(req)
+		}
+	}
+	if response.Update != nil {
+		c.handleUpdateOffer(response.Update)
+	}
+	return nil
 }
 
 // ReportStepResult 上报步骤执行结果
@@ -69,6 +151,16 @@ func (c *Client) ReportStepResult(stepID uuid.UUID, status string, exitCode int,
 	return err
 }
 
+// RPCError 服务端处理请求后返回的错误（如认证失败），区别于连接失败等网络错误
+type RPCError struct {
+	Code    int
+	Message string
+}
+
+func (e *RPCError) Error() string {
+	return "RPC error: " + e.Message
+}
+
 // callRPC 调用JSON-RPC方法
 func (c *Client) callRPC(method string, params interface{}) (json.RawMessage, error) {
 	paramsBytes, err := json.Marshal(params)
@@ -93,7 +185,10 @@ func (c *Client) callRPC(method string, params interface{}) (json.RawMessage, er
 		return nil, err
 	}
 	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("X-Agent-Token", c.agentToken)
+	if c.agentID != uuid.Nil {
+		httpReq.Header.Set("X-Agent-ID", c.agentID.String())
+		httpReq.Header.Set("X-Agent-Token", c.agentToken)
+	}
 
 	resp, err := c.httpClient.Do(httpReq)
 	if err != nil {
@@ -107,7 +202,7 @@ func (c *Client) callRPC(method string, params interface{}) (json.RawMessage, er
 	}
 
 	if rpcResp.Error != nil {
-		return nil, fmt.Errorf("RPC error: %s", rpcResp.Error.Message)
+		return nil, &RPCError{Code: rpcResp.Error.Code, Message: rpcResp.Error.Message}
 	}
 
 	result, err := json.Marshal(rpcResp.Result)
@@ -149,9 +244,11 @@ func (c *Client) PollTask() (bool, *TaskInfo, error) {
 	var response struct {
 		HasTask bool `json:"has_task"`
 		Task    *struct {
-			StepID  string `json:"step_id"`
-			Path    string `json:"path"`
-			Command string `json:"command"`
+			StepID  string        `json:"step_id"`
+			Type    string        `json:"type"`
+			Path    string        `json:"path"`
+			Command string        `json:"command"`
+			Spec    executor.Spec `json:"spec"`
 		} `json:"task,omitempty"`
 	}
 
@@ -165,8 +262,10 @@ func (c *Client) PollTask() (bool, *TaskInfo, error) {
 
 	taskInfo := &TaskInfo{
 		StepID:  response.Task.StepID,
+		Type:    response.Task.Type,
 		Path:    response.Task.Path,
 		Command: response.Task.Command,
+		Spec:    response.Task.Spec,
 	}
 
 	return true, taskInfo, nil
@@ -175,12 +274,16 @@ func (c *Client) PollTask() (bool, *TaskInfo, error) {
 // TaskInfo 任务信息
 type TaskInfo struct {
 	StepID  string
+	Type    string // 步骤类型，旧版服务端为空，按shell执行
 	Path    string
 	Command string
+	Spec    executor.Spec
 }
 
 // StartTaskPolling 启动任务轮询
 func (c *Client) StartTaskPolling(ctx context.Context, exec *executor.Executor, interval time.Duration) {
+	c.registerPlugins(exec)
+
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
@@ -189,7 +292,17 @@ func (c *Client) StartTaskPolling(ctx context.Context, exec *executor.Executor,
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
+			c.taskMu.Lock()
+			if c.draining {
+				c.taskMu.Unlock()
+				continue
+			}
 			hasTask, taskInfo, err := c.PollTask()
+			if hasTask {
+				c.tasks.Add(1)
+			}
+			c.taskMu.Unlock()
+
 			if err != nil {
 				fmt.Printf("Failed to poll task: %v\n", err)
 				continue
@@ -204,11 +317,12 @@ func (c *Client) StartTaskPolling(ctx context.Context, exec *executor.Executor,
 				taskInfo.StepID, taskInfo.Path, taskInfo.Command)
 
 			go func(info *TaskInfo) {
+				defer c.tasks.Done()
 				startTime := time.Now()
 				log.Printf("[Task] Starting execution - StepID: %s, Time: %s",
 					info.StepID, startTime.Format("2006-01-02 15:04:05"))
 
-				result := exec.ExecuteWithTimeout(info.Path, info.Command, 10*time.Minute)
+				result := c.runTask(exec, info)
 
 				endTime := time.Now()
 				duration := endTime.Sub(startTime)
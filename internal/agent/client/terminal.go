@@ -0,0 +1,57 @@
+package client
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/plumber/plumber/internal/agent/terminal"
+)
+
+// TerminalRequest 服务端下发的终端请求
+type TerminalRequest struct {
+	SessionID string `json:"session_id"`
+	Rows      int    `json:"rows"`
+	Cols      int    `json:"cols"`
+}
+
+// SetTerminalEnabled 设置是否允许通过服务端打开本机终端
+func (c *Client) SetTerminalEnabled(enabled bool) {
+	c.terminalEnabled = enabled
+}
+
+// serveTerminal 连回服务端并在本机PTY中提供终端，直到会话结束
+func (c *Client) serveTerminal(req TerminalRequest) {
+	defer c.terminals.Delete(req.SessionID)
+
+	wsURL := strings.Replace(c.serverURL, "http", "ws", 1) + "/api/agent/terminal?session_id=" + url.QueryEscape(req.SessionID)
+	header := http.Header{}
+	header.Set("X-Agent-ID", c.agentID.String())
+	header.Set("X-Agent-Token", c.agentToken)
+
+	dialer := websocket.Dialer{
+		TLSClientConfig:  c.tlsConfig,
+		HandshakeTimeout: 10 * time.Second,
+		Proxy:            http.ProxyFromEnvironment,
+	}
+	ws, _, err := dialer.Dial(wsURL, header)
+	if err != nil {
+		log.Printf("[Terminal] Failed to connect terminal session %s: %v", req.SessionID, err)
+		return
+	}
+
+	if !c.terminalEnabled {
+		terminal.SendError(ws, "terminal is disabled on this agent")
+		return
+	}
+
+	log.Printf("[Terminal] Session %s started", req.SessionID)
+	if err := terminal.Run(ws, req.Rows, req.Cols); err != nil {
+		log.Printf("[Terminal] Session %s failed: %v", req.SessionID, err)
+		return
+	}
+	log.Printf("[Terminal] Session %s closed", req.SessionID)
+}
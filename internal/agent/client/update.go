@@ -0,0 +1,111 @@
+package client
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/plumber/plumber/internal/agent/update"
+	"github.com/plumber/plumber/pkg/agentupdate"
+)
+
+// updateRetryInterval 自更新失败后再次尝试同一版本的间隔
+const updateRetryInterval = 10 * time.Minute
+
+// updateDownloadTimeout 下载新版本二进制的超时时间
+const updateDownloadTimeout = 10 * time.Minute
+
+// SetUpdater 启用自更新，未设置时忽略服务端下发的更新
+func (c *Client) SetUpdater(u *update.Updater) {
+	c.updater = u
+}
+
+// ReportUpdate 上报自更新结果
+func (c *Client) ReportUpdate(fromVersion, version, status, message string) error {
+	params := map[string]string{
+		"from_version": fromVersion,
+		"version":      version,
+		"status":       status,
+		"message":      message,
+	}
+
+	_, err := c.callRPC("plumber.agent.reportUpdate", params)
+	return err
+}
+
+// handleUpdateOffer 处理心跳响应中的自更新信息，同一时间只进行一次更新
+func (c *Client) handleUpdateOffer(offer *agentupdate.Offer) {
+	if c.updater == nil || offer.Version == c.updater.Version() {
+		return
+	}
+
+	c.updateMu.Lock()
+	defer c.updateMu.Unlock()
+	if c.updating {
+		return
+	}
+	if offer.Version == c.failedVersion && time.Since(c.failedAt) < updateRetryInterval {
+		return
+	}
+	c.updating = true
+	go c.selfUpdate(offer)
+}
+
+// selfUpdate 下载并安装新版本，等待正在执行的任务结束后重启为新版本
+func (c *Client) selfUpdate(offer *agentupdate.Offer) {
+	fromVersion := c.updater.Version()
+	log.Printf("[Update] Updating from %s to %s", fromVersion, offer.Version)
+
+	if err := c.installUpdate(offer); err != nil {
+		log.Printf("[Update] Update to %s failed: %v", offer.Version, err)
+		if reportErr := c.ReportUpdate(fromVersion, offer.Version, agentupdate.StatusFailed, err.Error()); reportErr != nil {
+			log.Printf("[Update] Failed to report update result: %v", reportErr)
+		}
+
+		c.updateMu.Lock()
+		c.updating = false
+		c.failedVersion = offer.Version
+		c.failedAt = time.Now()
+		c.updateMu.Unlock()
+	}
+}
+
+// installUpdate 替换二进制并重启，重启成功时不返回
+func (c *Client) installUpdate(offer *agentupdate.Offer) error {
+	req, err := http.NewRequest("GET", c.serverURL+offer.URL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Agent-ID", c.agentID.String())
+	req.Header.Set("X-Agent-Token", c.agentToken)
+
+	httpClient := *c.httpClient
+	httpClient.Timeout = updateDownloadTimeout
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to download binary: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to download binary: %s", resp.Status)
+	}
+
+	if err := c.updater.Apply(offer, resp.Body); err != nil {
+		return err
+	}
+
+	// 不再领取新任务，等待执行中的任务上报结果后再重启
+	c.taskMu.Lock()
+	c.draining = true
+	c.taskMu.Unlock()
+	c.tasks.Wait()
+
+	log.Printf("[Update] Binary replaced, restarting as %s", offer.Version)
+	err = c.updater.Restart()
+
+	c.taskMu.Lock()
+	c.draining = false
+	c.taskMu.Unlock()
+	return err
+}
@@ -0,0 +1,128 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// probeTimeout 单次探测的超时时间
+const probeTimeout = 10 * time.Second
+
+// runCheck check步骤，每隔Interval探测一次，连续Successes次成功后结束，超过Timeout时失败。
+// 每次探测的结果都写入步骤输出
+func (e *Executor) runCheck(ctx context.Context, step *Step) *ExecuteResult {
+	spec := step.Spec
+	switch spec.Probe {
+	case "http", "tcp", "cmd", "file":
+	default:
+		return Failed(fmt.Errorf("unsupported probe %q", spec.Probe))
+	}
+	interval, timeout := defaultWaitInterval, defaultWaitTimeout
+	for _, field := range []struct {
+		key   string
+		value string
+		d     *time.Duration
+	}{
+		{"interval", spec.Interval, &interval},
+		{"timeout", spec.Timeout, &timeout},
+	} {
+		if field.value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(field.value)
+		if err != nil || d <= 0 {
+			return Failed(fmt.Errorf("invalid %s %q", field.key, field.value))
+		}
+		*field.d = d
+	}
+	required := spec.Successes
+	if required <= 0 {
+		required = 1
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var output strings.Builder
+	fmt.Fprintf(&output, "checking %s every %s, %d consecutive success(es) required, timeout %s\n",
+		spec.Probe, interval, required, timeout)
+
+	successes := 0
+	for attempt := 1; ; attempt++ {
+		probeCtx, probeCancel := context.WithTimeout(ctx, probeTimeout)
+		detail, err := e.probe(probeCtx, step)
+		probeCancel()
+
+		status := "ok"
+		if err != nil {
+			successes = 0
+			status = "failed: " + err.Error()
+		} else {
+			successes++
+		}
+		if detail != "" {
+			status += " (" + detail + ")"
+		}
+		fmt.Fprintf(&output, "%s #%d %s [%d/%d]\n",
+			time.Now().Format("2006-01-02 15:04:05"), attempt, status, successes, required)
+
+		if successes >= required {
+			return Succeeded(output.String())
+		}
+		if err := sleep(ctx, interval); err != nil {
+			result := Failed(fmt.Errorf("check did not pass within %s", timeout))
+			result.Output = output.String() + result.Output
+			return result
+		}
+	}
+}
+
+// probe 执行一次探测，返回探测详情和失败原因
+func (e *Executor) probe(ctx context.Context, step *Step) (string, error) {
+	spec := step.Spec
+	switch spec.Probe {
+	case "http":
+		resp, data, err := httpRequest(ctx, spec)
+		if err != nil {
+			return "", err
+		}
+		return resp.Status, checkHTTPResponse(spec, resp.StatusCode, data)
+
+	case "tcp":
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", spec.Address)
+		if err != nil {
+			return "", err
+		}
+		conn.Close()
+		return spec.Address + " is open", nil
+
+	case "cmd":
+		result := e.Execute(ctx, step.WorkDir, spec.Run)
+		detail := fmt.Sprintf("exit code %d", result.ExitCode)
+		if out := strings.TrimSpace(result.Output); out != "" {
+			if len(out) > 200 {
+				out = out[:200] + "..."
+			}
+			detail += ": " + out
+		}
+		if result.ExitCode != 0 {
+			return detail, fmt.Errorf("command failed")
+		}
+		return detail, nil
+
+	case "file":
+		path := ResolvePath(step.WorkDir, spec.File)
+		if _, err := os.Stat(path); err != nil {
+			return "", err
+		}
+		return path + " exists", nil
+
+	default:
+		return "", fmt.Errorf("unsupported probe %q", spec.Probe)
+	}
+}
@@ -0,0 +1,171 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// containerWorkDir 步骤工作目录在容器中的挂载点
+const containerWorkDir = "/workspace"
+
+// containerCleanupTimeout 步骤结束（含取消和超时）后删除容器的超时时间
+const containerCleanupTimeout = 30 * time.Second
+
+// ContainerConfig 创建容器的参数
+type ContainerConfig struct {
+	Name    string
+	Image   string
+	Cmd     []string // 为空时执行镜像的默认命令
+	Env     []string // KEY=VALUE
+	User    string
+	WorkDir string
+	Binds   []string // 宿主机路径:容器路径[:ro]
+	Network string
+	Labels  map[string]string
+}
+
+// ContainerRuntime 容器运行时，默认实现通过Docker Engine API访问本机Docker或Podman的socket
+type ContainerRuntime interface {
+	// EnsureImage 本地不存在镜像时拉取
+	EnsureImage(ctx context.Context, image string) error
+	// Create 创建容器，返回容器ID
+	Create(ctx context.Context, config *ContainerConfig) (string, error)
+	// Start 启动容器
+	Start(ctx context.Context, id string) error
+	// Logs 将容器的stdout和stderr持续写入w，容器退出后返回
+	Logs(ctx context.Context, id string, w io.Writer) error
+	// Wait 等待容器退出并返回退出码
+	Wait(ctx context.Context, id string) (int, error)
+	// Remove 强制删除容器，运行中的容器会被停止
+	Remove(ctx context.Context, id string) error
+}
+
+// ContainerPlugin container步骤，在容器中执行命令，步骤工作目录挂载为容器的 /workspace
+type ContainerPlugin struct {
+	runtime ContainerRuntime
+}
+
+// NewContainerPlugin 创建container步骤插件
+func NewContainerPlugin(runtime ContainerRuntime) *ContainerPlugin {
+	return &ContainerPlugin{runtime: runtime}
+}
+
+// Run 创建并启动容器，等待容器退出后返回收集到的全部输出，结束或ctx取消时删除容器
+func (p *ContainerPlugin) Run(ctx context.Context, step *Step) *ExecuteResult {
+	spec := step.Spec
+	if spec.Image == "" {
+		return Failed(fmt.Errorf("image is required"))
+	}
+
+	var output syncBuffer
+	if err := p.runtime.EnsureImage(ctx, spec.Image); err != nil {
+		return Failed(fmt.Errorf("failed to pull image %s: %w", spec.Image, err))
+	}
+
+	config := &ContainerConfig{
+		Name:    "plumber-step-" + step.ID,
+		Image:   spec.Image,
+		Env:     containerEnv(spec.Env),
+		User:    spec.User,
+		Network: spec.Network,
+		Labels:  map[string]string{"plumber.step_id": step.ID},
+	}
+	if spec.Run != "" {
+		config.Cmd = []string{"sh", "-c", spec.Run}
+	}
+	if step.WorkDir != "" {
+		config.WorkDir = containerWorkDir
+		config.Binds = append(config.Binds, step.WorkDir+":"+containerWorkDir)
+	}
+	for _, volume := range spec.Volumes {
+		// 相对的宿主机路径基于步骤工作目录，不含路径分隔符的视为命名卷
+		hostPath, rest, _ := strings.Cut(volume, ":")
+		if strings.HasPrefix(hostPath, ".") || strings.Contains(hostPath, "/") {
+			hostPath = ResolvePath(step.WorkDir, hostPath)
+		}
+		config.Binds = append(config.Binds, hostPath+":"+rest)
+	}
+
+	id, err := p.runtime.Create(ctx, config)
+	if err != nil {
+		return Failed(fmt.Errorf("failed to create container: %w", err))
+	}
+	log.Printf("[Container] Created container %s from %s - StepID: %s", shortID(id), spec.Image, step.ID)
+	defer func() {
+		// ctx可能已经取消，使用独立的超时删除容器
+		cleanupCtx, cancel := context.WithTimeout(context.Background(), containerCleanupTimeout)
+		defer cancel()
+		if err := p.runtime.Remove(cleanupCtx, id); err != nil {
+			log.Printf("[Container] Failed to remove container %s: %v", shortID(id), err)
+		}
+	}()
+
+	if err := p.runtime.Start(ctx, id); err != nil {
+		return Failed(fmt.Errorf("failed to start container: %w", err))
+	}
+
+	logsDone := make(chan error, 1)
+	go func() {
+		logsDone <- p.runtime.Logs(ctx, id, &output)
+	}()
+
+	exitCode, err := p.runtime.Wait(ctx, id)
+	if err != nil {
+		result := Failed(fmt.Errorf("container %s did not finish: %w", shortID(id), err))
+		result.Output = output.String() + "\n" + result.Output
+		return result
+	}
+
+	// 容器已退出，日志流随之结束
+	select {
+	case err := <-logsDone:
+		if err != nil {
+			log.Printf("[Container] Failed to read logs of %s: %v", shortID(id), err)
+		}
+	case <-time.After(5 * time.Second):
+	}
+
+	return &ExecuteResult{ExitCode: exitCode, Output: output.String()}
+}
+
+// containerEnv 按名称排序的环境变量
+func containerEnv(env map[string]string) []string {
+	list := make([]string, 0, len(env))
+	for key, value := range env {
+		list = append(list, key+"="+value)
+	}
+	sort.Strings(list)
+	return list
+}
+
+func shortID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
+
+// syncBuffer 并发安全的输出缓冲，日志在后台goroutine中写入，超时或取消时也能取到已收集的输出
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
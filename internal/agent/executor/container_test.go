@@ -0,0 +1,204 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRuntime 记录调用的容器运行时，blockWait为true时Wait一直阻塞到ctx结束
+type fakeRuntime struct {
+	logs      string
+	startErr  error
+	exitCode  int
+	blockWait bool
+
+	mu        sync.Mutex
+	config    *ContainerConfig
+	removed   []string
+	removeErr error // Remove被调用时ctx的状态，已取消说明清理使用了步骤的ctx
+}
+
+func (f *fakeRuntime) EnsureImage(ctx context.Context, image string) error {
+	return nil
+}
+
+func (f *fakeRuntime) Create(ctx context.Context, config *ContainerConfig) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.config = config
+	return "container-1", nil
+}
+
+func (f *fakeRuntime) Start(ctx context.Context, id string) error {
+	return f.startErr
+}
+
+func (f *fakeRuntime) Logs(ctx context.Context, id string, w io.Writer) error {
+	_, err := io.WriteString(w, f.logs)
+	return err
+}
+
+func (f *fakeRuntime) Wait(ctx context.Context, id string) (int, error) {
+	if f.blockWait {
+		<-ctx.Done()
+		return 0, ctx.Err()
+	}
+	return f.exitCode, nil
+}
+
+func (f *fakeRuntime) Remove(ctx context.Context, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.removed = append(f.removed, id)
+	f.removeErr = ctx.Err()
+	return nil
+}
+
+func TestContainerPluginRun(t *testing.T) {
+	tests := []struct {
+		name       string
+		runtime    *fakeRuntime
+		timeout    time.Duration
+		wantExit   int
+		wantOutput string
+		wantErr    string
+	}{
+		{
+			name:       "success",
+			runtime:    &fakeRuntime{logs: "hello\n"},
+			wantOutput: "hello\n",
+		},
+		{
+			name:       "non-zero exit code",
+			runtime:    &fakeRuntime{logs: "boom\n", exitCode: 3},
+			wantExit:   3,
+			wantOutput: "boom\n",
+		},
+		{
+			name:     "start failure",
+			runtime:  &fakeRuntime{startErr: errors.New("no such network")},
+			wantExit: 1,
+			wantErr:  "failed to start container",
+		},
+		{
+			name:     "timeout",
+			runtime:  &fakeRuntime{blockWait: true},
+			timeout:  50 * time.Millisecond,
+			wantExit: 1,
+			wantErr:  "did not finish",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+
+			step := &Step{ID: "step-1", Type: "container", Spec: Spec{Image: "alpine", Run: "echo hello"}}
+			result := NewContainerPlugin(tt.runtime).Run(ctx, step)
+
+			if result.ExitCode != tt.wantExit {
+				t.Errorf("ExitCode = %d, want %d", result.ExitCode, tt.wantExit)
+			}
+			if tt.wantErr != "" {
+				if result.Error == nil || !strings.Contains(result.Error.Error(), tt.wantErr) {
+					t.Errorf("Error = %v, want containing %q", result.Error, tt.wantErr)
+				}
+			} else if result.Output != tt.wantOutput {
+				t.Errorf("Output = %q, want %q", result.Output, tt.wantOutput)
+			}
+
+			// 无论成功、失败还是超时，容器都要用未取消的ctx删除
+			if !reflect.DeepEqual(tt.runtime.removed, []string{"container-1"}) {
+				t.Errorf("removed = %v, want [container-1]", tt.runtime.removed)
+			}
+			if tt.runtime.removeErr != nil {
+				t.Errorf("Remove called with finished ctx: %v", tt.runtime.removeErr)
+			}
+		})
+	}
+}
+
+func TestContainerPluginRunCancel(t *testing.T) {
+	runtime := &fakeRuntime{blockWait: true}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+
+	result := NewContainerPlugin(runtime).Run(ctx, &Step{ID: "step-1", Spec: Spec{Image: "alpine"}})
+	if result.ExitCode == 0 || result.Error == nil {
+		t.Fatalf("expected failure after cancel, got exit code %d", result.ExitCode)
+	}
+	if len(runtime.removed) != 1 || runtime.removeErr != nil {
+		t.Errorf("removed = %v (ctx err %v), want one removal with a live ctx", runtime.removed, runtime.removeErr)
+	}
+}
+
+func TestContainerPluginVolumes(t *testing.T) {
+	tests := []struct {
+		name      string
+		workDir   string
+		volumes   []string
+		wantBinds []string
+	}{
+		{
+			name:      "work dir mounted at /workspace",
+			workDir:   "/srv/build",
+			wantBinds: []string{"/srv/build:/workspace"},
+		},
+		{
+			name:      "relative host path",
+			workDir:   "/srv/build",
+			volumes:   []string{"./cache:/cache", "data/in:/in:ro"},
+			wantBinds: []string{"/srv/build:/workspace", "/srv/build/cache:/cache", "/srv/build/data/in:/in:ro"},
+		},
+		{
+			name:      "absolute host path",
+			workDir:   "/srv/build",
+			volumes:   []string{"/var/run/app.sock:/app.sock"},
+			wantBinds: []string{"/srv/build:/workspace", "/var/run/app.sock:/app.sock"},
+		},
+		{
+			name:      "named volume",
+			workDir:   "/srv/build",
+			volumes:   []string{"gocache:/root/.cache"},
+			wantBinds: []string{"/srv/build:/workspace", "gocache:/root/.cache"},
+		},
+		{
+			name:      "parent directory",
+			workDir:   "/srv/build",
+			volumes:   []string{"../shared:/shared"},
+			wantBinds: []string{"/srv/build:/workspace", "/srv/shared:/shared"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runtime := &fakeRuntime{}
+			step := &Step{ID: "step-1", WorkDir: tt.workDir, Spec: Spec{Image: "alpine", Volumes: tt.volumes}}
+			NewContainerPlugin(runtime).Run(context.Background(), step)
+
+			if runtime.config == nil {
+				t.Fatal("container was not created")
+			}
+			if !reflect.DeepEqual(runtime.config.Binds, tt.wantBinds) {
+				t.Errorf("Binds = %v, want %v", runtime.config.Binds, tt.wantBinds)
+			}
+			if runtime.config.WorkDir != containerWorkDir {
+				t.Errorf("WorkDir = %q, want %q", runtime.config.WorkDir, containerWorkDir)
+			}
+		})
+	}
+}
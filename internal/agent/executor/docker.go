@@ -0,0 +1,269 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DockerRuntime 通过Docker Engine API访问本机的Docker或Podman（兼容接口）socket
+type DockerRuntime struct {
+	client *http.Client
+}
+
+// NewDockerRuntime 创建容器运行时，socket为空时在连接时依次尝试DOCKER_HOST、Docker和Podman的默认socket
+func NewDockerRuntime(socket string) *DockerRuntime {
+	return &DockerRuntime{
+		client: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					path := socket
+					if path == "" {
+						detected, err := detectSocket()
+						if err != nil {
+							return nil, err
+						}
+						path = detected
+					}
+					var dialer net.Dialer
+					return dialer.DialContext(ctx, "unix", path)
+				},
+			},
+		},
+	}
+}
+
+// detectSocket 查找可用的容器运行时socket
+func detectSocket() (string, error) {
+	if host := os.Getenv("DOCKER_HOST"); strings.HasPrefix(host, "unix://") {
+		return strings.TrimPrefix(host, "unix://"), nil
+	}
+	candidates := []string{"/var/run/docker.sock", "/run/podman/podman.sock"}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		candidates = append(candidates, filepath.Join(dir, "podman", "podman.sock"), filepath.Join(dir, "docker.sock"))
+	}
+	for _, socket := range candidates {
+		if stat, err := os.Stat(socket); err == nil && stat.Mode()&os.ModeSocket != 0 {
+			return socket, nil
+		}
+	}
+	return "", fmt.Errorf("no docker or podman socket found, set container_socket in the agent config")
+}
+
+// request 向运行时发送请求，非2xx响应作为错误返回
+func (d *DockerRuntime) request(ctx context.Context, method, path string, query url.Values, body interface{}) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	target := "http://localhost" + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		var message struct {
+			Message string `json:"message"`
+		}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if json.Unmarshal(data, &message) == nil && message.Message != "" {
+			return nil, &dockerError{status: resp.StatusCode, message: message.Message}
+		}
+		return nil, &dockerError{status: resp.StatusCode, message: strings.TrimSpace(string(data))}
+	}
+	return resp, nil
+}
+
+// dockerError 运行时返回的错误响应
+type dockerError struct {
+	status  int
+	message string
+}
+
+func (e *dockerError) Error() string {
+	return fmt.Sprintf("%d: %s", e.status, e.message)
+}
+
+// EnsureImage 本地不存在镜像时拉取
+func (d *DockerRuntime) EnsureImage(ctx context.Context, image string) error {
+	resp, err := d.request(ctx, http.MethodGet, "/images/"+image+"/json", nil, nil)
+	if err == nil {
+		resp.Body.Close()
+		return nil
+	}
+	if derr, ok := err.(*dockerError); !ok || derr.status != http.StatusNotFound {
+		return err
+	}
+
+	// 未指定tag时拉取latest，否则Docker会拉取该镜像的所有tag
+	query := url.Values{"fromImage": {image}}
+	if !strings.Contains(image, "@") && !strings.Contains(image[strings.LastIndex(image, "/")+1:], ":") {
+		query.Set("tag", "latest")
+	}
+	resp, err = d.request(ctx, http.MethodPost, "/images/create", query, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// 拉取进度为JSON流，失败信息在流中返回
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var progress struct {
+			Error string `json:"error"`
+		}
+		if err := decoder.Decode(&progress); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if progress.Error != "" {
+			return fmt.Errorf("%s", progress.Error)
+		}
+	}
+}
+
+// Create 创建容器，同名的残留容器（如Agent异常退出时）会先被删除
+func (d *DockerRuntime) Create(ctx context.Context, config *ContainerConfig) (string, error) {
+	if config.Name != "" {
+		if err := d.Remove(ctx, config.Name); err != nil {
+			if derr, ok := err.(*dockerError); !ok || derr.status != http.StatusNotFound {
+				return "", err
+			}
+		}
+	}
+
+	type hostConfig struct {
+		Binds       []string `json:",omitempty"`
+		NetworkMode string   `json:",omitempty"`
+	}
+	body := struct {
+		Image      string
+		Cmd        []string          `json:",omitempty"`
+		Env        []string          `json:",omitempty"`
+		User       string            `json:",omitempty"`
+		WorkingDir string            `json:",omitempty"`
+		Labels     map[string]string `json:",omitempty"`
+		HostConfig hostConfig
+	}{
+		Image:      config.Image,
+		Cmd:        config.Cmd,
+		Env:        config.Env,
+		User:       config.User,
+		WorkingDir: config.WorkDir,
+		Labels:     config.Labels,
+		HostConfig: hostConfig{Binds: config.Binds, NetworkMode: config.Network},
+	}
+
+	var query url.Values
+	if config.Name != "" {
+		query = url.Values{"name": {config.Name}}
+	}
+	resp, err := d.request(ctx, http.MethodPost, "/containers/create", query, body)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var created struct {
+		ID string `json:"Id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		return "", fmt.Errorf("invalid create response: %w", err)
+	}
+	return created.ID, nil
+}
+
+// Start 启动容器
+func (d *DockerRuntime) Start(ctx context.Context, id string) error {
+	resp, err := d.request(ctx, http.MethodPost, "/containers/"+id+"/start", nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Logs 持续读取容器输出直到容器退出。非TTY容器的日志为多路复用流，
+// 每帧以8字节头开始：流类型（1为stdout，2为stderr）、3字节填充、4字节大端长度
+func (d *DockerRuntime) Logs(ctx context.Context, id string, w io.Writer) error {
+	query := url.Values{"follow": {"1"}, "stdout": {"1"}, "stderr": {"1"}}
+	resp, err := d.request(ctx, http.MethodGet, "/containers/"+id+"/logs", query, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(resp.Body, header); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		size := int64(binary.BigEndian.Uint32(header[4:]))
+		if _, err := io.CopyN(w, resp.Body, size); err != nil {
+			return err
+		}
+	}
+}
+
+// Wait 等待容器退出并返回退出码
+func (d *DockerRuntime) Wait(ctx context.Context, id string) (int, error) {
+	resp, err := d.request(ctx, http.MethodPost, "/containers/"+id+"/wait", nil, nil)
+	if err != nil {
+		return -1, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		StatusCode int
+		Error      *struct {
+			Message string
+		}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return -1, fmt.Errorf("invalid wait response: %w", err)
+	}
+	if result.Error != nil && result.Error.Message != "" {
+		return -1, fmt.Errorf("%s", result.Error.Message)
+	}
+	return result.StatusCode, nil
+}
+
+// Remove 强制删除容器及其匿名卷
+func (d *DockerRuntime) Remove(ctx context.Context, id string) error {
+	query := url.Values{"force": {"1"}, "v": {"1"}}
+	resp, err := d.request(ctx, http.MethodDelete, "/containers/"+id, query, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
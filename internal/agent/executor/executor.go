@@ -7,16 +7,25 @@ import (
 	"time"
 )
 
-// Executor 命令执行器
+// Executor 命令执行器，按步骤类型分发到插件
 type Executor struct {
 	workDir string
+	plugins map[string]Plugin
 }
 
-// NewExecutor 创建新的执行器
+// NewExecutor 创建新的执行器并注册内置步骤类型
 func NewExecutor(workDir string) *Executor {
-	return &Executor{
+	e := &Executor{
 		workDir: workDir,
+		plugins: make(map[string]Plugin),
 	}
+	e.Register("shell", PluginFunc(e.runShell))
+	e.Register("script", PluginFunc(e.runScript))
+	e.Register("http", PluginFunc(runHTTP))
+	e.Register("template", PluginFunc(runTemplate))
+	e.Register("wait", PluginFunc(e.runWait))
+	e.Register("check", PluginFunc(e.runCheck))
+	return e
 }
 
 // ExecuteResult 执行结果
@@ -26,19 +35,31 @@ type ExecuteResult struct {
 	Error    error
 }
 
-// Execute 执行命令
-func (e *Executor) Execute(ctx context.Context, path, command string) *ExecuteResult {
-	result := &ExecuteResult{}
-
-	// 设置工作目录
-	workDir := path
-	if workDir == "" {
-		workDir = e.workDir
+// WorkDir 步骤的工作目录，未指定path时使用默认工作目录
+func (e *Executor) WorkDir(path string) string {
+	if path == "" {
+		return e.workDir
 	}
+	return path
+}
 
+// Execute 执行命令
+func (e *Executor) Execute(ctx context.Context, path, command string) *ExecuteResult {
 	// 创建命令
 	cmd := exec.CommandContext(ctx, "sh", "-c", command)
-	cmd.Dir = workDir
+	cmd.Dir = e.WorkDir(path)
+
+	return run(cmd)
+}
+
+// runShell shell步骤，sh -c 执行命令
+func (e *Executor) runShell(ctx context.Context, step *Step) *ExecuteResult {
+	return e.Execute(ctx, step.WorkDir, step.Command)
+}
+
+// run 执行命令并合并输出
+func run(cmd *exec.Cmd) *ExecuteResult {
+	result := &ExecuteResult{}
 
 	// 捕获输出
 	var stdout, stderr bytes.Buffer
@@ -0,0 +1,99 @@
+package executor
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ResolvePath 相对路径基于步骤的工作目录
+func ResolvePath(dir, path string) string {
+	if filepath.IsAbs(path) || dir == "" {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(dir, path)
+}
+
+// ParseFileMode 解析八进制文件权限（不支持setuid等特殊位），默认0644
+func ParseFileMode(mode string) (os.FileMode, error) {
+	if mode == "" {
+		return 0644, nil
+	}
+	value, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || value > 0777 {
+		return 0, fmt.Errorf("invalid file mode %q", mode)
+	}
+	return os.FileMode(value), nil
+}
+
+// LookupOwner 解析 user 或 user:group，未指定组时使用用户的主组
+func LookupOwner(owner string) (int, int, error) {
+	if owner == "" {
+		return -1, -1, nil
+	}
+	userName, groupName, hasGroup := strings.Cut(owner, ":")
+	u, err := user.Lookup(userName)
+	if err != nil {
+		return 0, 0, err
+	}
+	gidString := u.Gid
+	if hasGroup {
+		g, err := user.LookupGroup(groupName)
+		if err != nil {
+			return 0, 0, err
+		}
+		gidString = g.Gid
+	}
+
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return 0, 0, fmt.Errorf("unsupported uid %q", u.Uid)
+	}
+	gid, err := strconv.Atoi(gidString)
+	if err != nil {
+		return 0, 0, fmt.Errorf("unsupported gid %q", gidString)
+	}
+	return uid, gid, nil
+}
+
+// WriteFile 通过write写入同目录下的临时文件，设置权限和属主后原子替换dest，失败时不留下残缺文件
+func WriteFile(dest string, mode os.FileMode, owner string, write func(f *os.File) error) error {
+	uid, gid, err := LookupOwner(owner)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return fmt.Errorf("failed to create destination dir: %w", err)
+	}
+	// 临时文件与目标在同一目录，保证rename是原子操作
+	tmp, err := os.CreateTemp(filepath.Dir(dest), ".plumber-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	err = write(tmp)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+	if owner != "" {
+		if err := os.Chown(tmp.Name(), uid, gid); err != nil {
+			return fmt.Errorf("failed to change owner: %w", err)
+		}
+	}
+	if err := os.Rename(tmp.Name(), dest); err != nil {
+		return fmt.Errorf("failed to write %s: %w", dest, err)
+	}
+	return nil
+}
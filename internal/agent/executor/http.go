@@ -0,0 +1,103 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	defaultHTTPTimeout = 30 * time.Second
+	maxHTTPOutput      = 4096 // 输出中保留的响应体长度
+	maxHTTPBody        = 1 << 20
+)
+
+// runHTTP http步骤，发送请求并校验状态码和响应体
+func runHTTP(ctx context.Context, step *Step) *ExecuteResult {
+	spec := step.Spec
+	timeout := defaultHTTPTimeout
+	if spec.Timeout != "" {
+		d, err := time.ParseDuration(spec.Timeout)
+		if err != nil {
+			return Failed(fmt.Errorf("invalid timeout %q", spec.Timeout))
+		}
+		timeout = d
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	resp, data, err := httpRequest(ctx, spec)
+	if err != nil {
+		return Failed(err)
+	}
+
+	output := fmt.Sprintf("%s %s -> %s\n", resp.Request.Method, spec.URL, resp.Status)
+	if len(data) > maxHTTPOutput {
+		output += string(data[:maxHTTPOutput]) + "\n... (truncated)\n"
+	} else if len(data) > 0 {
+		output += string(data) + "\n"
+	}
+
+	if err := checkHTTPResponse(spec, resp.StatusCode, data); err != nil {
+		result := Failed(err)
+		result.Output = output + result.Output
+		return result
+	}
+	return Succeeded(output)
+}
+
+// httpRequest 发送请求并读取响应体（最多1MB），响应体已关闭
+func httpRequest(ctx context.Context, spec Spec) (*http.Response, []byte, error) {
+	method := spec.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	var body io.Reader
+	if spec.Body != "" {
+		body = strings.NewReader(spec.Body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, spec.URL, body)
+	if err != nil {
+		return nil, nil, err
+	}
+	for key, value := range spec.Headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxHTTPBody))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	return resp, data, nil
+}
+
+// checkHTTPResponse 未指定ExpectStatus时要求2xx，ExpectBody为匹配响应体的正则表达式
+func checkHTTPResponse(spec Spec, status int, body []byte) error {
+	if spec.ExpectStatus != 0 {
+		if status != spec.ExpectStatus {
+			return fmt.Errorf("unexpected status %d, expected %d", status, spec.ExpectStatus)
+		}
+	} else if status < 200 || status > 299 {
+		return fmt.Errorf("unexpected status %d", status)
+	}
+	if spec.ExpectBody != "" {
+		re, err := regexp.Compile(spec.ExpectBody)
+		if err != nil {
+			return fmt.Errorf("invalid expect_body: %w", err)
+		}
+		if !re.Match(body) {
+			return fmt.Errorf("response body does not match %q", spec.ExpectBody)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Step 服务端下发的步骤
+type Step struct {
+	ID      string
+	Type    string // 为空时为shell
+	WorkDir string // 已解析的工作目录
+	Command string // shell/script为命令或脚本内容，其他类型为步骤描述
+	Spec    Spec
+}
+
+// Spec 步骤参数，各类型只使用与自己相关的字段
+type Spec struct {
+	Collect []string       `json:"collect,omitempty"` // 步骤成功后收集的文件glob
+	Use     []UsedArtifact `json:"use,omitempty"`     // 执行前下载到工作目录的制品
+
+	ArtifactID string `json:"artifact_id,omitempty"`
+	Name       string `json:"name,omitempty"`
+	SHA256     string `json:"sha256,omitempty"`
+	Size       int64  `json:"size,omitempty"`
+	Src        string `json:"src,omitempty"`
+	Dest       string `json:"dest,omitempty"`
+	Mode       string `json:"mode,omitempty"`
+	Owner      string `json:"owner,omitempty"`
+
+	Interpreter string `json:"interpreter,omitempty"`
+
+	URL          string            `json:"url,omitempty"`
+	Method       string            `json:"method,omitempty"`
+	Headers      map[string]string `json:"headers,omitempty"`
+	Body         string            `json:"body,omitempty"`
+	ExpectStatus int               `json:"expect_status,omitempty"`
+	ExpectBody   string            `json:"expect_body,omitempty"`
+
+	Template string            `json:"template,omitempty"`
+	Params   map[string]string `json:"params,omitempty"`
+
+	Duration string `json:"duration,omitempty"`
+	Until    string `json:"until,omitempty"`
+	Interval string `json:"interval,omitempty"`
+	Timeout  string `json:"timeout,omitempty"`
+
+	Image   string            `json:"image,omitempty"`
+	Run     string            `json:"run,omitempty"`
+	Volumes []string          `json:"volumes,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+	User    string            `json:"user,omitempty"`
+	Network string            `json:"network,omitempty"`
+
+	Probe     string `json:"probe,omitempty"`
+	Address   string `json:"address,omitempty"`
+	File      string `json:"file,omitempty"`
+	Successes int    `json:"successes,omitempty"`
+}
+
+// UsedArtifact 步骤执行前下载到工作目录的制品
+type UsedArtifact struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Plugin 步骤类型插件，ctx取消或超时时应尽快返回
+type Plugin interface {
+	Run(ctx context.Context, step *Step) *ExecuteResult
+}
+
+// PluginFunc 以函数实现的插件
+type PluginFunc func(ctx context.Context, step *Step) *ExecuteResult
+
+func (f PluginFunc) Run(ctx context.Context, step *Step) *ExecuteResult {
+	return f(ctx, step)
+}
+
+// Register 注册步骤类型插件，已存在时替换
+func (e *Executor) Register(stepType string, plugin Plugin) {
+	e.plugins[stepType] = plugin
+}
+
+// Run 按步骤类型执行
+func (e *Executor) Run(ctx context.Context, step *Step) *ExecuteResult {
+	stepType := step.Type
+	if stepType == "" {
+		stepType = "shell"
+	}
+	plugin, ok := e.plugins[stepType]
+	if !ok {
+		return Failed(fmt.Errorf("unsupported step type %q, the agent may need to be upgraded", step.Type))
+	}
+	return plugin.Run(ctx, step)
+}
+
+// RunWithTimeout 带超时的步骤执行
+func (e *Executor) RunWithTimeout(step *Step, timeout time.Duration) *ExecuteResult {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return e.Run(ctx, step)
+}
+
+// Succeeded 成功的结果
+func Succeeded(output string) *ExecuteResult {
+	return &ExecuteResult{Output: output}
+}
+
+// Failed 失败的结果，输出为错误信息
+func Failed(err error) *ExecuteResult {
+	return &ExecuteResult{ExitCode: 1, Output: err.Error(), Error: err}
+}
@@ -0,0 +1,44 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// runScript script步骤，将脚本内容写入临时文件后执行。
+// 指定Interpreter时以其执行（如 python3、bash -e），否则有shebang时直接执行，都没有时使用sh
+func (e *Executor) runScript(ctx context.Context, step *Step) *ExecuteResult {
+	f, err := os.CreateTemp("", "plumber-script-*")
+	if err != nil {
+		return Failed(fmt.Errorf("failed to create script file: %w", err))
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.WriteString(step.Command)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return Failed(fmt.Errorf("failed to write script file: %w", err))
+	}
+	if err := os.Chmod(f.Name(), 0700); err != nil {
+		return Failed(err)
+	}
+
+	var cmd *exec.Cmd
+	switch {
+	case step.Spec.Interpreter != "":
+		args := strings.Fields(step.Spec.Interpreter)
+		cmd = exec.CommandContext(ctx, args[0], append(args[1:], f.Name())...)
+	case strings.HasPrefix(step.Command, "#!"):
+		cmd = exec.CommandContext(ctx, f.Name())
+	default:
+		cmd = exec.CommandContext(ctx, "sh", f.Name())
+	}
+	cmd.Dir = e.WorkDir(step.WorkDir)
+
+	return run(cmd)
+}
@@ -0,0 +1,53 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"text/template"
+)
+
+// runTemplate template步骤，使用Params渲染内联Template或Src文件并写入Dest。
+// 模板语法为Go text/template，参数通过 {{.key}} 引用，缺少参数时报错
+func runTemplate(ctx context.Context, step *Step) *ExecuteResult {
+	spec := step.Spec
+	mode, err := ParseFileMode(spec.Mode)
+	if err != nil {
+		return Failed(err)
+	}
+
+	text := spec.Template
+	name := "template"
+	if spec.Src != "" {
+		name = ResolvePath(step.WorkDir, spec.Src)
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return Failed(err)
+		}
+		text = string(data)
+	}
+
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return Failed(fmt.Errorf("invalid template: %w", err))
+	}
+	params := spec.Params
+	if params == nil {
+		params = map[string]string{}
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, params); err != nil {
+		return Failed(fmt.Errorf("failed to render template: %w", err))
+	}
+
+	dest := ResolvePath(step.WorkDir, spec.Dest)
+	err = WriteFile(dest, mode, spec.Owner, func(f *os.File) error {
+		_, err := f.Write(buf.Bytes())
+		return err
+	})
+	if err != nil {
+		return Failed(err)
+	}
+	return Succeeded(fmt.Sprintf("rendered %s (%d bytes, mode %#o)\n", dest, buf.Len(), mode))
+}
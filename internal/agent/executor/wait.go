@@ -0,0 +1,77 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	defaultWaitInterval = 5 * time.Second
+	defaultWaitTimeout  = 5 * time.Minute
+)
+
+// runWait wait步骤，先等待Duration；指定Until时每隔Interval执行一次，直到退出码为0或超过Timeout
+func (e *Executor) runWait(ctx context.Context, step *Step) *ExecuteResult {
+	spec := step.Spec
+	durations := map[string]time.Duration{}
+	for key, value := range map[string]string{"duration": spec.Duration, "interval": spec.Interval, "timeout": spec.Timeout} {
+		if value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return Failed(fmt.Errorf("invalid %s %q", key, value))
+		}
+		durations[key] = d
+	}
+
+	var output strings.Builder
+	if d := durations["duration"]; d > 0 {
+		if err := sleep(ctx, d); err != nil {
+			return Failed(err)
+		}
+		fmt.Fprintf(&output, "waited %s\n", d)
+	}
+	if spec.Until == "" {
+		return Succeeded(output.String())
+	}
+
+	interval, ok := durations["interval"]
+	if !ok || interval <= 0 {
+		interval = defaultWaitInterval
+	}
+	timeout, ok := durations["timeout"]
+	if !ok || timeout <= 0 {
+		timeout = defaultWaitTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for attempt := 1; ; attempt++ {
+		result := e.Execute(ctx, step.WorkDir, spec.Until)
+		if result.ExitCode == 0 {
+			fmt.Fprintf(&output, "condition met after %d attempt(s)\n", attempt)
+			return Succeeded(output.String())
+		}
+		if err := sleep(ctx, interval); err != nil {
+			fmt.Fprintf(&output, "condition not met after %d attempt(s), last exit code %d:\n%s\n", attempt, result.ExitCode, result.Output)
+			result := Failed(fmt.Errorf("timed out waiting for condition"))
+			result.Output = output.String() + result.Output
+			return result
+		}
+	}
+}
+
+// sleep 等待d，ctx取消时提前返回错误
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
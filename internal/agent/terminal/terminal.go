@@ -0,0 +1,109 @@
+package terminal
+
+import (
+	"log"
+	"os"
+	"os/exec"
+	"sync"
+
+	"github.com/creack/pty"
+	"github.com/gorilla/websocket"
+)
+
+// Message 与服务端WebSSH相同的终端消息格式
+// 服务端 -> Agent：data（输入）、resize；Agent -> 服务端：data（输出）、error、exit
+type Message struct {
+	Type string `json:"type"`
+	Data string `json:"data"`
+	Rows int    `json:"rows,omitempty"`
+	Cols int    `json:"cols,omitempty"`
+}
+
+// conn 串行化WebSocket写入
+type conn struct {
+	*websocket.Conn
+	mu sync.Mutex
+}
+
+func (c *conn) send(msg Message) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.Conn.WriteJSON(msg)
+}
+
+// SendError 向服务端报告错误并关闭连接
+func SendError(ws *websocket.Conn, message string) {
+	ws.WriteJSON(Message{Type: "error", Data: message})
+	ws.Close()
+}
+
+// Run 在PTY中启动登录shell并通过WebSocket转发输入输出，直到shell退出或连接断开
+func Run(ws *websocket.Conn, rows, cols int) error {
+	c := &conn{Conn: ws}
+	defer c.Close()
+
+	cmd := exec.Command(shell(), "-l")
+	cmd.Env = append(os.Environ(), "TERM=xterm")
+	if home, err := os.UserHomeDir(); err == nil {
+		cmd.Dir = home
+	}
+
+	ptmx, err := pty.StartWithSize(cmd, &pty.Winsize{Rows: uint16(rows), Cols: uint16(cols)})
+	if err != nil {
+		c.send(Message{Type: "error", Data: "failed to start shell: " + err.Error()})
+		return err
+	}
+	defer ptmx.Close()
+
+	// PTY 输出 -> 服务端，shell退出后通知服务端结束会话
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, err := ptmx.Read(buf)
+			if n > 0 {
+				if err := c.send(Message{Type: "data", Data: string(buf[:n])}); err != nil {
+					break
+				}
+			}
+			if err != nil {
+				break
+			}
+		}
+		c.send(Message{Type: "exit"})
+		c.Close()
+	}()
+
+	// 服务端 -> PTY 输入
+	for {
+		var msg Message
+		if err := c.ReadJSON(&msg); err != nil {
+			break
+		}
+		switch msg.Type {
+		case "data":
+			if _, err := ptmx.Write([]byte(msg.Data)); err != nil {
+				log.Printf("[Terminal] PTY write error: %v", err)
+			}
+		case "resize":
+			if msg.Rows > 0 && msg.Cols > 0 {
+				pty.Setsize(ptmx, &pty.Winsize{Rows: uint16(msg.Rows), Cols: uint16(msg.Cols)})
+			}
+		}
+	}
+
+	// 连接断开（浏览器关闭或超时）时结束shell，shell已退出时Kill无副作用
+	cmd.Process.Kill()
+	cmd.Wait()
+	return nil
+}
+
+// shell 优先使用SHELL环境变量，其次bash，最后sh
+func shell() string {
+	if s := os.Getenv("SHELL"); s != "" {
+		return s
+	}
+	if _, err := os.Stat("/bin/bash"); err == nil {
+		return "/bin/bash"
+	}
+	return "/bin/sh"
+}
@@ -0,0 +1,248 @@
+package update
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"time"
+
+	"github.com/plumber/plumber/pkg/agentupdate"
+)
+
+// maxStartAttempts 新版本启动后未确认即退出的次数上限，超过后恢复原二进制
+const maxStartAttempts = 3
+
+// 更新状态文件中的状态
+const statePending = "pending" // 已替换二进制，等待新版本确认
+
+// State 保存在二进制旁的 .update.json，跨进程重启记录自更新进度
+type State struct {
+	FromVersion string    `json:"from_version"`
+	ToVersion   string    `json:"to_version"`
+	Status      string    `json:"status"` // pending/success/failed/rolled_back
+	Message     string    `json:"message,omitempty"`
+	Attempts    int       `json:"attempts"`
+	StartedAt   time.Time `json:"started_at"`
+}
+
+// Updater 下载校验后原子替换Agent二进制并重启，新版本未能正常启动时恢复原二进制
+type Updater struct {
+	exe       string
+	version   string
+	publicKey ed25519.PublicKey
+}
+
+// New 创建更新器，publicKey 为服务端签名公钥
+func New(version string, publicKey ed25519.PublicKey) (*Updater, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to locate executable: %w", err)
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return nil, fmt.Errorf("failed to resolve executable: %w", err)
+	}
+	return &Updater{
+		exe:       exe,
+		version:   version,
+		publicKey: publicKey,
+	}, nil
+}
+
+// Version 当前运行的版本
+func (u *Updater) Version() string {
+	return u.version
+}
+
+func (u *Updater) backupPath() string {
+	return u.exe + ".bak"
+}
+
+func (u *Updater) statePath() string {
+	return u.exe + ".update.json"
+}
+
+// Apply 将下载内容写入临时文件，校验签名、平台、大小和摘要后备份当前二进制并原子替换
+func (u *Updater) Apply(offer *agentupdate.Offer, body io.Reader) error {
+	if err := agentupdate.Verify(u.publicKey, offer); err != nil {
+		return err
+	}
+	if offer.OS != runtime.GOOS || offer.Arch != runtime.GOARCH {
+		return fmt.Errorf("update is for %s/%s, this agent runs on %s/%s", offer.OS, offer.Arch, runtime.GOOS, runtime.GOARCH)
+	}
+
+	// 临时文件与目标在同一目录，保证rename是原子操作
+	tmp, err := os.CreateTemp(filepath.Dir(u.exe), ".plumber-agent-update-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, hash), io.LimitReader(body, offer.Size+1))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to download binary: %w", err)
+	}
+	if n != offer.Size {
+		return fmt.Errorf("size mismatch: got %d bytes, expected %d", n, offer.Size)
+	}
+	if digest := hex.EncodeToString(hash.Sum(nil)); digest != offer.SHA256 {
+		return fmt.Errorf("checksum mismatch: got %s, expected %s", digest, offer.SHA256)
+	}
+	if err := os.Chmod(tmp.Name(), 0755); err != nil {
+		return err
+	}
+
+	if err := copyFile(u.exe, u.backupPath()); err != nil {
+		return fmt.Errorf("failed to back up current binary: %w", err)
+	}
+	if err := u.saveState(&State{
+		FromVersion: u.version,
+		ToVersion:   offer.Version,
+		Status:      statePending,
+		StartedAt:   time.Now(),
+	}); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), u.exe); err != nil {
+		u.clearState()
+		return fmt.Errorf("failed to replace binary: %w", err)
+	}
+	return nil
+}
+
+// Restart 以相同参数重新执行当前二进制（替换后即为新版本），成功时不返回；
+// 新二进制无法执行时恢复原二进制并返回错误
+func (u *Updater) Restart() error {
+	err := syscall.Exec(u.exe, os.Args, os.Environ())
+	if restoreErr := u.restore(); restoreErr != nil {
+		return fmt.Errorf("failed to start new binary: %v; restore failed: %w", err, restoreErr)
+	}
+	u.clearState()
+	return fmt.Errorf("failed to start new binary: %w", err)
+}
+
+// Resume 在启动时检查上一次自更新：新版本启动次数超过上限或版本不符时恢复原二进制并重启；
+// 返回需要确认（pending）或上报（rolled_back）的状态，没有进行中的更新时返回nil
+func (u *Updater) Resume() (*State, error) {
+	state, err := u.loadState()
+	if err != nil || state == nil {
+		return nil, err
+	}
+	if state.Status != statePending {
+		return state, nil
+	}
+
+	state.Attempts++
+	if u.version != state.ToVersion {
+		return nil, u.Rollback(state, fmt.Sprintf("new binary reports version %q, expected %q", u.version, state.ToVersion))
+	}
+	if state.Attempts > maxStartAttempts {
+		return nil, u.Rollback(state, fmt.Sprintf("new version exited %d times before confirming", maxStartAttempts))
+	}
+	if err := u.saveState(state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// Confirm 新版本已成功注册，删除备份和状态文件
+func (u *Updater) Confirm() {
+	if err := os.Remove(u.backupPath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("[Update] Failed to remove backup: %v", err)
+	}
+	u.clearState()
+}
+
+// Clear 结果已上报，删除状态文件
+func (u *Updater) Clear() {
+	u.clearState()
+}
+
+// Rollback 新版本未能完成启动（如无法注册），恢复原二进制并重启，成功时不返回
+func (u *Updater) Rollback(state *State, reason string) error {
+	log.Printf("[Update] Rolling back to %s: %s", state.FromVersion, reason)
+	if err := u.restore(); err != nil {
+		return fmt.Errorf("rollback failed: %w", err)
+	}
+	state.Status = agentupdate.StatusRolledBack
+	state.Message = reason
+	if err := u.saveState(state); err != nil {
+		return err
+	}
+	err := syscall.Exec(u.exe, os.Args, os.Environ())
+	return fmt.Errorf("failed to restart previous binary: %w", err)
+}
+
+// restore 用备份原子替换当前二进制
+func (u *Updater) restore() error {
+	tmp := u.exe + ".restore"
+	if err := copyFile(u.backupPath(), tmp); err != nil {
+		return err
+	}
+	return os.Rename(tmp, u.exe)
+}
+
+func (u *Updater) loadState() (*State, error) {
+	data, err := os.ReadFile(u.statePath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read update state: %w", err)
+	}
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		// 状态文件损坏时放弃这次更新的跟踪
+		u.clearState()
+		return nil, nil
+	}
+	return &state, nil
+}
+
+func (u *Updater) saveState(state *State) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(u.statePath(), data, 0600); err != nil {
+		return fmt.Errorf("failed to write update state: %w", err)
+	}
+	return nil
+}
+
+func (u *Updater) clearState() {
+	if err := os.Remove(u.statePath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("[Update] Failed to remove update state: %v", err)
+	}
+}
+
+// copyFile 复制文件并保留可执行权限
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
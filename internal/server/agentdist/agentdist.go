@@ -0,0 +1,277 @@
+package agentdist
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// binaryPrefix 二进制文件名前缀，完整文件名为 plumber-agent-<os>-<arch>，与 make build-agent-dist 的输出一致
+const binaryPrefix = "plumber-agent-"
+
+// versionSuffix 二进制版本号保存在同名的 .version 文件中
+const versionSuffix = ".version"
+
+var platformPattern = regexp.MustCompile(`^[a-z0-9]+$`)
+
+// Binary 服务端托管的Agent二进制
+type Binary struct {
+	OS      string    `json:"os"`
+	Arch    string    `json:"arch"`
+	Version string    `json:"version,omitempty"` // 未提供版本时为空，升级时不校验版本
+	Size    int64     `json:"size"`
+	SHA256  string    `json:"sha256"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// Store 按操作系统/架构保存Agent二进制，用于离线部署和Agent自更新
+type Store struct {
+	dir string
+
+	mu      sync.Mutex
+	digests map[string]cachedDigest // 按路径缓存SHA-256，心跳下发自更新时避免重复计算
+}
+
+// cachedDigest 文件大小和修改时间不变时复用摘要
+type cachedDigest struct {
+	size    int64
+	modTime time.Time
+	sha256  string
+}
+
+// NewStore 创建二进制仓库，目录不存在时自动创建
+func NewStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create agent binary dir: %w", err)
+	}
+	return &Store{dir: dir, digests: make(map[string]cachedDigest)}, nil
+}
+
+// ValidatePlatform 校验操作系统和架构名称（GOOS/GOARCH格式）
+func ValidatePlatform(goos, goarch string) error {
+	if !platformPattern.MatchString(goos) || !platformPattern.MatchString(goarch) {
+		return fmt.Errorf("invalid platform %q/%q", goos, goarch)
+	}
+	return nil
+}
+
+func (s *Store) path(goos, goarch string) string {
+	return filepath.Join(s.dir, binaryPrefix+goos+"-"+goarch)
+}
+
+// List 列出所有已托管的二进制
+func (s *Store) List() ([]Binary, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	binaries := make([]Binary, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, binaryPrefix) {
+			continue
+		}
+		goos, goarch, ok := strings.Cut(strings.TrimPrefix(name, binaryPrefix), "-")
+		if !ok || ValidatePlatform(goos, goarch) != nil {
+			continue
+		}
+		binary, err := s.Stat(goos, goarch)
+		if err != nil {
+			return nil, err
+		}
+		binaries = append(binaries, *binary)
+	}
+	sort.Slice(binaries, func(i, j int) bool {
+		if binaries[i].OS != binaries[j].OS {
+			return binaries[i].OS < binaries[j].OS
+		}
+		return binaries[i].Arch < binaries[j].Arch
+	})
+	return binaries, nil
+}
+
+// Stat 获取指定平台的二进制信息
+func (s *Store) Stat(goos, goarch string) (*Binary, error) {
+	if err := ValidatePlatform(goos, goarch); err != nil {
+		return nil, err
+	}
+	f, err := os.Open(s.path(goos, goarch))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("no agent binary for %s/%s, upload one or run make build-agent-dist", goos, goarch)
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	digest, err := s.digest(f, info)
+	if err != nil {
+		return nil, err
+	}
+	version, err := os.ReadFile(s.path(goos, goarch) + versionSuffix)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return &Binary{
+		OS:      goos,
+		Arch:    goarch,
+		Version: strings.TrimSpace(string(version)),
+		Size:    info.Size(),
+		SHA256:  digest,
+		ModTime: info.ModTime(),
+	}, nil
+}
+
+// digest 计算文件的SHA-256，文件未变化时使用缓存
+func (s *Store) digest(f *os.File, info os.FileInfo) (string, error) {
+	s.mu.Lock()
+	cached, ok := s.digests[f.Name()]
+	s.mu.Unlock()
+	if ok && cached.size == info.Size() && cached.modTime.Equal(info.ModTime()) {
+		return cached.sha256, nil
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	digest := hex.EncodeToString(hash.Sum(nil))
+
+	s.mu.Lock()
+	s.digests[f.Name()] = cachedDigest{size: info.Size(), modTime: info.ModTime(), sha256: digest}
+	s.mu.Unlock()
+	return digest, nil
+}
+
+// Open 打开指定平台的二进制，调用方负责关闭
+func (s *Store) Open(goos, goarch string) (*os.File, *Binary, error) {
+	binary, err := s.Stat(goos, goarch)
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err := os.Open(s.path(goos, goarch))
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, binary, nil
+}
+
+// Save 保存（替换）指定平台的二进制及其版本号，先写入临时文件再重命名，部署中的读取不受影响
+func (s *Store) Save(goos, goarch, version string, r io.Reader) (*Binary, error) {
+	if err := ValidatePlatform(goos, goarch); err != nil {
+		return nil, err
+	}
+	if strings.ContainsAny(version, " \t\r\n") || len(version) > 50 {
+		return nil, fmt.Errorf("invalid version %q", version)
+	}
+
+	tmp, err := os.CreateTemp(s.dir, ".upload-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(tmp.Name(), 0755); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp.Name(), s.path(goos, goarch)); err != nil {
+		return nil, err
+	}
+	if version == "" {
+		err = os.Remove(s.path(goos, goarch) + versionSuffix)
+		if os.IsNotExist(err) {
+			err = nil
+		}
+	} else {
+		err = os.WriteFile(s.path(goos, goarch)+versionSuffix, []byte(version+"\n"), 0644)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.Stat(goos, goarch)
+}
+
+// Delete 删除指定平台的二进制
+func (s *Store) Delete(goos, goarch string) error {
+	if err := ValidatePlatform(goos, goarch); err != nil {
+		return err
+	}
+	if err := os.Remove(s.path(goos, goarch)); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("no agent binary for %s/%s", goos, goarch)
+		}
+		return err
+	}
+	if err := os.Remove(s.path(goos, goarch) + versionSuffix); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// ParseUname 将目标主机 uname -s / uname -m 的输出转换为GOOS/GOARCH
+func ParseUname(kernel, machine string) (string, string, error) {
+	goos := strings.ToLower(strings.TrimSpace(kernel))
+	switch goos {
+	case "linux", "darwin", "freebsd":
+	default:
+		return "", "", fmt.Errorf("unsupported operating system %q", kernel)
+	}
+
+	var goarch string
+	switch strings.TrimSpace(machine) {
+	case "x86_64", "amd64":
+		goarch = "amd64"
+	case "aarch64", "arm64":
+		goarch = "arm64"
+	case "armv7l", "armv6l":
+		goarch = "arm"
+	case "i386", "i686":
+		goarch = "386"
+	default:
+		return "", "", fmt.Errorf("unsupported architecture %q", machine)
+	}
+	return goos, goarch, nil
+}
+
+// SystemdUnit 生成Agent的systemd服务单元，Agent从工作目录读取 agent.json
+func SystemdUnit(installDir string) string {
+	return fmt.Sprintf(`[Unit]
+Description=PlumberAgent
+After=network.target nss-lookup.target
+Wants=network.target
+
+[Service]
+User=root
+Group=root
+Type=simple
+LimitNOFILE=999999
+WorkingDirectory=%[1]s
+Environment="PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+ExecStart=%[1]s/plumber-agent
+Restart=always
+RestartSec=10
+
+[Install]
+WantedBy=multi-user.target
+`, installDir)
+}
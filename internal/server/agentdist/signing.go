@@ -0,0 +1,82 @@
+package agentdist
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/plumber/plumber/pkg/agentupdate"
+)
+
+// Signer 签名下发给Agent的自更新信息，Agent使用 agent.json 中的公钥校验
+type Signer struct {
+	key ed25519.PrivateKey
+}
+
+// LoadOrCreateSigner 从文件加载Ed25519签名私钥，不存在时自动生成
+func LoadOrCreateSigner(path string) (*Signer, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return createSigner(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("invalid signing key PEM")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signing key: %w", err)
+	}
+	key, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("signing key must be ed25519")
+	}
+	return &Signer{key: key}, nil
+}
+
+func createSigner(path string) (*Signer, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate signing key: %w", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal signing key: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create signing key directory: %w", err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write signing key: %w", err)
+	}
+	return &Signer{key: key}, nil
+}
+
+// PublicKey 返回写入 agent.json 的公钥
+func (s *Signer) PublicKey() string {
+	return agentupdate.EncodePublicKey(s.key.Public().(ed25519.PublicKey))
+}
+
+// Offer 生成指定二进制的自更新信息并签名
+func (s *Signer) Offer(binary *Binary, url string) *agentupdate.Offer {
+	offer := &agentupdate.Offer{
+		Version: binary.Version,
+		OS:      binary.OS,
+		Arch:    binary.Arch,
+		Size:    binary.Size,
+		SHA256:  binary.SHA256,
+		URL:     url,
+	}
+	agentupdate.Sign(s.key, offer)
+	return offer
+}
@@ -0,0 +1,203 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/plumber/plumber/internal/server/pki"
+	"github.com/plumber/plumber/internal/server/storage"
+	"github.com/plumber/plumber/pkg/auth"
+	"github.com/plumber/plumber/pkg/models"
+)
+
+// agentTokenLength Agent令牌随机字节数（十六进制编码后为64个字符，低于bcrypt的72字节上限）
+const agentTokenLength = 32
+
+// agentAuthenticator Agent令牌认证器
+// 每个Agent持有独立令牌，服务端只保存bcrypt哈希。
+// Agent心跳和轮询非常频繁，验证通过后缓存令牌摘要，避免每次请求都执行bcrypt。
+// 启用mTLS后，持有有效客户端证书的请求直接以证书中的Agent ID作为身份。
+type agentAuthenticator struct {
+	storage     storage.Storage
+	requireCert bool     // 是否强制要求客户端证书
+	cache       sync.Map // uuid.UUID -> agentTokenCacheEntry
+}
+
+type agentTokenCacheEntry struct {
+	tokenHash string   // 验证时使用的bcrypt哈希，令牌轮换或吊销后自动失效
+	digest    [32]byte // 已验证令牌的SHA-256摘要
+}
+
+func newAgentAuthenticator(storage storage.Storage, requireCert bool) *agentAuthenticator {
+	return &agentAuthenticator{storage: storage, requireCert: requireCert}
+}
+
+// AuthenticateRequest 认证Agent请求，优先使用客户端证书，其次使用令牌
+func (a *agentAuthenticator) AuthenticateRequest(r *http.Request, method string) (*models.Agent, error) {
+	if cert := verifiedClientCert(r); cert != nil {
+		return a.AuthenticateCert(r.Context(), cert, r.Header.Get("X-Agent-ID"))
+	}
+
+	// 首次申请证书（或证书已过期）时只能使用令牌
+	if a.requireCert && method != enrollCertMethodName {
+		return nil, fmt.Errorf("client certificate required")
+	}
+
+	return a.Authenticate(r.Context(), r.Header.Get("X-Agent-ID"), r.Header.Get("X-Agent-Token"))
+}
+
+// AuthenticateCert 校验客户端证书是否由本服务签发且未吊销，
+// 令牌已吊销或已下线的Agent即使持有有效证书也拒绝
+func (a *agentAuthenticator) AuthenticateCert(ctx context.Context, cert *x509.Certificate, claimedID string) (*models.Agent, error) {
+	agentUUID, err := uuid.Parse(cert.Subject.CommonName)
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate subject")
+	}
+
+	if claimedID != "" && claimedID != agentUUID.String() {
+		return nil, fmt.Errorf("agent id does not match certificate")
+	}
+
+	record, err := a.storage.GetAgentCertificateBySerial(ctx, pki.SerialString(cert))
+	if err != nil {
+		return nil, fmt.Errorf("unknown certificate")
+	}
+	if record.AgentID != agentUUID {
+		return nil, fmt.Errorf("certificate does not belong to agent")
+	}
+	if record.RevokedAt != nil {
+		return nil, fmt.Errorf("certificate revoked")
+	}
+
+	agent, err := a.storage.GetAgent(ctx, agentUUID)
+	if err != nil {
+		return nil, fmt.Errorf("unknown agent")
+	}
+	if agent.Status == "decommissioned" {
+		return nil, fmt.Errorf("agent decommissioned")
+	}
+	if agent.TokenHash == "" {
+		return nil, fmt.Errorf("agent token revoked or not issued")
+	}
+
+	return agent, nil
+}
+
+// verifiedClientCert 返回TLS握手中已通过CA校验的客户端证书
+func verifiedClientCert(r *http.Request) *x509.Certificate {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return r.TLS.VerifiedChains[0][0]
+}
+
+// Authenticate 校验Agent ID和令牌，返回对应的Agent
+func (a *agentAuthenticator) Authenticate(ctx context.Context, agentID, token string) (*models.Agent, error) {
+	if agentID == "" || token == "" {
+		return nil, fmt.Errorf("missing agent credentials")
+	}
+
+	agentUUID, err := uuid.Parse(agentID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid agent id")
+	}
+
+	agent, err := a.storage.GetAgent(ctx, agentUUID)
+	if err != nil {
+		return nil, fmt.Errorf("unknown agent")
+	}
+
+	if agent.TokenHash == "" {
+		return nil, fmt.Errorf("agent token revoked or not issued")
+	}
+
+	digest := sha256.Sum256([]byte(token))
+	if v, ok := a.cache.Load(agent.ID); ok {
+		entry := v.(agentTokenCacheEntry)
+		if entry.tokenHash == agent.TokenHash && subtle.ConstantTimeCompare(entry.digest[:], digest[:]) == 1 {
+			return agent, nil
+		}
+	}
+
+	if !auth.CheckPassword(token, agent.TokenHash) {
+		return nil, fmt.Errorf("invalid agent token")
+	}
+
+	a.cache.Store(agent.ID, agentTokenCacheEntry{tokenHash: agent.TokenHash, digest: digest})
+	return agent, nil
+}
+
+// issueAgentToken 为Agent签发新令牌并保存哈希，旧令牌立即失效
+// 返回的明文令牌只在此时可见，调用方负责交给用户或写入agent.json
+func issueAgentToken(ctx context.Context, storage storage.Storage, agentID uuid.UUID) (string, error) {
+	token, hash, err := newAgentToken()
+	if err != nil {
+		return "", err
+	}
+
+	if err := storage.UpdateAgentToken(ctx, agentID, hash); err != nil {
+		return "", fmt.Errorf("failed to save agent token: %w", err)
+	}
+
+	return token, nil
+}
+
+// newAgentToken 生成Agent令牌及其bcrypt哈希
+func newAgentToken() (string, string, error) {
+	token, err := auth.GenerateToken(agentTokenLength)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate agent token: %w", err)
+	}
+
+	hash, err := auth.HashPassword(token)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to hash agent token: %w", err)
+	}
+	return token, hash, nil
+}
+
+// agentConfigBuilder 生成agent.json内容
+type agentConfigBuilder struct {
+	serverAddr string
+	ca         *pki.CA // 启用TLS时写入CA证书，Agent据此校验服务端并申请客户端证书
+	updateKey  string  // 自更新签名公钥，Agent据此校验服务端下发的二进制
+}
+
+func (b *agentConfigBuilder) Build(agentID uuid.UUID, token string) ([]byte, error) {
+	config := map[string]interface{}{
+		"id":          agentID.String(),
+		"server_addr": b.serverAddr,
+	}
+	if token != "" {
+		config["token"] = token
+	}
+	if b.ca != nil {
+		config["ca_cert"] = string(b.ca.CertPEM())
+	}
+	if b.updateKey != "" {
+		config["update_public_key"] = b.updateKey
+	}
+	return json.MarshalIndent(config, "", "  ")
+}
+
+// authenticatedAgentID 获取当前请求已认证的Agent ID
+// 参数中的agent_id仅用于兼容旧版Agent，若提供则必须与认证身份一致
+func authenticatedAgentID(ctx context.Context, claimed string) (uuid.UUID, error) {
+	agentID, ok := GetAgentIDFromContext(ctx)
+	if !ok {
+		return uuid.Nil, fmt.Errorf("agent not authenticated")
+	}
+
+	if claimed != "" && claimed != agentID.String() {
+		return uuid.Nil, fmt.Errorf("agent_id does not match authenticated agent")
+	}
+
+	return agentID, nil
+}
@@ -0,0 +1,188 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/plumber/plumber/internal/server/agentdist"
+	"github.com/plumber/plumber/internal/server/audit"
+	"github.com/plumber/plumber/pkg/auth"
+	"github.com/plumber/plumber/pkg/models"
+)
+
+// ListAgentBinariesMethod 列出服务端托管的Agent二进制
+type ListAgentBinariesMethod struct {
+	binaries *agentdist.Store
+}
+
+func NewListAgentBinariesMethod(binaries *agentdist.Store) *ListAgentBinariesMethod {
+	return &ListAgentBinariesMethod{binaries: binaries}
+}
+
+func (m *ListAgentBinariesMethod) Name() string {
+	return "plumber.agent.listBinaries"
+}
+
+func (m *ListAgentBinariesMethod) Permission() string {
+	return auth.PermAgentRead
+}
+
+func (m *ListAgentBinariesMethod) Execute(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	binaries, err := m.binaries.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list agent binaries: %w", err)
+	}
+
+	return map[string]interface{}{
+		"binaries": binaries,
+	}, nil
+}
+
+// DeleteAgentBinaryMethod 删除服务端托管的Agent二进制
+type DeleteAgentBinaryMethod struct {
+	binaries *agentdist.Store
+}
+
+func NewDeleteAgentBinaryMethod(binaries *agentdist.Store) *DeleteAgentBinaryMethod {
+	return &DeleteAgentBinaryMethod{binaries: binaries}
+}
+
+func (m *DeleteAgentBinaryMethod) Name() string {
+	return "plumber.agent.deleteBinary"
+}
+
+func (m *DeleteAgentBinaryMethod) Permission() string {
+	return auth.PermAgentDeploy
+}
+
+type DeleteAgentBinaryParams struct {
+	OS   string `json:"os"`
+	Arch string `json:"arch"`
+}
+
+func (m *DeleteAgentBinaryMethod) Execute(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var p DeleteAgentBinaryParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, fmt.Errorf("invalid params: %w", err)
+	}
+
+	if err := m.binaries.Delete(p.OS, p.Arch); err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"status": "deleted",
+	}, nil
+}
+
+// AgentBinaryHandler 上传Agent二进制
+// POST /api/agent/binaries?os=linux&arch=amd64[&version=1.2.0]，请求体为二进制内容，认证使用 Authorization: Bearer
+type AgentBinaryHandler struct {
+	handler  *Handler
+	binaries *agentdist.Store
+	maxSize  int64
+}
+
+// NewAgentBinaryHandler 创建Agent二进制上传处理器，maxSize为0时不限制大小
+func NewAgentBinaryHandler(handler *Handler, binaries *agentdist.Store, maxSize int64) *AgentBinaryHandler {
+	return &AgentBinaryHandler{
+		handler:  handler,
+		binaries: binaries,
+		maxSize:  maxSize,
+	}
+}
+
+func (h *AgentBinaryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" {
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	ctx := r.Context()
+	start := time.Now()
+	query := r.URL.Query()
+	goos, goarch, version := query.Get("os"), query.Get("arch"), query.Get("version")
+	details := map[string]interface{}{"os": goos, "arch": goarch, "version": version}
+
+	user, err := h.handler.AuthorizeToken(ctx, token, auth.PermAgentDeploy, nil)
+	if err != nil {
+		h.recordAudit(r, user, token, details, start, audit.ResultDenied, err)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if err := agentdist.ValidatePlatform(goos, goarch); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// 二进制较大，上传时间可能超过服务器默认的读写超时
+	rc := http.NewResponseController(w)
+	rc.SetReadDeadline(time.Time{})
+	rc.SetWriteDeadline(time.Time{})
+
+	if h.maxSize > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, h.maxSize)
+	}
+	binary, err := h.binaries.Save(goos, goarch, version, r.Body)
+	if err != nil {
+		h.recordAudit(r, user, token, details, start, audit.ResultError, err)
+		status := http.StatusInternalServerError
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	details["size"] = binary.Size
+	details["sha256"] = binary.SHA256
+	h.recordAudit(r, user, token, details, start, audit.ResultSuccess, nil)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(binary)
+}
+
+// recordAudit 记录二进制上传审计
+func (h *AgentBinaryHandler) recordAudit(r *http.Request, user *models.User, token string, details map[string]interface{}, start time.Time, result string, err error) {
+	entry := &models.AuditLog{
+		Via:        audit.ViaSession,
+		Method:     "agent.uploadBinary",
+		Params:     details,
+		Result:     result,
+		ClientIP:   clientIP(r),
+		UserAgent:  r.UserAgent(),
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	if auth.IsAPIToken(token) {
+		entry.Via = audit.ViaAPIToken
+	}
+	if user != nil {
+		entry.UserID = &user.ID
+		entry.Username = user.Username
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	h.handler.audit.Record(r.Context(), entry)
+}
@@ -0,0 +1,266 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/plumber/plumber/internal/server/agentdist"
+	"github.com/plumber/plumber/internal/server/storage"
+	"github.com/plumber/plumber/pkg/auth"
+	"github.com/plumber/plumber/pkg/models"
+)
+
+// latestVersions 返回服务端托管的各平台二进制版本，键为 os/arch，未记录版本的二进制不包含在内
+func latestVersions(binaries *agentdist.Store) (map[string]string, error) {
+	list, err := binaries.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list agent binaries: %w", err)
+	}
+	versions := make(map[string]string, len(list))
+	for _, binary := range list {
+		if binary.Version != "" {
+			versions[binary.OS+"/"+binary.Arch] = binary.Version
+		}
+	}
+	return versions, nil
+}
+
+// UpgradeAgentMethod 分批将Agent升级到服务端托管的二进制版本，每个Agent需以新版本重新注册，
+// 失败时自动回滚该Agent并停止后续批次
+type UpgradeAgentMethod struct {
+	storage storage.Storage
+	runner  *deployRunner
+}
+
+func NewUpgradeAgentMethod(storage storage.Storage, runner *deployRunner) *UpgradeAgentMethod {
+	return &UpgradeAgentMethod{
+		storage: storage,
+		runner:  runner,
+	}
+}
+
+func (m *UpgradeAgentMethod) Name() string {
+	return "plumber.agent.upgrade"
+}
+
+func (m *UpgradeAgentMethod) Permission() string {
+	return auth.PermAgentDeploy
+}
+
+type UpgradeAgentParams struct {
+	AgentID    string            `json:"agent_id"`
+	AgentIDs   []string          `json:"agent_ids"`
+	Labels     map[string]string `json:"labels"`      // 按标签选择Agent（只选择已配置SSH的Agent）
+	BatchSize  int               `json:"batch_size"`  // 每批升级的Agent数量，默认5
+	InstallDir string            `json:"install_dir"` // 默认 /opt/plumber_agent，Agent记录了部署时的安装目录时以记录为准
+	Force      bool              `json:"force"`       // 版本已是最新时也重新安装
+}
+
+func (m *UpgradeAgentMethod) Execute(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var p UpgradeAgentParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, fmt.Errorf("invalid params: %w", err)
+	}
+
+	job := &models.DeployJob{
+		Kind:        DeployKindUpgrade,
+		InstallDir:  p.InstallDir,
+		Parallelism: p.BatchSize,
+	}
+	if err := m.runner.normalizeJob(job); err != nil {
+		return nil, err
+	}
+
+	agents, err := selectAgents(ctx, m.storage, agentSelection{
+		AgentID:    p.AgentID,
+		AgentIDs:   p.AgentIDs,
+		Labels:     p.Labels,
+		RequireSSH: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	latest, err := latestVersions(m.runner.options.Binaries)
+	if err != nil {
+		return nil, err
+	}
+
+	// 平台未知（旧版本Agent未上报）的Agent在升级时检测平台
+	var upToDate []string
+	targetVersions := make(map[string]bool)
+	for _, agent := range agents {
+		version := latest[agent.OS+"/"+agent.Arch]
+		if !p.Force && version != "" && agent.Version == version {
+			upToDate = append(upToDate, agent.Name)
+			continue
+		}
+		if version != "" {
+			targetVersions[version] = true
+		}
+		job.Targets = append(job.Targets, models.DeployTarget{
+			AgentID:   agent.ID,
+			AgentName: agent.Name,
+			Status:    "pending",
+		})
+	}
+	if len(job.Targets) == 0 {
+		return nil, fmt.Errorf("all selected agents are up to date, use force to reinstall")
+	}
+	// 所有目标平台的版本一致时记录目标版本
+	if len(targetVersions) == 1 {
+		for version := range targetVersions {
+			job.Version = version
+		}
+	}
+
+	if err := createDeployJob(ctx, m.storage, job); err != nil {
+		return nil, err
+	}
+	m.runner.Start(job)
+
+	return map[string]interface{}{
+		"status":     "started",
+		"job_id":     job.ID.String(),
+		"targets":    len(job.Targets),
+		"up_to_date": upToDate,
+	}, nil
+}
+
+// UninstallAgentMethod 通过SSH停止并删除Agent服务和文件，完成后吊销凭据并将Agent标记为已卸载
+type UninstallAgentMethod struct {
+	storage storage.Storage
+	runner  *deployRunner
+}
+
+func NewUninstallAgentMethod(storage storage.Storage, runner *deployRunner) *UninstallAgentMethod {
+	return &UninstallAgentMethod{
+		storage: storage,
+		runner:  runner,
+	}
+}
+
+func (m *UninstallAgentMethod) Name() string {
+	return "plumber.agent.uninstall"
+}
+
+func (m *UninstallAgentMethod) Permission() string {
+	return auth.PermAgentDeploy
+}
+
+type UninstallAgentParams struct {
+	AgentID     string            `json:"agent_id"`
+	AgentIDs    []string          `json:"agent_ids"`
+	Labels      map[string]string `json:"labels"`      // 按标签选择Agent（只选择已配置SSH的Agent）
+	InstallDir  string            `json:"install_dir"` // 默认 /opt/plumber_agent，Agent记录了部署时的安装目录时以记录为准
+	Parallelism int               `json:"parallelism"` // 同时卸载的Agent数量，默认5
+}
+
+func (m *UninstallAgentMethod) Execute(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var p UninstallAgentParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, fmt.Errorf("invalid params: %w", err)
+	}
+
+	job := &models.DeployJob{
+		Kind:        DeployKindUninstall,
+		InstallDir:  p.InstallDir,
+		Parallelism: p.Parallelism,
+	}
+	if err := m.runner.normalizeJob(job); err != nil {
+		return nil, err
+	}
+
+	agents, err := selectAgents(ctx, m.storage, agentSelection{
+		AgentID:    p.AgentID,
+		AgentIDs:   p.AgentIDs,
+		Labels:     p.Labels,
+		RequireSSH: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, agent := range agents {
+		job.Targets = append(job.Targets, models.DeployTarget{
+			AgentID:   agent.ID,
+			AgentName: agent.Name,
+			Status:    "pending",
+		})
+	}
+
+	if err := createDeployJob(ctx, m.storage, job); err != nil {
+		return nil, err
+	}
+	m.runner.Start(job)
+
+	return map[string]interface{}{
+		"status":  "started",
+		"job_id":  job.ID.String(),
+		"targets": len(job.Targets),
+	}, nil
+}
+
+// AgentVersionsMethod 列出Agent上报的版本和对应平台的最新版本，标记需要升级的Agent
+type AgentVersionsMethod struct {
+	storage  storage.Storage
+	binaries *agentdist.Store
+}
+
+func NewAgentVersionsMethod(storage storage.Storage, binaries *agentdist.Store) *AgentVersionsMethod {
+	return &AgentVersionsMethod{
+		storage:  storage,
+		binaries: binaries,
+	}
+}
+
+func (m *AgentVersionsMethod) Name() string {
+	return "plumber.agent.versions"
+}
+
+func (m *AgentVersionsMethod) Permission() string {
+	return auth.PermAgentRead
+}
+
+func (m *AgentVersionsMethod) Execute(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	agents, err := m.storage.ListAgents(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list agents: %w", err)
+	}
+	latest, err := latestVersions(m.binaries)
+	if err != nil {
+		return nil, err
+	}
+
+	scope := userScopeFromContext(ctx)
+	result := make([]map[string]interface{}, 0, len(agents))
+	outdated := 0
+	for _, agent := range agents {
+		if agent.Status == "decommissioned" || !scope.AllowsAgent(agent) {
+			continue
+		}
+		version := latest[agent.OS+"/"+agent.Arch]
+		isOutdated := version != "" && agent.Version != version
+		if isOutdated {
+			outdated++
+		}
+		result = append(result, map[string]interface{}{
+			"agent_id":        agent.ID.String(),
+			"name":            agent.Name,
+			"status":          agent.Status,
+			"version":         agent.Version,
+			"os":              agent.OS,
+			"arch":            agent.Arch,
+			"latest_version":  version,
+			"outdated":        isOutdated,
+			"desired_version": agent.DesiredVersion,
+			"update_status":   agent.UpdateStatus,
+			"update_message":  agent.UpdateMessage,
+		})
+	}
+
+	return map[string]interface{}{
+		"agents":   result,
+		"latest":   latest,
+		"outdated": outdated,
+	}, nil
+}
@@ -0,0 +1,221 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/plumber/plumber/internal/server/agentdist"
+	"github.com/plumber/plumber/internal/server/storage"
+	"github.com/plumber/plumber/pkg/agentupdate"
+	"github.com/plumber/plumber/pkg/auth"
+	"github.com/plumber/plumber/pkg/jsonrpc"
+	"github.com/plumber/plumber/pkg/models"
+)
+
+// desiredVersionLatest 目标版本跟随服务端托管的二进制
+const desiredVersionLatest = "latest"
+
+// selfUpdater 根据Agent的目标版本生成心跳响应中的自更新信息
+type selfUpdater struct {
+	binaries *agentdist.Store
+	signer   *agentdist.Signer
+}
+
+// offer 返回Agent需要安装的版本，不需要更新时返回nil
+func (u *selfUpdater) offer(agent *models.Agent) *agentupdate.Offer {
+	if u.binaries == nil || u.signer == nil || agent.DesiredVersion == "" || agent.OS == "" || agent.Arch == "" {
+		return nil
+	}
+
+	binary, err := u.binaries.Stat(agent.OS, agent.Arch)
+	if err != nil || binary.Version == "" || binary.Version == agent.Version {
+		return nil
+	}
+	if agent.DesiredVersion != desiredVersionLatest && agent.DesiredVersion != binary.Version {
+		return nil
+	}
+	// 该版本已回滚过，等待管理员重新设置目标版本后再尝试
+	if agent.UpdateVersion == binary.Version && agent.UpdateStatus == agentupdate.StatusRolledBack {
+		return nil
+	}
+
+	query := url.Values{"os": {binary.OS}, "arch": {binary.Arch}}
+	return u.signer.Offer(binary, "/api/agent/update?"+query.Encode())
+}
+
+// AgentUpdateHandler 供Agent自更新下载二进制
+// GET /api/agent/update?os=linux&arch=amd64，认证使用Agent令牌或客户端证书
+type AgentUpdateHandler struct {
+	handler  *Handler
+	binaries *agentdist.Store
+}
+
+func NewAgentUpdateHandler(handler *Handler, binaries *agentdist.Store) *AgentUpdateHandler {
+	return &AgentUpdateHandler{
+		handler:  handler,
+		binaries: binaries,
+	}
+}
+
+func (h *AgentUpdateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	agent, err := h.handler.AuthenticateAgent(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	f, binary, err := h.binaries.Open(query.Get("os"), query.Get("arch"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+
+	// 二进制较大，下载时间可能超过服务器默认的写超时
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("X-Checksum-SHA256", binary.SHA256)
+	http.ServeContent(w, r, "plumber-agent", binary.ModTime, f)
+	log.Printf("[AgentUpdate] %s downloaded %s/%s version %q", agent.Name, binary.OS, binary.Arch, binary.Version)
+}
+
+// ReportAgentUpdateMethod Agent上报自更新结果
+type ReportAgentUpdateMethod struct {
+	storage storage.Storage
+}
+
+func NewReportAgentUpdateMethod(storage storage.Storage) *ReportAgentUpdateMethod {
+	return &ReportAgentUpdateMethod{storage: storage}
+}
+
+func (m *ReportAgentUpdateMethod) Name() string {
+	return "plumber.agent.reportUpdate"
+}
+
+func (m *ReportAgentUpdateMethod) Permission() string {
+	return jsonrpc.PermissionAgent
+}
+
+func (m *ReportAgentUpdateMethod) Audit() bool {
+	return true
+}
+
+type ReportAgentUpdateParams struct {
+	FromVersion string `json:"from_version"`
+	Version     string `json:"version"` // 自更新的目标版本
+	Status      string `json:"status"`  // success/failed/rolled_back
+	Message     string `json:"message"`
+}
+
+func (m *ReportAgentUpdateMethod) Execute(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var p ReportAgentUpdateParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, fmt.Errorf("invalid params: %w", err)
+	}
+
+	agentUUID, err := authenticatedAgentID(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	switch p.Status {
+	case agentupdate.StatusSuccess, agentupdate.StatusFailed, agentupdate.StatusRolledBack:
+	default:
+		return nil, fmt.Errorf("invalid status: %s", p.Status)
+	}
+	if len(p.Version) > 50 {
+		return nil, fmt.Errorf("invalid version")
+	}
+
+	if err := m.storage.UpdateAgentSelfUpdate(ctx, agentUUID, p.Version, p.Status, p.Message); err != nil {
+		return nil, fmt.Errorf("failed to record update result: %w", err)
+	}
+
+	return map[string]interface{}{
+		"status": "ok",
+	}, nil
+}
+
+// SetAgentDesiredVersionMethod 设置Agent自更新的目标版本，Agent在下一次心跳时下载并安装
+// 适用于服务端没有SSH凭据的Agent；需要SSH分批升级和回滚时使用 plumber.agent.upgrade
+type SetAgentDesiredVersionMethod struct {
+	storage  storage.Storage
+	binaries *agentdist.Store
+}
+
+func NewSetAgentDesiredVersionMethod(storage storage.Storage, binaries *agentdist.Store) *SetAgentDesiredVersionMethod {
+	return &SetAgentDesiredVersionMethod{
+		storage:  storage,
+		binaries: binaries,
+	}
+}
+
+func (m *SetAgentDesiredVersionMethod) Name() string {
+	return "plumber.agent.setDesiredVersion"
+}
+
+func (m *SetAgentDesiredVersionMethod) Permission() string {
+	return auth.PermAgentDeploy
+}
+
+type SetAgentDesiredVersionParams struct {
+	AgentID  string            `json:"agent_id"`
+	AgentIDs []string          `json:"agent_ids"`
+	Labels   map[string]string `json:"labels"`
+	Version  string            `json:"version"` // 目标版本，latest跟随服务端托管的二进制，为空关闭自更新
+}
+
+func (m *SetAgentDesiredVersionMethod) Execute(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var p SetAgentDesiredVersionParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, fmt.Errorf("invalid params: %w", err)
+	}
+
+	if p.Version != "" && p.Version != desiredVersionLatest {
+		latest, err := latestVersions(m.binaries)
+		if err != nil {
+			return nil, err
+		}
+		hosted := false
+		for _, version := range latest {
+			if version == p.Version {
+				hosted = true
+				break
+			}
+		}
+		if !hosted {
+			return nil, fmt.Errorf("no hosted agent binary has version %s", p.Version)
+		}
+	}
+
+	agents, err := selectAgents(ctx, m.storage, agentSelection{
+		AgentID:  p.AgentID,
+		AgentIDs: p.AgentIDs,
+		Labels:   p.Labels,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, agent := range agents {
+		if err := m.storage.SetAgentDesiredVersion(ctx, agent.ID, p.Version); err != nil {
+			return nil, fmt.Errorf("failed to set desired version for %s: %w", agent.Name, err)
+		}
+	}
+
+	return map[string]interface{}{
+		"status": "updated",
+		"agents": len(agents),
+	}, nil
+}
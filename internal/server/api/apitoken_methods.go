@@ -0,0 +1,222 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/plumber/plumber/internal/server/storage"
+	"github.com/plumber/plumber/pkg/auth"
+	"github.com/plumber/plumber/pkg/models"
+)
+
+const (
+	// apiTokenLength 个人API令牌随机字节数
+	apiTokenLength = 32
+	// apiTokenTouchInterval 更新令牌最近使用时间的最小间隔
+	apiTokenTouchInterval = time.Minute
+)
+
+// CreateAPITokenMethod 为当前用户创建个人API令牌
+type CreateAPITokenMethod struct {
+	storage storage.Storage
+}
+
+func NewCreateAPITokenMethod(storage storage.Storage) *CreateAPITokenMethod {
+	return &CreateAPITokenMethod{storage: storage}
+}
+
+func (m *CreateAPITokenMethod) Name() string {
+	return "plumber.apiToken.create"
+}
+
+func (m *CreateAPITokenMethod) Permission() string {
+	return auth.PermUserSelf
+}
+
+type CreateAPITokenParams struct {
+	Name          string   `json:"name"`
+	ExpiresInDays int      `json:"expires_in_days,omitempty"` // 有效期（天），0表示永不过期
+	Permissions   []string `json:"permissions,omitempty"`     // 权限范围，为空表示继承用户角色的全部权限
+}
+
+func (m *CreateAPITokenMethod) Execute(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var p CreateAPITokenParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, fmt.Errorf("invalid params: %w", err)
+	}
+
+	if p.Name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	if p.ExpiresInDays < 0 {
+		return nil, fmt.Errorf("expires_in_days must not be negative")
+	}
+
+	// 避免泄露的令牌被用来签发新的令牌
+	if _, ok := GetAPITokenFromContext(ctx); ok {
+		return nil, fmt.Errorf("API tokens cannot be created with an API token")
+	}
+
+	user, ok := GetUserFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("user not authenticated")
+	}
+
+	for _, permission := range p.Permissions {
+		if !auth.ValidPermission(permission) {
+			return nil, fmt.Errorf("invalid permission: %s", permission)
+		}
+		if !auth.HasPermission(user.Role, permission) {
+			return nil, fmt.Errorf("your role does not have permission %s", permission)
+		}
+	}
+
+	random, err := auth.GenerateToken(apiTokenLength)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate API token: %w", err)
+	}
+	token := auth.APITokenPrefix + random
+
+	apiToken := &models.APIToken{
+		UserID:      user.ID,
+		Name:        p.Name,
+		Prefix:      token[:len(auth.APITokenPrefix)+8],
+		TokenHash:   auth.HashToken(token),
+		Permissions: p.Permissions,
+	}
+	if p.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, p.ExpiresInDays)
+		apiToken.ExpiresAt = &expiresAt
+	}
+
+	if err := m.storage.CreateAPIToken(ctx, apiToken); err != nil {
+		return nil, fmt.Errorf("failed to create API token: %w", err)
+	}
+
+	return map[string]interface{}{
+		"id":          apiToken.ID.String(),
+		"token":       token,
+		"name":        apiToken.Name,
+		"permissions": apiToken.Permissions,
+		"expires_at":  apiToken.ExpiresAt,
+	}, nil
+}
+
+// ListAPITokensMethod 列出API令牌
+// 默认列出当前用户的令牌，拥有用户管理权限时可通过user_id查看其他用户的令牌
+type ListAPITokensMethod struct {
+	storage storage.Storage
+}
+
+func NewListAPITokensMethod(storage storage.Storage) *ListAPITokensMethod {
+	return &ListAPITokensMethod{storage: storage}
+}
+
+func (m *ListAPITokensMethod) Name() string {
+	return "plumber.apiToken.list"
+}
+
+func (m *ListAPITokensMethod) Permission() string {
+	return auth.PermUserSelf
+}
+
+func (m *ListAPITokensMethod) Audit() bool {
+	return false
+}
+
+type ListAPITokensParams struct {
+	UserID string `json:"user_id,omitempty"`
+}
+
+func (m *ListAPITokensMethod) Execute(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var p ListAPITokensParams
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, fmt.Errorf("invalid params: %w", err)
+		}
+	}
+
+	selfID, err := currentUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	userID := selfID
+	if p.UserID != "" {
+		userID, err = uuid.Parse(p.UserID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid user_id: %w", err)
+		}
+	}
+
+	if userID != selfID && !hasPermission(ctx, auth.PermUserAdmin) {
+		return nil, fmt.Errorf("permission denied: %s required", auth.PermUserAdmin)
+	}
+
+	tokens, err := m.storage.ListAPITokens(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API tokens: %w", err)
+	}
+
+	return map[string]interface{}{
+		"api_tokens": tokens,
+	}, nil
+}
+
+// RevokeAPITokenMethod 吊销API令牌
+// 可以吊销自己的令牌，拥有用户管理权限时可以吊销任意用户的令牌
+type RevokeAPITokenMethod struct {
+	storage storage.Storage
+}
+
+func NewRevokeAPITokenMethod(storage storage.Storage) *RevokeAPITokenMethod {
+	return &RevokeAPITokenMethod{storage: storage}
+}
+
+func (m *RevokeAPITokenMethod) Name() string {
+	return "plumber.apiToken.revoke"
+}
+
+func (m *RevokeAPITokenMethod) Permission() string {
+	return auth.PermUserSelf
+}
+
+type RevokeAPITokenParams struct {
+	ID string `json:"id"`
+}
+
+func (m *RevokeAPITokenMethod) Execute(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var p RevokeAPITokenParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, fmt.Errorf("invalid params: %w", err)
+	}
+
+	id, err := uuid.Parse(p.ID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id: %w", err)
+	}
+
+	selfID, err := currentUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := m.storage.GetAPIToken(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("API token not found")
+	}
+	if token.UserID != selfID && !hasPermission(ctx, auth.PermUserAdmin) {
+		return nil, fmt.Errorf("API token not found")
+	}
+
+	if err := m.storage.RevokeAPIToken(ctx, id); err != nil {
+		return nil, fmt.Errorf("failed to revoke API token: %w", err)
+	}
+
+	return map[string]interface{}{
+		"status": "revoked",
+	}, nil
+}
@@ -0,0 +1,516 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/plumber/plumber/internal/server/artifacts"
+	"github.com/plumber/plumber/internal/server/audit"
+	"github.com/plumber/plumber/internal/server/storage"
+	"github.com/plumber/plumber/pkg/auth"
+	"github.com/plumber/plumber/pkg/models"
+)
+
+// ListArtifactsMethod 列出制品
+type ListArtifactsMethod struct {
+	storage storage.Storage
+}
+
+func NewListArtifactsMethod(storage storage.Storage) *ListArtifactsMethod {
+	return &ListArtifactsMethod{storage: storage}
+}
+
+func (m *ListArtifactsMethod) Name() string {
+	return "plumber.artifact.list"
+}
+
+func (m *ListArtifactsMethod) Permission() string {
+	return auth.PermTaskRead
+}
+
+type ListArtifactsParams struct {
+	ExecutionID string `json:"execution_id,omitempty"`
+	StepName    string `json:"step_name,omitempty"` // 收集制品的步骤名称
+	Name        string `json:"name,omitempty"`
+	Limit       int    `json:"limit,omitempty"` // 默认50，最大500
+	Offset      int    `json:"offset,omitempty"`
+}
+
+func (m *ListArtifactsMethod) Execute(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var p ListArtifactsParams
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, fmt.Errorf("invalid params: %w", err)
+		}
+	}
+
+	filter := storage.ArtifactFilter{
+		StepName: p.StepName,
+		Name:     p.Name,
+		Limit:    p.Limit,
+		Offset:   p.Offset,
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = 50
+	}
+	if filter.Limit > 500 {
+		filter.Limit = 500
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+
+	if p.ExecutionID != "" {
+		executionID, err := uuid.Parse(p.ExecutionID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid execution_id: %w", err)
+		}
+		filter.ExecutionID = &executionID
+	} else if !userScopeFromContext(ctx).IsEmpty() {
+		// 范围受限的用户只能按执行记录查看，执行记录的范围在鉴权时检查
+		return nil, fmt.Errorf("execution_id is required for users with a restricted scope")
+	}
+
+	list, total, err := m.storage.ListArtifacts(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list artifacts: %w", err)
+	}
+
+	return map[string]interface{}{
+		"artifacts": list,
+		"total":     total,
+	}, nil
+}
+
+// GetArtifactMethod 获取制品信息，内容通过 /api/artifacts?id=... 下载
+type GetArtifactMethod struct {
+	storage storage.Storage
+	access  *accessChecker
+}
+
+func NewGetArtifactMethod(storage storage.Storage) *GetArtifactMethod {
+	return &GetArtifactMethod{
+		storage: storage,
+		access:  newAccessChecker(storage),
+	}
+}
+
+func (m *GetArtifactMethod) Name() string {
+	return "plumber.artifact.get"
+}
+
+func (m *GetArtifactMethod) Permission() string {
+	return auth.PermTaskRead
+}
+
+type GetArtifactParams struct {
+	ID string `json:"id"`
+}
+
+func (m *GetArtifactMethod) Execute(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var p GetArtifactParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, fmt.Errorf("invalid params: %w", err)
+	}
+
+	artifact, err := getScopedArtifact(ctx, m.storage, m.access, p.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"artifact": artifact,
+	}, nil
+}
+
+// DeleteArtifactMethod 删除制品及其文件
+type DeleteArtifactMethod struct {
+	storage storage.Storage
+	store   *artifacts.Store
+	access  *accessChecker
+}
+
+func NewDeleteArtifactMethod(storage storage.Storage, store *artifacts.Store) *DeleteArtifactMethod {
+	return &DeleteArtifactMethod{
+		storage: storage,
+		store:   store,
+		access:  newAccessChecker(storage),
+	}
+}
+
+func (m *DeleteArtifactMethod) Name() string {
+	return "plumber.artifact.delete"
+}
+
+func (m *DeleteArtifactMethod) Permission() string {
+	return auth.PermTaskWrite
+}
+
+type DeleteArtifactParams struct {
+	ID string `json:"id"`
+}
+
+func (m *DeleteArtifactMethod) Execute(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var p DeleteArtifactParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, fmt.Errorf("invalid params: %w", err)
+	}
+
+	artifact, err := getScopedArtifact(ctx, m.storage, m.access, p.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.store.Remove(artifact.FilePath); err != nil {
+		return nil, fmt.Errorf("failed to remove artifact file: %w", err)
+	}
+	if err := m.storage.DeleteArtifact(ctx, artifact.ID); err != nil {
+		return nil, fmt.Errorf("failed to delete artifact: %w", err)
+	}
+
+	return map[string]interface{}{
+		"status": "deleted",
+	}, nil
+}
+
+// getScopedArtifact 获取制品，执行记录产生的制品所属任务需在用户范围内
+func getScopedArtifact(ctx context.Context, store storage.Storage, access *accessChecker, id string) (*models.Artifact, error) {
+	artifactID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id: %w", err)
+	}
+	artifact, err := store.GetArtifact(ctx, artifactID)
+	if err != nil {
+		return nil, fmt.Errorf("artifact not found: %w", err)
+	}
+
+	if !access.ArtifactInScope(ctx, userScopeFromContext(ctx), artifact) {
+		return nil, fmt.Errorf("permission denied: artifact belongs to a task outside your scope")
+	}
+	return artifact, nil
+}
+
+// ArtifactHandler 制品上传和下载
+// 用户：POST /api/artifacts?name=xxx 上传（请求体为文件内容），GET /api/artifacts?id=xxx 下载，认证使用 Authorization: Bearer
+// Agent：GET /api/agent/artifacts?step_id=xxx[&artifact_id=xxx] 下载upload步骤或use_artifacts引用的制品，
+// POST /api/agent/artifacts?step_id=xxx[&name=xxx] 上传download步骤或artifacts收集的文件
+type ArtifactHandler struct {
+	handler *Handler
+	storage storage.Storage
+	store   *artifacts.Store
+	maxSize int64
+}
+
+// NewArtifactHandler 创建制品处理器，maxSize为0时不限制大小
+func NewArtifactHandler(handler *Handler, storage storage.Storage, store *artifacts.Store, maxSize int64) *ArtifactHandler {
+	return &ArtifactHandler{
+		handler: handler,
+		storage: storage,
+		store:   store,
+		maxSize: maxSize,
+	}
+}
+
+func (h *ArtifactHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+
+	switch r.Method {
+	case http.MethodOptions:
+		w.WriteHeader(http.StatusOK)
+	case http.MethodPost:
+		h.upload(w, r)
+	case http.MethodGet:
+		h.download(w, r)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// upload 用户上传制品
+func (h *ArtifactHandler) upload(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" {
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	ctx := r.Context()
+	start := time.Now()
+	name := r.URL.Query().Get("name")
+	details := map[string]interface{}{"name": name}
+
+	user, err := h.handler.AuthorizeToken(ctx, token, auth.PermTaskWrite, nil)
+	if err != nil {
+		h.recordAudit(r, user, token, "artifact.upload", "", details, start, audit.ResultDenied, err)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err := artifacts.ValidateName(name); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	artifact := &models.Artifact{
+		Name:     name,
+		UserID:   &user.ID,
+		Username: user.Username,
+	}
+	if status, err := h.save(w, r, artifact); err != nil {
+		h.recordAudit(r, user, token, "artifact.upload", "", details, start, audit.ResultError, err)
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	details["size"] = artifact.Size
+	details["sha256"] = artifact.SHA256
+	h.recordAudit(r, user, token, "artifact.upload", artifact.ID.String(), details, start, audit.ResultSuccess, nil)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(artifact)
+}
+
+// download 用户下载制品，令牌通过Authorization头或token查询参数传递
+func (h *ArtifactHandler) download(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" {
+		token = r.URL.Query().Get("token")
+	}
+	if token == "" {
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	ctx := r.Context()
+	artifactID, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	artifact, err := h.storage.GetArtifact(ctx, artifactID)
+	if err != nil {
+		http.Error(w, "artifact not found", http.StatusNotFound)
+		return
+	}
+
+	// 执行记录产生的制品按所属任务检查范围
+	var params json.RawMessage
+	if artifact.ExecutionID != nil {
+		params, _ = json.Marshal(map[string]string{"execution_id": artifact.ExecutionID.String()})
+	}
+	user, err := h.handler.AuthorizeToken(ctx, token, auth.PermTaskRead, params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	h.recordAudit(r, user, token, "artifact.download", artifact.ID.String(), map[string]interface{}{"name": artifact.Name}, time.Now(), audit.ResultSuccess, nil)
+	h.serve(w, r, artifact)
+}
+
+// ServeAgent 供Agent执行步骤时传输制品，只能访问分配给自己且正在执行的步骤
+func (h *ArtifactHandler) ServeAgent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	agent, err := h.handler.AuthenticateAgent(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	ctx := r.Context()
+	stepID, err := uuid.Parse(r.URL.Query().Get("step_id"))
+	if err != nil {
+		http.Error(w, "invalid step_id", http.StatusBadRequest)
+		return
+	}
+	step, err := h.storage.GetStepExecution(ctx, stepID)
+	if err != nil {
+		http.Error(w, "step not found", http.StatusNotFound)
+		return
+	}
+	if step.AgentID != agent.ID || !step.Assigned || step.Status != "running" {
+		http.Error(w, "step is not running on this agent", http.StatusForbidden)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		artifactID, err := uuid.Parse(r.URL.Query().Get("artifact_id"))
+		if err != nil && step.Type == models.StepTypeUpload {
+			artifactID, err = uuid.Parse(step.Spec.ArtifactID)
+		}
+		if err != nil || !stepUsesArtifact(step, artifactID.String()) {
+			http.Error(w, "artifact is not used by this step", http.StatusForbidden)
+			return
+		}
+		artifact, err := h.storage.GetArtifact(ctx, artifactID)
+		if err != nil {
+			http.Error(w, "artifact not found", http.StatusNotFound)
+			return
+		}
+		h.serve(w, r, artifact)
+		return
+	}
+
+	// download步骤使用步骤中配置的名称，收集制品的步骤由Agent按文件名提交
+	name := step.Spec.Name
+	if step.Type != models.StepTypeDownload {
+		if len(step.Spec.Collect) == 0 {
+			http.Error(w, "step does not collect artifacts", http.StatusBadRequest)
+			return
+		}
+		name = r.URL.Query().Get("name")
+		if err := artifacts.ValidateName(name); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	artifact := &models.Artifact{
+		Name:        name,
+		ExecutionID: &step.ExecutionID,
+		StepID:      &step.ID,
+		StepName:    step.Name,
+		AgentID:     &agent.ID,
+	}
+	if status, err := h.save(w, r, artifact); err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	log.Printf("[Artifact] %s collected %s (%d bytes) for step %s", agent.Name, artifact.Name, artifact.Size, step.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(artifact)
+}
+
+// stepUsesArtifact 制品是否为步骤的upload源或use_artifacts引用的制品
+func stepUsesArtifact(step *models.StepExecution, artifactID string) bool {
+	if step.Type == models.StepTypeUpload && step.Spec.ArtifactID == artifactID {
+		return true
+	}
+	for _, used := range step.Spec.Use {
+		if used.ID == artifactID {
+			return true
+		}
+	}
+	return false
+}
+
+// save 保存请求体为制品文件并创建记录，失败时返回HTTP状态码
+func (h *ArtifactHandler) save(w http.ResponseWriter, r *http.Request, artifact *models.Artifact) (int, error) {
+	// 制品可能较大，上传时间可能超过服务器默认的读写超时
+	rc := http.NewResponseController(w)
+	rc.SetReadDeadline(time.Time{})
+	rc.SetWriteDeadline(time.Time{})
+
+	if h.maxSize > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, h.maxSize)
+	}
+	file, err := h.store.Save(r.Body)
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			return http.StatusRequestEntityTooLarge, err
+		}
+		return http.StatusInternalServerError, err
+	}
+
+	artifact.Size = file.Size
+	artifact.SHA256 = file.SHA256
+	artifact.FilePath = file.Path
+	if err := h.storage.CreateArtifact(r.Context(), artifact); err != nil {
+		h.store.Remove(file.Path)
+		return http.StatusInternalServerError, fmt.Errorf("failed to create artifact: %w", err)
+	}
+	return http.StatusOK, nil
+}
+
+// serve 发送制品内容，响应头携带SHA-256供客户端校验
+func (h *ArtifactHandler) serve(w http.ResponseWriter, r *http.Request, artifact *models.Artifact) {
+	f, err := h.store.Open(artifact.FilePath)
+	if err != nil {
+		http.Error(w, "artifact file not available", http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", artifact.Name))
+	w.Header().Set("X-Checksum-SHA256", artifact.SHA256)
+	http.ServeContent(w, r, "", artifact.CreatedAt, f)
+}
+
+// StartRetention 定期删除超过保留期的制品，retention为0表示永久保留
+func (h *ArtifactHandler) StartRetention(retention time.Duration) {
+	if retention <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		h.purge(time.Now().Add(-retention))
+		<-ticker.C
+	}
+}
+
+func (h *ArtifactHandler) purge(before time.Time) {
+	ctx := context.Background()
+	list, err := h.storage.ListArtifactsBefore(ctx, before)
+	if err != nil {
+		log.Printf("Failed to list expired artifacts: %v", err)
+		return
+	}
+
+	for _, artifact := range list {
+		if err := h.store.Remove(artifact.FilePath); err != nil {
+			log.Printf("Failed to remove artifact %s: %v", artifact.FilePath, err)
+			continue
+		}
+		if err := h.storage.DeleteArtifact(ctx, artifact.ID); err != nil {
+			log.Printf("Failed to delete artifact %s: %v", artifact.ID, err)
+		}
+	}
+
+	if len(list) > 0 {
+		log.Printf("Removed %d expired artifacts", len(list))
+	}
+}
+
+// recordAudit 记录制品上传和下载审计
+func (h *ArtifactHandler) recordAudit(r *http.Request, user *models.User, token, method, targetID string, details map[string]interface{}, start time.Time, result string, err error) {
+	entry := &models.AuditLog{
+		Via:        audit.ViaSession,
+		Method:     method,
+		TargetID:   targetID,
+		Params:     details,
+		Result:     result,
+		ClientIP:   clientIP(r),
+		UserAgent:  r.UserAgent(),
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	if auth.IsAPIToken(token) {
+		entry.Via = audit.ViaAPIToken
+	}
+	if user != nil {
+		entry.UserID = &user.ID
+		entry.Username = user.Username
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	h.handler.audit.Record(r.Context(), entry)
+}
@@ -0,0 +1,247 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/plumber/plumber/internal/server/audit"
+	"github.com/plumber/plumber/internal/server/storage"
+	"github.com/plumber/plumber/pkg/auth"
+	"github.com/plumber/plumber/pkg/jsonrpc"
+	"github.com/plumber/plumber/pkg/models"
+)
+
+// auditable 可选接口，方法可以覆盖是否写入审计日志的默认判断
+type auditable interface {
+	Audit() bool
+}
+
+// shouldAudit 是否为需要审计的操作
+// 默认只读权限和Agent的常规上报（心跳、拉取任务、步骤上报）不审计
+func shouldAudit(method jsonrpc.Method) bool {
+	if a, ok := method.(auditable); ok {
+		return a.Audit()
+	}
+	switch method.Permission() {
+	case auth.PermAgentRead, auth.PermTaskRead, jsonrpc.PermissionAgent:
+		return false
+	}
+	return true
+}
+
+// auditTarget 从参数和结果中提取的目标资源ID
+type auditTarget struct {
+	TaskID      string `json:"task_id"`
+	AgentID     string `json:"agent_id"`
+	ExecutionID string `json:"execution_id"`
+	UserID      string `json:"user_id"`
+	ID          string `json:"id"`
+}
+
+// auditDenied 记录认证或授权失败的操作
+func (h *Handler) auditDenied(ctx context.Context, method jsonrpc.Method, req *jsonrpc.Request, start time.Time, reason string) {
+	if !shouldAudit(method) {
+		return
+	}
+	entry := newAuditEntry(ctx, method, req, start)
+	entry.Result = audit.ResultDenied
+	entry.Error = reason
+	h.audit.Record(ctx, entry)
+}
+
+// auditResponse 记录方法执行结果
+func (h *Handler) auditResponse(ctx context.Context, method jsonrpc.Method, req *jsonrpc.Request, start time.Time, response *jsonrpc.Response) {
+	if !shouldAudit(method) {
+		return
+	}
+	entry := newAuditEntry(ctx, method, req, start)
+	if response.Error != nil {
+		entry.Result = audit.ResultError
+		entry.Error = response.Error.Message
+	} else {
+		entry.Result = audit.ResultSuccess
+		applyAuditResult(entry, response.Result)
+	}
+	h.audit.Record(ctx, entry)
+}
+
+func newAuditEntry(ctx context.Context, method jsonrpc.Method, req *jsonrpc.Request, start time.Time) *models.AuditLog {
+	ip, userAgent := GetClientInfoFromContext(ctx)
+	entry := &models.AuditLog{
+		Method:     req.Method,
+		Params:     audit.SanitizeParams(req.Params),
+		ClientIP:   ip,
+		UserAgent:  userAgent,
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+
+	switch method.Permission() {
+	case jsonrpc.PermissionPublic:
+		entry.Via = audit.ViaPublic
+	case jsonrpc.PermissionAgent:
+		entry.Via = audit.ViaAgent
+	default:
+		entry.Via = audit.ViaSession
+		if _, ok := GetAPITokenFromContext(ctx); ok {
+			entry.Via = audit.ViaAPIToken
+		}
+	}
+
+	if user, ok := GetUserFromContext(ctx); ok {
+		entry.UserID = &user.ID
+		entry.Username = user.Username
+	}
+	if agentID, ok := GetAgentIDFromContext(ctx); ok {
+		entry.AgentID = agentID.String()
+	}
+
+	var target auditTarget
+	if len(req.Params) > 0 && json.Unmarshal(req.Params, &target) == nil {
+		applyAuditTarget(entry, target)
+	}
+
+	return entry
+}
+
+// applyAuditResult 从结果中补充新创建的资源ID，公开方法（登录）从结果中补充调用者
+func applyAuditResult(entry *models.AuditLog, result interface{}) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return
+	}
+
+	var target auditTarget
+	if json.Unmarshal(data, &target) != nil {
+		return
+	}
+
+	if entry.Via == audit.ViaPublic && entry.UserID == nil {
+		if userID, err := uuid.Parse(target.UserID); err == nil {
+			entry.UserID = &userID
+			var login struct {
+				Username string `json:"username"`
+			}
+			json.Unmarshal(data, &login)
+			entry.Username = login.Username
+			target.UserID = ""
+		}
+	}
+
+	applyAuditTarget(entry, target)
+}
+
+func applyAuditTarget(entry *models.AuditLog, target auditTarget) {
+	if entry.TaskID == "" {
+		entry.TaskID = target.TaskID
+	}
+	if entry.AgentID == "" {
+		entry.AgentID = target.AgentID
+	}
+	if entry.ExecutionID == "" {
+		entry.ExecutionID = target.ExecutionID
+	}
+	if entry.TargetID == "" {
+		if target.UserID != "" {
+			entry.TargetID = target.UserID
+		} else {
+			entry.TargetID = target.ID
+		}
+	}
+}
+
+// ListAuditLogsMethod 查询审计日志
+type ListAuditLogsMethod struct {
+	storage storage.Storage
+}
+
+func NewListAuditLogsMethod(storage storage.Storage) *ListAuditLogsMethod {
+	return &ListAuditLogsMethod{storage: storage}
+}
+
+func (m *ListAuditLogsMethod) Name() string {
+	return "plumber.audit.list"
+}
+
+func (m *ListAuditLogsMethod) Permission() string {
+	return auth.PermAuditRead
+}
+
+func (m *ListAuditLogsMethod) Audit() bool {
+	return false
+}
+
+type ListAuditLogsParams struct {
+	UserID   string `json:"user_id,omitempty"`
+	Username string `json:"username,omitempty"`
+	Method   string `json:"method,omitempty"` // 方法名前缀
+	TaskID   string `json:"task_id,omitempty"`
+	AgentID  string `json:"agent_id,omitempty"`
+	Result   string `json:"result,omitempty"` // success/error/denied
+	Since    string `json:"since,omitempty"`  // RFC3339
+	Until    string `json:"until,omitempty"`  // RFC3339
+	Limit    int    `json:"limit,omitempty"`  // 默认100，最大1000
+	Offset   int    `json:"offset,omitempty"`
+}
+
+func (m *ListAuditLogsMethod) Execute(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var p ListAuditLogsParams
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, fmt.Errorf("invalid params: %w", err)
+		}
+	}
+
+	filter := storage.AuditLogFilter{
+		Username: p.Username,
+		Method:   p.Method,
+		TaskID:   p.TaskID,
+		AgentID:  p.AgentID,
+		Result:   p.Result,
+		Limit:    p.Limit,
+		Offset:   p.Offset,
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = 100
+	}
+	if filter.Limit > 1000 {
+		filter.Limit = 1000
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+
+	if p.UserID != "" {
+		userID, err := uuid.Parse(p.UserID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid user_id: %w", err)
+		}
+		filter.UserID = &userID
+	}
+	if p.Since != "" {
+		since, err := time.Parse(time.RFC3339, p.Since)
+		if err != nil {
+			return nil, fmt.Errorf("invalid since: %w", err)
+		}
+		filter.Since = &since
+	}
+	if p.Until != "" {
+		until, err := time.Parse(time.RFC3339, p.Until)
+		if err != nil {
+			return nil, fmt.Errorf("invalid until: %w", err)
+		}
+		filter.Until = &until
+	}
+
+	entries, total, err := m.storage.ListAuditLogs(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit logs: %w", err)
+	}
+
+	return map[string]interface{}{
+		"entries": entries,
+		"total":   total,
+	}, nil
+}
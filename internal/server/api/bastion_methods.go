@@ -0,0 +1,399 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/plumber/plumber/internal/server/secrets"
+	"github.com/plumber/plumber/internal/server/sshdial"
+	"github.com/plumber/plumber/internal/server/storage"
+	"github.com/plumber/plumber/pkg/auth"
+	"github.com/plumber/plumber/pkg/models"
+)
+
+// CreateBastionMethod 创建SSH跳板机
+type CreateBastionMethod struct {
+	storage storage.Storage
+	keyring *secrets.Keyring
+}
+
+func NewCreateBastionMethod(storage storage.Storage, keyring *secrets.Keyring) *CreateBastionMethod {
+	return &CreateBastionMethod{
+		storage: storage,
+		keyring: keyring,
+	}
+}
+
+func (m *CreateBastionMethod) Name() string {
+	return "plumber.bastion.create"
+}
+
+func (m *CreateBastionMethod) Permission() string {
+	return auth.PermAgentWrite
+}
+
+type CreateBastionParams struct {
+	Name          string `json:"name"`
+	Host          string `json:"host"`
+	Port          int    `json:"port,omitempty"`
+	User          string `json:"user"`
+	AuthType      string `json:"auth_type"` // password/key
+	Password      string `json:"password,omitempty"`
+	PrivateKey    string `json:"private_key,omitempty"`
+	JumpBastionID string `json:"jump_bastion_id,omitempty"` // 经由的上一级跳板机（多级跳转）
+	Description   string `json:"description,omitempty"`
+}
+
+func (m *CreateBastionMethod) Execute(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var p CreateBastionParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, fmt.Errorf("invalid params: %w", err)
+	}
+
+	if p.Name == "" || p.Host == "" || p.User == "" {
+		return nil, fmt.Errorf("name, host and user are required")
+	}
+	if p.AuthType != "password" && p.AuthType != "key" {
+		return nil, fmt.Errorf("auth_type must be 'password' or 'key'")
+	}
+	if p.Port == 0 {
+		p.Port = 22
+	}
+
+	bastion := &models.Bastion{
+		ID:          uuid.New(),
+		Name:        p.Name,
+		Host:        p.Host,
+		Port:        p.Port,
+		User:        p.User,
+		AuthType:    p.AuthType,
+		Description: p.Description,
+	}
+
+	jumpID, err := parseBastionID(ctx, m.storage, p.JumpBastionID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkBastionChain(ctx, m.storage, bastion.ID, jumpID); err != nil {
+		return nil, err
+	}
+	bastion.JumpID = jumpID
+
+	bastion.Password, bastion.PrivateKey, err = sealCredentials(m.keyring, p.AuthType, p.Password, p.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	if bastion.Password == "" && bastion.PrivateKey == "" {
+		return nil, fmt.Errorf("credentials are required for %s authentication", p.AuthType)
+	}
+
+	if err := m.storage.CreateBastion(ctx, bastion); err != nil {
+		return nil, fmt.Errorf("failed to create bastion: %w", err)
+	}
+
+	return map[string]interface{}{
+		"bastion_id": bastion.ID.String(),
+		"name":       bastion.Name,
+		"status":     "created",
+	}, nil
+}
+
+// ListBastionsMethod 列出SSH跳板机
+type ListBastionsMethod struct {
+	storage storage.Storage
+}
+
+func NewListBastionsMethod(storage storage.Storage) *ListBastionsMethod {
+	return &ListBastionsMethod{storage: storage}
+}
+
+func (m *ListBastionsMethod) Name() string {
+	return "plumber.bastion.list"
+}
+
+func (m *ListBastionsMethod) Permission() string {
+	return auth.PermAgentRead
+}
+
+func (m *ListBastionsMethod) Execute(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	bastions, err := m.storage.ListBastions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list bastions: %w", err)
+	}
+
+	return map[string]interface{}{
+		"bastions": bastions,
+	}, nil
+}
+
+// UpdateBastionMethod 更新SSH跳板机
+type UpdateBastionMethod struct {
+	storage storage.Storage
+	keyring *secrets.Keyring
+}
+
+func NewUpdateBastionMethod(storage storage.Storage, keyring *secrets.Keyring) *UpdateBastionMethod {
+	return &UpdateBastionMethod{
+		storage: storage,
+		keyring: keyring,
+	}
+}
+
+func (m *UpdateBastionMethod) Name() string {
+	return "plumber.bastion.update"
+}
+
+func (m *UpdateBastionMethod) Permission() string {
+	return auth.PermAgentWrite
+}
+
+type UpdateBastionParams struct {
+	BastionID     string  `json:"bastion_id"`
+	Name          string  `json:"name,omitempty"`
+	Host          string  `json:"host,omitempty"`
+	Port          int     `json:"port,omitempty"`
+	User          string  `json:"user,omitempty"`
+	AuthType      string  `json:"auth_type,omitempty"`
+	Password      string  `json:"password,omitempty"`        // 为空时保留原凭据（认证类型不变时）
+	PrivateKey    string  `json:"private_key,omitempty"`     // 为空时保留原凭据（认证类型不变时）
+	JumpBastionID *string `json:"jump_bastion_id,omitempty"` // 为nil时保持不变，空字符串表示直连
+	Description   *string `json:"description,omitempty"`
+}
+
+func (m *UpdateBastionMethod) Execute(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var p UpdateBastionParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, fmt.Errorf("invalid params: %w", err)
+	}
+
+	bastionUUID, err := uuid.Parse(p.BastionID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bastion_id: %w", err)
+	}
+
+	bastion, err := m.storage.GetBastion(ctx, bastionUUID)
+	if err != nil {
+		return nil, fmt.Errorf("bastion not found: %w", err)
+	}
+
+	host, port := bastion.Host, bastion.Port
+	if p.Name != "" {
+		bastion.Name = p.Name
+	}
+	if p.Host != "" {
+		bastion.Host = p.Host
+	}
+	if p.Port != 0 {
+		bastion.Port = p.Port
+	}
+	if p.User != "" {
+		bastion.User = p.User
+	}
+	if p.Description != nil {
+		bastion.Description = *p.Description
+	}
+
+	jumpID := bastion.JumpID
+	if p.JumpBastionID != nil {
+		if jumpID, err = parseBastionID(ctx, m.storage, *p.JumpBastionID); err != nil {
+			return nil, err
+		}
+		if err := checkBastionChain(ctx, m.storage, bastion.ID, jumpID); err != nil {
+			return nil, err
+		}
+	}
+	// 地址或上一跳变更后原来固定的主机公钥不再适用
+	if bastion.Host != host || bastion.Port != port || !sameUUID(bastion.JumpID, jumpID) {
+		bastion.HostKey = ""
+		bastion.HostKeyFP = ""
+		bastion.HostKeyAt = nil
+	}
+	bastion.JumpID = jumpID
+
+	password, privateKey := p.Password, p.PrivateKey
+	if p.AuthType == "" || p.AuthType == bastion.AuthType {
+		if password == "" {
+			password = bastion.Password
+		}
+		if privateKey == "" {
+			privateKey = bastion.PrivateKey
+		}
+	} else if p.AuthType != "password" && p.AuthType != "key" {
+		return nil, fmt.Errorf("auth_type must be 'password' or 'key'")
+	} else {
+		bastion.AuthType = p.AuthType
+	}
+	bastion.Password, bastion.PrivateKey, err = sealCredentials(m.keyring, bastion.AuthType, password, privateKey)
+	if err != nil {
+		return nil, err
+	}
+	if bastion.Password == "" && bastion.PrivateKey == "" {
+		return nil, fmt.Errorf("credentials are required for %s authentication", bastion.AuthType)
+	}
+
+	if err := m.storage.UpdateBastion(ctx, bastion); err != nil {
+		return nil, fmt.Errorf("failed to update bastion: %w", err)
+	}
+
+	return map[string]interface{}{
+		"status":  "updated",
+		"message": "Bastion updated successfully",
+	}, nil
+}
+
+// DeleteBastionMethod 删除SSH跳板机，仍被Agent或其他跳板机引用时拒绝删除
+type DeleteBastionMethod struct {
+	storage storage.Storage
+}
+
+func NewDeleteBastionMethod(storage storage.Storage) *DeleteBastionMethod {
+	return &DeleteBastionMethod{storage: storage}
+}
+
+func (m *DeleteBastionMethod) Name() string {
+	return "plumber.bastion.delete"
+}
+
+func (m *DeleteBastionMethod) Permission() string {
+	return auth.PermAgentWrite
+}
+
+type DeleteBastionParams struct {
+	BastionID string `json:"bastion_id"`
+}
+
+func (m *DeleteBastionMethod) Execute(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var p DeleteBastionParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, fmt.Errorf("invalid params: %w", err)
+	}
+
+	bastionUUID, err := uuid.Parse(p.BastionID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bastion_id: %w", err)
+	}
+
+	if _, err := m.storage.GetBastion(ctx, bastionUUID); err != nil {
+		return nil, fmt.Errorf("bastion not found: %w", err)
+	}
+
+	refs, err := m.storage.CountBastionReferences(ctx, bastionUUID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check bastion references: %w", err)
+	}
+	if refs > 0 {
+		return nil, fmt.Errorf("bastion is still used by %d agent(s) or bastion(s)", refs)
+	}
+
+	if err := m.storage.DeleteBastion(ctx, bastionUUID); err != nil {
+		return nil, fmt.Errorf("failed to delete bastion: %w", err)
+	}
+
+	return map[string]interface{}{
+		"status":  "deleted",
+		"message": "Bastion deleted successfully",
+	}, nil
+}
+
+// ResetBastionHostKeyMethod 重置跳板机固定的SSH主机公钥
+// 不传host_key时清除固定的公钥，下次连接按策略重新信任；传入时直接固定为该公钥
+type ResetBastionHostKeyMethod struct {
+	storage storage.Storage
+}
+
+func NewResetBastionHostKeyMethod(storage storage.Storage) *ResetBastionHostKeyMethod {
+	return &ResetBastionHostKeyMethod{storage: storage}
+}
+
+func (m *ResetBastionHostKeyMethod) Name() string {
+	return "plumber.bastion.resetHostKey"
+}
+
+func (m *ResetBastionHostKeyMethod) Permission() string {
+	return auth.PermAgentWrite
+}
+
+type ResetBastionHostKeyParams struct {
+	BastionID string `json:"bastion_id"`
+	HostKey   string `json:"host_key"` // 可选，authorized_keys或known_hosts格式
+}
+
+func (m *ResetBastionHostKeyMethod) Execute(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var p ResetBastionHostKeyParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, fmt.Errorf("invalid params: %w", err)
+	}
+
+	bastionUUID, err := uuid.Parse(p.BastionID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bastion_id: %w", err)
+	}
+
+	bastion, err := m.storage.GetBastion(ctx, bastionUUID)
+	if err != nil {
+		return nil, fmt.Errorf("bastion not found: %w", err)
+	}
+
+	hostKey, fingerprint := "", ""
+	if p.HostKey != "" {
+		key, err := sshdial.ParseHostKey(p.HostKey)
+		if err != nil {
+			return nil, err
+		}
+		hostKey, fingerprint = sshdial.MarshalHostKey(key), sshdial.Fingerprint(key)
+	}
+
+	if err := m.storage.UpdateBastionHostKey(ctx, bastion.ID, hostKey, fingerprint); err != nil {
+		return nil, fmt.Errorf("failed to update host key: %w", err)
+	}
+
+	return map[string]interface{}{
+		"bastion_id":           bastion.ID.String(),
+		"previous_fingerprint": bastion.HostKeyFP,
+		"fingerprint":          fingerprint,
+		"pinned":               hostKey != "",
+	}, nil
+}
+
+// parseBastionID 解析并校验跳板机ID，空字符串表示不使用跳板机
+func parseBastionID(ctx context.Context, storage storage.Storage, raw string) (*uuid.UUID, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	id, err := uuid.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bastion id: %w", err)
+	}
+	if _, err := storage.GetBastion(ctx, id); err != nil {
+		return nil, fmt.Errorf("bastion not found: %w", err)
+	}
+	return &id, nil
+}
+
+// checkBastionChain 校验跳板机的上一跳链路不成环且不超过最大跳数
+func checkBastionChain(ctx context.Context, storage storage.Storage, bastionID uuid.UUID, jumpID *uuid.UUID) error {
+	hops := 1
+	for id := jumpID; id != nil; hops++ {
+		if *id == bastionID {
+			return fmt.Errorf("bastion chain would contain a loop")
+		}
+		if hops >= sshdial.MaxHops {
+			return fmt.Errorf("bastion chain exceeds %d hops", sshdial.MaxHops)
+		}
+		jump, err := storage.GetBastion(ctx, *id)
+		if err != nil {
+			return fmt.Errorf("bastion %s not found: %w", id, err)
+		}
+		id = jump.JumpID
+	}
+	return nil
+}
+
+func sameUUID(a, b *uuid.UUID) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -0,0 +1,442 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/plumber/plumber/internal/server/storage"
+	"github.com/plumber/plumber/pkg/auth"
+	"github.com/plumber/plumber/pkg/models"
+)
+
+// DeployAgentMethod 创建部署任务，后台部署一个或多个Agent，通过 plumber.deploy.get 查询进度
+type DeployAgentMethod struct {
+	storage storage.Storage
+	runner  *deployRunner
+}
+
+func NewDeployAgentMethod(storage storage.Storage, runner *deployRunner) *DeployAgentMethod {
+	return &DeployAgentMethod{
+		storage: storage,
+		runner:  runner,
+	}
+}
+
+func (m *DeployAgentMethod) Name() string {
+	return "plumber.agent.deploy"
+}
+
+func (m *DeployAgentMethod) Permission() string {
+	return auth.PermAgentDeploy
+}
+
+type DeployAgentParams struct {
+	AgentID     string            `json:"agent_id"`
+	AgentIDs    []string          `json:"agent_ids"`   // 批量部署
+	Labels      map[string]string `json:"labels"`      // 按标签选择Agent（只选择已配置SSH的Agent）
+	Method      string            `json:"method"`      // offline/script，留空时提供了script_url则为script，否则为offline
+	ScriptURL   string            `json:"script_url"`  // script方式使用的安装脚本
+	InstallDir  string            `json:"install_dir"` // 默认 /opt/plumber_agent
+	Parallelism int               `json:"parallelism"` // 同时部署的Agent数量，默认5
+}
+
+func (m *DeployAgentMethod) Execute(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var p DeployAgentParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, fmt.Errorf("invalid params: %w", err)
+	}
+
+	job := &models.DeployJob{
+		Method:      p.Method,
+		ScriptURL:   p.ScriptURL,
+		InstallDir:  p.InstallDir,
+		Parallelism: p.Parallelism,
+	}
+	if err := m.runner.normalizeJob(job); err != nil {
+		return nil, err
+	}
+
+	agents, err := selectAgents(ctx, m.storage, agentSelection{
+		AgentID:               p.AgentID,
+		AgentIDs:              p.AgentIDs,
+		Labels:                p.Labels,
+		RequireSSH:            true,
+		IncludeDecommissioned: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, agent := range agents {
+		job.Targets = append(job.Targets, models.DeployTarget{
+			AgentID:   agent.ID,
+			AgentName: agent.Name,
+			Status:    "pending",
+		})
+	}
+
+	if err := createDeployJob(ctx, m.storage, job); err != nil {
+		return nil, err
+	}
+	m.runner.Start(job)
+
+	return map[string]interface{}{
+		"status":  "started",
+		"job_id":  job.ID.String(),
+		"targets": len(job.Targets),
+	}, nil
+}
+
+// agentSelection 批量操作选择Agent的条件
+type agentSelection struct {
+	AgentID               string
+	AgentIDs              []string
+	Labels                map[string]string // 按标签选择，只选择当前用户范围内的Agent
+	RequireSSH            bool              // 只能选择已配置SSH的Agent，按标签选择时跳过未配置的
+	IncludeDecommissioned bool              // 允许选择已卸载的Agent，否则明确指定时报错，按标签选择时跳过
+}
+
+// selectAgents 合并 agent_id、agent_ids 和 labels 选中的Agent并去重
+func selectAgents(ctx context.Context, store storage.Storage, sel agentSelection) ([]*models.Agent, error) {
+	ids := sel.AgentIDs
+	if sel.AgentID != "" {
+		ids = append([]string{sel.AgentID}, ids...)
+	}
+
+	seen := make(map[uuid.UUID]bool)
+	var agents []*models.Agent
+	for _, id := range ids {
+		agentUUID, err := uuid.Parse(id)
+		if err != nil {
+			return nil, fmt.Errorf("invalid agent_id: %w", err)
+		}
+		if seen[agentUUID] {
+			continue
+		}
+		agent, err := store.GetAgent(ctx, agentUUID)
+		if err != nil {
+			return nil, fmt.Errorf("agent %s not found: %w", id, err)
+		}
+		if sel.RequireSSH && agent.SSHHost == "" {
+			return nil, fmt.Errorf("agent %s has no SSH configuration", agent.Name)
+		}
+		if !sel.IncludeDecommissioned && agent.Status == "decommissioned" {
+			return nil, fmt.Errorf("agent %s has been decommissioned", agent.Name)
+		}
+		seen[agentUUID] = true
+		agents = append(agents, agent)
+	}
+
+	if len(sel.Labels) > 0 {
+		all, err := store.ListAgents(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list agents: %w", err)
+		}
+		selector := models.UserScope{AgentLabels: sel.Labels}
+		scope := userScopeFromContext(ctx)
+		for _, agent := range all {
+			if seen[agent.ID] || !selector.AllowsAgent(agent) || !scope.AllowsAgent(agent) {
+				continue
+			}
+			if sel.RequireSSH && agent.SSHHost == "" || !sel.IncludeDecommissioned && agent.Status == "decommissioned" {
+				continue
+			}
+			seen[agent.ID] = true
+			agents = append(agents, agent)
+		}
+	}
+
+	if len(agents) == 0 {
+		return nil, fmt.Errorf("no agents selected, specify agent_id, agent_ids or labels")
+	}
+	return agents, nil
+}
+
+// normalizeJob 补全任务类型、部署方式、安装目录和并发数的默认值并校验
+func (r *deployRunner) normalizeJob(job *models.DeployJob) error {
+	switch job.Kind {
+	case "", DeployKindDeploy:
+		job.Kind = DeployKindDeploy
+		if err := normalizeDeployMethod(job); err != nil {
+			return err
+		}
+	case DeployKindUpgrade:
+		// 升级只推送服务端托管的二进制
+		job.Method = DeployMethodOffline
+		job.ScriptURL = ""
+	case DeployKindUninstall:
+		job.Method = ""
+		job.ScriptURL = ""
+	default:
+		return fmt.Errorf("invalid kind: %s", job.Kind)
+	}
+
+	if job.InstallDir == "" {
+		job.InstallDir = defaultInstallDir
+	}
+	if !validInstallDir(job.InstallDir) {
+		return fmt.Errorf("install_dir must be a clean absolute path without spaces, special characters or .. segments")
+	}
+
+	if job.Parallelism <= 0 {
+		job.Parallelism = defaultDeployParallelism
+	}
+	if r.options.MaxParallelism > 0 && job.Parallelism > r.options.MaxParallelism {
+		job.Parallelism = r.options.MaxParallelism
+	}
+	return nil
+}
+
+// normalizeDeployMethod 补全部署方式并校验安装脚本地址
+func normalizeDeployMethod(job *models.DeployJob) error {
+	if job.Method == "" {
+		job.Method = DeployMethodOffline
+		if job.ScriptURL != "" {
+			job.Method = DeployMethodScript
+		}
+	}
+	switch job.Method {
+	case DeployMethodOffline:
+		job.ScriptURL = ""
+	case DeployMethodScript:
+		if job.ScriptURL == "" {
+			return fmt.Errorf("script_url is required for script deployment")
+		}
+		// 脚本地址会拼接到远程shell命令中
+		if !strings.HasPrefix(job.ScriptURL, "http://") && !strings.HasPrefix(job.ScriptURL, "https://") ||
+			strings.ContainsAny(job.ScriptURL, "\"'`$\\ \n") {
+			return fmt.Errorf("invalid script_url")
+		}
+	default:
+		return fmt.Errorf("invalid method: %s", job.Method)
+	}
+	return nil
+}
+
+// createDeployJob 保存部署任务，记录发起人
+func createDeployJob(ctx context.Context, store storage.Storage, job *models.DeployJob) error {
+	job.Status = "pending"
+	if user, ok := GetUserFromContext(ctx); ok {
+		job.UserID = &user.ID
+		job.Username = user.Username
+	}
+	if err := store.CreateDeployJob(ctx, job); err != nil {
+		return fmt.Errorf("failed to create deploy job: %w", err)
+	}
+	return nil
+}
+
+// GetDeployJobMethod 查询部署任务及每个Agent的阶段、输出和结果
+type GetDeployJobMethod struct {
+	storage storage.Storage
+}
+
+func NewGetDeployJobMethod(storage storage.Storage) *GetDeployJobMethod {
+	return &GetDeployJobMethod{storage: storage}
+}
+
+func (m *GetDeployJobMethod) Name() string {
+	return "plumber.deploy.get"
+}
+
+func (m *GetDeployJobMethod) Permission() string {
+	return auth.PermAgentRead
+}
+
+type GetDeployJobParams struct {
+	JobID string `json:"job_id"`
+}
+
+func (m *GetDeployJobMethod) Execute(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var p GetDeployJobParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, fmt.Errorf("invalid params: %w", err)
+	}
+
+	jobUUID, err := uuid.Parse(p.JobID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid job_id: %w", err)
+	}
+
+	job, err := m.storage.GetDeployJob(ctx, jobUUID)
+	if err != nil {
+		return nil, fmt.Errorf("deploy job not found: %w", err)
+	}
+
+	return map[string]interface{}{
+		"job": job,
+	}, nil
+}
+
+// ListDeployJobsMethod 查询部署历史，按创建时间倒序
+type ListDeployJobsMethod struct {
+	storage storage.Storage
+	access  *accessChecker
+}
+
+func NewListDeployJobsMethod(storage storage.Storage) *ListDeployJobsMethod {
+	return &ListDeployJobsMethod{
+		storage: storage,
+		access:  newAccessChecker(storage),
+	}
+}
+
+func (m *ListDeployJobsMethod) Name() string {
+	return "plumber.deploy.list"
+}
+
+func (m *ListDeployJobsMethod) Permission() string {
+	return auth.PermAgentRead
+}
+
+type ListDeployJobsParams struct {
+	AgentID string `json:"agent_id"`
+	Status  string `json:"status"`
+	Limit   int    `json:"limit"`
+	Offset  int    `json:"offset"`
+}
+
+func (m *ListDeployJobsMethod) Execute(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var p ListDeployJobsParams
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, fmt.Errorf("invalid params: %w", err)
+		}
+	}
+
+	filter := storage.DeployJobFilter{
+		Status: p.Status,
+		Limit:  p.Limit,
+		Offset: p.Offset,
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = 50
+	}
+	if filter.Limit > 500 {
+		filter.Limit = 500
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+	if p.AgentID != "" {
+		agentID, err := uuid.Parse(p.AgentID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid agent_id: %w", err)
+		}
+		filter.AgentID = &agentID
+	}
+
+	jobs, total, err := m.storage.ListDeployJobs(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deploy jobs: %w", err)
+	}
+
+	// 有范围限制的用户只能看到全部目标都在范围内的任务
+	if scope := userScopeFromContext(ctx); !scope.IsEmpty() {
+		visible := jobs[:0]
+		for _, job := range jobs {
+			if m.access.DeployJobInScope(ctx, scope, job) {
+				visible = append(visible, job)
+			}
+		}
+		jobs = visible
+	}
+
+	return map[string]interface{}{
+		"jobs":  jobs,
+		"total": total,
+	}, nil
+}
+
+// RetryDeployJobMethod 重新执行已结束任务中失败或被跳过的Agent，生成同类型的新任务
+type RetryDeployJobMethod struct {
+	storage storage.Storage
+	runner  *deployRunner
+}
+
+func NewRetryDeployJobMethod(storage storage.Storage, runner *deployRunner) *RetryDeployJobMethod {
+	return &RetryDeployJobMethod{
+		storage: storage,
+		runner:  runner,
+	}
+}
+
+func (m *RetryDeployJobMethod) Name() string {
+	return "plumber.deploy.retry"
+}
+
+func (m *RetryDeployJobMethod) Permission() string {
+	return auth.PermAgentDeploy
+}
+
+type RetryDeployJobParams struct {
+	JobID    string   `json:"job_id"`
+	AgentIDs []string `json:"agent_ids"` // 只重试这些Agent，留空重试全部失败和被跳过的Agent
+}
+
+func (m *RetryDeployJobMethod) Execute(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var p RetryDeployJobParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, fmt.Errorf("invalid params: %w", err)
+	}
+
+	jobUUID, err := uuid.Parse(p.JobID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid job_id: %w", err)
+	}
+
+	previous, err := m.storage.GetDeployJob(ctx, jobUUID)
+	if err != nil {
+		return nil, fmt.Errorf("deploy job not found: %w", err)
+	}
+	if previous.Status == "pending" || previous.Status == "running" {
+		return nil, fmt.Errorf("deploy job is still running")
+	}
+
+	selected := make(map[string]bool)
+	for _, id := range p.AgentIDs {
+		selected[id] = true
+	}
+
+	job := &models.DeployJob{
+		Kind:        previous.Kind,
+		Version:     previous.Version,
+		Method:      previous.Method,
+		ScriptURL:   previous.ScriptURL,
+		InstallDir:  previous.InstallDir,
+		Parallelism: previous.Parallelism,
+		RetryOf:     &previous.ID,
+	}
+	if err := m.runner.normalizeJob(job); err != nil {
+		return nil, err
+	}
+	for _, target := range previous.Targets {
+		if len(selected) > 0 && !selected[target.AgentID.String()] {
+			continue
+		}
+		if len(selected) == 0 && target.Status != "failed" && target.Status != "skipped" {
+			continue
+		}
+		job.Targets = append(job.Targets, models.DeployTarget{
+			AgentID:   target.AgentID,
+			AgentName: target.AgentName,
+			Status:    "pending",
+		})
+	}
+	if len(job.Targets) == 0 {
+		return nil, fmt.Errorf("no agents to retry")
+	}
+
+	if err := createDeployJob(ctx, m.storage, job); err != nil {
+		return nil, err
+	}
+	m.runner.Start(job)
+
+	return map[string]interface{}{
+		"status":  "started",
+		"job_id":  job.ID.String(),
+		"targets": len(job.Targets),
+	}, nil
+}
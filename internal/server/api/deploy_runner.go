@@ -0,0 +1,609 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/sftp"
+	"github.com/plumber/plumber/internal/server/agentdist"
+	"github.com/plumber/plumber/internal/server/sshdial"
+	"github.com/plumber/plumber/internal/server/storage"
+	"github.com/plumber/plumber/pkg/models"
+	"golang.org/x/crypto/ssh"
+)
+
+// DeployOptions Agent部署配置
+type DeployOptions struct {
+	Binaries       *agentdist.Store  // 离线部署和自更新使用的Agent二进制
+	Signer         *agentdist.Signer // 签名自更新信息
+	VerifyTimeout  time.Duration     // 部署后等待Agent注册的时间
+	MaxParallelism int               // 单个部署任务同时部署的Agent数量上限
+}
+
+// 任务类型
+const (
+	DeployKindDeploy    = "deploy"    // 首次部署或重新部署，签发新令牌
+	DeployKindUpgrade   = "upgrade"   // 替换二进制并重启，失败时回滚
+	DeployKindUninstall = "uninstall" // 停止服务、删除文件并标记Agent已卸载
+)
+
+// 部署方式
+const (
+	DeployMethodOffline = "offline" // 通过SFTP推送服务端托管的二进制，目标主机无需访问外网
+	DeployMethodScript  = "script"  // 目标主机下载并执行安装脚本
+)
+
+// 部署阶段，按顺序执行
+const (
+	DeployStageConnect   = "connect"   // 建立SSH连接（离线部署同时检测目标平台）
+	DeployStageUpload    = "upload"    // 推送二进制、配置和服务单元（仅离线部署）
+	DeployStageConfigure = "configure" // 安装文件、写入配置
+	DeployStageStart     = "start"     // 启动服务
+	DeployStageRegister  = "register"  // 等待Agent使用新令牌注册
+	DeployStageRollback  = "rollback"  // 升级失败，恢复原二进制
+	DeployStageStop      = "stop"      // 卸载：停止并禁用服务
+	DeployStageRemove    = "remove"    // 卸载：删除服务单元和安装目录
+)
+
+// defaultInstallDir Agent默认安装目录，与 plumber-agent.service 一致
+const defaultInstallDir = "/opt/plumber_agent"
+
+// defaultDeployParallelism 未指定并发数时同时部署的Agent数量
+const defaultDeployParallelism = 5
+
+// installDirPattern 安装目录会拼接到远程shell命令中，只允许安全字符
+var installDirPattern = regexp.MustCompile(`^/[A-Za-z0-9._/-]+$`)
+
+// validInstallDir 安装目录只允许安全字符，且必须是规范的绝对路径（不含 . 和 .. 段、重复或末尾的 /）
+func validInstallDir(dir string) bool {
+	return installDirPattern.MatchString(dir) && path.Clean(dir) == dir
+}
+
+// agentInstallDir 优先使用部署时记录在Agent上的安装目录，未记录（早于记录或手动安装）时使用任务参数
+func agentInstallDir(agent *models.Agent, job *models.DeployJob) string {
+	if agent.InstallDir != "" && validInstallDir(agent.InstallDir) {
+		return agent.InstallDir
+	}
+	return job.InstallDir
+}
+
+// registrationPollInterval 等待Agent注册时查询数据库的间隔
+const registrationPollInterval = 2 * time.Second
+
+// deployRunner 在后台执行部署任务，按任务的并发数同时部署多个Agent，进度实时写入数据库
+type deployRunner struct {
+	storage storage.Storage
+	config  *agentConfigBuilder
+	dialer  *sshdial.Dialer
+	options DeployOptions
+}
+
+func newDeployRunner(storage storage.Storage, config *agentConfigBuilder, dialer *sshdial.Dialer, options DeployOptions) *deployRunner {
+	return &deployRunner{
+		storage: storage,
+		config:  config,
+		dialer:  dialer,
+		options: options,
+	}
+}
+
+// Start 在后台执行部署任务，job及其Targets必须已保存
+func (r *deployRunner) Start(job *models.DeployJob) {
+	go r.run(job)
+}
+
+func (r *deployRunner) run(job *models.DeployJob) {
+	ctx := context.Background()
+	startTime := time.Now()
+	log.Printf("[Deploy] Starting %s job - JobID: %s, Method: %s, Targets: %d, Parallelism: %d",
+		job.Kind, job.ID, job.Method, len(job.Targets), job.Parallelism)
+
+	job.Status = "running"
+	job.StartTime = &startTime
+	if err := r.storage.UpdateDeployJob(ctx, job); err != nil {
+		log.Printf("[Deploy] Failed to update deploy job: %v", err)
+	}
+
+	if job.Kind == DeployKindUpgrade {
+		r.runBatches(ctx, job)
+	} else {
+		r.runParallel(ctx, job, job.Targets)
+	}
+
+	succeeded := 0
+	for _, target := range job.Targets {
+		if target.Status == "success" {
+			succeeded++
+		}
+	}
+	job.Status = "success"
+	if succeeded < len(job.Targets) {
+		job.Status = "failed"
+	}
+	endTime := time.Now()
+	job.EndTime = &endTime
+	if err := r.storage.UpdateDeployJob(ctx, job); err != nil {
+		log.Printf("[Deploy] Failed to update deploy job: %v", err)
+	}
+
+	log.Printf("[Deploy] %s job finished - JobID: %s, Status: %s, Succeeded: %d/%d, Duration: %s",
+		job.Kind, job.ID, job.Status, succeeded, len(job.Targets), endTime.Sub(startTime))
+}
+
+// runParallel 同时处理最多 job.Parallelism 个目标
+func (r *deployRunner) runParallel(ctx context.Context, job *models.DeployJob, targets []models.DeployTarget) {
+	sem := make(chan struct{}, job.Parallelism)
+	var wg sync.WaitGroup
+	for i := range targets {
+		target := &targets[i]
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			r.runTarget(ctx, job, target)
+		}()
+	}
+	wg.Wait()
+}
+
+// runBatches 按 job.Parallelism 分批升级，某一批有失败时停止，其余目标标记为跳过
+func (r *deployRunner) runBatches(ctx context.Context, job *models.DeployJob) {
+	for start := 0; start < len(job.Targets); start += job.Parallelism {
+		end := min(start+job.Parallelism, len(job.Targets))
+		batch := job.Targets[start:end]
+		r.runParallel(ctx, job, batch)
+
+		for _, target := range batch {
+			if target.Status == "success" {
+				continue
+			}
+			for i := end; i < len(job.Targets); i++ {
+				skipped := &job.Targets[i]
+				skipped.Status = "skipped"
+				skipped.Error = fmt.Sprintf("skipped because %s failed in a previous batch", target.AgentName)
+				(&targetProgress{storage: r.storage, target: skipped}).save()
+			}
+			return
+		}
+	}
+}
+
+// runTarget 部署单个Agent并记录结果
+func (r *deployRunner) runTarget(ctx context.Context, job *models.DeployJob, target *models.DeployTarget) {
+	p := &targetProgress{storage: r.storage, target: target}
+
+	startTime := time.Now()
+	target.Status = "running"
+	target.StartTime = &startTime
+	p.save()
+
+	err := r.deployTarget(ctx, job, p)
+
+	endTime := time.Now()
+	target.EndTime = &endTime
+	if err != nil {
+		target.Status = "failed"
+		target.Error = err.Error()
+		log.Printf("[Deploy] %s failed at stage %s: %v", target.AgentName, target.Stage, err)
+	} else {
+		target.Status = "success"
+		log.Printf("[Deploy] %s %s succeeded", target.AgentName, job.Kind)
+	}
+	p.save()
+}
+
+func (r *deployRunner) deployTarget(ctx context.Context, job *models.DeployJob, p *targetProgress) error {
+	p.stage(DeployStageConnect)
+	agent, err := r.storage.GetAgent(ctx, p.target.AgentID)
+	if err != nil {
+		return fmt.Errorf("agent not found: %w", err)
+	}
+	if agent.SSHHost == "" {
+		return fmt.Errorf("agent has no SSH configuration")
+	}
+
+	client, err := r.dialer.Dial(ctx, agent)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	p.logf("Connected to %s", sshdial.Address(agent))
+
+	switch job.Kind {
+	case DeployKindUpgrade:
+		return r.upgradeTarget(ctx, client, agent, job, p)
+	case DeployKindUninstall:
+		return r.uninstallTarget(ctx, client, agent, job, p)
+	}
+
+	// 离线部署先确认有对应平台的二进制，再签发新令牌，避免失败时让正在运行的Agent失效
+	var binary *agentdist.Binary
+	if job.Method == DeployMethodOffline {
+		goos, goarch, err := detectPlatform(client)
+		if err != nil {
+			return err
+		}
+		p.target.OS, p.target.Arch = goos, goarch
+		if binary, err = r.options.Binaries.Stat(goos, goarch); err != nil {
+			return err
+		}
+		p.logf("Target platform %s/%s, agent binary sha256 %s", goos, goarch, binary.SHA256)
+	}
+
+	// 部署时签发新令牌写入目标机器的 agent.json
+	token, err := issueAgentToken(ctx, r.storage, agent.ID)
+	if err != nil {
+		return err
+	}
+	configJSON, err := r.config.Build(agent.ID, token)
+	if err != nil {
+		return fmt.Errorf("failed to generate config: %w", err)
+	}
+
+	var startedAt time.Time
+	if job.Method == DeployMethodOffline {
+		startedAt, err = r.deployOffline(client, agent, job.InstallDir, configJSON, binary, p)
+	} else {
+		startedAt, err = r.deployScript(client, agent, job.InstallDir, job.ScriptURL, configJSON, p)
+	}
+	if err != nil {
+		return err
+	}
+	if err := r.storage.UpdateAgentInstallDir(ctx, agent.ID, job.InstallDir); err != nil {
+		log.Printf("[Deploy] Failed to record install dir - AgentID: %s, Error: %v", agent.ID, err)
+	}
+
+	p.stage(DeployStageRegister)
+	registered, err := r.waitForRegistration(ctx, agent.ID, startedAt, "")
+	if err != nil {
+		return err
+	}
+	p.logf("Agent registered at %s", registered.RegisteredAt.Format(time.RFC3339))
+	return nil
+}
+
+// upgradeTarget 替换Agent二进制并重启，沿用现有配置和令牌；
+// Agent未在限定时间内以目标版本重新注册时恢复原二进制
+func (r *deployRunner) upgradeTarget(ctx context.Context, client *ssh.Client, agent *models.Agent, job *models.DeployJob, p *targetProgress) error {
+	goos, goarch, err := detectPlatform(client)
+	if err != nil {
+		return err
+	}
+	p.target.OS, p.target.Arch = goos, goarch
+	binFile, binary, err := r.options.Binaries.Open(goos, goarch)
+	if err != nil {
+		return err
+	}
+	defer binFile.Close()
+	p.logf("Upgrading %s/%s from version %q to %q, agent binary sha256 %s", goos, goarch, agent.Version, binary.Version, binary.SHA256)
+
+	p.stage(DeployStageUpload)
+	stage, cleanup, err := stageFiles(client, []stagedFile{{"plumber-agent", 0755, binFile}})
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	p.logf("Uploaded agent binary (%d bytes)", binary.Size)
+
+	sudo := sudoPrefix(agent)
+	installDir := agentInstallDir(agent, job)
+
+	p.stage(DeployStageConfigure)
+	configureScript := fmt.Sprintf(`set -e
+test -f %[2]s/agent.json || { echo "agent is not installed in %[2]s"; exit 1; }
+%[1]scp -p %[2]s/plumber-agent %[2]s/plumber-agent.bak
+%[1]sinstall -m 0755 %[3]s/plumber-agent %[2]s/plumber-agent
+`, sudo, installDir, stage)
+	if err := p.run(client, configureScript); err != nil {
+		return fmt.Errorf("failed to replace binary: %w", err)
+	}
+
+	// 之后的失败都需要回滚
+	upgradeErr := func() error {
+		p.stage(DeployStageStart)
+		startedAt := time.Now()
+		if err := p.run(client, sudo+"systemctl restart plumber-agent"); err != nil {
+			return fmt.Errorf("failed to restart service: %w", err)
+		}
+
+		p.stage(DeployStageRegister)
+		registered, err := r.waitForRegistration(ctx, agent.ID, startedAt, binary.Version)
+		if err != nil {
+			return err
+		}
+		p.logf("Agent registered with version %q at %s", registered.Version, registered.RegisteredAt.Format(time.RFC3339))
+		return nil
+	}()
+	if upgradeErr == nil {
+		return nil
+	}
+
+	failedStage := p.target.Stage
+	p.logf("Upgrade failed: %v", upgradeErr)
+	p.stage(DeployStageRollback)
+	rollbackScript := fmt.Sprintf(`set -e
+%[1]sinstall -m 0755 %[2]s/plumber-agent.bak %[2]s/plumber-agent
+%[1]ssystemctl restart plumber-agent
+`, sudo, installDir)
+	if err := p.run(client, rollbackScript); err != nil {
+		return fmt.Errorf("upgrade failed at stage %s: %v; rollback failed: %w", failedStage, upgradeErr, err)
+	}
+	p.logf("Rolled back to the previous binary")
+	return fmt.Errorf("upgrade failed at stage %s and was rolled back: %w", failedStage, upgradeErr)
+}
+
+// uninstallTarget 停止并删除Agent服务和安装目录，然后吊销令牌和证书并将Agent标记为已卸载。
+// 目录中没有Agent文件时不做任何删除，避免误删其他目录
+func (r *deployRunner) uninstallTarget(ctx context.Context, client *ssh.Client, agent *models.Agent, job *models.DeployJob, p *targetProgress) error {
+	sudo := sudoPrefix(agent)
+	installDir := agentInstallDir(agent, job)
+	p.logf("Uninstalling agent from %s", installDir)
+
+	p.stage(DeployStageStop)
+	stopScript := fmt.Sprintf(`test -f %[2]s/agent.json || test -f %[2]s/plumber-agent || { echo "agent is not installed in %[2]s"; exit 1; }
+%[1]ssystemctl stop plumber-agent 2>/dev/null || true
+%[1]ssystemctl disable plumber-agent 2>/dev/null || true
+`, sudo, installDir)
+	if err := p.run(client, stopScript); err != nil {
+		return fmt.Errorf("failed to stop service: %w", err)
+	}
+
+	p.stage(DeployStageRemove)
+	removeScript := fmt.Sprintf(`set -e
+%[1]srm -f /etc/systemd/system/plumber-agent.service
+%[1]ssystemctl daemon-reload
+%[1]srm -rf %[2]s
+`, sudo, installDir)
+	if err := p.run(client, removeScript); err != nil {
+		return fmt.Errorf("failed to remove agent files: %w", err)
+	}
+
+	if err := r.storage.DecommissionAgent(ctx, agent.ID); err != nil {
+		return fmt.Errorf("agent removed but failed to mark it decommissioned: %w", err)
+	}
+	if _, err := r.storage.RevokeAgentCertificatesByAgent(ctx, agent.ID); err != nil {
+		return fmt.Errorf("agent decommissioned but failed to revoke its certificates: %w", err)
+	}
+	p.logf("Agent removed and marked decommissioned")
+	return nil
+}
+
+// deployOffline 通过SFTP推送服务端托管的二进制、agent.json和systemd服务单元，安装并启动服务，
+// 整个过程目标主机无需访问外网，返回服务启动时间
+func (r *deployRunner) deployOffline(client *ssh.Client, agent *models.Agent, installDir string, configJSON []byte, binary *agentdist.Binary, p *targetProgress) (time.Time, error) {
+	p.stage(DeployStageUpload)
+	binFile, _, err := r.options.Binaries.Open(binary.OS, binary.Arch)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer binFile.Close()
+
+	stage, cleanup, err := stageFiles(client, []stagedFile{
+		{"plumber-agent", 0755, binFile},
+		{"agent.json", 0600, strings.NewReader(string(configJSON))},
+		{"plumber-agent.service", 0644, strings.NewReader(agentdist.SystemdUnit(installDir))},
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer cleanup()
+	p.logf("Uploaded agent binary (%d bytes), configuration and service unit", binary.Size)
+
+	sudo := sudoPrefix(agent)
+
+	p.stage(DeployStageConfigure)
+	configureScript := fmt.Sprintf(`set -e
+%[1]ssystemctl stop plumber-agent 2>/dev/null || true
+%[1]smkdir -p %[2]s
+%[1]sinstall -m 0755 %[3]s/plumber-agent %[2]s/plumber-agent
+%[1]sinstall -m 0600 %[3]s/agent.json %[2]s/agent.json
+%[1]sinstall -m 0644 %[3]s/plumber-agent.service /etc/systemd/system/plumber-agent.service
+%[1]ssystemctl daemon-reload
+%[1]ssystemctl enable plumber-agent
+`, sudo, installDir, stage)
+	if err := p.run(client, configureScript); err != nil {
+		return time.Time{}, fmt.Errorf("install failed: %w", err)
+	}
+
+	p.stage(DeployStageStart)
+	startedAt := time.Now()
+	if err := p.run(client, sudo+"systemctl restart plumber-agent"); err != nil {
+		return time.Time{}, fmt.Errorf("failed to start service: %w", err)
+	}
+	return startedAt, nil
+}
+
+// deployScript 写入 agent.json 后由目标主机下载并执行安装脚本，返回脚本开始执行的时间
+func (r *deployRunner) deployScript(client *ssh.Client, agent *models.Agent, installDir, scriptURL string, configJSON []byte, p *targetProgress) (time.Time, error) {
+	sudo := sudoPrefix(agent)
+
+	p.stage(DeployStageConfigure)
+	configureScript := fmt.Sprintf(`set -e
+%[1]srm -rf %[2]s || true
+%[1]smkdir -p %[2]s
+cat > /tmp/agent.json << 'EOF'
+%[3]s
+EOF
+%[1]smv /tmp/agent.json %[2]s/agent.json
+%[1]schmod 644 %[2]s/agent.json
+`, sudo, installDir, string(configJSON))
+	if err := p.run(client, configureScript); err != nil {
+		return time.Time{}, fmt.Errorf("failed to write agent configuration: %w", err)
+	}
+
+	p.stage(DeployStageStart)
+	startedAt := time.Now()
+	if err := p.run(client, fmt.Sprintf(`set -e
+curl -sSL "%s" | %sbash
+`, scriptURL, sudo)); err != nil {
+		return time.Time{}, fmt.Errorf("installation script failed: %w", err)
+	}
+	return startedAt, nil
+}
+
+// waitForRegistration 等待Agent进程在since之后启动并注册，version不为空时还要求上报的版本一致
+func (r *deployRunner) waitForRegistration(ctx context.Context, agentID uuid.UUID, since time.Time, version string) (*models.Agent, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.options.VerifyTimeout)
+	defer cancel()
+
+	ticker := time.NewTicker(registrationPollInterval)
+	defer ticker.Stop()
+
+	var reported string
+	for {
+		agent, err := r.storage.GetAgent(ctx, agentID)
+		if err == nil && agent.Status == "online" && agent.RegisteredAt != nil && agent.RegisteredAt.After(since) {
+			if version == "" || agent.Version == version {
+				return agent, nil
+			}
+			reported = agent.Version
+		}
+
+		select {
+		case <-ctx.Done():
+			if reported != "" {
+				return nil, fmt.Errorf("agent registered with version %q, expected %q", reported, version)
+			}
+			return nil, fmt.Errorf("agent did not register within %s, check the service with: journalctl -u plumber-agent", r.options.VerifyTimeout)
+		case <-ticker.C:
+		}
+	}
+}
+
+// targetProgress 记录单个Agent的部署阶段和输出，每次变化立即写入数据库供查询
+type targetProgress struct {
+	storage storage.Storage
+	target  *models.DeployTarget
+	output  strings.Builder
+}
+
+func (p *targetProgress) stage(name string) {
+	p.target.Stage = name
+	p.logf("==> %s", name)
+}
+
+func (p *targetProgress) logf(format string, args ...interface{}) {
+	fmt.Fprintf(&p.output, format+"\n", args...)
+	p.target.Output = p.output.String()
+	p.save()
+}
+
+// run 在目标主机执行命令并记录输出
+func (p *targetProgress) run(client *ssh.Client, command string) error {
+	output, err := runRemote(client, command)
+	p.output.WriteString(output)
+	p.target.Output = p.output.String()
+	p.save()
+	return err
+}
+
+func (p *targetProgress) save() {
+	if err := p.storage.UpdateDeployTarget(context.Background(), p.target); err != nil {
+		log.Printf("[Deploy] Failed to update deploy target %s: %v", p.target.ID, err)
+	}
+}
+
+// detectPlatform 通过 uname 检测目标主机的操作系统和架构，离线部署安装systemd服务，只支持linux
+func detectPlatform(client *ssh.Client) (string, string, error) {
+	uname, err := runRemote(client, "uname -s; uname -m")
+	if err != nil {
+		return "", "", fmt.Errorf("failed to detect platform: %w", err)
+	}
+	fields := strings.Fields(uname)
+	if len(fields) != 2 {
+		return "", "", fmt.Errorf("unexpected uname output: %q", uname)
+	}
+	goos, goarch, err := agentdist.ParseUname(fields[0], fields[1])
+	if err != nil {
+		return "", "", err
+	}
+	if goos != "linux" {
+		return "", "", fmt.Errorf("offline deployment installs a systemd service and only supports linux, target is %s", goos)
+	}
+	return goos, goarch, nil
+}
+
+// sudoPrefix 非root用户通过sudo执行安装命令
+func sudoPrefix(agent *models.Agent) string {
+	if agent.SSHUser == "root" {
+		return ""
+	}
+	return "sudo "
+}
+
+// runRemote 在目标主机执行命令，返回合并的标准输出和错误输出
+func runRemote(client *ssh.Client, command string) (string, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return "", fmt.Errorf("failed to create SSH session: %w", err)
+	}
+	defer session.Close()
+
+	output, err := session.CombinedOutput(command)
+	return string(output), err
+}
+
+// stagedFile 上传到临时目录的文件
+type stagedFile struct {
+	name string
+	mode os.FileMode
+	src  io.Reader
+}
+
+// stageFiles 通过SFTP把文件上传到仅当前SSH用户可访问的临时目录，再由调用方用sudo安装到最终位置；
+// 返回临时目录和清理函数
+func stageFiles(client *ssh.Client, files []stagedFile) (string, func(), error) {
+	sftpClient, err := sftp.NewClient(client)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to start sftp: %w", err)
+	}
+	defer sftpClient.Close()
+
+	stage := path.Join("/tmp", "plumber-agent-"+uuid.New().String())
+	if err := sftpClient.Mkdir(stage); err != nil {
+		return "", nil, fmt.Errorf("failed to create staging dir: %w", err)
+	}
+	cleanup := func() {
+		if _, err := runRemote(client, "rm -rf "+stage); err != nil {
+			log.Printf("[Deploy] Failed to remove staging dir %s: %v", stage, err)
+		}
+	}
+	if err := sftpClient.Chmod(stage, 0700); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("failed to protect staging dir: %w", err)
+	}
+
+	for _, file := range files {
+		if err := uploadFile(sftpClient, path.Join(stage, file.name), file.mode, file.src); err != nil {
+			cleanup()
+			return "", nil, fmt.Errorf("failed to upload %s: %w", file.name, err)
+		}
+	}
+	return stage, cleanup, nil
+}
+
+// uploadFile 通过SFTP写入文件并设置权限
+func uploadFile(client *sftp.Client, name string, mode os.FileMode, src io.Reader) error {
+	f, err := client.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, src); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return client.Chmod(name, mode)
+}
@@ -2,37 +2,45 @@ package api
 
 import (
 	"context"
+	"crypto/x509"
 	"encoding/json"
+	"fmt"
 	"log"
+	"math/big"
+	"net"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/plumber/plumber/internal/server/audit"
+	"github.com/plumber/plumber/internal/server/pki"
 	"github.com/plumber/plumber/internal/server/storage"
 	"github.com/plumber/plumber/pkg/auth"
 	"github.com/plumber/plumber/pkg/jsonrpc"
+	"github.com/plumber/plumber/pkg/models"
 )
 
-// parseAgentUUID 辅助函数：解析UUID字符串
-func parseAgentUUID(s string) (uuid.UUID, error) {
-	return uuid.Parse(s)
-}
-
 // Handler HTTP处理器
 type Handler struct {
 	router     *jsonrpc.Router
 	storage    storage.Storage
 	jwtManager *auth.JWTManager
-	agentToken string // Agent认证Token
+	agentAuth  *agentAuthenticator // Agent令牌认证
+	access     *accessChecker      // 用户权限与范围校验
+	audit      *audit.Recorder     // 审计日志
 }
 
 // NewHandler 创建新的处理器
-func NewHandler(router *jsonrpc.Router, storage storage.Storage, jwtManager *auth.JWTManager, agentToken string) *Handler {
+// requireAgentCert 为true时Agent接口必须通过mTLS客户端证书认证
+func NewHandler(router *jsonrpc.Router, storage storage.Storage, jwtManager *auth.JWTManager, requireAgentCert bool) *Handler {
 	return &Handler{
 		router:     router,
 		storage:    storage,
 		jwtManager: jwtManager,
-		agentToken: agentToken,
+		agentAuth:  newAgentAuthenticator(storage, requireAgentCert),
+		access:     newAccessChecker(storage),
+		audit:      audit.NewRecorder(storage),
 	}
 }
 
@@ -41,7 +49,7 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// 设置CORS头
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Agent-Token")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Agent-ID, X-Agent-Token")
 	w.Header().Set("Content-Type", "application/json")
 
 	// 处理预检请求
@@ -68,55 +76,185 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx := r.Context()
+	ctx := ContextWithClientInfo(r.Context(), clientIP(r), r.UserAgent())
+	start := time.Now()
 
-	// 检查是否为Agent方法（Agent主动上报的方法）
-	isAgentMethod := req.Method == "plumber.agent.register" ||
-		req.Method == "plumber.agent.heartbeat" ||
-		strings.HasPrefix(req.Method, "plumber.step.")
+	// 根据方法声明的权限进行认证和授权
+	switch permission := method.Permission(); permission {
+	case jsonrpc.PermissionPublic:
+		// 无需认证
 
-	if isAgentMethod {
-		// Agent方法使用Token认证
-		agentToken := r.Header.Get("X-Agent-Token")
-		if agentToken == "" || agentToken != h.agentToken {
-			h.writeError(w, jsonrpc.InvalidRequest, "Invalid or missing agent token")
+	case jsonrpc.PermissionAgent:
+		// Agent方法使用客户端证书或每个Agent独立的Token认证
+		agent, err := h.agentAuth.AuthenticateRequest(r, req.Method)
+		if err != nil {
+			log.Printf("[Server] Agent authentication failed for %s: %v", req.Method, err)
+			h.auditDenied(ctx, method, &req, start, err.Error())
+			h.writeError(w, jsonrpc.Unauthenticated, "Invalid or missing agent token")
 			return
 		}
-	} else if method.RequireAuth() {
-		// 用户方法使用JWT认证
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			h.writeError(w, jsonrpc.InvalidRequest, "Authorization header required")
+
+		// 将Agent身份添加到context
+		ctx = ContextWithAgentID(ctx, agent.ID)
+
+	default:
+		// 用户方法使用JWT或个人API令牌认证，再按角色和范围授权
+		user, apiToken, sessionID, err := h.authenticateRequest(r)
+		if err != nil {
+			h.auditDenied(ctx, method, &req, start, err.Error())
+			h.writeError(w, jsonrpc.Unauthenticated, err.Error())
 			return
 		}
 
-		// 验证Bearer token
-		parts := strings.SplitN(authHeader, " ", 2)
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			h.writeError(w, jsonrpc.InvalidRequest, "Invalid authorization header format")
-			return
+		if apiToken != nil {
+			ctx = ContextWithAPIToken(ctx, apiToken)
+		} else {
+			ctx = ContextWithSessionID(ctx, sessionID)
 		}
 
-		token := parts[1]
-		claims, err := h.jwtManager.Verify(token)
-		if err != nil {
-			h.writeError(w, jsonrpc.InvalidRequest, "Invalid or expired token")
+		// 将用户信息添加到context
+		ctx = ContextWithUserID(ctx, user.ID.String())
+		ctx = ContextWithUsername(ctx, user.Username)
+		ctx = ContextWithUser(ctx, user)
+
+		if apiToken != nil && !apiToken.AllowsPermission(permission) {
+			message := fmt.Sprintf("permission denied: API token is not scoped for %s", permission)
+			h.auditDenied(ctx, method, &req, start, message)
+			h.writeError(w, jsonrpc.PermissionDenied, message)
 			return
 		}
 
-		// 将用户信息添加到context
-		ctx = ContextWithUserID(ctx, claims.UserID)
-		ctx = ContextWithUsername(ctx, claims.Username)
+		if err := h.access.Authorize(ctx, user, permission, req.Params); err != nil {
+			h.auditDenied(ctx, method, &req, start, err.Error())
+			h.writeError(w, jsonrpc.PermissionDenied, err.Error())
+			return
+		}
 	}
 
 	// 执行方法
 	response := h.router.Handle(ctx, &req)
+	h.auditResponse(ctx, method, &req, start, response)
 
 	if err := json.NewEncoder(w).Encode(response); err != nil {
 		log.Printf("Failed to encode response: %v", err)
 	}
 }
 
+// authenticateRequest 校验请求中的Bearer令牌并返回对应的用户
+func (h *Handler) authenticateRequest(r *http.Request) (*models.User, *models.APIToken, uuid.UUID, error) {
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		return nil, nil, uuid.Nil, fmt.Errorf("Authorization header required")
+	}
+
+	// 验证Bearer token
+	parts := strings.SplitN(authHeader, " ", 2)
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		return nil, nil, uuid.Nil, fmt.Errorf("Invalid authorization header format")
+	}
+
+	return h.authenticateToken(r.Context(), parts[1])
+}
+
+// authenticateToken 校验JWT访问令牌或个人API令牌并返回对应的用户
+// 使用个人API令牌认证时同时返回该令牌，以便按令牌的权限范围进一步限制；使用JWT时返回所属会话ID
+func (h *Handler) authenticateToken(ctx context.Context, raw string) (*models.User, *models.APIToken, uuid.UUID, error) {
+	var userUUID, sessionID uuid.UUID
+	var apiToken *models.APIToken
+	if auth.IsAPIToken(raw) {
+		token, err := h.verifyAPIToken(ctx, raw)
+		if err != nil {
+			return nil, nil, uuid.Nil, err
+		}
+		userUUID = token.UserID
+		apiToken = token
+	} else {
+		session, err := h.verifyAccessToken(ctx, raw)
+		if err != nil {
+			return nil, nil, uuid.Nil, err
+		}
+		userUUID = session.UserID
+		sessionID = session.ID
+	}
+
+	// 用户被删除或禁用后，已签发的令牌立即失效
+	user, err := h.storage.GetUser(ctx, userUUID)
+	if err != nil || user.Disabled {
+		return nil, nil, uuid.Nil, fmt.Errorf("User not found or disabled")
+	}
+
+	return user, apiToken, sessionID, nil
+}
+
+// AuthenticateAgent 供RPC之外的接口（Agent终端回连等）认证Agent，规则与Agent RPC方法相同
+func (h *Handler) AuthenticateAgent(r *http.Request) (*models.Agent, error) {
+	return h.agentAuth.AuthenticateRequest(r, "")
+}
+
+// AuthorizeToken 供RPC之外的接口（WebSSH等）校验用户令牌，并按permission和params中的目标资源授权
+func (h *Handler) AuthorizeToken(ctx context.Context, token, permission string, params json.RawMessage) (*models.User, error) {
+	user, apiToken, _, err := h.authenticateToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if apiToken != nil && !apiToken.AllowsPermission(permission) {
+		return nil, fmt.Errorf("permission denied: API token is not scoped for %s", permission)
+	}
+
+	if err := h.access.Authorize(ctx, user, permission, params); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// verifyAccessToken 校验JWT访问令牌及其所属会话，会话吊销后令牌立即失效
+func (h *Handler) verifyAccessToken(ctx context.Context, raw string) (*models.Session, error) {
+	claims, err := h.jwtManager.Verify(raw)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid or expired token")
+	}
+
+	sessionID, err := uuid.Parse(claims.SessionID)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid or expired token")
+	}
+
+	session, err := h.storage.GetSession(ctx, sessionID)
+	if err != nil || session.RevokedAt != nil || time.Now().After(session.ExpiresAt) || session.UserID.String() != claims.UserID {
+		return nil, fmt.Errorf("Session has been revoked or expired")
+	}
+
+	return session, nil
+}
+
+// verifyAPIToken 校验个人API令牌并记录最近使用时间
+func (h *Handler) verifyAPIToken(ctx context.Context, raw string) (*models.APIToken, error) {
+	token, err := h.storage.GetAPITokenByHash(ctx, auth.HashToken(raw))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid API token")
+	}
+
+	now := time.Now()
+	if token.RevokedAt != nil {
+		return nil, fmt.Errorf("API token has been revoked")
+	}
+	if token.ExpiresAt != nil && now.After(*token.ExpiresAt) {
+		return nil, fmt.Errorf("API token has expired")
+	}
+
+	// 限制写库频率，避免每个请求都更新
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) > apiTokenTouchInterval {
+		if err := h.storage.TouchAPIToken(ctx, token.ID, now); err != nil {
+			log.Printf("Failed to update API token last used time: %v", err)
+		}
+		token.LastUsedAt = &now
+	}
+
+	return token, nil
+}
+
 func (h *Handler) writeError(w http.ResponseWriter, code int, message string) {
 	response := jsonrpc.NewErrorResponse(nil, code, message)
 	json.NewEncoder(w).Encode(response)
@@ -128,8 +266,28 @@ type contextKey string
 const (
 	userIDKey   contextKey = "user_id"
 	usernameKey contextKey = "username"
+	agentIDKey  contextKey = "agent_id"
+	userKey     contextKey = "user"
+	apiTokenKey contextKey = "api_token"
+	sessionKey  contextKey = "session_id"
+	clientKey   contextKey = "client_info"
 )
 
+// clientInfo 请求来源信息
+type clientInfo struct {
+	IP        string
+	UserAgent string
+}
+
+// clientIP 获取请求来源IP
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
 // ContextWithUserID 添加用户ID到context
 func ContextWithUserID(ctx context.Context, userID string) context.Context {
 	return context.WithValue(ctx, userIDKey, userID)
@@ -152,75 +310,118 @@ func GetUsernameFromContext(ctx context.Context) (string, bool) {
 	return username, ok
 }
 
+// ContextWithUser 添加已认证的用户到context
+func ContextWithUser(ctx context.Context, user *models.User) context.Context {
+	return context.WithValue(ctx, userKey, user)
+}
+
+// GetUserFromContext 从context获取已认证的用户
+func GetUserFromContext(ctx context.Context) (*models.User, bool) {
+	user, ok := ctx.Value(userKey).(*models.User)
+	return user, ok
+}
+
+// ContextWithAPIToken 添加本次请求使用的个人API令牌到context
+func ContextWithAPIToken(ctx context.Context, token *models.APIToken) context.Context {
+	return context.WithValue(ctx, apiTokenKey, token)
+}
+
+// GetAPITokenFromContext 从context获取本次请求使用的个人API令牌
+func GetAPITokenFromContext(ctx context.Context) (*models.APIToken, bool) {
+	token, ok := ctx.Value(apiTokenKey).(*models.APIToken)
+	return token, ok
+}
+
+// ContextWithSessionID 添加当前登录会话ID到context
+func ContextWithSessionID(ctx context.Context, sessionID uuid.UUID) context.Context {
+	return context.WithValue(ctx, sessionKey, sessionID)
+}
+
+// GetSessionIDFromContext 从context获取当前登录会话ID
+func GetSessionIDFromContext(ctx context.Context) (uuid.UUID, bool) {
+	sessionID, ok := ctx.Value(sessionKey).(uuid.UUID)
+	return sessionID, ok && sessionID != uuid.Nil
+}
+
+// ContextWithClientInfo 添加请求来源IP和User-Agent到context
+func ContextWithClientInfo(ctx context.Context, ip, userAgent string) context.Context {
+	return context.WithValue(ctx, clientKey, clientInfo{IP: ip, UserAgent: userAgent})
+}
+
+// GetClientInfoFromContext 从context获取请求来源IP和User-Agent
+func GetClientInfoFromContext(ctx context.Context) (ip, userAgent string) {
+	info, _ := ctx.Value(clientKey).(clientInfo)
+	return info.IP, info.UserAgent
+}
+
+// ContextWithAgentID 添加已认证的Agent ID到context
+func ContextWithAgentID(ctx context.Context, agentID uuid.UUID) context.Context {
+	return context.WithValue(ctx, agentIDKey, agentID)
+}
+
+// GetAgentIDFromContext 从context获取已认证的Agent ID
+func GetAgentIDFromContext(ctx context.Context) (uuid.UUID, bool) {
+	agentID, ok := ctx.Value(agentIDKey).(uuid.UUID)
+	return agentID, ok
+}
+
 // RestHandler RESTful API处理器
 type RestHandler struct {
-	storage    storage.Storage
-	agentToken string
-	serverAddr string
+	storage storage.Storage
+	ca      *pki.CA
 }
 
 // NewRestHandler 创建新的REST处理器
-func NewRestHandler(storage storage.Storage, agentToken, serverAddr string) *RestHandler {
+func NewRestHandler(storage storage.Storage, ca *pki.CA) *RestHandler {
 	return &RestHandler{
-		storage:    storage,
-		agentToken: agentToken,
-		serverAddr: serverAddr,
+		storage: storage,
+		ca:      ca,
 	}
 }
 
-// GetAgentConfig 获取Agent配置（RESTful API）
-func (h *RestHandler) GetAgentConfig(w http.ResponseWriter, r *http.Request) {
-	// 设置CORS头
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-	w.Header().Set("Content-Type", "application/json")
-
-	// 处理预检请求
-	if r.Method == http.MethodOptions {
-		w.WriteHeader(http.StatusOK)
+// GetCACert 获取内置CA证书（PEM）
+func (h *RestHandler) GetCACert(w http.ResponseWriter, r *http.Request) {
+	if h.ca == nil {
+		http.Error(w, "TLS is not enabled", http.StatusNotFound)
 		return
 	}
 
-	if r.Method != http.MethodGet {
-		http.Error(w, "Only GET method is allowed", http.StatusMethodNotAllowed)
-		return
-	}
+	w.Header().Set("Content-Type", "application/x-pem-file")
+	w.Write(h.ca.CertPEM())
+}
 
-	// 从URL路径中提取agent_id
-	// 路径格式: /api/agent/config/{agent_id}
-	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
-	if len(parts) < 4 {
-		http.Error(w, "Invalid URL format", http.StatusBadRequest)
+// GetCRL 获取Agent证书吊销列表（PEM）
+func (h *RestHandler) GetCRL(w http.ResponseWriter, r *http.Request) {
+	if h.ca == nil {
+		http.Error(w, "TLS is not enabled", http.StatusNotFound)
 		return
 	}
-	agentID := parts[3]
 
-	// 验证agent_id格式
-	agentUUID, err := parseAgentUUID(agentID)
+	revoked, err := h.storage.ListRevokedAgentCertificates(r.Context())
 	if err != nil {
-		http.Error(w, "Invalid agent_id format", http.StatusBadRequest)
+		http.Error(w, "Failed to load revoked certificates", http.StatusInternalServerError)
 		return
 	}
 
-	// 验证Agent存在
-	agent, err := h.storage.GetAgent(r.Context(), agentUUID)
-	if err != nil {
-		http.Error(w, "Agent not found", http.StatusNotFound)
-		return
+	entries := make([]x509.RevocationListEntry, 0, len(revoked))
+	for _, cert := range revoked {
+		serial, ok := new(big.Int).SetString(cert.Serial, 16)
+		if !ok {
+			continue
+		}
+		entries = append(entries, x509.RevocationListEntry{
+			SerialNumber:   serial,
+			RevocationTime: *cert.RevokedAt,
+		})
 	}
 
-	// 生成配置文件内容
-	config := map[string]any{
-		"id":          agent.ID.String(),
-		"token":       h.agentToken,
-		"server_addr": h.serverAddr,
+	crl, err := h.ca.CreateCRL(entries, time.Now().Unix())
+	if err != nil {
+		log.Printf("Failed to create CRL: %v", err)
+		http.Error(w, "Failed to create CRL", http.StatusInternalServerError)
+		return
 	}
 
-	// 返回JSON响应
-	w.WriteHeader(http.StatusOK)
-	if err := json.NewEncoder(w).Encode(config); err != nil {
-		log.Printf("Failed to encode config: %v", err)
-	}
+	w.Header().Set("Content-Type", "application/x-pem-file")
+	w.Write(crl)
 }
-
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/google/uuid"
+	"github.com/plumber/plumber/internal/server/sshdial"
+	"github.com/plumber/plumber/internal/server/storage"
+	"github.com/plumber/plumber/pkg/auth"
+)
+
+// GetAgentHostKeyMethod 查看Agent固定的SSH主机公钥
+type GetAgentHostKeyMethod struct {
+	storage storage.Storage
+}
+
+func NewGetAgentHostKeyMethod(storage storage.Storage) *GetAgentHostKeyMethod {
+	return &GetAgentHostKeyMethod{storage: storage}
+}
+
+func (m *GetAgentHostKeyMethod) Name() string {
+	return "plumber.agent.hostKey"
+}
+
+func (m *GetAgentHostKeyMethod) Permission() string {
+	return auth.PermAgentRead
+}
+
+type GetAgentHostKeyParams struct {
+	AgentID string `json:"agent_id"`
+}
+
+func (m *GetAgentHostKeyMethod) Execute(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var p GetAgentHostKeyParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, fmt.Errorf("invalid params: %w", err)
+	}
+
+	agentUUID, err := uuid.Parse(p.AgentID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid agent_id: %w", err)
+	}
+
+	agent, err := m.storage.GetAgent(ctx, agentUUID)
+	if err != nil {
+		return nil, fmt.Errorf("agent not found: %w", err)
+	}
+
+	result := map[string]interface{}{
+		"agent_id": agent.ID.String(),
+		"pinned":   agent.SSHHostKey != "",
+	}
+	if agent.SSHHost != "" {
+		result["address"] = sshdial.Address(agent)
+	}
+	if agent.SSHHostKey != "" {
+		result["host_key"] = agent.SSHHostKey
+		result["fingerprint"] = agent.SSHHostKeyFP
+		result["pinned_at"] = agent.SSHHostKeyAt
+	}
+	return result, nil
+}
+
+// ResetAgentHostKeyMethod 重置Agent固定的SSH主机公钥
+// 不传host_key时清除固定的公钥，下次连接按策略重新信任；传入时直接固定为该公钥
+type ResetAgentHostKeyMethod struct {
+	storage storage.Storage
+}
+
+func NewResetAgentHostKeyMethod(storage storage.Storage) *ResetAgentHostKeyMethod {
+	return &ResetAgentHostKeyMethod{storage: storage}
+}
+
+func (m *ResetAgentHostKeyMethod) Name() string {
+	return "plumber.agent.resetHostKey"
+}
+
+func (m *ResetAgentHostKeyMethod) Permission() string {
+	return auth.PermAgentWrite
+}
+
+type ResetAgentHostKeyParams struct {
+	AgentID string `json:"agent_id"`
+	HostKey string `json:"host_key"` // 可选，authorized_keys或known_hosts格式
+}
+
+func (m *ResetAgentHostKeyMethod) Execute(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var p ResetAgentHostKeyParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, fmt.Errorf("invalid params: %w", err)
+	}
+
+	agentUUID, err := uuid.Parse(p.AgentID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid agent_id: %w", err)
+	}
+
+	agent, err := m.storage.GetAgent(ctx, agentUUID)
+	if err != nil {
+		return nil, fmt.Errorf("agent not found: %w", err)
+	}
+
+	hostKey, fingerprint := "", ""
+	if p.HostKey != "" {
+		key, err := sshdial.ParseHostKey(p.HostKey)
+		if err != nil {
+			return nil, err
+		}
+		hostKey, fingerprint = sshdial.MarshalHostKey(key), sshdial.Fingerprint(key)
+	}
+
+	if err := m.storage.UpdateAgentHostKey(ctx, agent.ID, hostKey, fingerprint); err != nil {
+		return nil, fmt.Errorf("failed to update host key: %w", err)
+	}
+
+	log.Printf("[Server] SSH host key of agent %s reset (previous: %s, pinned: %s)", agent.ID, agent.SSHHostKeyFP, fingerprint)
+
+	return map[string]interface{}{
+		"agent_id":             agent.ID.String(),
+		"previous_fingerprint": agent.SSHHostKeyFP,
+		"fingerprint":          fingerprint,
+		"pinned":               hostKey != "",
+	}, nil
+}
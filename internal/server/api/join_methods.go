@@ -0,0 +1,240 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/plumber/plumber/internal/server/storage"
+	"github.com/plumber/plumber/pkg/auth"
+	"github.com/plumber/plumber/pkg/jsonrpc"
+	"github.com/plumber/plumber/pkg/models"
+)
+
+// joinTokenLength 加入令牌随机字节数
+const joinTokenLength = 24
+
+// CreateJoinTokenMethod 创建Agent加入令牌
+type CreateJoinTokenMethod struct {
+	storage storage.Storage
+}
+
+func NewCreateJoinTokenMethod(storage storage.Storage) *CreateJoinTokenMethod {
+	return &CreateJoinTokenMethod{storage: storage}
+}
+
+func (m *CreateJoinTokenMethod) Name() string {
+	return "plumber.joinToken.create"
+}
+
+func (m *CreateJoinTokenMethod) Permission() string {
+	return auth.PermAgentWrite
+}
+
+type CreateJoinTokenParams struct {
+	Description    string            `json:"description"`
+	MaxUses        int               `json:"max_uses"`         // 可使用次数，默认1次
+	ExpiresInHours int               `json:"expires_in_hours"` // 有效期（小时），默认24小时
+	Labels         map[string]string `json:"labels,omitempty"` // 加入的Agent自动带上的标签
+}
+
+func (m *CreateJoinTokenMethod) Execute(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var p CreateJoinTokenParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, fmt.Errorf("invalid params: %w", err)
+	}
+
+	if p.MaxUses <= 0 {
+		p.MaxUses = 1
+	}
+	if p.ExpiresInHours <= 0 {
+		p.ExpiresInHours = 24
+	}
+
+	token, err := auth.GenerateToken(joinTokenLength)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate join token: %w", err)
+	}
+
+	username, _ := GetUsernameFromContext(ctx)
+	joinToken := &models.JoinToken{
+		Description: p.Description,
+		TokenHash:   auth.HashToken(token),
+		MaxUses:     p.MaxUses,
+		Labels:      p.Labels,
+		ExpiresAt:   time.Now().Add(time.Duration(p.ExpiresInHours) * time.Hour),
+		CreatedBy:   username,
+	}
+
+	if err := m.storage.CreateJoinToken(ctx, joinToken); err != nil {
+		return nil, fmt.Errorf("failed to create join token: %w", err)
+	}
+
+	return map[string]interface{}{
+		"id":         joinToken.ID.String(),
+		"token":      token,
+		"max_uses":   joinToken.MaxUses,
+		"expires_at": joinToken.ExpiresAt,
+	}, nil
+}
+
+// ListJoinTokensMethod 列出加入令牌
+type ListJoinTokensMethod struct {
+	storage storage.Storage
+}
+
+func NewListJoinTokensMethod(storage storage.Storage) *ListJoinTokensMethod {
+	return &ListJoinTokensMethod{storage: storage}
+}
+
+func (m *ListJoinTokensMethod) Name() string {
+	return "plumber.joinToken.list"
+}
+
+func (m *ListJoinTokensMethod) Permission() string {
+	return auth.PermAgentWrite
+}
+
+func (m *ListJoinTokensMethod) Audit() bool {
+	return false
+}
+
+func (m *ListJoinTokensMethod) Execute(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	tokens, err := m.storage.ListJoinTokens(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list join tokens: %w", err)
+	}
+
+	return map[string]interface{}{
+		"join_tokens": tokens,
+	}, nil
+}
+
+// RevokeJoinTokenMethod 吊销加入令牌
+type RevokeJoinTokenMethod struct {
+	storage storage.Storage
+}
+
+func NewRevokeJoinTokenMethod(storage storage.Storage) *RevokeJoinTokenMethod {
+	return &RevokeJoinTokenMethod{storage: storage}
+}
+
+func (m *RevokeJoinTokenMethod) Name() string {
+	return "plumber.joinToken.revoke"
+}
+
+func (m *RevokeJoinTokenMethod) Permission() string {
+	return auth.PermAgentWrite
+}
+
+type RevokeJoinTokenParams struct {
+	ID string `json:"id"`
+}
+
+func (m *RevokeJoinTokenMethod) Execute(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var p RevokeJoinTokenParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, fmt.Errorf("invalid params: %w", err)
+	}
+
+	id, err := uuid.Parse(p.ID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id: %w", err)
+	}
+
+	if err := m.storage.RevokeJoinToken(ctx, id); err != nil {
+		return nil, fmt.Errorf("failed to revoke join token: %w", err)
+	}
+
+	return map[string]interface{}{
+		"status": "revoked",
+	}, nil
+}
+
+// AgentJoinMethod Agent使用加入令牌自助注册
+// 无需用户或Agent凭证，加入令牌本身即为授权；成功后返回该Agent专属的agent.json
+type AgentJoinMethod struct {
+	storage storage.Storage
+	config  *agentConfigBuilder
+}
+
+func NewAgentJoinMethod(storage storage.Storage, config *agentConfigBuilder) *AgentJoinMethod {
+	return &AgentJoinMethod{
+		storage: storage,
+		config:  config,
+	}
+}
+
+func (m *AgentJoinMethod) Name() string {
+	return "plumber.agent.join"
+}
+
+func (m *AgentJoinMethod) Permission() string {
+	return jsonrpc.PermissionPublic
+}
+
+type AgentJoinParams struct {
+	JoinToken string `json:"join_token"`
+	Name      string `json:"name"`
+	Hostname  string `json:"hostname"`
+	IP        string `json:"ip"`
+}
+
+func (m *AgentJoinMethod) Execute(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var p AgentJoinParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, fmt.Errorf("invalid params: %w", err)
+	}
+
+	if p.JoinToken == "" {
+		return nil, fmt.Errorf("join_token is required")
+	}
+
+	name := p.Name
+	if name == "" {
+		name = p.Hostname
+	}
+	if name == "" {
+		return nil, fmt.Errorf("agent name is required")
+	}
+
+	token, tokenHash, err := newAgentToken()
+	if err != nil {
+		return nil, err
+	}
+
+	agent := &models.Agent{
+		ID:          uuid.New(),
+		Name:        name,
+		Hostname:    p.Hostname,
+		IP:          p.IP,
+		SSHPort:     22,
+		SSHAuthType: "none",
+		TokenHash:   tokenHash,
+		Status:      "offline",
+	}
+
+	// 参数校验通过后再消耗令牌，消耗与创建Agent在同一事务中
+	joinToken, err := m.storage.JoinAgent(ctx, auth.HashToken(p.JoinToken), agent)
+	if err != nil {
+		// 不区分具体原因，避免泄露令牌状态
+		log.Printf("[Server] Agent join rejected - Name: %s, Error: %v", name, err)
+		return nil, fmt.Errorf("invalid, expired or exhausted join token")
+	}
+
+	configJSON, err := m.config.Build(agent.ID, token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate config: %w", err)
+	}
+
+	log.Printf("[Server] Agent joined - AgentID: %s, Name: %s, JoinTokenID: %s, Uses: %d/%d",
+		agent.ID, agent.Name, joinToken.ID, joinToken.Uses, joinToken.MaxUses)
+
+	return map[string]interface{}{
+		"agent_id": agent.ID.String(),
+		"config":   string(configJSON),
+	}, nil
+}
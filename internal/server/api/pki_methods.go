@@ -0,0 +1,185 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/google/uuid"
+	"github.com/plumber/plumber/internal/server/pki"
+	"github.com/plumber/plumber/internal/server/storage"
+	"github.com/plumber/plumber/pkg/auth"
+	"github.com/plumber/plumber/pkg/jsonrpc"
+	"github.com/plumber/plumber/pkg/models"
+)
+
+const enrollCertMethodName = "plumber.agent.enrollCert"
+
+// EnrollAgentCertMethod Agent申请/续期客户端证书
+// Agent在本地生成私钥，只上送CSR；首次申请使用令牌认证，续期使用当前证书认证
+type EnrollAgentCertMethod struct {
+	storage storage.Storage
+	ca      *pki.CA
+}
+
+func NewEnrollAgentCertMethod(storage storage.Storage, ca *pki.CA) *EnrollAgentCertMethod {
+	return &EnrollAgentCertMethod{
+		storage: storage,
+		ca:      ca,
+	}
+}
+
+func (m *EnrollAgentCertMethod) Name() string {
+	return enrollCertMethodName
+}
+
+func (m *EnrollAgentCertMethod) Permission() string {
+	return jsonrpc.PermissionAgent
+}
+
+func (m *EnrollAgentCertMethod) Audit() bool {
+	return true
+}
+
+type EnrollAgentCertParams struct {
+	CSR string `json:"csr"` // PEM格式的证书签名请求
+}
+
+func (m *EnrollAgentCertMethod) Execute(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	if m.ca == nil {
+		return nil, fmt.Errorf("TLS is not enabled on this server")
+	}
+
+	var p EnrollAgentCertParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, fmt.Errorf("invalid params: %w", err)
+	}
+
+	agentUUID, err := authenticatedAgentID(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	cert, certPEM, err := m.ca.SignAgentCSR([]byte(p.CSR), agentUUID.String())
+	if err != nil {
+		return nil, err
+	}
+
+	record := &models.AgentCertificate{
+		AgentID:   agentUUID,
+		Serial:    pki.SerialString(cert),
+		NotBefore: cert.NotBefore,
+		NotAfter:  cert.NotAfter,
+	}
+	if err := m.storage.CreateAgentCertificate(ctx, record); err != nil {
+		return nil, fmt.Errorf("failed to save certificate: %w", err)
+	}
+
+	log.Printf("[Server] Issued agent certificate - AgentID: %s, Serial: %s, NotAfter: %s",
+		agentUUID, record.Serial, cert.NotAfter.Format("2006-01-02 15:04:05"))
+
+	return map[string]interface{}{
+		"certificate":    string(certPEM),
+		"ca_certificate": string(m.ca.CertPEM()),
+		"serial":         record.Serial,
+		"not_after":      cert.NotAfter,
+	}, nil
+}
+
+// ListAgentCertsMethod 列出Agent的证书
+type ListAgentCertsMethod struct {
+	storage storage.Storage
+}
+
+func NewListAgentCertsMethod(storage storage.Storage) *ListAgentCertsMethod {
+	return &ListAgentCertsMethod{storage: storage}
+}
+
+func (m *ListAgentCertsMethod) Name() string {
+	return "plumber.agent.listCerts"
+}
+
+func (m *ListAgentCertsMethod) Permission() string {
+	return auth.PermAgentRead
+}
+
+type ListAgentCertsParams struct {
+	AgentID string `json:"agent_id"`
+}
+
+func (m *ListAgentCertsMethod) Execute(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var p ListAgentCertsParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, fmt.Errorf("invalid params: %w", err)
+	}
+
+	agentUUID, err := uuid.Parse(p.AgentID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid agent_id: %w", err)
+	}
+
+	certs, err := m.storage.ListAgentCertificates(ctx, agentUUID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list certificates: %w", err)
+	}
+
+	return map[string]interface{}{
+		"certificates": certs,
+	}, nil
+}
+
+// RevokeAgentCertMethod 吊销Agent证书
+// 指定serial时吊销单个证书，只指定agent_id时吊销该Agent的全部证书
+type RevokeAgentCertMethod struct {
+	storage storage.Storage
+}
+
+func NewRevokeAgentCertMethod(storage storage.Storage) *RevokeAgentCertMethod {
+	return &RevokeAgentCertMethod{storage: storage}
+}
+
+func (m *RevokeAgentCertMethod) Name() string {
+	return "plumber.agent.revokeCert"
+}
+
+func (m *RevokeAgentCertMethod) Permission() string {
+	return auth.PermAgentWrite
+}
+
+type RevokeAgentCertParams struct {
+	AgentID string `json:"agent_id,omitempty"`
+	Serial  string `json:"serial,omitempty"`
+}
+
+func (m *RevokeAgentCertMethod) Execute(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var p RevokeAgentCertParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, fmt.Errorf("invalid params: %w", err)
+	}
+
+	if p.Serial != "" {
+		if err := m.storage.RevokeAgentCertificate(ctx, p.Serial); err != nil {
+			return nil, fmt.Errorf("failed to revoke certificate: %w", err)
+		}
+		return map[string]interface{}{
+			"status":  "revoked",
+			"revoked": 1,
+		}, nil
+	}
+
+	agentUUID, err := uuid.Parse(p.AgentID)
+	if err != nil {
+		return nil, fmt.Errorf("serial or agent_id is required")
+	}
+
+	count, err := m.storage.RevokeAgentCertificatesByAgent(ctx, agentUUID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to revoke certificates: %w", err)
+	}
+
+	return map[string]interface{}{
+		"status":  "revoked",
+		"revoked": count,
+	}, nil
+}
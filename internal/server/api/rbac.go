@@ -0,0 +1,242 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/BurntSushi/toml"
+	"github.com/google/uuid"
+	"github.com/plumber/plumber/internal/server/storage"
+	"github.com/plumber/plumber/pkg/auth"
+	"github.com/plumber/plumber/pkg/models"
+)
+
+// scopeTarget 从RPC参数中提取的资源标识，用于范围检查
+type scopeTarget struct {
+	TaskID      string   `json:"task_id"`
+	AgentID     string   `json:"agent_id"`
+	AgentIDs    []string `json:"agent_ids"`
+	ExecutionID string   `json:"execution_id"`
+	DeployJobID string   `json:"job_id"`
+	Config      string   `json:"config"`
+}
+
+// accessChecker 集中校验用户的角色权限和资源范围
+type accessChecker struct {
+	storage storage.Storage
+}
+
+func newAccessChecker(storage storage.Storage) *accessChecker {
+	return &accessChecker{storage: storage}
+}
+
+// Authorize 检查用户是否可以以给定参数调用需要permission的方法
+func (c *accessChecker) Authorize(ctx context.Context, user *models.User, permission string, params json.RawMessage) error {
+	if !auth.HasPermission(user.Role, permission) {
+		return fmt.Errorf("permission denied: %s required", permission)
+	}
+
+	if user.Scope.IsEmpty() || len(params) == 0 {
+		return nil
+	}
+
+	// 受限用户的范围检查失败即拒绝：参数无法解析、ID无效或资源不存在都视为不在范围内，
+	// 且每个目标字段都要检查，避免一个无效字段跳过其余检查
+	var target scopeTarget
+	if err := json.Unmarshal(params, &target); err != nil {
+		return fmt.Errorf("permission denied: invalid params for scope check")
+	}
+
+	if target.ExecutionID != "" {
+		executionUUID, err := uuid.Parse(target.ExecutionID)
+		if err != nil {
+			return fmt.Errorf("permission denied: invalid execution_id")
+		}
+		execution, err := c.storage.GetExecution(ctx, executionUUID)
+		if err != nil {
+			return fmt.Errorf("permission denied: execution not found")
+		}
+		if err := c.authorizeTask(ctx, user.Scope, execution.TaskID); err != nil {
+			return err
+		}
+	}
+
+	if target.TaskID != "" {
+		taskUUID, err := uuid.Parse(target.TaskID)
+		if err != nil {
+			return fmt.Errorf("permission denied: invalid task_id")
+		}
+		if err := c.authorizeTask(ctx, user.Scope, taskUUID); err != nil {
+			return err
+		}
+	}
+
+	agentIDs := target.AgentIDs
+	if target.AgentID != "" {
+		agentIDs = append(agentIDs, target.AgentID)
+	}
+	for _, agentID := range agentIDs {
+		if !c.agentIDInScope(ctx, user.Scope, agentID) {
+			return fmt.Errorf("permission denied: agent is outside your scope")
+		}
+	}
+
+	// 部署任务涉及的全部Agent都必须在范围内
+	if target.DeployJobID != "" {
+		jobUUID, err := uuid.Parse(target.DeployJobID)
+		if err != nil {
+			return fmt.Errorf("permission denied: invalid job_id")
+		}
+		job, err := c.storage.GetDeployJob(ctx, jobUUID)
+		if err != nil {
+			return fmt.Errorf("permission denied: deploy job not found")
+		}
+		if !c.DeployJobInScope(ctx, user.Scope, job) {
+			return fmt.Errorf("permission denied: deploy job includes agents outside your scope")
+		}
+	}
+
+	// 创建/修改任务时，配置中引用的Agent和制品也必须在范围内
+	if target.Config != "" && !c.configInScope(ctx, user.Scope, target.Config) {
+		return fmt.Errorf("permission denied: task config references agents or artifacts outside your scope")
+	}
+
+	return nil
+}
+
+// authorizeTask 任务必须存在且在范围内
+func (c *accessChecker) authorizeTask(ctx context.Context, scope models.UserScope, taskID uuid.UUID) error {
+	task, err := c.storage.GetTask(ctx, taskID)
+	if err != nil {
+		return fmt.Errorf("permission denied: task not found")
+	}
+	if !c.TaskInScope(ctx, scope, task) {
+		return fmt.Errorf("permission denied: task is outside your scope")
+	}
+	return nil
+}
+
+// agentIDInScope Agent是否在范围内，ID无效或Agent不存在时视为不在范围内
+func (c *accessChecker) agentIDInScope(ctx context.Context, scope models.UserScope, agentID string) bool {
+	agentUUID, err := uuid.Parse(agentID)
+	if err != nil {
+		return false
+	}
+	agent, err := c.storage.GetAgent(ctx, agentUUID)
+	if err != nil {
+		return false
+	}
+	return scope.AllowsAgent(agent)
+}
+
+// DeployJobInScope 部署任务的全部目标Agent是否都在范围内，已删除的Agent视为不在范围内
+func (c *accessChecker) DeployJobInScope(ctx context.Context, scope models.UserScope, job *models.DeployJob) bool {
+	if len(scope.AgentLabels) == 0 {
+		return true
+	}
+	for _, target := range job.Targets {
+		agent, err := c.storage.GetAgent(ctx, target.AgentID)
+		if err != nil || !scope.AllowsAgent(agent) {
+			return false
+		}
+	}
+	return true
+}
+
+// TaskInScope 任务本身及其引用的全部Agent是否都在范围内
+func (c *accessChecker) TaskInScope(ctx context.Context, scope models.UserScope, task *models.Task) bool {
+	if !scope.AllowsTaskID(task.ID.String()) {
+		return false
+	}
+	return c.configAgentsInScope(ctx, scope, task.Config)
+}
+
+// ArtifactInScope 制品是否在范围内：用户上传的制品不受限制，执行记录产生的制品所属任务需在范围内
+func (c *accessChecker) ArtifactInScope(ctx context.Context, scope models.UserScope, artifact *models.Artifact) bool {
+	if artifact.ExecutionID == nil || scope.IsEmpty() {
+		return true
+	}
+	execution, err := c.storage.GetExecution(ctx, *artifact.ExecutionID)
+	if err != nil {
+		return false
+	}
+	task, err := c.storage.GetTask(ctx, execution.TaskID)
+	if err != nil {
+		return false
+	}
+	return c.TaskInScope(ctx, scope, task)
+}
+
+// configInScope 创建/修改任务时检查配置：引用的Agent和upload步骤引用的制品都必须在范围内。
+// 保存时尚不存在的制品在执行时再检查
+func (c *accessChecker) configInScope(ctx context.Context, scope models.UserScope, config string) bool {
+	if !c.configAgentsInScope(ctx, scope, config) {
+		return false
+	}
+	if scope.IsEmpty() {
+		return true
+	}
+
+	var taskConfig models.TaskConfig
+	if err := toml.Unmarshal([]byte(config), &taskConfig); err != nil {
+		return false
+	}
+	for _, step := range taskConfig.Steps {
+		if step.Type != models.StepTypeUpload || step.Artifact == "" {
+			continue
+		}
+		artifact, err := findArtifact(ctx, c.storage, step.Artifact)
+		if err != nil {
+			continue
+		}
+		if !c.ArtifactInScope(ctx, scope, artifact) {
+			return false
+		}
+	}
+	return true
+}
+
+// configAgentsInScope 配置中引用的全部Agent是否都在范围内
+func (c *accessChecker) configAgentsInScope(ctx context.Context, scope models.UserScope, config string) bool {
+	if len(scope.AgentLabels) == 0 {
+		return true
+	}
+
+	var taskConfig models.TaskConfig
+	if err := toml.Unmarshal([]byte(config), &taskConfig); err != nil {
+		return false
+	}
+
+	for _, step := range taskConfig.Steps {
+		agentUUID, err := uuid.Parse(step.ServerID)
+		if err != nil {
+			return false
+		}
+		agent, err := c.storage.GetAgent(ctx, agentUUID)
+		if err != nil || !scope.AllowsAgent(agent) {
+			return false
+		}
+	}
+	return true
+}
+
+// userScopeFromContext 获取当前用户的资源范围，未登录或无限制时返回空范围
+func userScopeFromContext(ctx context.Context) models.UserScope {
+	if user, ok := GetUserFromContext(ctx); ok {
+		return user.Scope
+	}
+	return models.UserScope{}
+}
+
+// hasPermission 当前用户是否拥有指定权限，使用API令牌时还需在令牌的权限范围内
+func hasPermission(ctx context.Context, permission string) bool {
+	user, ok := GetUserFromContext(ctx)
+	if !ok || !auth.HasPermission(user.Role, permission) {
+		return false
+	}
+	if token, ok := GetAPITokenFromContext(ctx); ok && !token.AllowsPermission(permission) {
+		return false
+	}
+	return true
+}
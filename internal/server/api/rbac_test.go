@@ -0,0 +1,181 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/plumber/plumber/pkg/auth"
+	"github.com/plumber/plumber/pkg/models"
+)
+
+// rbacFixture 范围为 team=a 时，*In 的资源在范围内，*Out 的资源不在
+type rbacFixture struct {
+	storage *memStorage
+
+	agentIn, agentOut         uuid.UUID
+	taskIn, taskOut           uuid.UUID
+	executionIn, executionOut uuid.UUID
+	jobIn, jobOut             uuid.UUID
+	artifactIn, artifactOut   uuid.UUID
+}
+
+func taskConfigFor(agentIDs ...uuid.UUID) string {
+	config := ""
+	for _, id := range agentIDs {
+		config += fmt.Sprintf("[[step]]\nServerID = %q\nCMD = \"echo\"\n\n", id)
+	}
+	return config
+}
+
+func newRBACFixture() *rbacFixture {
+	f := &rbacFixture{
+		storage:      newMemStorage(),
+		agentIn:      uuid.New(),
+		agentOut:     uuid.New(),
+		taskIn:       uuid.New(),
+		taskOut:      uuid.New(),
+		executionIn:  uuid.New(),
+		executionOut: uuid.New(),
+		jobIn:        uuid.New(),
+		jobOut:       uuid.New(),
+		artifactIn:   uuid.New(),
+		artifactOut:  uuid.New(),
+	}
+	s := f.storage
+	s.agents[f.agentIn] = &models.Agent{ID: f.agentIn, Labels: map[string]string{"team": "a"}}
+	s.agents[f.agentOut] = &models.Agent{ID: f.agentOut, Labels: map[string]string{"team": "b"}}
+	s.tasks[f.taskIn] = &models.Task{ID: f.taskIn, Config: taskConfigFor(f.agentIn)}
+	s.tasks[f.taskOut] = &models.Task{ID: f.taskOut, Config: taskConfigFor(f.agentIn, f.agentOut)}
+	s.executions[f.executionIn] = &models.TaskExecution{ID: f.executionIn, TaskID: f.taskIn}
+	s.executions[f.executionOut] = &models.TaskExecution{ID: f.executionOut, TaskID: f.taskOut}
+	s.jobs[f.jobIn] = &models.DeployJob{ID: f.jobIn, Targets: []models.DeployTarget{{AgentID: f.agentIn}}}
+	s.jobs[f.jobOut] = &models.DeployJob{ID: f.jobOut, Targets: []models.DeployTarget{{AgentID: f.agentIn}, {AgentID: f.agentOut}}}
+	s.artifacts[f.artifactIn] = &models.Artifact{ID: f.artifactIn, Name: "in.tar.gz", ExecutionID: &f.executionIn}
+	s.artifacts[f.artifactOut] = &models.Artifact{ID: f.artifactOut, Name: "out.tar.gz", ExecutionID: &f.executionOut}
+	return f
+}
+
+func TestAuthorizeScope(t *testing.T) {
+	f := newRBACFixture()
+	missing := uuid.New()
+	scoped := &models.User{Role: auth.RoleAdmin, Scope: models.UserScope{AgentLabels: map[string]string{"team": "a"}}}
+
+	tests := []struct {
+		name    string
+		user    *models.User
+		perm    string
+		params  interface{}
+		allowed bool
+	}{
+		{"role without permission", &models.User{Role: auth.RoleViewer}, auth.PermTaskRun, nil, false},
+		{"unscoped user skips scope checks", &models.User{Role: auth.RoleAdmin}, auth.PermAgentRead,
+			map[string]string{"agent_id": "not-a-uuid"}, true},
+		{"unparsable params", scoped, auth.PermAgentRead, json.RawMessage(`{"agent_id": 1}`), false},
+
+		{"agent in scope", scoped, auth.PermAgentRead, map[string]string{"agent_id": f.agentIn.String()}, true},
+		{"agent out of scope", scoped, auth.PermAgentRead, map[string]string{"agent_id": f.agentOut.String()}, false},
+		{"invalid agent_id", scoped, auth.PermAgentRead, map[string]string{"agent_id": "x"}, false},
+		{"missing agent", scoped, auth.PermAgentRead, map[string]string{"agent_id": missing.String()}, false},
+		{"agent_ids in scope with agent_id out of scope", scoped, auth.PermAgentDeploy, map[string]interface{}{
+			"agent_ids": []string{f.agentIn.String()}, "agent_id": f.agentOut.String()}, false},
+		{"agent_id in scope with agent_ids out of scope", scoped, auth.PermAgentDeploy, map[string]interface{}{
+			"agent_ids": []string{f.agentIn.String(), f.agentOut.String()}, "agent_id": f.agentIn.String()}, false},
+		{"agent_ids and agent_id in scope", scoped, auth.PermAgentDeploy, map[string]interface{}{
+			"agent_ids": []string{f.agentIn.String()}, "agent_id": f.agentIn.String()}, true},
+
+		{"task in scope", scoped, auth.PermTaskRead, map[string]string{"task_id": f.taskIn.String()}, true},
+		{"task referencing agent out of scope", scoped, auth.PermTaskRead, map[string]string{"task_id": f.taskOut.String()}, false},
+		{"invalid task_id", scoped, auth.PermTaskRead, map[string]string{"task_id": "x"}, false},
+		{"missing task", scoped, auth.PermTaskRead, map[string]string{"task_id": missing.String()}, false},
+		{"invalid task_id does not skip agent check", scoped, auth.PermTaskRead, map[string]string{
+			"task_id": "x", "agent_id": f.agentOut.String()}, false},
+
+		{"execution in scope", scoped, auth.PermTaskRead, map[string]string{"execution_id": f.executionIn.String()}, true},
+		{"execution out of scope", scoped, auth.PermTaskRead, map[string]string{"execution_id": f.executionOut.String()}, false},
+		{"missing execution", scoped, auth.PermTaskRead, map[string]string{"execution_id": missing.String()}, false},
+		{"invalid execution_id does not skip task check", scoped, auth.PermTaskRun, map[string]string{
+			"execution_id": "x", "task_id": f.taskOut.String()}, false},
+		{"execution in scope does not hide task out of scope", scoped, auth.PermTaskRun, map[string]string{
+			"execution_id": f.executionIn.String(), "task_id": f.taskOut.String()}, false},
+
+		{"deploy job in scope", scoped, auth.PermAgentDeploy, map[string]string{"job_id": f.jobIn.String()}, true},
+		{"deploy job with a target out of scope", scoped, auth.PermAgentDeploy, map[string]string{"job_id": f.jobOut.String()}, false},
+		{"invalid job_id", scoped, auth.PermAgentDeploy, map[string]string{"job_id": "x"}, false},
+		{"missing deploy job", scoped, auth.PermAgentDeploy, map[string]string{"job_id": missing.String()}, false},
+		{"invalid job_id does not skip agent check", scoped, auth.PermAgentDeploy, map[string]string{
+			"job_id": "x", "agent_id": f.agentIn.String()}, false},
+
+		{"config in scope", scoped, auth.PermTaskWrite, map[string]string{"config": taskConfigFor(f.agentIn)}, true},
+		{"config referencing agent out of scope", scoped, auth.PermTaskWrite, map[string]string{
+			"config": taskConfigFor(f.agentIn, f.agentOut)}, false},
+		{"config with unparsable ServerID", scoped, auth.PermTaskWrite, map[string]string{
+			"config": "[[step]]\nServerID = \"web-1\"\nCMD = \"echo\"\n"}, false},
+		{"config with invalid TOML", scoped, auth.PermTaskWrite, map[string]string{"config": "[[step]\n"}, false},
+		{"config uploading artifact in scope", scoped, auth.PermTaskWrite, map[string]string{"config": fmt.Sprintf(
+			"[[step]]\nServerID = %q\nType = \"upload\"\nArtifact = %q\nDest = \"/tmp/a\"\n", f.agentIn, f.artifactIn)}, true},
+		{"config uploading artifact out of scope by ID", scoped, auth.PermTaskWrite, map[string]string{"config": fmt.Sprintf(
+			"[[step]]\nServerID = %q\nType = \"upload\"\nArtifact = %q\nDest = \"/tmp/a\"\n", f.agentIn, f.artifactOut)}, false},
+		{"config uploading artifact out of scope by name", scoped, auth.PermTaskWrite, map[string]string{"config": fmt.Sprintf(
+			"[[step]]\nServerID = %q\nType = \"upload\"\nArtifact = \"out.tar.gz\"\nDest = \"/tmp/a\"\n", f.agentIn)}, false},
+
+		{"task ID scope", &models.User{Role: auth.RoleAdmin, Scope: models.UserScope{TaskIDs: []string{f.taskIn.String()}}},
+			auth.PermTaskRead, map[string]string{"task_id": f.taskIn.String()}, true},
+		{"task ID scope excludes other tasks", &models.User{Role: auth.RoleAdmin, Scope: models.UserScope{TaskIDs: []string{f.taskIn.String()}}},
+			auth.PermTaskRead, map[string]string{"task_id": f.taskOut.String()}, false},
+	}
+
+	checker := newAccessChecker(f.storage)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var params json.RawMessage
+			switch p := tt.params.(type) {
+			case nil:
+			case json.RawMessage:
+				params = p
+			default:
+				data, err := json.Marshal(p)
+				if err != nil {
+					t.Fatal(err)
+				}
+				params = data
+			}
+
+			err := checker.Authorize(context.Background(), tt.user, tt.perm, params)
+			if tt.allowed && err != nil {
+				t.Errorf("expected access, got %v", err)
+			}
+			if !tt.allowed && err == nil {
+				t.Error("expected access to be denied")
+			}
+		})
+	}
+}
+
+func TestDeployJobInScope(t *testing.T) {
+	f := newRBACFixture()
+	checker := newAccessChecker(f.storage)
+	scope := models.UserScope{AgentLabels: map[string]string{"team": "a"}}
+	deleted := &models.DeployJob{Targets: []models.DeployTarget{{AgentID: uuid.New()}}}
+
+	tests := []struct {
+		name  string
+		scope models.UserScope
+		job   *models.DeployJob
+		want  bool
+	}{
+		{"all targets in scope", scope, f.storage.jobs[f.jobIn], true},
+		{"one target out of scope", scope, f.storage.jobs[f.jobOut], false},
+		{"deleted agent", scope, deleted, false},
+		{"no agent labels", models.UserScope{TaskIDs: []string{f.taskIn.String()}}, f.storage.jobs[f.jobOut], true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := checker.DeployJobInScope(context.Background(), tt.scope, tt.job); got != tt.want {
+				t.Errorf("DeployJobInScope = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/google/uuid"
+	"github.com/plumber/plumber/internal/server/storage"
+	"github.com/plumber/plumber/pkg/auth"
+)
+
+// ListRecordingsMethod 列出WebSSH会话录像
+type ListRecordingsMethod struct {
+	storage storage.Storage
+}
+
+func NewListRecordingsMethod(storage storage.Storage) *ListRecordingsMethod {
+	return &ListRecordingsMethod{storage: storage}
+}
+
+func (m *ListRecordingsMethod) Name() string {
+	return "plumber.recording.list"
+}
+
+func (m *ListRecordingsMethod) Permission() string {
+	return auth.PermRecordRead
+}
+
+func (m *ListRecordingsMethod) Audit() bool {
+	return false
+}
+
+type ListRecordingsParams struct {
+	UserID  string `json:"user_id,omitempty"`
+	AgentID string `json:"agent_id,omitempty"`
+	Limit   int    `json:"limit,omitempty"` // 默认50，最大500
+	Offset  int    `json:"offset,omitempty"`
+}
+
+func (m *ListRecordingsMethod) Execute(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var p ListRecordingsParams
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, fmt.Errorf("invalid params: %w", err)
+		}
+	}
+
+	filter := storage.TerminalRecordingFilter{
+		Limit:  p.Limit,
+		Offset: p.Offset,
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = 50
+	}
+	if filter.Limit > 500 {
+		filter.Limit = 500
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+
+	if p.UserID != "" {
+		userID, err := uuid.Parse(p.UserID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid user_id: %w", err)
+		}
+		filter.UserID = &userID
+	}
+	if p.AgentID != "" {
+		agentID, err := uuid.Parse(p.AgentID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid agent_id: %w", err)
+		}
+		filter.AgentID = &agentID
+	}
+
+	recordings, total, err := m.storage.ListTerminalRecordings(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list recordings: %w", err)
+	}
+
+	// 有范围限制的用户只能看到范围内Agent的录像，Agent已删除的录像不可见
+	if scope := userScopeFromContext(ctx); !scope.IsEmpty() {
+		allowed := make(map[uuid.UUID]bool)
+		visible := recordings[:0]
+		for _, recording := range recordings {
+			ok, checked := allowed[recording.AgentID]
+			if !checked {
+				agent, err := m.storage.GetAgent(ctx, recording.AgentID)
+				ok = err == nil && scope.AllowsAgent(agent)
+				allowed[recording.AgentID] = ok
+			}
+			if ok {
+				visible = append(visible, recording)
+			}
+		}
+		recordings = visible
+	}
+
+	return map[string]interface{}{
+		"recordings": recordings,
+		"total":      total,
+	}, nil
+}
+
+// GetRecordingMethod 获取会话录像及其asciicast内容
+// 大文件建议通过 /api/webssh/recording?id=... 下载
+type GetRecordingMethod struct {
+	storage storage.Storage
+}
+
+func NewGetRecordingMethod(storage storage.Storage) *GetRecordingMethod {
+	return &GetRecordingMethod{storage: storage}
+}
+
+func (m *GetRecordingMethod) Name() string {
+	return "plumber.recording.get"
+}
+
+func (m *GetRecordingMethod) Permission() string {
+	return auth.PermRecordRead
+}
+
+type GetRecordingParams struct {
+	ID string `json:"id"`
+}
+
+func (m *GetRecordingMethod) Execute(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var p GetRecordingParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, fmt.Errorf("invalid params: %w", err)
+	}
+
+	id, err := uuid.Parse(p.ID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id: %w", err)
+	}
+
+	recording, err := m.storage.GetTerminalRecording(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("recording not found: %w", err)
+	}
+
+	// 录像所属Agent需在用户范围内，Agent已删除时有范围限制的用户无法查看
+	if scope := userScopeFromContext(ctx); !scope.IsEmpty() {
+		agent, err := m.storage.GetAgent(ctx, recording.AgentID)
+		if err != nil || !scope.AllowsAgent(agent) {
+			return nil, fmt.Errorf("permission denied: agent is outside your scope")
+		}
+	}
+
+	content, err := os.ReadFile(recording.FilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recording: %w", err)
+	}
+
+	return map[string]interface{}{
+		"recording": recording,
+		"content":   string(content),
+	}, nil
+}
@@ -8,11 +8,15 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/plumber/plumber/internal/server/artifacts"
+	"github.com/plumber/plumber/internal/server/pki"
+	"github.com/plumber/plumber/internal/server/relay"
+	"github.com/plumber/plumber/internal/server/secrets"
+	"github.com/plumber/plumber/internal/server/sshdial"
 	"github.com/plumber/plumber/internal/server/storage"
 	"github.com/plumber/plumber/pkg/auth"
 	"github.com/plumber/plumber/pkg/jsonrpc"
 	"github.com/plumber/plumber/pkg/models"
-	"golang.org/x/crypto/ssh"
 )
 
 // AgentRegisterMethod Agent注册方法
@@ -28,14 +32,21 @@ func (m *AgentRegisterMethod) Name() string {
 	return "plumber.agent.register"
 }
 
-func (m *AgentRegisterMethod) RequireAuth() bool {
-	return false
+func (m *AgentRegisterMethod) Permission() string {
+	return jsonrpc.PermissionAgent
+}
+
+func (m *AgentRegisterMethod) Audit() bool {
+	return true
 }
 
 type AgentRegisterParams struct {
 	AgentID  string `json:"agent_id"`
 	Hostname string `json:"hostname"`
 	IP       string `json:"ip"`
+	Version  string `json:"version"`
+	OS       string `json:"os"`
+	Arch     string `json:"arch"`
 }
 
 func (m *AgentRegisterMethod) Execute(ctx context.Context, params json.RawMessage) (interface{}, error) {
@@ -44,9 +55,9 @@ func (m *AgentRegisterMethod) Execute(ctx context.Context, params json.RawMessag
 		return nil, fmt.Errorf("invalid params: %w", err)
 	}
 
-	agentUUID, err := uuid.Parse(p.AgentID)
+	agentUUID, err := authenticatedAgentID(ctx, p.AgentID)
 	if err != nil {
-		return nil, fmt.Errorf("invalid agent_id: %w", err)
+		return nil, err
 	}
 
 	// 尝试获取现有agent
@@ -55,9 +66,13 @@ func (m *AgentRegisterMethod) Execute(ctx context.Context, params json.RawMessag
 		// Agent已存在,更新状态和实际信息
 		existing.Hostname = p.Hostname
 		existing.IP = p.IP
+		existing.Version = p.Version
+		existing.OS = p.OS
+		existing.Arch = p.Arch
 		existing.Status = "online"
 		now := time.Now()
 		existing.LastHeartbeat = &now
+		existing.RegisteredAt = &now
 
 		if err := m.storage.UpdateAgent(ctx, existing); err != nil {
 			return nil, err
@@ -75,18 +90,24 @@ func (m *AgentRegisterMethod) Execute(ctx context.Context, params json.RawMessag
 // AgentHeartbeatMethod Agent心跳方法
 type AgentHeartbeatMethod struct {
 	storage storage.Storage
+	broker  *relay.Broker
+	updates *selfUpdater
 }
 
-func NewAgentHeartbeatMethod(storage storage.Storage) *AgentHeartbeatMethod {
-	return &AgentHeartbeatMethod{storage: storage}
+func NewAgentHeartbeatMethod(storage storage.Storage, broker *relay.Broker, updates *selfUpdater) *AgentHeartbeatMethod {
+	return &AgentHeartbeatMethod{
+		storage: storage,
+		broker:  broker,
+		updates: updates,
+	}
 }
 
 func (m *AgentHeartbeatMethod) Name() string {
 	return "plumber.agent.heartbeat"
 }
 
-func (m *AgentHeartbeatMethod) RequireAuth() bool {
-	return false
+func (m *AgentHeartbeatMethod) Permission() string {
+	return jsonrpc.PermissionAgent
 }
 
 type AgentHeartbeatParams struct {
@@ -99,32 +120,41 @@ func (m *AgentHeartbeatMethod) Execute(ctx context.Context, params json.RawMessa
 		return nil, fmt.Errorf("invalid params: %w", err)
 	}
 
-	agentUUID, err := uuid.Parse(p.AgentID)
+	agentUUID, err := authenticatedAgentID(ctx, p.AgentID)
 	if err != nil {
-		return nil, fmt.Errorf("invalid agent_id: %w", err)
+		return nil, err
 	}
 
 	if err := m.storage.UpdateAgentHeartbeat(ctx, agentUUID); err != nil {
 		return nil, fmt.Errorf("failed to update heartbeat: %w", err)
 	}
 
-	return map[string]interface{}{
+	result := map[string]interface{}{
 		"status": "ok",
-	}, nil
+	}
+	// 下发等待Agent连回的终端请求
+	if terminals := m.broker.Pending(agentUUID); len(terminals) > 0 {
+		result["terminals"] = terminals
+	}
+	// 设置了目标版本且版本不一致时下发自更新信息
+	if agent, err := m.storage.GetAgent(ctx, agentUUID); err == nil {
+		if offer := m.updates.offer(agent); offer != nil {
+			result["update"] = offer
+		}
+	}
+	return result, nil
 }
 
 // UserLoginMethod 用户登录方法
 type UserLoginMethod struct {
-	jwtManager    *auth.JWTManager
-	adminUsername string
-	adminPassword string
+	storage  storage.Storage
+	sessions *sessionManager
 }
 
-func NewUserLoginMethod(jwtManager *auth.JWTManager, adminUsername, adminPassword string) *UserLoginMethod {
+func NewUserLoginMethod(storage storage.Storage, sessions *sessionManager) *UserLoginMethod {
 	return &UserLoginMethod{
-		jwtManager:    jwtManager,
-		adminUsername: adminUsername,
-		adminPassword: adminPassword,
+		storage:  storage,
+		sessions: sessions,
 	}
 }
 
@@ -132,8 +162,8 @@ func (m *UserLoginMethod) Name() string {
 	return "plumber.user.login"
 }
 
-func (m *UserLoginMethod) RequireAuth() bool {
-	return false
+func (m *UserLoginMethod) Permission() string {
+	return jsonrpc.PermissionPublic
 }
 
 type UserLoginParams struct {
@@ -147,24 +177,17 @@ func (m *UserLoginMethod) Execute(ctx context.Context, params json.RawMessage) (
 		return nil, fmt.Errorf("invalid params: %w", err)
 	}
 
-	// 直接从配置验证用户名和密码
-	if p.Username != m.adminUsername || p.Password != m.adminPassword {
+	// 从用户表验证用户名和密码
+	user, err := m.storage.GetUserByUsername(ctx, p.Username)
+	if err != nil || !auth.CheckPassword(p.Password, user.Password) {
 		return nil, fmt.Errorf("invalid username or password")
 	}
 
-	// 生成用户ID (使用固定UUID或用户名hash)
-	userID := "admin"
-
-	token, err := m.jwtManager.Generate(userID, p.Username)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate token: %w", err)
+	if user.Disabled {
+		return nil, fmt.Errorf("user is disabled")
 	}
 
-	return map[string]interface{}{
-		"token":    token,
-		"username": p.Username,
-		"user_id":  userID,
-	}, nil
+	return m.sessions.Start(ctx, user)
 }
 
 // ListAgentsMethod 列出所有Agent
@@ -180,8 +203,8 @@ func (m *ListAgentsMethod) Name() string {
 	return "plumber.agent.list"
 }
 
-func (m *ListAgentsMethod) RequireAuth() bool {
-	return true
+func (m *ListAgentsMethod) Permission() string {
+	return auth.PermAgentRead
 }
 
 func (m *ListAgentsMethod) Execute(ctx context.Context, params json.RawMessage) (interface{}, error) {
@@ -190,6 +213,17 @@ func (m *ListAgentsMethod) Execute(ctx context.Context, params json.RawMessage)
 		return nil, fmt.Errorf("failed to list agents: %w", err)
 	}
 
+	// 只返回当前用户范围内的Agent
+	if scope := userScopeFromContext(ctx); !scope.IsEmpty() {
+		visible := make([]*models.Agent, 0, len(agents))
+		for _, agent := range agents {
+			if scope.AllowsAgent(agent) {
+				visible = append(visible, agent)
+			}
+		}
+		agents = visible
+	}
+
 	return map[string]interface{}{
 		"agents": agents,
 	}, nil
@@ -208,14 +242,16 @@ func (m *CreateTaskMethod) Name() string {
 	return "plumber.task.create"
 }
 
-func (m *CreateTaskMethod) RequireAuth() bool {
-	return true
+func (m *CreateTaskMethod) Permission() string {
+	return auth.PermTaskWrite
 }
 
 type CreateTaskParams struct {
 	Name        string `json:"name"`
 	Description string `json:"description"`
 	Config      string `json:"config"` // TOML配置
+
+	SkipValidation bool `json:"skip_validation,omitempty"` // 跳过Agent引用检查（如引用的Agent尚未注册），配置本身仍会校验
 }
 
 func (m *CreateTaskMethod) Execute(ctx context.Context, params json.RawMessage) (interface{}, error) {
@@ -224,6 +260,10 @@ func (m *CreateTaskMethod) Execute(ctx context.Context, params json.RawMessage)
 		return nil, fmt.Errorf("invalid params: %w", err)
 	}
 
+	if err := checkTaskConfig(ctx, m.storage, p.Config, p.SkipValidation); err != nil {
+		return nil, err
+	}
+
 	task := &models.Task{
 		Name:        p.Name,
 		Description: p.Description,
@@ -254,8 +294,8 @@ func (m *UpdateTaskMethod) Name() string {
 	return "plumber.task.update"
 }
 
-func (m *UpdateTaskMethod) RequireAuth() bool {
-	return true
+func (m *UpdateTaskMethod) Permission() string {
+	return auth.PermTaskWrite
 }
 
 type UpdateTaskParams struct {
@@ -263,6 +303,8 @@ type UpdateTaskParams struct {
 	Name        string `json:"name"`
 	Description string `json:"description"`
 	Config      string `json:"config"`
+
+	SkipValidation bool `json:"skip_validation,omitempty"` // 跳过Agent引用检查，配置本身仍会校验
 }
 
 func (m *UpdateTaskMethod) Execute(ctx context.Context, params json.RawMessage) (interface{}, error) {
@@ -281,6 +323,10 @@ func (m *UpdateTaskMethod) Execute(ctx context.Context, params json.RawMessage)
 		return nil, fmt.Errorf("task not found: %w", err)
 	}
 
+	if err := checkTaskConfig(ctx, m.storage, p.Config, p.SkipValidation); err != nil {
+		return nil, err
+	}
+
 	// 更新字段
 	if p.Name != "" {
 		task.Name = p.Name
@@ -311,8 +357,8 @@ func (m *ListTasksMethod) Name() string {
 	return "plumber.task.list"
 }
 
-func (m *ListTasksMethod) RequireAuth() bool {
-	return true
+func (m *ListTasksMethod) Permission() string {
+	return auth.PermTaskRead
 }
 
 func (m *ListTasksMethod) Execute(ctx context.Context, params json.RawMessage) (interface{}, error) {
@@ -321,6 +367,18 @@ func (m *ListTasksMethod) Execute(ctx context.Context, params json.RawMessage) (
 		return nil, fmt.Errorf("failed to list tasks: %w", err)
 	}
 
+	// 只返回当前用户范围内的任务
+	if scope := userScopeFromContext(ctx); !scope.IsEmpty() {
+		access := newAccessChecker(m.storage)
+		visible := make([]*models.Task, 0, len(tasks))
+		for _, task := range tasks {
+			if access.TaskInScope(ctx, scope, task) {
+				visible = append(visible, task)
+			}
+		}
+		tasks = visible
+	}
+
 	return map[string]interface{}{
 		"tasks": tasks,
 	}, nil
@@ -339,8 +397,8 @@ func (m *PollTaskMethod) Name() string {
 	return "plumber.agent.pollTask"
 }
 
-func (m *PollTaskMethod) RequireAuth() bool {
-	return false
+func (m *PollTaskMethod) Permission() string {
+	return jsonrpc.PermissionAgent
 }
 
 type PollTaskParams struct {
@@ -353,9 +411,9 @@ func (m *PollTaskMethod) Execute(ctx context.Context, params json.RawMessage) (i
 		return nil, fmt.Errorf("invalid params: %w", err)
 	}
 
-	agentUUID, err := uuid.Parse(p.AgentID)
+	agentUUID, err := authenticatedAgentID(ctx, p.AgentID)
 	if err != nil {
-		return nil, fmt.Errorf("invalid agent_id: %w", err)
+		return nil, err
 	}
 
 	// 获取待执行的步骤（限制1个，避免一次拉取太多）
@@ -388,8 +446,10 @@ func (m *PollTaskMethod) Execute(ctx context.Context, params json.RawMessage) (i
 		"has_task": true,
 		"task": map[string]interface{}{
 			"step_id": step.ID.String(),
+			"type":    step.Type,
 			"path":    step.Path,
 			"command": step.Command,
+			"spec":    step.Spec,
 		},
 	}, nil
 }
@@ -407,8 +467,8 @@ func (m *StepReportMethod) Name() string {
 	return "plumber.step.report"
 }
 
-func (m *StepReportMethod) RequireAuth() bool {
-	return false
+func (m *StepReportMethod) Permission() string {
+	return jsonrpc.PermissionAgent
 }
 
 type StepReportParams struct {
@@ -429,11 +489,23 @@ func (m *StepReportMethod) Execute(ctx context.Context, params json.RawMessage)
 		return nil, fmt.Errorf("invalid step_id: %w", err)
 	}
 
+	agentUUID, err := authenticatedAgentID(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
 	step, err := m.storage.GetStepExecution(ctx, stepUUID)
 	if err != nil {
 		return nil, fmt.Errorf("step not found: %w", err)
 	}
 
+	// 只允许上报分配给自己的步骤
+	if step.AgentID != agentUUID || !step.Assigned {
+		log.Printf("[Server] Rejected step report - AgentID: %s, StepID: %s, AssignedAgent: %s",
+			agentUUID, step.ID, step.AgentID)
+		return nil, fmt.Errorf("step is not assigned to this agent")
+	}
+
 	now := time.Now()
 	step.Status = p.Status
 	step.ExitCode = &p.ExitCode
@@ -452,11 +524,15 @@ func (m *StepReportMethod) Execute(ctx context.Context, params json.RawMessage)
 // CreateAgentMethod 创建Agent
 type CreateAgentMethod struct {
 	storage storage.Storage
+	config  *agentConfigBuilder
+	keyring *secrets.Keyring
 }
 
-func NewCreateAgentMethod(storage storage.Storage) *CreateAgentMethod {
+func NewCreateAgentMethod(storage storage.Storage, config *agentConfigBuilder, keyring *secrets.Keyring) *CreateAgentMethod {
 	return &CreateAgentMethod{
 		storage: storage,
+		config:  config,
+		keyring: keyring,
 	}
 }
 
@@ -464,18 +540,20 @@ func (m *CreateAgentMethod) Name() string {
 	return "plumber.agent.create"
 }
 
-func (m *CreateAgentMethod) RequireAuth() bool {
-	return true
+func (m *CreateAgentMethod) Permission() string {
+	return auth.PermAgentWrite
 }
 
 type CreateAgentParams struct {
-	Name          string `json:"name"`
-	SSHHost       string `json:"ssh_host,omitempty"`
-	SSHPort       int    `json:"ssh_port,omitempty"`
-	SSHUser       string `json:"ssh_user,omitempty"`
-	SSHAuthType   string `json:"ssh_auth_type,omitempty"`   // password/key/none
-	SSHPassword   string `json:"ssh_password,omitempty"`    // 密码认证
-	SSHPrivateKey string `json:"ssh_private_key,omitempty"` // 密钥认证
+	Name          string            `json:"name"`
+	SSHHost       string            `json:"ssh_host,omitempty"`
+	SSHPort       int               `json:"ssh_port,omitempty"`
+	SSHUser       string            `json:"ssh_user,omitempty"`
+	SSHAuthType   string            `json:"ssh_auth_type,omitempty"`   // password/key/none
+	SSHPassword   string            `json:"ssh_password,omitempty"`    // 密码认证
+	SSHPrivateKey string            `json:"ssh_private_key,omitempty"` // 密钥认证
+	SSHBastionID  string            `json:"ssh_bastion_id,omitempty"`  // 经由的跳板机
+	Labels        map[string]string `json:"labels,omitempty"`
 }
 
 func (m *CreateAgentMethod) Execute(ctx context.Context, params json.RawMessage) (interface{}, error) {
@@ -496,55 +574,116 @@ func (m *CreateAgentMethod) Execute(ctx context.Context, params json.RawMessage)
 		p.SSHAuthType = "none"
 	}
 
+	bastionID, err := parseBastionID(ctx, m.storage, p.SSHBastionID)
+	if err != nil {
+		return nil, err
+	}
+
 	agent := &models.Agent{
-		ID:            uuid.New(),
-		Name:          p.Name,
-		SSHHost:       p.SSHHost,
-		SSHPort:       p.SSHPort,
-		SSHUser:       p.SSHUser,
-		SSHAuthType:   p.SSHAuthType,
-		SSHPassword:   p.SSHPassword,
-		SSHPrivateKey: p.SSHPrivateKey,
-		Status:        "offline",
+		ID:           uuid.New(),
+		Name:         p.Name,
+		SSHHost:      p.SSHHost,
+		SSHPort:      p.SSHPort,
+		SSHUser:      p.SSHUser,
+		SSHAuthType:  p.SSHAuthType,
+		SSHBastionID: bastionID,
+		Labels:       p.Labels,
+		Status:       "offline",
+	}
+	agent.SSHPassword, agent.SSHPrivateKey, err = sealCredentials(m.keyring, agent.SSHAuthType, p.SSHPassword, p.SSHPrivateKey)
+	if err != nil {
+		return nil, err
 	}
 
 	if err := m.storage.CreateAgent(ctx, agent); err != nil {
 		return nil, fmt.Errorf("failed to create agent: %w", err)
 	}
 
+	// 签发Agent专属令牌（明文仅在创建时返回一次）
+	token, err := issueAgentToken(ctx, m.storage, agent.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	configJSON, err := m.config.Build(agent.ID, token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate config: %w", err)
+	}
+
 	return map[string]interface{}{
 		"agent_id": agent.ID.String(),
 		"name":     agent.Name,
 		"status":   "created",
+		"token":    token,
+		"config":   string(configJSON),
 	}, nil
 }
 
+// sealCredentials 按认证类型保存SSH凭据，只保留当前认证方式需要的凭据，明文在写入前加密
+func sealCredentials(keyring *secrets.Keyring, authType, password, privateKey string) (string, string, error) {
+	switch authType {
+	case "password":
+		privateKey = ""
+	case "key":
+		password = ""
+	default:
+		password, privateKey = "", ""
+	}
+
+	password, err := sealCredential(keyring, password)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to encrypt SSH password: %w", err)
+	}
+	privateKey, err = sealCredential(keyring, privateKey)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to encrypt SSH private key: %w", err)
+	}
+	return password, privateKey, nil
+}
+
+// sealCredential 加密凭据，已加密且能用当前密钥解密的值（沿用的原凭据）保持不变；
+// 形似密文但无法解密的值来自客户端，按明文加密，避免未加密的凭据入库
+func sealCredential(keyring *secrets.Keyring, value string) (string, error) {
+	if secrets.IsSealed(value) {
+		if _, err := keyring.Open(value); err == nil {
+			return value, nil
+		}
+	}
+	return keyring.Seal(value)
+}
+
 // UpdateAgentMethod 更新Agent
 type UpdateAgentMethod struct {
 	storage storage.Storage
+	keyring *secrets.Keyring
 }
 
-func NewUpdateAgentMethod(storage storage.Storage) *UpdateAgentMethod {
-	return &UpdateAgentMethod{storage: storage}
+func NewUpdateAgentMethod(storage storage.Storage, keyring *secrets.Keyring) *UpdateAgentMethod {
+	return &UpdateAgentMethod{
+		storage: storage,
+		keyring: keyring,
+	}
 }
 
 func (m *UpdateAgentMethod) Name() string {
 	return "plumber.agent.update"
 }
 
-func (m *UpdateAgentMethod) RequireAuth() bool {
-	return true
+func (m *UpdateAgentMethod) Permission() string {
+	return auth.PermAgentWrite
 }
 
 type UpdateAgentParams struct {
-	AgentID       string `json:"agent_id"`
-	Name          string `json:"name"`
-	SSHHost       string `json:"ssh_host,omitempty"`
-	SSHPort       int    `json:"ssh_port,omitempty"`
-	SSHUser       string `json:"ssh_user,omitempty"`
-	SSHAuthType   string `json:"ssh_auth_type,omitempty"`
-	SSHPassword   string `json:"ssh_password,omitempty"`
-	SSHPrivateKey string `json:"ssh_private_key,omitempty"`
+	AgentID       string            `json:"agent_id"`
+	Name          string            `json:"name"`
+	SSHHost       string            `json:"ssh_host,omitempty"`
+	SSHPort       int               `json:"ssh_port,omitempty"`
+	SSHUser       string            `json:"ssh_user,omitempty"`
+	SSHAuthType   string            `json:"ssh_auth_type,omitempty"`
+	SSHPassword   string            `json:"ssh_password,omitempty"`    // 为空时保留原凭据（认证类型不变时）
+	SSHPrivateKey string            `json:"ssh_private_key,omitempty"` // 为空时保留原凭据（认证类型不变时）
+	SSHBastionID  *string           `json:"ssh_bastion_id,omitempty"`  // 为nil时保持不变，空字符串表示直连
+	Labels        map[string]string `json:"labels,omitempty"`          // 为nil时保持不变
 }
 
 func (m *UpdateAgentMethod) Execute(ctx context.Context, params json.RawMessage) (interface{}, error) {
@@ -567,12 +706,40 @@ func (m *UpdateAgentMethod) Execute(ctx context.Context, params json.RawMessage)
 	if p.Name != "" {
 		agent.Name = p.Name
 	}
+	bastionID := agent.SSHBastionID
+	if p.SSHBastionID != nil {
+		if bastionID, err = parseBastionID(ctx, m.storage, *p.SSHBastionID); err != nil {
+			return nil, err
+		}
+	}
+	// SSH地址或跳板机变更后原来固定的主机公钥不再适用
+	if agent.SSHHost != p.SSHHost || agent.SSHPort != p.SSHPort || !sameUUID(agent.SSHBastionID, bastionID) {
+		agent.SSHHostKey = ""
+		agent.SSHHostKeyFP = ""
+		agent.SSHHostKeyAt = nil
+	}
 	agent.SSHHost = p.SSHHost
 	agent.SSHPort = p.SSHPort
 	agent.SSHUser = p.SSHUser
+	agent.SSHBastionID = bastionID
+	// 凭据不再返回给客户端，编辑时未重新填写则沿用已保存的凭据
+	password, privateKey := p.SSHPassword, p.SSHPrivateKey
+	if p.SSHAuthType == agent.SSHAuthType {
+		if password == "" {
+			password = agent.SSHPassword
+		}
+		if privateKey == "" {
+			privateKey = agent.SSHPrivateKey
+		}
+	}
 	agent.SSHAuthType = p.SSHAuthType
-	agent.SSHPassword = p.SSHPassword
-	agent.SSHPrivateKey = p.SSHPrivateKey
+	agent.SSHPassword, agent.SSHPrivateKey, err = sealCredentials(m.keyring, agent.SSHAuthType, password, privateKey)
+	if err != nil {
+		return nil, err
+	}
+	if p.Labels != nil {
+		agent.Labels = p.Labels
+	}
 
 	if err := m.storage.UpdateAgent(ctx, agent); err != nil {
 		return nil, fmt.Errorf("failed to update agent: %w", err)
@@ -597,8 +764,8 @@ func (m *DeleteAgentMethod) Name() string {
 	return "plumber.agent.delete"
 }
 
-func (m *DeleteAgentMethod) RequireAuth() bool {
-	return true
+func (m *DeleteAgentMethod) Permission() string {
+	return auth.PermAgentWrite
 }
 
 type DeleteAgentParams struct {
@@ -627,17 +794,17 @@ func (m *DeleteAgentMethod) Execute(ctx context.Context, params json.RawMessage)
 }
 
 // GetAgentConfigMethod 获取Agent配置文件
+// 服务端只保存令牌哈希，默认返回不含令牌的配置；rotate为true时签发新令牌写入配置，
+// 正在运行的Agent持有的旧令牌随即失效（与 plumber.agent.rotateToken 相同）
 type GetAgentConfigMethod struct {
-	storage    storage.Storage
-	agentToken string
-	serverAddr string
+	storage storage.Storage
+	config  *agentConfigBuilder
 }
 
-func NewGetAgentConfigMethod(storage storage.Storage, agentToken, serverAddr string) *GetAgentConfigMethod {
+func NewGetAgentConfigMethod(storage storage.Storage, config *agentConfigBuilder) *GetAgentConfigMethod {
 	return &GetAgentConfigMethod{
-		storage:    storage,
-		agentToken: agentToken,
-		serverAddr: serverAddr,
+		storage: storage,
+		config:  config,
 	}
 }
 
@@ -645,12 +812,13 @@ func (m *GetAgentConfigMethod) Name() string {
 	return "plumber.agent.getConfig"
 }
 
-func (m *GetAgentConfigMethod) RequireAuth() bool {
-	return true
+func (m *GetAgentConfigMethod) Permission() string {
+	return auth.PermAgentWrite
 }
 
 type GetAgentConfigParams struct {
 	AgentID string `json:"agent_id"`
+	Rotate  bool   `json:"rotate,omitempty"` // 签发新令牌，旧令牌失效
 }
 
 func (m *GetAgentConfigMethod) Execute(ctx context.Context, params json.RawMessage) (interface{}, error) {
@@ -670,56 +838,54 @@ func (m *GetAgentConfigMethod) Execute(ctx context.Context, params json.RawMessa
 		return nil, fmt.Errorf("agent not found: %w", err)
 	}
 
-	// 生成配置文件内容
-	config := map[string]interface{}{
-		"id":          p.AgentID,
-		"token":       m.agentToken,
-		"server_addr": m.serverAddr,
+	var token string
+	if p.Rotate {
+		token, err = issueAgentToken(ctx, m.storage, agentUUID)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	configJSON, err := json.MarshalIndent(config, "", "  ")
+	// 生成配置文件内容
+	configJSON, err := m.config.Build(agentUUID, token)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate config: %w", err)
 	}
 
 	return map[string]interface{}{
-		"config":   string(configJSON),
-		"filename": "agent.json",
+		"config":        string(configJSON),
+		"filename":      "agent.json",
+		"token_rotated": p.Rotate,
 	}, nil
 }
 
-// DeployAgentMethod 部署Agent到服务器
-type DeployAgentMethod struct {
-	storage    storage.Storage
-	agentToken string
-	serverAddr string
+// RotateAgentTokenMethod 轮换Agent令牌
+type RotateAgentTokenMethod struct {
+	storage storage.Storage
+	config  *agentConfigBuilder
 }
 
-func NewDeployAgentMethod(storage storage.Storage, agentToken, serverAddr string) *DeployAgentMethod {
-	return &DeployAgentMethod{
-		storage:    storage,
-		agentToken: agentToken,
-		serverAddr: serverAddr,
+func NewRotateAgentTokenMethod(storage storage.Storage, config *agentConfigBuilder) *RotateAgentTokenMethod {
+	return &RotateAgentTokenMethod{
+		storage: storage,
+		config:  config,
 	}
 }
 
-func (m *DeployAgentMethod) Name() string {
-	return "plumber.agent.deploy"
+func (m *RotateAgentTokenMethod) Name() string {
+	return "plumber.agent.rotateToken"
 }
 
-func (m *DeployAgentMethod) RequireAuth() bool {
-	return true
+func (m *RotateAgentTokenMethod) Permission() string {
+	return auth.PermAgentWrite
 }
 
-type DeployAgentParams struct {
-	AgentID    string `json:"agent_id"`
-	ScriptURL  string `json:"script_url"`
-	InstallDir string `json:"install_dir"`
+type RotateAgentTokenParams struct {
+	AgentID string `json:"agent_id"`
 }
 
-func (m *DeployAgentMethod) Execute(ctx context.Context, params json.RawMessage) (interface{}, error) {
-	log.Println("DeployAgentMethod Execute")
-	var p DeployAgentParams
+func (m *RotateAgentTokenMethod) Execute(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var p RotateAgentTokenParams
 	if err := json.Unmarshal(params, &p); err != nil {
 		return nil, fmt.Errorf("invalid params: %w", err)
 	}
@@ -729,171 +895,152 @@ func (m *DeployAgentMethod) Execute(ctx context.Context, params json.RawMessage)
 		return nil, fmt.Errorf("invalid agent_id: %w", err)
 	}
 
-	agent, err := m.storage.GetAgent(ctx, agentUUID)
-	if err != nil {
+	if _, err := m.storage.GetAgent(ctx, agentUUID); err != nil {
 		return nil, fmt.Errorf("agent not found: %w", err)
 	}
 
-	if agent.SSHHost == "" {
-		return nil, fmt.Errorf("agent has no SSH configuration")
+	token, err := issueAgentToken(ctx, m.storage, agentUUID)
+	if err != nil {
+		return nil, err
 	}
 
-	// 使用 SSH 执行部署
-	output, err := m.deployViaSSH(agent, p)
+	configJSON, err := m.config.Build(agentUUID, token)
 	if err != nil {
-		return nil, fmt.Errorf("deploy failed: %w", err)
+		return nil, fmt.Errorf("failed to generate config: %w", err)
 	}
 
 	return map[string]interface{}{
-		"status": "success",
-		"output": output,
+		"agent_id": agentUUID.String(),
+		"token":    token,
+		"config":   string(configJSON),
+		"filename": "agent.json",
 	}, nil
 }
 
-func (m *DeployAgentMethod) deployViaSSH(agent *models.Agent, params DeployAgentParams) (string, error) {
-	// 生成 agent 配置，使用服务器配置的地址
-	config := map[string]any{
-		"id":          agent.ID.String(),
-		"token":       m.agentToken,
-		"server_addr": m.serverAddr,
-	}
-	configJSON, err := json.MarshalIndent(config, "", "  ")
-	if err != nil {
-		return "", fmt.Errorf("failed to generate config: %w", err)
-	}
-
-	// 构建部署命令
-	// 根据用户是否是 root 来决定是否使用 sudo
-	sudoCmd := "sudo"
-	if agent.SSHUser == "root" {
-		sudoCmd = ""
-	}
-
-	deployScript := fmt.Sprintf(`
-set -e
-echo "Step 1: Removing old installation directory..."
-%s rm -rf %s || true
-
-echo "Step 2: Creating installation directory..."
-%s mkdir -p %s
-
-echo "Step 3: Writing agent configuration..."
-cat > /tmp/agent.json << 'EOF'
-%s
-EOF
-%s mv /tmp/agent.json %s/agent.json
-%s chmod 644 %s/agent.json
-
-echo "Step 4: Downloading and executing installation script..."
-curl -sSL "%s" | %s bash
-
-echo "Deployment completed successfully!"
-`,
-		sudoCmd, params.InstallDir,
-		sudoCmd, params.InstallDir,
-		string(configJSON),
-		sudoCmd, params.InstallDir,
-		sudoCmd, params.InstallDir,
-		params.ScriptURL, sudoCmd)
-
-	// 验证 SSH 连接信息
-	if agent.SSHUser == "" {
-		return "", fmt.Errorf("SSH user is required")
-	}
-	if agent.SSHHost == "" {
-		return "", fmt.Errorf("SSH host is required")
-	}
-
-	// 创建 SSH 配置
-	sshConfig := &ssh.ClientConfig{
-		User:            agent.SSHUser,
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-		Timeout:         30 * time.Second,
-	}
+// RevokeAgentTokenMethod 吊销Agent令牌和客户端证书
+type RevokeAgentTokenMethod struct {
+	storage storage.Storage
+}
 
-	var authMethods []ssh.AuthMethod
+func NewRevokeAgentTokenMethod(storage storage.Storage) *RevokeAgentTokenMethod {
+	return &RevokeAgentTokenMethod{storage: storage}
+}
 
-	// 根据认证类型设置认证方法
-	switch agent.SSHAuthType {
-	case "password":
-		if agent.SSHPassword == "" {
-			return "", fmt.Errorf("password is required for password authentication")
-		}
-		log.Printf("[Deploy] Using password authentication for %s@%s", agent.SSHUser, agent.SSHHost)
-		authMethods = append(authMethods, ssh.Password(agent.SSHPassword))
+func (m *RevokeAgentTokenMethod) Name() string {
+	return "plumber.agent.revokeToken"
+}
 
-	case "key":
-		if agent.SSHPrivateKey == "" {
-			return "", fmt.Errorf("private key is required for key authentication")
-		}
-		signer, err := ssh.ParsePrivateKey([]byte(agent.SSHPrivateKey))
-		if err != nil {
-			return "", fmt.Errorf("failed to parse private key: %w", err)
-		}
-		log.Printf("[Deploy] Using key authentication for %s@%s", agent.SSHUser, agent.SSHHost)
-		authMethods = append(authMethods, ssh.PublicKeys(signer))
+func (m *RevokeAgentTokenMethod) Permission() string {
+	return auth.PermAgentWrite
+}
 
-	default:
-		return "", fmt.Errorf("authentication type '%s' is not supported. Use 'password' or 'key'", agent.SSHAuthType)
-	}
+type RevokeAgentTokenParams struct {
+	AgentID string `json:"agent_id"`
+}
 
-	if len(authMethods) == 0 {
-		return "", fmt.Errorf("no authentication method configured")
+func (m *RevokeAgentTokenMethod) Execute(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var p RevokeAgentTokenParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, fmt.Errorf("invalid params: %w", err)
 	}
 
-	sshConfig.Auth = authMethods
-
-	// 连接到 SSH 服务器
-	addr := fmt.Sprintf("%s:%d", agent.SSHHost, agent.SSHPort)
-	log.Printf("[Deploy] Connecting to SSH server: %s@%s", agent.SSHUser, addr)
-
-	client, err := ssh.Dial("tcp", addr, sshConfig)
+	agentUUID, err := uuid.Parse(p.AgentID)
 	if err != nil {
-		return "", fmt.Errorf("SSH connection failed: %w", err)
+		return nil, fmt.Errorf("invalid agent_id: %w", err)
 	}
-	defer client.Close()
-
-	log.Printf("[Deploy] SSH connection established successfully")
 
-	// 创建会话
-	session, err := client.NewSession()
-	if err != nil {
-		return "", fmt.Errorf("failed to create SSH session: %w", err)
+	if _, err := m.storage.GetAgent(ctx, agentUUID); err != nil {
+		return nil, fmt.Errorf("agent not found: %w", err)
 	}
-	defer session.Close()
-
-	log.Printf("[Deploy] Executing deployment script...")
 
-	// 执行部署脚本
-	output, err := session.CombinedOutput(deployScript)
+	if err := m.storage.UpdateAgentToken(ctx, agentUUID, ""); err != nil {
+		return nil, fmt.Errorf("failed to revoke agent token: %w", err)
+	}
+	// 同时吊销客户端证书，否则Agent仍可凭证书认证
+	revoked, err := m.storage.RevokeAgentCertificatesByAgent(ctx, agentUUID)
 	if err != nil {
-		log.Printf("[Deploy] Script execution failed: %v\nOutput: %s", err, string(output))
-		return string(output), fmt.Errorf("deployment script failed: %w\nOutput: %s", err, string(output))
+		return nil, fmt.Errorf("agent token revoked but failed to revoke its certificates: %w", err)
 	}
 
-	log.Printf("[Deploy] Deployment completed successfully")
-	return string(output), nil
+	return map[string]interface{}{
+		"status":               "revoked",
+		"message":              "Agent token and certificates revoked",
+		"revoked_certificates": revoked,
+	}, nil
 }
 
 // RegisterAllMethods 注册所有RPC方法
-func RegisterAllMethods(router *jsonrpc.Router, storage storage.Storage, jwtManager *auth.JWTManager, adminUsername, adminPassword, agentToken, serverAddr string) {
+// sessionTTL 为登录会话（刷新令牌）的有效期
+func RegisterAllMethods(router *jsonrpc.Router, storage storage.Storage, jwtManager *auth.JWTManager, sessionTTL time.Duration, serverAddr string, ca *pki.CA, keyring *secrets.Keyring, dialer *sshdial.Dialer, broker *relay.Broker, artifactStore *artifacts.Store, deploy DeployOptions) {
 	executor := NewTaskExecutor(storage)
+	agentConfig := &agentConfigBuilder{serverAddr: serverAddr, ca: ca}
+	if deploy.Signer != nil {
+		agentConfig.updateKey = deploy.Signer.PublicKey()
+	}
+	updates := &selfUpdater{binaries: deploy.Binaries, signer: deploy.Signer}
+	deployer := newDeployRunner(storage, agentConfig, dialer, deploy)
+	sessions := newSessionManager(storage, jwtManager, sessionTTL)
 
 	router.Register(NewAgentRegisterMethod(storage))
-	router.Register(NewAgentHeartbeatMethod(storage))
-	router.Register(NewUserLoginMethod(jwtManager, adminUsername, adminPassword))
+	router.Register(NewAgentHeartbeatMethod(storage, broker, updates))
+	router.Register(NewReportAgentUpdateMethod(storage))
+	router.Register(NewUserLoginMethod(storage, sessions))
+	router.Register(NewRefreshTokenMethod(sessions))
+	router.Register(NewLogoutMethod(storage))
+	router.Register(NewListSessionsMethod(storage))
+	router.Register(NewListAuditLogsMethod(storage))
+	router.Register(NewListRecordingsMethod(storage))
+	router.Register(NewGetRecordingMethod(storage))
+	router.Register(NewCreateUserMethod(storage))
+	router.Register(NewListUsersMethod(storage))
+	router.Register(NewSetUserDisabledMethod(storage))
+	router.Register(NewSetUserRoleMethod(storage))
+	router.Register(NewDeleteUserMethod(storage))
+	router.Register(NewChangePasswordMethod(storage))
+	router.Register(NewCreateAPITokenMethod(storage))
+	router.Register(NewListAPITokensMethod(storage))
+	router.Register(NewRevokeAPITokenMethod(storage))
 	router.Register(NewListAgentsMethod(storage))
-	router.Register(NewCreateAgentMethod(storage))
-	router.Register(NewUpdateAgentMethod(storage))
+	router.Register(NewCreateAgentMethod(storage, agentConfig, keyring))
+	router.Register(NewUpdateAgentMethod(storage, keyring))
 	router.Register(NewDeleteAgentMethod(storage))
-	router.Register(NewGetAgentConfigMethod(storage, agentToken, serverAddr))
-	router.Register(NewDeployAgentMethod(storage, agentToken, serverAddr))
+	router.Register(NewGetAgentConfigMethod(storage, agentConfig))
+	router.Register(NewRotateAgentTokenMethod(storage, agentConfig))
+	router.Register(NewRevokeAgentTokenMethod(storage))
+	router.Register(NewEnrollAgentCertMethod(storage, ca))
+	router.Register(NewListAgentCertsMethod(storage))
+	router.Register(NewRevokeAgentCertMethod(storage))
+	router.Register(NewDeployAgentMethod(storage, deployer))
+	router.Register(NewGetDeployJobMethod(storage))
+	router.Register(NewListDeployJobsMethod(storage))
+	router.Register(NewRetryDeployJobMethod(storage, deployer))
+	router.Register(NewUpgradeAgentMethod(storage, deployer))
+	router.Register(NewUninstallAgentMethod(storage, deployer))
+	router.Register(NewAgentVersionsMethod(storage, deploy.Binaries))
+	router.Register(NewSetAgentDesiredVersionMethod(storage, deploy.Binaries))
+	router.Register(NewListAgentBinariesMethod(deploy.Binaries))
+	router.Register(NewDeleteAgentBinaryMethod(deploy.Binaries))
+	router.Register(NewGetAgentHostKeyMethod(storage))
+	router.Register(NewResetAgentHostKeyMethod(storage))
+	router.Register(NewCreateBastionMethod(storage, keyring))
+	router.Register(NewListBastionsMethod(storage))
+	router.Register(NewUpdateBastionMethod(storage, keyring))
+	router.Register(NewDeleteBastionMethod(storage))
+	router.Register(NewResetBastionHostKeyMethod(storage))
+	router.Register(NewAgentJoinMethod(storage, agentConfig))
+	router.Register(NewCreateJoinTokenMethod(storage))
+	router.Register(NewListJoinTokensMethod(storage))
+	router.Register(NewRevokeJoinTokenMethod(storage))
 	router.Register(NewCreateTaskMethod(storage))
 	router.Register(NewUpdateTaskMethod(storage))
+	router.Register(NewValidateTaskMethod(storage))
 	router.Register(NewListTasksMethod(storage))
 	router.Register(NewPollTaskMethod(storage))
 	router.Register(NewStepReportMethod(storage))
 	router.Register(NewRunTaskMethod(storage, executor))
 	router.Register(NewGetExecutionMethod(storage))
 	router.Register(NewListExecutionsMethod(storage))
+	router.Register(NewListArtifactsMethod(storage))
+	router.Register(NewGetArtifactMethod(storage))
+	router.Register(NewDeleteArtifactMethod(storage, artifactStore))
 }
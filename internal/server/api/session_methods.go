@@ -0,0 +1,268 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/plumber/plumber/internal/server/storage"
+	"github.com/plumber/plumber/pkg/auth"
+	"github.com/plumber/plumber/pkg/jsonrpc"
+	"github.com/plumber/plumber/pkg/models"
+)
+
+// refreshTokenLength 刷新令牌随机字节数
+const refreshTokenLength = 32
+
+// sessionManager 管理登录会话，签发短期访问令牌和可轮换的刷新令牌
+type sessionManager struct {
+	storage    storage.Storage
+	jwtManager *auth.JWTManager
+	refreshTTL time.Duration
+}
+
+func newSessionManager(storage storage.Storage, jwtManager *auth.JWTManager, refreshTTL time.Duration) *sessionManager {
+	return &sessionManager{
+		storage:    storage,
+		jwtManager: jwtManager,
+		refreshTTL: refreshTTL,
+	}
+}
+
+// Start 为用户创建新会话并签发令牌
+func (s *sessionManager) Start(ctx context.Context, user *models.User) (map[string]interface{}, error) {
+	refreshToken, err := auth.GenerateToken(refreshTokenLength)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+
+	ip, userAgent := GetClientInfoFromContext(ctx)
+	session := &models.Session{
+		UserID:           user.ID,
+		RefreshTokenHash: auth.HashToken(refreshToken),
+		UserAgent:        truncate(userAgent, 255),
+		IP:               ip,
+		ExpiresAt:        time.Now().Add(s.refreshTTL),
+	}
+	if err := s.storage.CreateSession(ctx, session); err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+
+	return s.issue(user, session, refreshToken)
+}
+
+// Refresh 校验并轮换刷新令牌，返回新的访问令牌和刷新令牌
+// 已轮换掉的刷新令牌再次出现说明令牌可能已泄露，此时吊销整个会话
+func (s *sessionManager) Refresh(ctx context.Context, refreshToken string) (map[string]interface{}, error) {
+	tokenHash := auth.HashToken(refreshToken)
+	session, err := s.storage.GetSessionByRefreshToken(ctx, tokenHash)
+	if err != nil {
+		return nil, fmt.Errorf("invalid refresh token")
+	}
+
+	if session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+		return nil, fmt.Errorf("session has been revoked or expired")
+	}
+
+	if session.RefreshTokenHash != tokenHash {
+		if err := s.storage.RevokeSession(ctx, session.ID); err != nil {
+			log.Printf("Failed to revoke session %s: %v", session.ID, err)
+		}
+		log.Printf("[Server] Refresh token reuse detected, session revoked - SessionID: %s, UserID: %s", session.ID, session.UserID)
+		return nil, fmt.Errorf("refresh token has already been used; session revoked")
+	}
+
+	user, err := s.storage.GetUser(ctx, session.UserID)
+	if err != nil || user.Disabled {
+		return nil, fmt.Errorf("user not found or disabled")
+	}
+
+	newToken, err := auth.GenerateToken(refreshTokenLength)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+	if err := s.storage.RotateSessionRefreshToken(ctx, session.ID, tokenHash, auth.HashToken(newToken)); err != nil {
+		return nil, fmt.Errorf("invalid refresh token")
+	}
+
+	return s.issue(user, session, newToken)
+}
+
+func (s *sessionManager) issue(user *models.User, session *models.Session, refreshToken string) (map[string]interface{}, error) {
+	token, err := s.jwtManager.Generate(user.ID.String(), user.Username, session.ID.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	return map[string]interface{}{
+		"token":              token,
+		"expires_in":         int(s.jwtManager.TokenDuration().Seconds()),
+		"refresh_token":      refreshToken,
+		"refresh_expires_at": session.ExpiresAt,
+		"username":           user.Username,
+		"user_id":            user.ID.String(),
+	}, nil
+}
+
+func truncate(s string, max int) string {
+	if len(s) > max {
+		return s[:max]
+	}
+	return s
+}
+
+// RefreshTokenMethod 使用刷新令牌换取新的访问令牌
+type RefreshTokenMethod struct {
+	sessions *sessionManager
+}
+
+func NewRefreshTokenMethod(sessions *sessionManager) *RefreshTokenMethod {
+	return &RefreshTokenMethod{sessions: sessions}
+}
+
+func (m *RefreshTokenMethod) Name() string {
+	return "plumber.user.refresh"
+}
+
+func (m *RefreshTokenMethod) Permission() string {
+	return jsonrpc.PermissionPublic
+}
+
+func (m *RefreshTokenMethod) Audit() bool {
+	return false
+}
+
+type RefreshTokenParams struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+func (m *RefreshTokenMethod) Execute(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var p RefreshTokenParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, fmt.Errorf("invalid params: %w", err)
+	}
+
+	if p.RefreshToken == "" {
+		return nil, fmt.Errorf("refresh_token is required")
+	}
+
+	return m.sessions.Refresh(ctx, p.RefreshToken)
+}
+
+// LogoutMethod 退出登录
+// 默认只吊销当前会话；all为true时吊销自己的全部会话；指定user_id时为管理员强制下线该用户
+type LogoutMethod struct {
+	storage storage.Storage
+}
+
+func NewLogoutMethod(storage storage.Storage) *LogoutMethod {
+	return &LogoutMethod{storage: storage}
+}
+
+func (m *LogoutMethod) Name() string {
+	return "plumber.user.logout"
+}
+
+func (m *LogoutMethod) Permission() string {
+	return auth.PermUserSelf
+}
+
+type LogoutParams struct {
+	All    bool   `json:"all,omitempty"`
+	UserID string `json:"user_id,omitempty"`
+}
+
+func (m *LogoutMethod) Execute(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var p LogoutParams
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, fmt.Errorf("invalid params: %w", err)
+		}
+	}
+
+	selfID, err := currentUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	targetID := selfID
+	if p.UserID != "" {
+		targetID, err = uuid.Parse(p.UserID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid user_id: %w", err)
+		}
+	}
+
+	if targetID != selfID {
+		if !hasPermission(ctx, auth.PermUserAdmin) {
+			return nil, fmt.Errorf("permission denied: %s required", auth.PermUserAdmin)
+		}
+		p.All = true
+	}
+
+	if p.All {
+		count, err := m.storage.RevokeUserSessions(ctx, targetID, uuid.Nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to revoke sessions: %w", err)
+		}
+		return map[string]interface{}{
+			"status":  "logged_out",
+			"revoked": count,
+		}, nil
+	}
+
+	sessionID, ok := GetSessionIDFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("current request is not bound to a login session")
+	}
+	if err := m.storage.RevokeSession(ctx, sessionID); err != nil {
+		return nil, fmt.Errorf("failed to revoke session: %w", err)
+	}
+
+	return map[string]interface{}{
+		"status":  "logged_out",
+		"revoked": 1,
+	}, nil
+}
+
+// ListSessionsMethod 列出当前用户的有效会话
+type ListSessionsMethod struct {
+	storage storage.Storage
+}
+
+func NewListSessionsMethod(storage storage.Storage) *ListSessionsMethod {
+	return &ListSessionsMethod{storage: storage}
+}
+
+func (m *ListSessionsMethod) Name() string {
+	return "plumber.user.sessions"
+}
+
+func (m *ListSessionsMethod) Permission() string {
+	return auth.PermUserSelf
+}
+
+func (m *ListSessionsMethod) Audit() bool {
+	return false
+}
+
+func (m *ListSessionsMethod) Execute(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	selfID, err := currentUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := m.storage.ListSessions(ctx, selfID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	currentID, _ := GetSessionIDFromContext(ctx)
+	return map[string]interface{}{
+		"sessions":           sessions,
+		"current_session_id": currentID,
+	}, nil
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/plumber/plumber/pkg/auth"
+	"github.com/plumber/plumber/pkg/models"
+)
+
+// startSession 创建会话，返回会话管理器、存储和初始刷新令牌
+func startSession(t *testing.T) (*sessionManager, *memStorage, string) {
+	t.Helper()
+	mem := newMemStorage()
+	user := &models.User{ID: uuid.New(), Username: "alice", Role: auth.RoleOperator}
+	mem.users[user.ID] = user
+
+	sessions := newSessionManager(mem, auth.NewJWTManager("secret", time.Minute), time.Hour)
+	result, err := sessions.Start(context.Background(), user)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	return sessions, mem, result["refresh_token"].(string)
+}
+
+// onlySession 返回存储中唯一的会话
+func onlySession(t *testing.T, mem *memStorage) *models.Session {
+	t.Helper()
+	if len(mem.sessions) != 1 {
+		t.Fatalf("expected 1 session, got %d", len(mem.sessions))
+	}
+	for _, session := range mem.sessions {
+		return session
+	}
+	return nil
+}
+
+func TestSessionRefreshRotates(t *testing.T) {
+	sessions, mem, first := startSession(t)
+	ctx := context.Background()
+
+	result, err := sessions.Refresh(ctx, first)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	second := result["refresh_token"].(string)
+	if second == first {
+		t.Fatal("refresh token was not rotated")
+	}
+
+	session := onlySession(t, mem)
+	if session.RefreshTokenHash != auth.HashToken(second) || session.PreviousTokenHash != auth.HashToken(first) {
+		t.Error("session hashes do not match the rotated tokens")
+	}
+
+	// 新令牌可以继续轮换
+	if _, err := sessions.Refresh(ctx, second); err != nil {
+		t.Fatalf("Refresh with rotated token: %v", err)
+	}
+	if session.RevokedAt != nil {
+		t.Error("session revoked after normal rotation")
+	}
+}
+
+func TestSessionRefreshReuseRevokes(t *testing.T) {
+	sessions, mem, first := startSession(t)
+	ctx := context.Background()
+
+	result, err := sessions.Refresh(ctx, first)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	second := result["refresh_token"].(string)
+
+	_, err = sessions.Refresh(ctx, first)
+	if err == nil || !strings.Contains(err.Error(), "session revoked") {
+		t.Fatalf("replayed token: error = %v, want session revoked", err)
+	}
+	if onlySession(t, mem).RevokedAt == nil {
+		t.Fatal("session not revoked after token reuse")
+	}
+
+	// 吊销后当前令牌也失效
+	if _, err := sessions.Refresh(ctx, second); err == nil {
+		t.Error("current token still works after session was revoked")
+	}
+}
+
+func TestSessionRefreshConcurrent(t *testing.T) {
+	sessions, mem, first := startSession(t)
+
+	// 两个请求都通过查找后才进入轮换，模拟并发刷新
+	const n = 2
+	mem.rotateBarrier = &sync.WaitGroup{}
+	mem.rotateBarrier.Add(n)
+
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = sessions.Refresh(context.Background(), first)
+		}(i)
+	}
+	wg.Wait()
+
+	succeeded := 0
+	for _, err := range errs {
+		if err == nil {
+			succeeded++
+		}
+	}
+	if succeeded != 1 {
+		t.Fatalf("%d refreshes succeeded, want exactly 1 (errors: %v)", succeeded, errs)
+	}
+	if onlySession(t, mem).PreviousTokenHash != auth.HashToken(first) {
+		t.Error("session was not rotated away from the original token")
+	}
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/plumber/plumber/internal/server/storage"
+	"github.com/plumber/plumber/pkg/models"
+	"gorm.io/gorm"
+)
+
+// memStorage 测试用的内存存储，只实现测试用到的方法，调用其余方法会panic
+type memStorage struct {
+	storage.Storage
+
+	mu         sync.Mutex
+	agents     map[uuid.UUID]*models.Agent
+	tasks      map[uuid.UUID]*models.Task
+	executions map[uuid.UUID]*models.TaskExecution
+	jobs       map[uuid.UUID]*models.DeployJob
+	artifacts  map[uuid.UUID]*models.Artifact
+	users      map[uuid.UUID]*models.User
+	sessions   map[uuid.UUID]*models.Session
+
+	// rotateBarrier 不为nil时，RotateSessionRefreshToken 在全部并发调用到达后才执行
+	rotateBarrier *sync.WaitGroup
+}
+
+func newMemStorage() *memStorage {
+	return &memStorage{
+		agents:     make(map[uuid.UUID]*models.Agent),
+		tasks:      make(map[uuid.UUID]*models.Task),
+		executions: make(map[uuid.UUID]*models.TaskExecution),
+		jobs:       make(map[uuid.UUID]*models.DeployJob),
+		artifacts:  make(map[uuid.UUID]*models.Artifact),
+		users:      make(map[uuid.UUID]*models.User),
+		sessions:   make(map[uuid.UUID]*models.Session),
+	}
+}
+
+// get 返回副本，避免调用方修改存储中的记录
+func get[T any](s *memStorage, m map[uuid.UUID]*T, id uuid.UUID) (*T, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := m[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	copied := *v
+	return &copied, nil
+}
+
+func (s *memStorage) GetAgent(ctx context.Context, id uuid.UUID) (*models.Agent, error) {
+	return get(s, s.agents, id)
+}
+
+func (s *memStorage) GetTask(ctx context.Context, id uuid.UUID) (*models.Task, error) {
+	return get(s, s.tasks, id)
+}
+
+func (s *memStorage) GetExecution(ctx context.Context, id uuid.UUID) (*models.TaskExecution, error) {
+	return get(s, s.executions, id)
+}
+
+func (s *memStorage) GetDeployJob(ctx context.Context, id uuid.UUID) (*models.DeployJob, error) {
+	return get(s, s.jobs, id)
+}
+
+func (s *memStorage) GetArtifact(ctx context.Context, id uuid.UUID) (*models.Artifact, error) {
+	return get(s, s.artifacts, id)
+}
+
+func (s *memStorage) GetLatestArtifactByName(ctx context.Context, name string) (*models.Artifact, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var latest *models.Artifact
+	for _, artifact := range s.artifacts {
+		if artifact.Name == name && (latest == nil || artifact.CreatedAt.After(latest.CreatedAt)) {
+			latest = artifact
+		}
+	}
+	if latest == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	copied := *latest
+	return &copied, nil
+}
+
+func (s *memStorage) GetUser(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	return get(s, s.users, id)
+}
+
+func (s *memStorage) CreateSession(ctx context.Context, session *models.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if session.ID == uuid.Nil {
+		session.ID = uuid.New()
+	}
+	copied := *session
+	s.sessions[session.ID] = &copied
+	return nil
+}
+
+func (s *memStorage) GetSessionByRefreshToken(ctx context.Context, tokenHash string) (*models.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, session := range s.sessions {
+		if session.RefreshTokenHash == tokenHash || session.PreviousTokenHash == tokenHash {
+			copied := *session
+			return &copied, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+// RotateSessionRefreshToken 与数据库实现一样以旧令牌为条件轮换
+func (s *memStorage) RotateSessionRefreshToken(ctx context.Context, id uuid.UUID, oldHash, newHash string) error {
+	if s.rotateBarrier != nil {
+		s.rotateBarrier.Done()
+		s.rotateBarrier.Wait()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[id]
+	if !ok || session.RefreshTokenHash != oldHash || session.RevokedAt != nil {
+		return gorm.ErrRecordNotFound
+	}
+	now := time.Now()
+	session.RefreshTokenHash = newHash
+	session.PreviousTokenHash = oldHash
+	session.LastUsedAt = &now
+	return nil
+}
+
+func (s *memStorage) RevokeSession(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if session, ok := s.sessions[id]; ok && session.RevokedAt == nil {
+		now := time.Now()
+		session.RevokedAt = &now
+	}
+	return nil
+}
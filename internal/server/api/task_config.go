@@ -0,0 +1,106 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/plumber/plumber/internal/server/storage"
+	"github.com/plumber/plumber/pkg/auth"
+	"github.com/plumber/plumber/pkg/taskconfig"
+)
+
+// ValidateTaskMethod 校验任务配置：TOML语法、未知的键、步骤参数以及引用的Agent是否存在
+type ValidateTaskMethod struct {
+	storage storage.Storage
+}
+
+func NewValidateTaskMethod(storage storage.Storage) *ValidateTaskMethod {
+	return &ValidateTaskMethod{storage: storage}
+}
+
+func (m *ValidateTaskMethod) Name() string {
+	return "plumber.task.validate"
+}
+
+func (m *ValidateTaskMethod) Permission() string {
+	return auth.PermTaskWrite
+}
+
+// Audit 只读校验，不写审计日志
+func (m *ValidateTaskMethod) Audit() bool {
+	return false
+}
+
+type ValidateTaskParams struct {
+	Config string `json:"config"` // TOML配置
+}
+
+func (m *ValidateTaskMethod) Execute(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var p ValidateTaskParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, fmt.Errorf("invalid params: %w", err)
+	}
+
+	result := validateTaskConfig(ctx, m.storage, p.Config)
+	errors := result.Errors
+	if errors == nil {
+		errors = taskconfig.Errors{}
+	}
+	steps := 0
+	if result.Config != nil {
+		steps = len(result.Config.Steps)
+	}
+	return map[string]interface{}{
+		"valid":  len(result.Errors) == 0,
+		"steps":  steps,
+		"errors": errors,
+	}, nil
+}
+
+// validateTaskConfig 在配置本身的校验之上检查步骤引用的Agent是否存在
+func validateTaskConfig(ctx context.Context, storage storage.Storage, config string) *taskconfig.Result {
+	result := taskconfig.Validate(config)
+	checkTaskAgents(ctx, storage, result)
+	return result
+}
+
+// checkTaskAgents 检查步骤引用的Agent是否存在，受限用户范围之外或已卸载的Agent视为不存在
+func checkTaskAgents(ctx context.Context, storage storage.Storage, result *taskconfig.Result) {
+	if result.Config == nil {
+		return
+	}
+
+	scope := userScopeFromContext(ctx)
+	checked := make(map[uuid.UUID]bool)
+	for i, step := range result.Config.Steps {
+		agentID, err := uuid.Parse(step.ServerID)
+		if err != nil {
+			continue // 格式错误已在配置校验中报告
+		}
+		found, ok := checked[agentID]
+		if !ok {
+			agent, err := storage.GetAgent(ctx, agentID)
+			found = err == nil && agent.Status != "decommissioned" && scope.AllowsAgent(agent)
+			checked[agentID] = found
+		}
+		if !found {
+			result.StepError(i, "ServerID", fmt.Sprintf("agent %s not found", agentID))
+		}
+	}
+	result.Errors.Sort()
+}
+
+// checkTaskConfig 保存任务前的校验。skipAgents为true时只跳过Agent引用检查（如引用的Agent尚未注册），
+// 语法、未知的键和步骤参数始终校验
+func checkTaskConfig(ctx context.Context, storage storage.Storage, config string, skipAgents bool) error {
+	result := taskconfig.Validate(config)
+	if !skipAgents {
+		checkTaskAgents(ctx, storage, result)
+	}
+	if len(result.Errors) > 0 {
+		return fmt.Errorf("invalid task config: %w", result.Errors)
+	}
+	return nil
+}
@@ -9,11 +9,12 @@ import (
 	"net/http"
 	"time"
 
-	"github.com/BurntSushi/toml"
 	"github.com/google/uuid"
 	"github.com/plumber/plumber/internal/server/storage"
+	"github.com/plumber/plumber/pkg/auth"
 	"github.com/plumber/plumber/pkg/jsonrpc"
 	"github.com/plumber/plumber/pkg/models"
+	"github.com/plumber/plumber/pkg/taskconfig"
 )
 
 // TaskExecutor 任务执行器
@@ -26,8 +27,8 @@ func NewTaskExecutor(storage storage.Storage) *TaskExecutor {
 	return &TaskExecutor{storage: storage}
 }
 
-// ExecuteTask 执行任务
-func (e *TaskExecutor) ExecuteTask(ctx context.Context, taskID uuid.UUID) error {
+// ExecuteTask 执行任务，scope为发起执行的用户的范围，upload步骤只能使用范围内的制品
+func (e *TaskExecutor) ExecuteTask(ctx context.Context, taskID uuid.UUID, scope models.UserScope) error {
 	startTime := time.Now()
 	log.Printf("[Server] Starting task execution - TaskID: %s, Time: %s", taskID, startTime.Format("2006-01-02 15:04:05"))
 
@@ -37,10 +38,10 @@ func (e *TaskExecutor) ExecuteTask(ctx context.Context, taskID uuid.UUID) error
 		return fmt.Errorf("failed to get task: %w", err)
 	}
 
-	// 解析TOML配置
-	var config models.TaskConfig
-	if err := toml.Unmarshal([]byte(task.Config), &config); err != nil {
-		return fmt.Errorf("failed to parse task config: %w", err)
+	// 解析并校验TOML配置
+	config, err := taskconfig.Parse(task.Config)
+	if err != nil {
+		return err
 	}
 
 	log.Printf("[Server] Task config parsed - TaskID: %s, Steps: %d", taskID, len(config.Steps))
@@ -91,15 +92,31 @@ func (e *TaskExecutor) ExecuteTask(ctx context.Context, taskID uuid.UUID) error
 			break
 		}
 
+		stepType, command, spec, err := e.resolveStep(ctx, step, scope)
+		if err != nil {
+			log.Printf("[Server] Invalid step %d: %v", i, err)
+			success = false
+			break
+		}
+		spec.Collect = step.Artifacts
+		if spec.Use, err = e.resolveUsedArtifacts(ctx, execution.ID, step.UseArtifacts); err != nil {
+			log.Printf("[Server] Step %d: %v", i, err)
+			success = false
+			break
+		}
+
 		log.Printf("[Server] Creating step for agent - AgentID: %s", agentID)
 
 		// 创建步骤执行记录（状态为pending，等待agent拉取）
 		stepExec := &models.StepExecution{
 			ExecutionID: execution.ID,
 			StepIndex:   i,
+			Name:        step.Name,
 			AgentID:     agentID,
 			Path:        step.Path,
-			Command:     step.CMD,
+			Type:        stepType,
+			Command:     command,
+			Spec:        spec,
 			Status:      "pending",
 			Assigned:    false,
 		}
@@ -114,7 +131,7 @@ func (e *TaskExecutor) ExecuteTask(ctx context.Context, taskID uuid.UUID) error
 		log.Printf("[Server] Waiting for step completion - StepID: %s", stepExec.ID)
 
 		// 等待步骤完成(轮询检查状态)
-		if err := e.waitForStepCompletion(ctx, stepExec.ID); err != nil {
+		if err := e.waitForStepCompletion(ctx, stepExec.ID, stepDeadline(spec)); err != nil {
 			log.Printf("[Server] Step execution failed: %v", err)
 			success = false
 			break
@@ -165,6 +182,183 @@ func (e *TaskExecutor) ExecuteTask(ctx context.Context, taskID uuid.UUID) error
 	return nil
 }
 
+// resolveStep 根据步骤类型生成下发给Agent的命令（或步骤描述）和参数，upload步骤在此时确定制品版本，
+// 制品需在scope范围内
+func (e *TaskExecutor) resolveStep(ctx context.Context, step models.TaskStep, scope models.UserScope) (string, string, models.StepSpec, error) {
+	var spec models.StepSpec
+	switch step.Type {
+	case "", models.StepTypeShell:
+		return models.StepTypeShell, step.CMD, spec, nil
+
+	case models.StepTypeScript:
+		spec.Interpreter = step.Interpreter
+		return models.StepTypeScript, step.CMD, spec, nil
+
+	case models.StepTypeHTTP:
+		method := step.Method
+		if method == "" {
+			method = http.MethodGet
+		}
+		spec = models.StepSpec{
+			URL:          step.URL,
+			Method:       method,
+			Headers:      step.Headers,
+			Body:         step.Body,
+			ExpectStatus: step.ExpectStatus,
+			ExpectBody:   step.ExpectBody,
+			Timeout:      step.Timeout,
+		}
+		return models.StepTypeHTTP, method + " " + step.URL, spec, nil
+
+	case models.StepTypeTemplate:
+		spec = models.StepSpec{
+			Template: step.Template,
+			Src:      step.Src,
+			Params:   step.Params,
+			Dest:     step.Dest,
+			Mode:     step.Mode,
+			Owner:    step.Owner,
+		}
+		source := step.Src
+		if source == "" {
+			source = "inline template"
+		}
+		return models.StepTypeTemplate, fmt.Sprintf("render %s -> %s", source, step.Dest), spec, nil
+
+	case models.StepTypeWait:
+		spec = models.StepSpec{
+			Duration: step.Duration,
+			Until:    step.CMD,
+			Interval: step.Interval,
+			Timeout:  step.Timeout,
+		}
+		command := "wait " + step.Duration
+		if step.CMD != "" {
+			command = "wait until: " + step.CMD
+		}
+		return models.StepTypeWait, command, spec, nil
+
+	case models.StepTypeContainer:
+		spec = models.StepSpec{
+			Image:   step.Image,
+			Run:     step.CMD,
+			Volumes: step.Volumes,
+			Env:     step.Env,
+			User:    step.User,
+			Network: step.Network,
+		}
+		command := "container " + step.Image
+		if step.CMD != "" {
+			command += ": " + step.CMD
+		}
+		return models.StepTypeContainer, command, spec, nil
+
+	case models.StepTypeCheck:
+		spec = models.StepSpec{
+			Probe:     step.Probe,
+			Interval:  step.Interval,
+			Timeout:   step.Timeout,
+			Successes: step.Successes,
+		}
+		var target string
+		switch step.Probe {
+		case "http":
+			spec.URL = step.URL
+			spec.Method = step.Method
+			if spec.Method == "" {
+				spec.Method = http.MethodGet
+			}
+			spec.Headers = step.Headers
+			spec.Body = step.Body
+			spec.ExpectStatus = step.ExpectStatus
+			spec.ExpectBody = step.ExpectBody
+			target = spec.Method + " " + step.URL
+		case "tcp":
+			spec.Address = step.Address
+			target = step.Address
+		case "cmd":
+			spec.Run = step.CMD
+			target = step.CMD
+		case "file":
+			spec.File = step.File
+			target = step.File
+		}
+		return models.StepTypeCheck, fmt.Sprintf("check %s %s", step.Probe, target), spec, nil
+
+	case models.StepTypeUpload:
+		artifact, err := findArtifact(ctx, e.storage, step.Artifact)
+		if err != nil {
+			return "", "", spec, err
+		}
+		if !newAccessChecker(e.storage).ArtifactInScope(ctx, scope, artifact) {
+			return "", "", spec, fmt.Errorf("permission denied: artifact %q belongs to a task outside your scope", step.Artifact)
+		}
+		spec = models.StepSpec{
+			ArtifactID: artifact.ID.String(),
+			SHA256:     artifact.SHA256,
+			Size:       artifact.Size,
+			Dest:       step.Dest,
+			Mode:       step.Mode,
+			Owner:      step.Owner,
+		}
+		return models.StepTypeUpload, fmt.Sprintf("upload %s -> %s", artifact.Name, step.Dest), spec, nil
+
+	case models.StepTypeDownload:
+		name := taskconfig.DownloadArtifactName(&step)
+		spec = models.StepSpec{
+			Name: name,
+			Src:  step.Src,
+		}
+		return models.StepTypeDownload, fmt.Sprintf("download %s -> %s", step.Src, name), spec, nil
+
+	default:
+		return "", "", spec, fmt.Errorf("unknown step type %q", step.Type)
+	}
+}
+
+// resolveUsedArtifacts 查找本次执行中被引用步骤收集的制品
+func (e *TaskExecutor) resolveUsedArtifacts(ctx context.Context, executionID uuid.UUID, refs []string) ([]models.StepArtifact, error) {
+	var used []models.StepArtifact
+	for _, ref := range refs {
+		list, _, err := e.storage.ListArtifacts(ctx, storage.ArtifactFilter{
+			ExecutionID: &executionID,
+			StepName:    ref,
+			Limit:       500,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list artifacts of step %q: %w", ref, err)
+		}
+		if len(list) == 0 {
+			return nil, fmt.Errorf("step %q collected no artifacts", ref)
+		}
+		for _, artifact := range list {
+			used = append(used, models.StepArtifact{
+				ID:     artifact.ID.String(),
+				Name:   artifact.Name,
+				Size:   artifact.Size,
+				SHA256: artifact.SHA256,
+			})
+		}
+	}
+	return used, nil
+}
+
+// findArtifact 按ID查找制品，不是ID时按名称取最新的制品
+func findArtifact(ctx context.Context, storage storage.Storage, ref string) (*models.Artifact, error) {
+	if id, err := uuid.Parse(ref); err == nil {
+		artifact, err := storage.GetArtifact(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("artifact %s not found: %w", ref, err)
+		}
+		return artifact, nil
+	}
+	artifact, err := storage.GetLatestArtifactByName(ctx, ref)
+	if err != nil {
+		return nil, fmt.Errorf("artifact %q not found: %w", ref, err)
+	}
+	return artifact, nil
+}
+
 // sendCommandToAgent 发送命令到Agent
 func (e *TaskExecutor) sendCommandToAgent(ctx context.Context, agentIP string, stepID uuid.UUID, path, cmd string) error {
 	// 构造参数
@@ -219,9 +413,21 @@ func (e *TaskExecutor) sendCommandToAgent(ctx context.Context, agentIP string, s
 	return nil
 }
 
-// waitForStepCompletion 等待步骤完成
-func (e *TaskExecutor) waitForStepCompletion(ctx context.Context, stepID uuid.UUID) error {
-	timeout := time.After(10 * time.Minute)
+// stepCompletionGrace 等待步骤完成时额外留出的时间，用于Agent拉取步骤和上报结果
+const stepCompletionGrace = time.Minute
+
+// stepDeadline 等待步骤完成的时限：Agent的执行时限，加上收集或使用制品时的传输时限
+func stepDeadline(spec models.StepSpec) time.Duration {
+	deadline := models.MaxStepTimeout + stepCompletionGrace
+	if len(spec.Collect) > 0 || len(spec.Use) > 0 {
+		deadline += models.MaxStepTransferTime
+	}
+	return deadline
+}
+
+// waitForStepCompletion 等待步骤完成，超过deadline视为超时
+func (e *TaskExecutor) waitForStepCompletion(ctx context.Context, stepID uuid.UUID, deadline time.Duration) error {
+	timeout := time.After(deadline)
 	ticker := time.NewTicker(2 * time.Second)
 	defer ticker.Stop()
 
@@ -259,8 +465,8 @@ func (m *RunTaskMethod) Name() string {
 	return "plumber.task.run"
 }
 
-func (m *RunTaskMethod) RequireAuth() bool {
-	return true
+func (m *RunTaskMethod) Permission() string {
+	return auth.PermTaskRun
 }
 
 type RunTaskParams struct {
@@ -278,6 +484,18 @@ func (m *RunTaskMethod) Execute(ctx context.Context, params json.RawMessage) (in
 		return nil, fmt.Errorf("invalid task_id: %w", err)
 	}
 
+	// 启动前同步校验配置，错误返回给调用方，而不是只在后台执行时记录日志
+	task, err := m.storage.GetTask(ctx, taskUUID)
+	if err != nil {
+		return nil, fmt.Errorf("task not found: %w", err)
+	}
+	if _, err := taskconfig.Parse(task.Config); err != nil {
+		return nil, fmt.Errorf("invalid task config: %w", err)
+	}
+
+	// 后台执行时沿用发起用户的范围
+	scope := userScopeFromContext(ctx)
+
 	// 同步获取 execution ID，然后异步执行任务
 	executionIDChan := make(chan uuid.UUID, 1)
 	errChan := make(chan error, 1)
@@ -289,7 +507,7 @@ func (m *RunTaskMethod) Execute(ctx context.Context, params json.RawMessage) (in
 		beforeCount := len(beforeExecutions)
 
 		// 启动任务执行
-		if err := m.executor.ExecuteTask(context.Background(), taskUUID); err != nil {
+		if err := m.executor.ExecuteTask(context.Background(), taskUUID, scope); err != nil {
 			log.Printf("Task execution error: %v", err)
 		}
 
@@ -342,8 +560,8 @@ func (m *GetExecutionMethod) Name() string {
 	return "plumber.execution.get"
 }
 
-func (m *GetExecutionMethod) RequireAuth() bool {
-	return true
+func (m *GetExecutionMethod) Permission() string {
+	return auth.PermTaskRead
 }
 
 type GetExecutionParams struct {
@@ -384,8 +602,8 @@ func (m *ListExecutionsMethod) Name() string {
 	return "plumber.execution.list"
 }
 
-func (m *ListExecutionsMethod) RequireAuth() bool {
-	return true
+func (m *ListExecutionsMethod) Permission() string {
+	return auth.PermTaskRead
 }
 
 type ListExecutionsParams struct {
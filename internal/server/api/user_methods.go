@@ -0,0 +1,447 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/google/uuid"
+	"github.com/plumber/plumber/internal/server/storage"
+	"github.com/plumber/plumber/pkg/auth"
+	"github.com/plumber/plumber/pkg/models"
+)
+
+// minPasswordLength 用户密码最小长度
+const minPasswordLength = 8
+
+// EnsureAdminUser 用户表为空时使用配置中的管理员账号初始化第一个用户
+// 已有用户但没有管理员时（例如从无角色的版本升级），将配置中的管理员账号提升为管理员
+func EnsureAdminUser(ctx context.Context, storage storage.Storage, username, password string) error {
+	count, err := storage.CountUsers(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to count users: %w", err)
+	}
+	if count > 0 {
+		return ensureAdminRole(ctx, storage, username)
+	}
+
+	if username == "" || password == "" {
+		return fmt.Errorf("no users exist and admin_username/admin_password are not configured")
+	}
+
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	if err := storage.CreateUser(ctx, &models.User{Username: username, Password: hash, Role: auth.RoleAdmin}); err != nil {
+		return fmt.Errorf("failed to create admin user: %w", err)
+	}
+
+	log.Printf("Bootstrapped admin user %q from config", username)
+	return nil
+}
+
+func ensureAdminRole(ctx context.Context, storage storage.Storage, username string) error {
+	users, err := storage.ListUsers(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list users: %w", err)
+	}
+	for _, user := range users {
+		if user.Role == auth.RoleAdmin && !user.Disabled {
+			return nil
+		}
+	}
+
+	if username == "" {
+		log.Printf("Warning: no enabled admin user exists and admin_username is not configured")
+		return nil
+	}
+
+	user, err := storage.GetUserByUsername(ctx, username)
+	if err != nil {
+		log.Printf("Warning: no enabled admin user exists and user %q was not found", username)
+		return nil
+	}
+
+	user.Role = auth.RoleAdmin
+	user.Disabled = false
+	if err := storage.UpdateUser(ctx, user); err != nil {
+		return fmt.Errorf("failed to promote admin user: %w", err)
+	}
+
+	log.Printf("Promoted user %q to admin from config", username)
+	return nil
+}
+
+// currentUserID 获取当前登录用户ID
+func currentUserID(ctx context.Context) (uuid.UUID, error) {
+	userID, ok := GetUserIDFromContext(ctx)
+	if !ok {
+		return uuid.Nil, fmt.Errorf("user not authenticated")
+	}
+	return uuid.Parse(userID)
+}
+
+// CreateUserMethod 创建用户
+type CreateUserMethod struct {
+	storage storage.Storage
+}
+
+func NewCreateUserMethod(storage storage.Storage) *CreateUserMethod {
+	return &CreateUserMethod{storage: storage}
+}
+
+func (m *CreateUserMethod) Name() string {
+	return "plumber.user.create"
+}
+
+func (m *CreateUserMethod) Permission() string {
+	return auth.PermUserAdmin
+}
+
+type CreateUserParams struct {
+	Username string           `json:"username"`
+	Password string           `json:"password"`
+	Role     string           `json:"role"`            // 默认viewer
+	Scope    models.UserScope `json:"scope,omitempty"` // 可选的任务/Agent标签范围
+}
+
+func (m *CreateUserMethod) Execute(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var p CreateUserParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, fmt.Errorf("invalid params: %w", err)
+	}
+
+	if p.Username == "" {
+		return nil, fmt.Errorf("username is required")
+	}
+	if len(p.Password) < minPasswordLength {
+		return nil, fmt.Errorf("password must be at least %d characters", minPasswordLength)
+	}
+	if p.Role == "" {
+		p.Role = auth.RoleViewer
+	}
+	if !auth.ValidRole(p.Role) {
+		return nil, fmt.Errorf("invalid role: %s", p.Role)
+	}
+
+	if _, err := m.storage.GetUserByUsername(ctx, p.Username); err == nil {
+		return nil, fmt.Errorf("username already exists")
+	}
+
+	hash, err := auth.HashPassword(p.Password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	user := &models.User{
+		Username: p.Username,
+		Password: hash,
+		Role:     p.Role,
+		Scope:    p.Scope,
+	}
+
+	if err := m.storage.CreateUser(ctx, user); err != nil {
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+
+	return map[string]interface{}{
+		"user_id":  user.ID.String(),
+		"username": user.Username,
+		"role":     user.Role,
+		"status":   "created",
+	}, nil
+}
+
+// ListUsersMethod 列出所有用户
+type ListUsersMethod struct {
+	storage storage.Storage
+}
+
+func NewListUsersMethod(storage storage.Storage) *ListUsersMethod {
+	return &ListUsersMethod{storage: storage}
+}
+
+func (m *ListUsersMethod) Name() string {
+	return "plumber.user.list"
+}
+
+func (m *ListUsersMethod) Permission() string {
+	return auth.PermUserAdmin
+}
+
+func (m *ListUsersMethod) Audit() bool {
+	return false
+}
+
+func (m *ListUsersMethod) Execute(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	users, err := m.storage.ListUsers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+
+	return map[string]interface{}{
+		"users": users,
+	}, nil
+}
+
+// SetUserDisabledMethod 禁用/启用用户
+type SetUserDisabledMethod struct {
+	storage storage.Storage
+}
+
+func NewSetUserDisabledMethod(storage storage.Storage) *SetUserDisabledMethod {
+	return &SetUserDisabledMethod{storage: storage}
+}
+
+func (m *SetUserDisabledMethod) Name() string {
+	return "plumber.user.setDisabled"
+}
+
+func (m *SetUserDisabledMethod) Permission() string {
+	return auth.PermUserAdmin
+}
+
+type SetUserDisabledParams struct {
+	UserID   string `json:"user_id"`
+	Disabled bool   `json:"disabled"`
+}
+
+func (m *SetUserDisabledMethod) Execute(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var p SetUserDisabledParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, fmt.Errorf("invalid params: %w", err)
+	}
+
+	userUUID, err := uuid.Parse(p.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user_id: %w", err)
+	}
+
+	if selfID, err := currentUserID(ctx); err == nil && selfID == userUUID && p.Disabled {
+		return nil, fmt.Errorf("cannot disable yourself")
+	}
+
+	user, err := m.storage.GetUser(ctx, userUUID)
+	if err != nil {
+		return nil, fmt.Errorf("user not found: %w", err)
+	}
+
+	user.Disabled = p.Disabled
+	if err := m.storage.UpdateUser(ctx, user); err != nil {
+		return nil, fmt.Errorf("failed to update user: %w", err)
+	}
+
+	// 禁用用户时让其全部会话下线
+	if p.Disabled {
+		if _, err := m.storage.RevokeUserSessions(ctx, userUUID, uuid.Nil); err != nil {
+			log.Printf("Failed to revoke sessions of user %s: %v", userUUID, err)
+		}
+	}
+
+	status := "enabled"
+	if p.Disabled {
+		status = "disabled"
+	}
+
+	return map[string]interface{}{
+		"status": status,
+	}, nil
+}
+
+// SetUserRoleMethod 修改用户角色和资源范围
+type SetUserRoleMethod struct {
+	storage storage.Storage
+}
+
+func NewSetUserRoleMethod(storage storage.Storage) *SetUserRoleMethod {
+	return &SetUserRoleMethod{storage: storage}
+}
+
+func (m *SetUserRoleMethod) Name() string {
+	return "plumber.user.setRole"
+}
+
+func (m *SetUserRoleMethod) Permission() string {
+	return auth.PermUserAdmin
+}
+
+type SetUserRoleParams struct {
+	UserID string           `json:"user_id"`
+	Role   string           `json:"role"`
+	Scope  models.UserScope `json:"scope"` // 为空表示不限制范围
+}
+
+func (m *SetUserRoleMethod) Execute(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var p SetUserRoleParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, fmt.Errorf("invalid params: %w", err)
+	}
+
+	userUUID, err := uuid.Parse(p.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user_id: %w", err)
+	}
+
+	if !auth.ValidRole(p.Role) {
+		return nil, fmt.Errorf("invalid role: %s", p.Role)
+	}
+
+	if selfID, err := currentUserID(ctx); err == nil && selfID == userUUID && p.Role != auth.RoleAdmin {
+		return nil, fmt.Errorf("cannot remove your own admin role")
+	}
+
+	user, err := m.storage.GetUser(ctx, userUUID)
+	if err != nil {
+		return nil, fmt.Errorf("user not found: %w", err)
+	}
+
+	user.Role = p.Role
+	user.Scope = p.Scope
+	if err := m.storage.UpdateUser(ctx, user); err != nil {
+		return nil, fmt.Errorf("failed to update user: %w", err)
+	}
+
+	return map[string]interface{}{
+		"status": "updated",
+		"role":   user.Role,
+	}, nil
+}
+
+// DeleteUserMethod 删除用户
+type DeleteUserMethod struct {
+	storage storage.Storage
+}
+
+func NewDeleteUserMethod(storage storage.Storage) *DeleteUserMethod {
+	return &DeleteUserMethod{storage: storage}
+}
+
+func (m *DeleteUserMethod) Name() string {
+	return "plumber.user.delete"
+}
+
+func (m *DeleteUserMethod) Permission() string {
+	return auth.PermUserAdmin
+}
+
+type DeleteUserParams struct {
+	UserID string `json:"user_id"`
+}
+
+func (m *DeleteUserMethod) Execute(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var p DeleteUserParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, fmt.Errorf("invalid params: %w", err)
+	}
+
+	userUUID, err := uuid.Parse(p.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user_id: %w", err)
+	}
+
+	if selfID, err := currentUserID(ctx); err == nil && selfID == userUUID {
+		return nil, fmt.Errorf("cannot delete yourself")
+	}
+
+	if _, err := m.storage.GetUser(ctx, userUUID); err != nil {
+		return nil, fmt.Errorf("user not found: %w", err)
+	}
+
+	if err := m.storage.DeleteUser(ctx, userUUID); err != nil {
+		return nil, fmt.Errorf("failed to delete user: %w", err)
+	}
+
+	return map[string]interface{}{
+		"status":  "deleted",
+		"message": "User deleted successfully",
+	}, nil
+}
+
+// ChangePasswordMethod 修改密码
+// 不指定user_id或指定自己时需要校验旧密码；指定其他用户时为管理员重置密码
+type ChangePasswordMethod struct {
+	storage storage.Storage
+}
+
+func NewChangePasswordMethod(storage storage.Storage) *ChangePasswordMethod {
+	return &ChangePasswordMethod{storage: storage}
+}
+
+func (m *ChangePasswordMethod) Name() string {
+	return "plumber.user.changePassword"
+}
+
+func (m *ChangePasswordMethod) Permission() string {
+	return auth.PermUserSelf
+}
+
+type ChangePasswordParams struct {
+	UserID      string `json:"user_id,omitempty"`
+	OldPassword string `json:"old_password,omitempty"`
+	NewPassword string `json:"new_password"`
+}
+
+func (m *ChangePasswordMethod) Execute(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var p ChangePasswordParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, fmt.Errorf("invalid params: %w", err)
+	}
+
+	if len(p.NewPassword) < minPasswordLength {
+		return nil, fmt.Errorf("password must be at least %d characters", minPasswordLength)
+	}
+
+	selfID, err := currentUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	targetID := selfID
+	if p.UserID != "" {
+		targetID, err = uuid.Parse(p.UserID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid user_id: %w", err)
+		}
+	}
+
+	// 重置他人密码需要用户管理权限
+	if targetID != selfID && !hasPermission(ctx, auth.PermUserAdmin) {
+		return nil, fmt.Errorf("permission denied: %s required", auth.PermUserAdmin)
+	}
+
+	user, err := m.storage.GetUser(ctx, targetID)
+	if err != nil {
+		return nil, fmt.Errorf("user not found: %w", err)
+	}
+
+	if targetID == selfID && !auth.CheckPassword(p.OldPassword, user.Password) {
+		return nil, fmt.Errorf("old password is incorrect")
+	}
+
+	hash, err := auth.HashPassword(p.NewPassword)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	user.Password = hash
+	if err := m.storage.UpdateUser(ctx, user); err != nil {
+		return nil, fmt.Errorf("failed to update password: %w", err)
+	}
+
+	// 修改密码后让该用户的其他会话下线，保留当前会话
+	currentSession, _ := GetSessionIDFromContext(ctx)
+	if targetID != selfID {
+		currentSession = uuid.Nil
+	}
+	if _, err := m.storage.RevokeUserSessions(ctx, targetID, currentSession); err != nil {
+		log.Printf("Failed to revoke sessions of user %s: %v", targetID, err)
+	}
+
+	return map[string]interface{}{
+		"status":  "updated",
+		"message": "Password changed successfully",
+	}, nil
+}
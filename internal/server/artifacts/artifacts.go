@@ -0,0 +1,82 @@
+package artifacts
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/plumber/plumber/pkg/models"
+)
+
+// File 已保存的制品文件
+type File struct {
+	Path   string
+	Size   int64
+	SHA256 string
+}
+
+// Store 在本地目录保存制品文件，元数据保存在数据库中
+type Store struct {
+	dir string
+}
+
+// NewStore 创建制品仓库，目录不存在时自动创建
+func NewStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, fmt.Errorf("failed to create artifact dir: %w", err)
+	}
+	return &Store{dir: dir}, nil
+}
+
+// ValidateName 校验制品名称，规则见 models.ValidateArtifactName
+func ValidateName(name string) error {
+	return models.ValidateArtifactName(name)
+}
+
+// Save 写入临时文件并计算SHA-256，完成后重命名为随机文件名，失败时不留下残缺文件
+func (s *Store) Save(r io.Reader) (*File, error) {
+	tmp, err := os.CreateTemp(s.dir, ".upload-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	final, err := os.CreateTemp(s.dir, "artifact-*")
+	if err != nil {
+		return nil, err
+	}
+	final.Close()
+	if err := os.Rename(tmp.Name(), final.Name()); err != nil {
+		os.Remove(final.Name())
+		return nil, err
+	}
+	return &File{
+		Path:   final.Name(),
+		Size:   size,
+		SHA256: hex.EncodeToString(hash.Sum(nil)),
+	}, nil
+}
+
+// Open 打开制品文件，调用方负责关闭
+func (s *Store) Open(path string) (*os.File, error) {
+	return os.Open(path)
+}
+
+// Remove 删除制品文件，文件不存在时不报错
+func (s *Store) Remove(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strings"
+
+	"github.com/plumber/plumber/internal/server/storage"
+	"github.com/plumber/plumber/pkg/models"
+)
+
+// 审计结果
+const (
+	ResultSuccess = "success"
+	ResultError   = "error"
+	ResultDenied  = "denied"
+)
+
+// 调用方身份来源
+const (
+	ViaSession  = "session"
+	ViaAPIToken = "api_token"
+	ViaAgent    = "agent"
+	ViaPublic   = "public"
+)
+
+const (
+	redacted = "[REDACTED]"
+	// maxValueLength 单个字符串参数最多保留的长度
+	maxValueLength = 4096
+)
+
+// sensitiveKeys 参数名包含这些片段时整体脱敏
+var sensitiveKeys = []string{
+	"password",
+	"token",
+	"secret",
+	"private_key",
+	"passphrase",
+	"credential",
+	"csr",
+}
+
+// Recorder 写入审计日志
+type Recorder struct {
+	storage storage.Storage
+}
+
+// NewRecorder 创建审计日志记录器
+func NewRecorder(storage storage.Storage) *Recorder {
+	return &Recorder{storage: storage}
+}
+
+// Record 写入一条审计日志，失败只记录到服务日志，不影响业务请求
+func (r *Recorder) Record(ctx context.Context, entry *models.AuditLog) {
+	if len(entry.UserAgent) > 255 {
+		entry.UserAgent = entry.UserAgent[:255]
+	}
+	if err := r.storage.CreateAuditLog(context.WithoutCancel(ctx), entry); err != nil {
+		log.Printf("Failed to write audit log for %s: %v", entry.Method, err)
+	}
+}
+
+// SanitizeParams 解析RPC参数并去除其中的敏感字段
+func SanitizeParams(raw json.RawMessage) map[string]interface{} {
+	if len(raw) == 0 {
+		return nil
+	}
+
+	var params map[string]interface{}
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return map[string]interface{}{"_invalid": true}
+	}
+
+	return sanitizeMap(params)
+}
+
+func sanitizeMap(m map[string]interface{}) map[string]interface{} {
+	for key, value := range m {
+		if isSensitive(key) {
+			if value != nil && value != "" {
+				m[key] = redacted
+			}
+			continue
+		}
+		m[key] = sanitizeValue(value)
+	}
+	return m
+}
+
+func sanitizeValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return sanitizeMap(v)
+	case []interface{}:
+		for i := range v {
+			v[i] = sanitizeValue(v[i])
+		}
+		return v
+	case string:
+		if strings.Contains(v, "PRIVATE KEY") {
+			return redacted
+		}
+		if len(v) > maxValueLength {
+			return v[:maxValueLength] + "...(truncated)"
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+func isSensitive(key string) bool {
+	key = strings.ToLower(key)
+	for _, s := range sensitiveKeys {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -9,9 +9,14 @@ import (
 
 // Config 配置结构
 type Config struct {
-	Server   ServerConfig   `toml:"server"`
-	Database DatabaseConfig `toml:"database"`
-	Auth     AuthConfig     `toml:"auth"`
+	Server    ServerConfig    `toml:"server"`
+	Database  DatabaseConfig  `toml:"database"`
+	Auth      AuthConfig      `toml:"auth"`
+	TLS       TLSConfig       `toml:"tls"`
+	WebSSH    WebSSHConfig    `toml:"webssh"`
+	SSH       SSHConfig       `toml:"ssh"`
+	Deploy    DeployConfig    `toml:"deploy"`
+	Artifacts ArtifactsConfig `toml:"artifacts"`
 }
 
 // ServerConfig 服务器配置
@@ -35,12 +40,73 @@ type DatabaseConfig struct {
 
 // AuthConfig 认证配置
 type AuthConfig struct {
-	JWTSecret       string `toml:"jwt_secret"`
-	TokenExpiration int    `toml:"token_expiration"` // 小时
-	AgentToken      string `toml:"agent_token"`      // Agent认证Token
-	AdminUsername   string `toml:"admin_username"`   // 管理员用户名
-	AdminPassword   string `toml:"admin_password"`   // 管理员密码
-	EncryptionKey   string `toml:"encryption_key"`   // 数据加密密钥（32字节）
+	JWTSecret          string                `toml:"jwt_secret"`           // 默认签名密钥（kid为default）
+	JWTKeys            []JWTKeyConfig        `toml:"jwt_keys"`             // 额外的签名密钥，用于密钥轮换
+	JWTKeyID           string                `toml:"jwt_key_id"`           // 签发新令牌使用的密钥ID，留空使用jwt_secret
+	AccessTokenMinutes int                   `toml:"access_token_minutes"` // 访问令牌有效期（分钟）
+	TokenExpiration    int                   `toml:"token_expiration"`     // 登录会话（刷新令牌）有效期，小时
+	AdminUsername      string                `toml:"admin_username"`       // 初始管理员用户名（仅在用户表为空时使用）
+	AdminPassword      string                `toml:"admin_password"`       // 初始管理员密码
+	EncryptionKey      string                `toml:"encryption_key"`       // 数据加密主密钥（32字节，密钥ID为default）
+	EncryptionKeys     []EncryptionKeyConfig `toml:"encryption_keys"`      // 额外的加密主密钥，用于密钥轮换
+	EncryptionKeyID    string                `toml:"encryption_key_id"`    // 加密新数据使用的主密钥ID，留空使用encryption_key
+}
+
+// EncryptionKeyConfig 数据加密主密钥
+type EncryptionKeyConfig struct {
+	ID  string `toml:"id"`
+	Key string `toml:"key"` // 32字节
+}
+
+// JWTKeyConfig JWT签名密钥
+type JWTKeyConfig struct {
+	ID     string `toml:"id"`
+	Secret string `toml:"secret"`
+}
+
+// WebSSHConfig WebSSH终端配置
+type WebSSHConfig struct {
+	AllowedOrigins     []string `toml:"allowed_origins"`      // 允许发起连接的页面来源，留空只允许同源，"*"允许任意来源
+	IdleTimeoutMinutes int      `toml:"idle_timeout_minutes"` // 无输入自动断开（分钟）
+	MaxSessionMinutes  int      `toml:"max_session_minutes"`  // 单次会话最长时长（分钟）
+	RecordingDir       string   `toml:"recording_dir"`        // 会话录像目录
+	RecordingRetention int      `toml:"recording_retention"`  // 录像保留天数，0表示永久保留
+	MaxUploadMB        int      `toml:"max_upload_mb"`        // SFTP单个文件上传上限（MB）
+	MaxDownloadMB      int      `toml:"max_download_mb"`      // SFTP单个文件下载上限（MB）
+}
+
+// SSHConfig 服务端连接Agent主机（WebSSH、部署）的SSH配置
+type SSHConfig struct {
+	HostKeyPolicy  string `toml:"host_key_policy"`  // 主机公钥策略：tofu首次连接时固定，strict只接受已固定或known_hosts中的公钥
+	KnownHostsFile string `toml:"known_hosts_file"` // 预置的known_hosts文件，可选
+	TimeoutSeconds int    `toml:"timeout_seconds"`  // 连接超时（秒）
+}
+
+// DeployConfig Agent部署配置
+type DeployConfig struct {
+	BinaryDir            string `toml:"binary_dir"`             // Agent二进制目录，文件名为 plumber-agent-<os>-<arch>
+	MaxBinaryMB          int    `toml:"max_binary_mb"`          // 上传二进制大小上限（MB）
+	VerifyTimeoutSeconds int    `toml:"verify_timeout_seconds"` // 部署后等待Agent注册的时间（秒）
+	MaxParallelism       int    `toml:"max_parallelism"`        // 单个部署任务同时部署的Agent数量上限
+	SigningKeyFile       string `toml:"signing_key_file"`       // Agent自更新签名私钥（Ed25519），不存在时自动生成
+}
+
+// ArtifactsConfig 任务制品（upload/download步骤传输的文件）配置
+type ArtifactsConfig struct {
+	Dir           string `toml:"dir"`            // 制品保存目录
+	RetentionDays int    `toml:"retention_days"` // 制品保留天数，0表示永久保留
+	MaxUploadMB   int    `toml:"max_upload_mb"`  // 单个制品大小上限（MB）
+}
+
+// TLSConfig TLS及Agent双向认证配置
+type TLSConfig struct {
+	Enabled          bool     `toml:"enabled"`            // 是否启用HTTPS
+	CertFile         string   `toml:"cert_file"`          // 服务端证书（留空则由内置CA签发）
+	KeyFile          string   `toml:"key_file"`           // 服务端私钥
+	CADir            string   `toml:"ca_dir"`             // 内置CA目录
+	Hosts            []string `toml:"hosts"`              // 内置CA签发服务端证书时使用的主机名/IP
+	RequireAgentCert bool     `toml:"require_agent_cert"` // Agent接口是否强制要求客户端证书
+	CertValidityDays int      `toml:"cert_validity_days"` // Agent证书有效期（天）
 }
 
 // Load 加载配置文件
@@ -56,6 +122,66 @@ func Load(path string) (*Config, error) {
 		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
 
+	if config.Auth.AccessTokenMinutes <= 0 {
+		config.Auth.AccessTokenMinutes = 15
+	}
+	if config.Auth.TokenExpiration <= 0 {
+		config.Auth.TokenExpiration = 168
+	}
+
+	if config.WebSSH.IdleTimeoutMinutes <= 0 {
+		config.WebSSH.IdleTimeoutMinutes = 15
+	}
+	if config.WebSSH.MaxSessionMinutes <= 0 {
+		config.WebSSH.MaxSessionMinutes = 240
+	}
+	if config.WebSSH.RecordingDir == "" {
+		config.WebSSH.RecordingDir = "data/recordings"
+	}
+	if config.WebSSH.MaxUploadMB <= 0 {
+		config.WebSSH.MaxUploadMB = 100
+	}
+	if config.WebSSH.MaxDownloadMB <= 0 {
+		config.WebSSH.MaxDownloadMB = 100
+	}
+
+	if config.SSH.HostKeyPolicy == "" {
+		config.SSH.HostKeyPolicy = "tofu"
+	}
+	if config.SSH.TimeoutSeconds <= 0 {
+		config.SSH.TimeoutSeconds = 30
+	}
+
+	if config.Deploy.BinaryDir == "" {
+		config.Deploy.BinaryDir = "data/agent-binaries"
+	}
+	if config.Deploy.MaxBinaryMB <= 0 {
+		config.Deploy.MaxBinaryMB = 200
+	}
+	if config.Deploy.VerifyTimeoutSeconds <= 0 {
+		config.Deploy.VerifyTimeoutSeconds = 60
+	}
+	if config.Deploy.MaxParallelism <= 0 {
+		config.Deploy.MaxParallelism = 20
+	}
+	if config.Deploy.SigningKeyFile == "" {
+		config.Deploy.SigningKeyFile = "data/agent-update.key"
+	}
+
+	if config.Artifacts.Dir == "" {
+		config.Artifacts.Dir = "data/artifacts"
+	}
+	if config.Artifacts.MaxUploadMB <= 0 {
+		config.Artifacts.MaxUploadMB = 1024
+	}
+
+	if config.TLS.CADir == "" {
+		config.TLS.CADir = "data/ca"
+	}
+	if config.TLS.CertValidityDays <= 0 {
+		config.TLS.CertValidityDays = 30
+	}
+
 	return &config, nil
 }
 
@@ -0,0 +1,103 @@
+package relay
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// Request 等待Agent接入的终端请求，通过心跳响应下发给Agent
+type Request struct {
+	SessionID uuid.UUID `json:"session_id"`
+	Rows      int       `json:"rows"`
+	Cols      int       `json:"cols"`
+}
+
+// session 一个待接入的终端会话
+type session struct {
+	Request
+	agentID  uuid.UUID
+	offered  bool                 // 已通过心跳下发给Agent
+	attached chan *websocket.Conn // Agent接入后传递连接
+}
+
+// Broker 在浏览器和Agent之间撮合终端会话
+// 浏览器打开终端时登记会话，Agent在心跳中领取请求后主动连回服务端，两端连接配对后由调用方转发数据
+type Broker struct {
+	mu       sync.Mutex
+	sessions map[uuid.UUID]*session
+}
+
+func NewBroker() *Broker {
+	return &Broker{sessions: make(map[uuid.UUID]*session)}
+}
+
+// Open 登记终端会话并等待Agent接入，超时或ctx取消时返回错误
+func (b *Broker) Open(ctx context.Context, agentID uuid.UUID, rows, cols int, timeout time.Duration) (*websocket.Conn, error) {
+	s := &session{
+		Request:  Request{SessionID: uuid.New(), Rows: rows, Cols: cols},
+		agentID:  agentID,
+		attached: make(chan *websocket.Conn, 1),
+	}
+
+	b.mu.Lock()
+	b.sessions[s.SessionID] = s
+	b.mu.Unlock()
+
+	defer func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.sessions, s.SessionID)
+		// 超时的同时Agent恰好接入，关闭这个无人使用的连接
+		select {
+		case conn := <-s.attached:
+			conn.Close()
+		default:
+		}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case conn := <-s.attached:
+		return conn, nil
+	case <-timer.C:
+		return nil, fmt.Errorf("agent did not connect within %s, check that it is online and up to date", timeout)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Pending 返回Agent尚未领取的终端请求，每个请求只下发一次
+func (b *Broker) Pending(agentID uuid.UUID) []Request {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var requests []Request
+	for _, s := range b.sessions {
+		if s.agentID == agentID && !s.offered {
+			s.offered = true
+			requests = append(requests, s.Request)
+		}
+	}
+	return requests
+}
+
+// Attach Agent连回后与等待中的会话配对，会话必须属于该Agent
+func (b *Broker) Attach(sessionID, agentID uuid.UUID, conn *websocket.Conn) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s, ok := b.sessions[sessionID]
+	if !ok || s.agentID != agentID {
+		return fmt.Errorf("terminal session not found")
+	}
+	delete(b.sessions, sessionID)
+	s.attached <- conn
+	return nil
+}
@@ -0,0 +1,224 @@
+package secrets
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/plumber/plumber/internal/server/storage"
+	"github.com/plumber/plumber/pkg/util"
+)
+
+// DefaultKeyID auth.encryption_key 对应的主密钥ID
+const DefaultKeyID = "default"
+
+// sealedPrefix 信封加密后的格式：enc:v1:<主密钥ID>:<主密钥加密的数据密钥>:<数据密钥加密的密文>
+const sealedPrefix = "enc:v1:"
+
+// Keyring 主密钥集合，新数据使用当前主密钥加密，旧主密钥只用于解密和轮换
+// 每个值使用独立的随机数据密钥（AES-256-GCM）加密，数据密钥再由主密钥加密，
+// 轮换主密钥时只需重新加密数据密钥
+type Keyring struct {
+	activeID string
+	keys     map[string][]byte
+}
+
+// NewKeyring 创建主密钥集合，activeID为空时使用default
+func NewKeyring(activeID string, keys map[string][]byte) (*Keyring, error) {
+	if activeID == "" {
+		activeID = DefaultKeyID
+	}
+	for id, key := range keys {
+		if id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("invalid encryption key id %q", id)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("encryption key %q must be 32 bytes", id)
+		}
+	}
+	if _, ok := keys[activeID]; !ok {
+		return nil, fmt.Errorf("encryption key %q is not configured", activeID)
+	}
+	return &Keyring{activeID: activeID, keys: keys}, nil
+}
+
+// ActiveID 当前用于加密的主密钥ID
+func (k *Keyring) ActiveID() string {
+	return k.activeID
+}
+
+// IsSealed 判断值是否已经过信封加密
+func IsSealed(value string) bool {
+	return strings.HasPrefix(value, sealedPrefix)
+}
+
+// Seal 加密凭据，空值保持为空
+func (k *Keyring) Seal(plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+
+	dek := make([]byte, 32)
+	if _, err := rand.Read(dek); err != nil {
+		return "", fmt.Errorf("failed to generate data key: %w", err)
+	}
+	ciphertext, err := util.Encrypt(plaintext, dek)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt: %w", err)
+	}
+	wrapped, err := util.Encrypt(string(dek), k.keys[k.activeID])
+	if err != nil {
+		return "", fmt.Errorf("failed to wrap data key: %w", err)
+	}
+	return sealedPrefix + k.activeID + ":" + wrapped + ":" + ciphertext, nil
+}
+
+// Open 解密凭据，空值返回空
+func (k *Keyring) Open(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	keyID, wrapped, ciphertext, err := parseSealed(value)
+	if err != nil {
+		return "", err
+	}
+	dek, err := k.unwrap(keyID, wrapped)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := util.Decrypt(ciphertext, dek)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt credential: %w", err)
+	}
+	return plaintext, nil
+}
+
+// Rewrap 将已加密的值转为当前主密钥加密；未加密或旧格式（直接用主密钥加密）的值重新加密
+// 返回值未变化时changed为false
+func (k *Keyring) Rewrap(value string) (result string, changed bool, err error) {
+	if value == "" {
+		return "", false, nil
+	}
+
+	if !IsSealed(value) {
+		return k.sealLegacy(value)
+	}
+
+	keyID, wrapped, ciphertext, err := parseSealed(value)
+	if err != nil {
+		return "", false, err
+	}
+	if keyID == k.activeID {
+		return value, false, nil
+	}
+	dek, err := k.unwrap(keyID, wrapped)
+	if err != nil {
+		return "", false, err
+	}
+	rewrapped, err := util.Encrypt(string(dek), k.keys[k.activeID])
+	if err != nil {
+		return "", false, fmt.Errorf("failed to wrap data key: %w", err)
+	}
+	return sealedPrefix + k.activeID + ":" + rewrapped + ":" + ciphertext, true, nil
+}
+
+// sealLegacy 加密明文值；早期直接用encryption_key加密的值先解密再加密
+func (k *Keyring) sealLegacy(value string) (string, bool, error) {
+	plaintext := value
+	for _, key := range k.keys {
+		if decrypted, err := util.Decrypt(value, key); err == nil {
+			plaintext = decrypted
+			break
+		}
+	}
+	sealed, err := k.Seal(plaintext)
+	if err != nil {
+		return "", false, err
+	}
+	return sealed, true, nil
+}
+
+func (k *Keyring) unwrap(keyID, wrapped string) ([]byte, error) {
+	key, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("encryption key %q is not configured", keyID)
+	}
+	dek, err := util.Decrypt(wrapped, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key with %q: %w", keyID, err)
+	}
+	return []byte(dek), nil
+}
+
+func parseSealed(value string) (keyID, wrapped, ciphertext string, err error) {
+	if !IsSealed(value) {
+		return "", "", "", fmt.Errorf("credential is not encrypted")
+	}
+	parts := strings.Split(strings.TrimPrefix(value, sealedPrefix), ":")
+	if len(parts) != 3 {
+		return "", "", "", fmt.Errorf("malformed encrypted credential")
+	}
+	return parts[0], parts[1], parts[2], nil
+}
+
+// MigrateCredentials 加密历史明文SSH凭据（Agent和跳板机），并将旧主密钥加密的凭据转为当前主密钥
+// 服务启动时执行，已是当前主密钥加密的记录不做修改
+func MigrateCredentials(ctx context.Context, store storage.Storage, keyring *Keyring) (int, error) {
+	agents, err := store.ListAgentCredentials(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list agent credentials: %w", err)
+	}
+
+	migrated := 0
+	for _, agent := range agents {
+		password, privateKey, changed, err := keyring.rewrapPair(agent.SSHPassword, agent.SSHPrivateKey)
+		if err != nil {
+			return migrated, fmt.Errorf("agent %s: %w", agent.ID, err)
+		}
+		if !changed {
+			continue
+		}
+		if err := store.UpdateAgentCredentials(ctx, agent.ID, password, privateKey); err != nil {
+			return migrated, fmt.Errorf("failed to update agent %s credentials: %w", agent.ID, err)
+		}
+		migrated++
+	}
+
+	bastions, err := store.ListBastionCredentials(ctx)
+	if err != nil {
+		return migrated, fmt.Errorf("failed to list bastion credentials: %w", err)
+	}
+	for _, bastion := range bastions {
+		password, privateKey, changed, err := keyring.rewrapPair(bastion.Password, bastion.PrivateKey)
+		if err != nil {
+			return migrated, fmt.Errorf("bastion %s: %w", bastion.ID, err)
+		}
+		if !changed {
+			continue
+		}
+		if err := store.UpdateBastionCredentials(ctx, bastion.ID, password, privateKey); err != nil {
+			return migrated, fmt.Errorf("failed to update bastion %s credentials: %w", bastion.ID, err)
+		}
+		migrated++
+	}
+
+	if migrated > 0 {
+		log.Printf("Encrypted SSH credentials of %d record(s) with key %q", migrated, keyring.ActiveID())
+	}
+	return migrated, nil
+}
+
+// rewrapPair 转换一组密码和私钥
+func (k *Keyring) rewrapPair(password, privateKey string) (string, string, bool, error) {
+	password, passwordChanged, err := k.Rewrap(password)
+	if err != nil {
+		return "", "", false, fmt.Errorf("password: %w", err)
+	}
+	privateKey, keyChanged, err := k.Rewrap(privateKey)
+	if err != nil {
+		return "", "", false, fmt.Errorf("private key: %w", err)
+	}
+	return password, privateKey, passwordChanged || keyChanged, nil
+}
@@ -0,0 +1,382 @@
+package sshdial
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/plumber/plumber/internal/server/secrets"
+	"github.com/plumber/plumber/internal/server/storage"
+	"github.com/plumber/plumber/pkg/models"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// 主机公钥校验策略
+const (
+	PolicyTOFU   = "tofu"   // 首次连接时记录主机公钥，之后必须一致
+	PolicyStrict = "strict" // 只接受已固定或known_hosts中的主机公钥
+)
+
+// Options SSH连接配置
+type Options struct {
+	HostKeyPolicy  string        // tofu/strict，默认tofu
+	KnownHostsFile string        // 预置的known_hosts文件，可选
+	Timeout        time.Duration // 建立连接和握手的超时
+}
+
+// HostKeyMismatchError 主机公钥与固定的公钥不一致
+type HostKeyMismatchError struct {
+	Host     string
+	Expected string // 期望的指纹
+	Actual   string // 实际收到的指纹
+	Source   string // 期望公钥的来源：pinned/known_hosts
+}
+
+func (e *HostKeyMismatchError) Error() string {
+	return fmt.Sprintf("SSH host key mismatch for %s: expected %s (%s), got %s; the host may have been reinstalled or the connection intercepted, verify and reset the pinned key if the change is expected",
+		e.Host, e.Expected, e.Source, e.Actual)
+}
+
+// ErrUnknownHostKey strict模式下主机公钥未固定
+var ErrUnknownHostKey = errors.New("SSH host key is not pinned and host_key_policy is strict")
+
+// Dialer WebSSH和部署共用的SSH连接器，负责凭据解密和主机公钥校验
+type Dialer struct {
+	storage    storage.Storage
+	keyring    *secrets.Keyring
+	options    Options
+	knownHosts ssh.HostKeyCallback
+}
+
+// New 创建SSH连接器，配置了known_hosts时立即加载
+func New(storage storage.Storage, keyring *secrets.Keyring, options Options) (*Dialer, error) {
+	switch options.HostKeyPolicy {
+	case "":
+		options.HostKeyPolicy = PolicyTOFU
+	case PolicyTOFU, PolicyStrict:
+	default:
+		return nil, fmt.Errorf("invalid host_key_policy %q, use %q or %q", options.HostKeyPolicy, PolicyTOFU, PolicyStrict)
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = 30 * time.Second
+	}
+
+	d := &Dialer{
+		storage: storage,
+		keyring: keyring,
+		options: options,
+	}
+	if options.KnownHostsFile != "" {
+		callback, err := knownhosts.New(options.KnownHostsFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load known_hosts: %w", err)
+		}
+		d.knownHosts = callback
+	}
+	return d, nil
+}
+
+// Fingerprint 返回公钥的SHA256指纹
+func Fingerprint(key ssh.PublicKey) string {
+	return ssh.FingerprintSHA256(key)
+}
+
+// ParseHostKey 解析authorized_keys或known_hosts格式的主机公钥
+func ParseHostKey(line string) (ssh.PublicKey, error) {
+	line = strings.TrimSpace(line)
+	if key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line)); err == nil {
+		return key, nil
+	}
+	_, _, key, _, _, err := ssh.ParseKnownHosts([]byte(line))
+	if err != nil {
+		return nil, fmt.Errorf("invalid host key: %w", err)
+	}
+	return key, nil
+}
+
+// MarshalHostKey 将公钥编码为authorized_keys格式（单行）
+func MarshalHostKey(key ssh.PublicKey) string {
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+}
+
+// MaxHops 跳板机链的最大长度
+const MaxHops = 8
+
+// Address 返回Agent的SSH地址
+func Address(agent *models.Agent) string {
+	return hostPort(agent.SSHHost, agent.SSHPort)
+}
+
+func hostPort(host string, port int) string {
+	if port == 0 {
+		port = 22
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// endpoint 链路上的一台SSH主机（跳板机或目标主机）
+type endpoint struct {
+	name       string // 日志和错误中显示的名称
+	addr       string
+	user       string
+	authType   string
+	password   string
+	privateKey string
+	hostKey    string // 已固定的主机公钥
+	pin        func(ctx context.Context, hostKey, fingerprint string) error
+}
+
+func agentEndpoint(d *Dialer, agent *models.Agent) *endpoint {
+	return &endpoint{
+		name:       "agent " + agent.ID.String(),
+		addr:       Address(agent),
+		user:       agent.SSHUser,
+		authType:   agent.SSHAuthType,
+		password:   agent.SSHPassword,
+		privateKey: agent.SSHPrivateKey,
+		hostKey:    agent.SSHHostKey,
+		pin: func(ctx context.Context, hostKey, fingerprint string) error {
+			if err := d.storage.UpdateAgentHostKey(ctx, agent.ID, hostKey, fingerprint); err != nil {
+				return err
+			}
+			agent.SSHHostKey, agent.SSHHostKeyFP = hostKey, fingerprint
+			return nil
+		},
+	}
+}
+
+func bastionEndpoint(d *Dialer, bastion *models.Bastion) *endpoint {
+	return &endpoint{
+		name:       "bastion " + bastion.Name,
+		addr:       hostPort(bastion.Host, bastion.Port),
+		user:       bastion.User,
+		authType:   bastion.AuthType,
+		password:   bastion.Password,
+		privateKey: bastion.PrivateKey,
+		hostKey:    bastion.HostKey,
+		pin: func(ctx context.Context, hostKey, fingerprint string) error {
+			if err := d.storage.UpdateBastionHostKey(ctx, bastion.ID, hostKey, fingerprint); err != nil {
+				return err
+			}
+			bastion.HostKey, bastion.HostKeyFP = hostKey, fingerprint
+			return nil
+		},
+	}
+}
+
+// Dial 连接Agent所在主机的SSH服务，配置了跳板机时依次经由各级跳板机连接
+// 关闭返回的客户端时同时关闭途经的跳板机连接
+func (d *Dialer) Dial(ctx context.Context, agent *models.Agent) (*ssh.Client, error) {
+	if agent.SSHUser == "" {
+		return nil, fmt.Errorf("SSH user is required")
+	}
+	if agent.SSHHost == "" {
+		return nil, fmt.Errorf("SSH host is required")
+	}
+
+	hops, err := d.ResolveChain(ctx, agent.SSHBastionID)
+	if err != nil {
+		return nil, err
+	}
+
+	var jumps []*ssh.Client
+	closeJumps := func() {
+		for i := len(jumps) - 1; i >= 0; i-- {
+			jumps[i].Close()
+		}
+	}
+
+	var via *ssh.Client
+	for _, bastion := range hops {
+		client, err := d.dialEndpoint(ctx, via, bastionEndpoint(d, bastion))
+		if err != nil {
+			closeJumps()
+			return nil, fmt.Errorf("bastion %s: %w", bastion.Name, err)
+		}
+		jumps = append(jumps, client)
+		via = client
+	}
+
+	client, err := d.dialEndpoint(ctx, via, agentEndpoint(d, agent))
+	if err != nil {
+		closeJumps()
+		return nil, err
+	}
+	if len(jumps) > 0 {
+		go func() {
+			client.Wait()
+			closeJumps()
+		}()
+	}
+	return client, nil
+}
+
+// ResolveChain 解析跳板机链，返回从服务端出发依次经过的跳板机
+func (d *Dialer) ResolveChain(ctx context.Context, bastionID *uuid.UUID) ([]*models.Bastion, error) {
+	var chain []*models.Bastion
+	seen := make(map[uuid.UUID]bool)
+	for id := bastionID; id != nil; {
+		if seen[*id] {
+			return nil, fmt.Errorf("bastion chain contains a loop at %s", id)
+		}
+		if len(chain) >= MaxHops {
+			return nil, fmt.Errorf("bastion chain exceeds %d hops", MaxHops)
+		}
+		seen[*id] = true
+
+		bastion, err := d.storage.GetBastion(ctx, *id)
+		if err != nil {
+			return nil, fmt.Errorf("bastion %s not found: %w", id, err)
+		}
+		chain = append(chain, bastion)
+		id = bastion.JumpID
+	}
+
+	// 链上记录的是每台主机的上一跳，连接时从最外层开始
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+	return chain, nil
+}
+
+// dialEndpoint 建立到一台主机的SSH连接，via不为空时通过该连接转发
+func (d *Dialer) dialEndpoint(ctx context.Context, via *ssh.Client, ep *endpoint) (*ssh.Client, error) {
+	authMethods, err := d.authMethods(ep)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &ssh.ClientConfig{
+		User:            ep.user,
+		Auth:            authMethods,
+		HostKeyCallback: d.hostKeyCallback(ctx, ep),
+		Timeout:         d.options.Timeout,
+	}
+
+	log.Printf("Connecting to SSH server: %s@%s (%s)", ep.user, ep.addr, ep.name)
+
+	ctx, cancel := context.WithTimeout(ctx, d.options.Timeout)
+	defer cancel()
+
+	var conn net.Conn
+	if via != nil {
+		conn, err = via.DialContext(ctx, "tcp", ep.addr)
+	} else {
+		dialer := net.Dialer{}
+		conn, err = dialer.DialContext(ctx, "tcp", ep.addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("SSH connection failed: %w", err)
+	}
+
+	// 握手同样受超时限制（经跳板机转发的连接不支持deadline，由ctx兜底）
+	conn.SetDeadline(time.Now().Add(d.options.Timeout))
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	c, chans, reqs, err := ssh.NewClientConn(conn, ep.addr, config)
+	if !stop() && err == nil {
+		err = ctx.Err()
+		c.Close()
+	}
+	if err != nil {
+		conn.Close()
+		var mismatch *HostKeyMismatchError
+		if errors.As(err, &mismatch) {
+			return nil, mismatch
+		}
+		return nil, fmt.Errorf("SSH connection failed: %w", err)
+	}
+	conn.SetDeadline(time.Time{})
+
+	log.Printf("SSH connection established successfully (%s)", ep.name)
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+// authMethods 按认证类型构造认证方式，凭据使用前解密
+func (d *Dialer) authMethods(ep *endpoint) ([]ssh.AuthMethod, error) {
+	switch ep.authType {
+	case "password":
+		if ep.password == "" {
+			return nil, fmt.Errorf("password is required for password authentication")
+		}
+		password, err := d.keyring.Open(ep.password)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt SSH password: %w", err)
+		}
+		return []ssh.AuthMethod{ssh.Password(password)}, nil
+
+	case "key":
+		if ep.privateKey == "" {
+			return nil, fmt.Errorf("private key is required for key authentication")
+		}
+		privateKey, err := d.keyring.Open(ep.privateKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt SSH private key: %w", err)
+		}
+		signer, err := ssh.ParsePrivateKey([]byte(privateKey))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse private key: %w", err)
+		}
+		return []ssh.AuthMethod{ssh.PublicKeys(signer)}, nil
+
+	default:
+		return nil, fmt.Errorf("authentication type '%s' is not supported. Use 'password' or 'key'", ep.authType)
+	}
+}
+
+// hostKeyCallback 校验顺序：已固定的公钥 > known_hosts > 按策略首次信任或拒绝
+func (d *Dialer) hostKeyCallback(ctx context.Context, ep *endpoint) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		actual := Fingerprint(key)
+
+		if ep.hostKey != "" {
+			pinned, err := ParseHostKey(ep.hostKey)
+			if err != nil {
+				return fmt.Errorf("pinned host key of %s is invalid: %w", ep.name, err)
+			}
+			if !keysEqual(pinned, key) {
+				return &HostKeyMismatchError{Host: hostname, Expected: Fingerprint(pinned), Actual: actual, Source: "pinned"}
+			}
+			return nil
+		}
+
+		if d.knownHosts != nil {
+			err := d.knownHosts(hostname, remote, key)
+			var keyErr *knownhosts.KeyError
+			switch {
+			case err == nil:
+				return d.pin(ctx, ep, key, "known_hosts")
+			case errors.As(err, &keyErr) && len(keyErr.Want) > 0:
+				return &HostKeyMismatchError{Host: hostname, Expected: Fingerprint(keyErr.Want[0].Key), Actual: actual, Source: "known_hosts"}
+			case !errors.As(err, &keyErr):
+				return err
+			}
+			// known_hosts中没有该主机，继续按策略处理
+		}
+
+		if d.options.HostKeyPolicy == PolicyStrict {
+			return fmt.Errorf("%w: %s presented %s", ErrUnknownHostKey, hostname, actual)
+		}
+		return d.pin(ctx, ep, key, "first use")
+	}
+}
+
+// pin 记录主机公钥，之后的连接必须使用相同公钥
+func (d *Dialer) pin(ctx context.Context, ep *endpoint, key ssh.PublicKey, source string) error {
+	hostKey, fingerprint := MarshalHostKey(key), Fingerprint(key)
+	if err := ep.pin(ctx, hostKey, fingerprint); err != nil {
+		return fmt.Errorf("failed to pin host key: %w", err)
+	}
+	log.Printf("Pinned SSH host key %s for %s (%s)", fingerprint, ep.name, source)
+	return nil
+}
+
+func keysEqual(a, b ssh.PublicKey) bool {
+	return a.Type() == b.Type() && string(a.Marshal()) == string(b.Marshal())
+}
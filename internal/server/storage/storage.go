@@ -22,8 +22,41 @@ type Storage interface {
 	UpdateAgent(ctx context.Context, agent *models.Agent) error
 	UpdateAgentHeartbeat(ctx context.Context, id uuid.UUID) error
 	UpdateAgentStatus(ctx context.Context, id uuid.UUID, status string) error
+	UpdateAgentToken(ctx context.Context, id uuid.UUID, tokenHash string) error
+	DecommissionAgent(ctx context.Context, id uuid.UUID) error
+	UpdateAgentInstallDir(ctx context.Context, id uuid.UUID, installDir string) error
+	SetAgentDesiredVersion(ctx context.Context, id uuid.UUID, version string) error
+	UpdateAgentSelfUpdate(ctx context.Context, id uuid.UUID, version, status, message string) error
+	UpdateAgentHostKey(ctx context.Context, id uuid.UUID, hostKey, fingerprint string) error
+	ListAgentCredentials(ctx context.Context) ([]*models.Agent, error)
+	UpdateAgentCredentials(ctx context.Context, id uuid.UUID, password, privateKey string) error
 	DeleteAgent(ctx context.Context, id uuid.UUID) error
 
+	// Bastion相关
+	CreateBastion(ctx context.Context, bastion *models.Bastion) error
+	GetBastion(ctx context.Context, id uuid.UUID) (*models.Bastion, error)
+	ListBastions(ctx context.Context) ([]*models.Bastion, error)
+	UpdateBastion(ctx context.Context, bastion *models.Bastion) error
+	UpdateBastionHostKey(ctx context.Context, id uuid.UUID, hostKey, fingerprint string) error
+	CountBastionReferences(ctx context.Context, id uuid.UUID) (int64, error)
+	ListBastionCredentials(ctx context.Context) ([]*models.Bastion, error)
+	UpdateBastionCredentials(ctx context.Context, id uuid.UUID, password, privateKey string) error
+	DeleteBastion(ctx context.Context, id uuid.UUID) error
+
+	// AgentCertificate相关
+	CreateAgentCertificate(ctx context.Context, cert *models.AgentCertificate) error
+	GetAgentCertificateBySerial(ctx context.Context, serial string) (*models.AgentCertificate, error)
+	ListAgentCertificates(ctx context.Context, agentID uuid.UUID) ([]*models.AgentCertificate, error)
+	ListRevokedAgentCertificates(ctx context.Context) ([]*models.AgentCertificate, error)
+	RevokeAgentCertificate(ctx context.Context, serial string) error
+	RevokeAgentCertificatesByAgent(ctx context.Context, agentID uuid.UUID) (int64, error)
+
+	// JoinToken相关
+	CreateJoinToken(ctx context.Context, token *models.JoinToken) error
+	ListJoinTokens(ctx context.Context) ([]*models.JoinToken, error)
+	RevokeJoinToken(ctx context.Context, id uuid.UUID) error
+	JoinAgent(ctx context.Context, tokenHash string, agent *models.Agent) (*models.JoinToken, error)
+
 	// Task相关
 	CreateTask(ctx context.Context, task *models.Task) error
 	GetTask(ctx context.Context, id uuid.UUID) (*models.Task, error)
@@ -46,13 +79,100 @@ type Storage interface {
 
 	// User相关
 	CreateUser(ctx context.Context, user *models.User) error
+	GetUser(ctx context.Context, id uuid.UUID) (*models.User, error)
+	ListUsers(ctx context.Context) ([]*models.User, error)
+	CountUsers(ctx context.Context) (int64, error)
+	UpdateUser(ctx context.Context, user *models.User) error
+	DeleteUser(ctx context.Context, id uuid.UUID) error
 	GetUserByUsername(ctx context.Context, username string) (*models.User, error)
-	GetUserByToken(ctx context.Context, token string) (*models.User, error)
-	UpdateUserToken(ctx context.Context, userID uuid.UUID, token string) error
+
+	// Session相关
+	CreateSession(ctx context.Context, session *models.Session) error
+	GetSession(ctx context.Context, id uuid.UUID) (*models.Session, error)
+	GetSessionByRefreshToken(ctx context.Context, tokenHash string) (*models.Session, error)
+	ListSessions(ctx context.Context, userID uuid.UUID) ([]*models.Session, error)
+	RotateSessionRefreshToken(ctx context.Context, id uuid.UUID, oldHash, newHash string) error
+	RevokeSession(ctx context.Context, id uuid.UUID) error
+	RevokeUserSessions(ctx context.Context, userID uuid.UUID, exceptID uuid.UUID) (int64, error)
+
+	// TerminalRecording相关
+	CreateTerminalRecording(ctx context.Context, recording *models.TerminalRecording) error
+	UpdateTerminalRecording(ctx context.Context, recording *models.TerminalRecording) error
+	GetTerminalRecording(ctx context.Context, id uuid.UUID) (*models.TerminalRecording, error)
+	ListTerminalRecordings(ctx context.Context, filter TerminalRecordingFilter) ([]*models.TerminalRecording, int64, error)
+	ListTerminalRecordingsBefore(ctx context.Context, before time.Time) ([]*models.TerminalRecording, error)
+	DeleteTerminalRecording(ctx context.Context, id uuid.UUID) error
+
+	// Artifact相关
+	CreateArtifact(ctx context.Context, artifact *models.Artifact) error
+	GetArtifact(ctx context.Context, id uuid.UUID) (*models.Artifact, error)
+	GetLatestArtifactByName(ctx context.Context, name string) (*models.Artifact, error)
+	ListArtifacts(ctx context.Context, filter ArtifactFilter) ([]*models.Artifact, int64, error)
+	ListArtifactsBefore(ctx context.Context, before time.Time) ([]*models.Artifact, error)
+	DeleteArtifact(ctx context.Context, id uuid.UUID) error
+
+	// DeployJob相关
+	CreateDeployJob(ctx context.Context, job *models.DeployJob) error
+	GetDeployJob(ctx context.Context, id uuid.UUID) (*models.DeployJob, error)
+	ListDeployJobs(ctx context.Context, filter DeployJobFilter) ([]*models.DeployJob, int64, error)
+	UpdateDeployJob(ctx context.Context, job *models.DeployJob) error
+	UpdateDeployTarget(ctx context.Context, target *models.DeployTarget) error
+	FailInterruptedDeployJobs(ctx context.Context, reason string) (int64, error)
+
+	// AuditLog相关（只追加）
+	CreateAuditLog(ctx context.Context, entry *models.AuditLog) error
+	ListAuditLogs(ctx context.Context, filter AuditLogFilter) ([]*models.AuditLog, int64, error)
+
+	// APIToken相关
+	CreateAPIToken(ctx context.Context, token *models.APIToken) error
+	GetAPIToken(ctx context.Context, id uuid.UUID) (*models.APIToken, error)
+	GetAPITokenByHash(ctx context.Context, tokenHash string) (*models.APIToken, error)
+	ListAPITokens(ctx context.Context, userID uuid.UUID) ([]*models.APIToken, error)
+	RevokeAPIToken(ctx context.Context, id uuid.UUID) error
+	TouchAPIToken(ctx context.Context, id uuid.UUID, usedAt time.Time) error
 
 	Close() error
 }
 
+// TerminalRecordingFilter 终端录像查询条件，零值字段不参与过滤
+type TerminalRecordingFilter struct {
+	UserID  *uuid.UUID
+	AgentID *uuid.UUID
+	Limit   int
+	Offset  int
+}
+
+// ArtifactFilter 制品查询条件，零值字段不参与过滤
+type ArtifactFilter struct {
+	ExecutionID *uuid.UUID
+	StepName    string
+	Name        string
+	Limit       int
+	Offset      int
+}
+
+// DeployJobFilter 部署任务查询条件，零值字段不参与过滤
+type DeployJobFilter struct {
+	AgentID *uuid.UUID // 包含该Agent的部署任务
+	Status  string
+	Limit   int
+	Offset  int
+}
+
+// AuditLogFilter 审计日志查询条件，零值字段不参与过滤
+type AuditLogFilter struct {
+	UserID   *uuid.UUID
+	Username string
+	Method   string // 支持前缀匹配，如 plumber.agent.
+	TaskID   string
+	AgentID  string
+	Result   string
+	Since    *time.Time
+	Until    *time.Time
+	Limit    int
+	Offset   int
+}
+
 // PostgresStorage PostgreSQL存储实现
 type PostgresStorage struct {
 	db *gorm.DB
@@ -75,6 +195,16 @@ func NewPostgresStorage(dsn string, debug bool) (*PostgresStorage, error) {
 	// 自动迁移
 	if err := db.AutoMigrate(
 		&models.Agent{},
+		&models.AgentCertificate{},
+		&models.Bastion{},
+		&models.JoinToken{},
+		&models.Session{},
+		&models.APIToken{},
+		&models.AuditLog{},
+		&models.TerminalRecording{},
+		&models.Artifact{},
+		&models.DeployJob{},
+		&models.DeployTarget{},
 		&models.Task{},
 		&models.TaskExecution{},
 		&models.StepExecution{},
@@ -126,10 +256,294 @@ func (s *PostgresStorage) UpdateAgentStatus(ctx context.Context, id uuid.UUID, s
 		Update("status", status).Error
 }
 
+func (s *PostgresStorage) UpdateAgentToken(ctx context.Context, id uuid.UUID, tokenHash string) error {
+	updates := map[string]interface{}{
+		"token_hash":      tokenHash,
+		"token_issued_at": nil,
+	}
+	if tokenHash != "" {
+		updates["token_issued_at"] = time.Now()
+	} else {
+		// 吊销令牌后Agent立即视为离线
+		updates["status"] = "offline"
+	}
+	return s.db.WithContext(ctx).Model(&models.Agent{}).
+		Where("id = ?", id).
+		Updates(updates).Error
+}
+
+// DecommissionAgent 标记Agent已卸载并吊销令牌，保留记录用于审计和部署历史
+func (s *PostgresStorage) DecommissionAgent(ctx context.Context, id uuid.UUID) error {
+	return s.db.WithContext(ctx).Model(&models.Agent{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"token_hash":      "",
+			"token_issued_at": nil,
+			"status":          "decommissioned",
+		}).Error
+}
+
+// UpdateAgentInstallDir 记录部署时的安装目录
+func (s *PostgresStorage) UpdateAgentInstallDir(ctx context.Context, id uuid.UUID, installDir string) error {
+	return s.db.WithContext(ctx).Model(&models.Agent{}).
+		Where("id = ?", id).
+		Update("install_dir", installDir).Error
+}
+
+// SetAgentDesiredVersion 设置Agent自更新的目标版本，并清除上次自更新结果以便重新尝试
+func (s *PostgresStorage) SetAgentDesiredVersion(ctx context.Context, id uuid.UUID, version string) error {
+	return s.db.WithContext(ctx).Model(&models.Agent{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"desired_version":    version,
+			"update_version":     "",
+			"update_status":      "",
+			"update_message":     "",
+			"update_reported_at": nil,
+		}).Error
+}
+
+// UpdateAgentSelfUpdate 记录Agent上报的自更新结果
+func (s *PostgresStorage) UpdateAgentSelfUpdate(ctx context.Context, id uuid.UUID, version, status, message string) error {
+	return s.db.WithContext(ctx).Model(&models.Agent{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"update_version":     version,
+			"update_status":      status,
+			"update_message":     message,
+			"update_reported_at": time.Now(),
+		}).Error
+}
+
+// UpdateAgentHostKey 固定或清除（hostKey为空）Agent的SSH主机公钥
+func (s *PostgresStorage) UpdateAgentHostKey(ctx context.Context, id uuid.UUID, hostKey, fingerprint string) error {
+	updates := map[string]interface{}{
+		"ssh_host_key":    hostKey,
+		"ssh_host_key_fp": fingerprint,
+		"ssh_host_key_at": nil,
+	}
+	if hostKey != "" {
+		updates["ssh_host_key_at"] = time.Now()
+	}
+	return s.db.WithContext(ctx).Model(&models.Agent{}).
+		Where("id = ?", id).
+		Updates(updates).Error
+}
+
+// ListAgentCredentials 列出所有Agent（包括已删除）的SSH凭据，用于加密迁移和密钥轮换
+func (s *PostgresStorage) ListAgentCredentials(ctx context.Context) ([]*models.Agent, error) {
+	var agents []*models.Agent
+	err := s.db.WithContext(ctx).Unscoped().
+		Select("id", "ssh_password", "ssh_private_key").
+		Where("ssh_password <> '' OR ssh_private_key <> ''").
+		Find(&agents).Error
+	if err != nil {
+		return nil, err
+	}
+	return agents, nil
+}
+
+// UpdateAgentCredentials 更新Agent的SSH凭据（调用方负责加密）
+func (s *PostgresStorage) UpdateAgentCredentials(ctx context.Context, id uuid.UUID, password, privateKey string) error {
+	return s.db.WithContext(ctx).Unscoped().Model(&models.Agent{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"ssh_password":    password,
+			"ssh_private_key": privateKey,
+		}).Error
+}
+
 func (s *PostgresStorage) DeleteAgent(ctx context.Context, id uuid.UUID) error {
 	return s.db.WithContext(ctx).Delete(&models.Agent{}, "id = ?", id).Error
 }
 
+// Bastion相关方法
+func (s *PostgresStorage) CreateBastion(ctx context.Context, bastion *models.Bastion) error {
+	return s.db.WithContext(ctx).Create(bastion).Error
+}
+
+func (s *PostgresStorage) GetBastion(ctx context.Context, id uuid.UUID) (*models.Bastion, error) {
+	var bastion models.Bastion
+	if err := s.db.WithContext(ctx).First(&bastion, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &bastion, nil
+}
+
+func (s *PostgresStorage) ListBastions(ctx context.Context) ([]*models.Bastion, error) {
+	var bastions []*models.Bastion
+	if err := s.db.WithContext(ctx).Order("name").Find(&bastions).Error; err != nil {
+		return nil, err
+	}
+	return bastions, nil
+}
+
+func (s *PostgresStorage) UpdateBastion(ctx context.Context, bastion *models.Bastion) error {
+	return s.db.WithContext(ctx).Save(bastion).Error
+}
+
+// UpdateBastionHostKey 固定或清除（hostKey为空）跳板机的SSH主机公钥
+func (s *PostgresStorage) UpdateBastionHostKey(ctx context.Context, id uuid.UUID, hostKey, fingerprint string) error {
+	updates := map[string]interface{}{
+		"host_key":    hostKey,
+		"host_key_fp": fingerprint,
+		"host_key_at": nil,
+	}
+	if hostKey != "" {
+		updates["host_key_at"] = time.Now()
+	}
+	return s.db.WithContext(ctx).Model(&models.Bastion{}).
+		Where("id = ?", id).
+		Updates(updates).Error
+}
+
+// CountBastionReferences 统计引用该跳板机的Agent和跳板机数量
+func (s *PostgresStorage) CountBastionReferences(ctx context.Context, id uuid.UUID) (int64, error) {
+	var agents, bastions int64
+	if err := s.db.WithContext(ctx).Model(&models.Agent{}).Where("ssh_bastion_id = ?", id).Count(&agents).Error; err != nil {
+		return 0, err
+	}
+	if err := s.db.WithContext(ctx).Model(&models.Bastion{}).Where("jump_id = ?", id).Count(&bastions).Error; err != nil {
+		return 0, err
+	}
+	return agents + bastions, nil
+}
+
+// ListBastionCredentials 列出所有跳板机（包括已删除）的凭据，用于加密迁移和密钥轮换
+func (s *PostgresStorage) ListBastionCredentials(ctx context.Context) ([]*models.Bastion, error) {
+	var bastions []*models.Bastion
+	err := s.db.WithContext(ctx).Unscoped().
+		Select("id", "password", "private_key").
+		Where("password <> '' OR private_key <> ''").
+		Find(&bastions).Error
+	if err != nil {
+		return nil, err
+	}
+	return bastions, nil
+}
+
+// UpdateBastionCredentials 更新跳板机凭据（调用方负责加密）
+func (s *PostgresStorage) UpdateBastionCredentials(ctx context.Context, id uuid.UUID, password, privateKey string) error {
+	return s.db.WithContext(ctx).Unscoped().Model(&models.Bastion{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"password":    password,
+			"private_key": privateKey,
+		}).Error
+}
+
+func (s *PostgresStorage) DeleteBastion(ctx context.Context, id uuid.UUID) error {
+	return s.db.WithContext(ctx).Delete(&models.Bastion{}, "id = ?", id).Error
+}
+
+// AgentCertificate相关方法
+func (s *PostgresStorage) CreateAgentCertificate(ctx context.Context, cert *models.AgentCertificate) error {
+	return s.db.WithContext(ctx).Create(cert).Error
+}
+
+func (s *PostgresStorage) GetAgentCertificateBySerial(ctx context.Context, serial string) (*models.AgentCertificate, error) {
+	var cert models.AgentCertificate
+	if err := s.db.WithContext(ctx).First(&cert, "serial = ?", serial).Error; err != nil {
+		return nil, err
+	}
+	return &cert, nil
+}
+
+func (s *PostgresStorage) ListAgentCertificates(ctx context.Context, agentID uuid.UUID) ([]*models.AgentCertificate, error) {
+	var certs []*models.AgentCertificate
+	if err := s.db.WithContext(ctx).
+		Where("agent_id = ?", agentID).
+		Order("created_at DESC").
+		Find(&certs).Error; err != nil {
+		return nil, err
+	}
+	return certs, nil
+}
+
+func (s *PostgresStorage) ListRevokedAgentCertificates(ctx context.Context) ([]*models.AgentCertificate, error) {
+	var certs []*models.AgentCertificate
+	// 已过期的证书无需再出现在吊销列表中
+	if err := s.db.WithContext(ctx).
+		Where("revoked_at IS NOT NULL AND not_after > ?", time.Now()).
+		Order("revoked_at ASC").
+		Find(&certs).Error; err != nil {
+		return nil, err
+	}
+	return certs, nil
+}
+
+func (s *PostgresStorage) RevokeAgentCertificate(ctx context.Context, serial string) error {
+	result := s.db.WithContext(ctx).Model(&models.AgentCertificate{}).
+		Where("serial = ? AND revoked_at IS NULL", serial).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (s *PostgresStorage) RevokeAgentCertificatesByAgent(ctx context.Context, agentID uuid.UUID) (int64, error) {
+	result := s.db.WithContext(ctx).Model(&models.AgentCertificate{}).
+		Where("agent_id = ? AND revoked_at IS NULL", agentID).
+		Update("revoked_at", time.Now())
+	return result.RowsAffected, result.Error
+}
+
+// JoinToken相关方法
+func (s *PostgresStorage) CreateJoinToken(ctx context.Context, token *models.JoinToken) error {
+	return s.db.WithContext(ctx).Create(token).Error
+}
+
+func (s *PostgresStorage) ListJoinTokens(ctx context.Context) ([]*models.JoinToken, error) {
+	var tokens []*models.JoinToken
+	if err := s.db.WithContext(ctx).Order("created_at DESC").Find(&tokens).Error; err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func (s *PostgresStorage) RevokeJoinToken(ctx context.Context, id uuid.UUID) error {
+	result := s.db.WithContext(ctx).Model(&models.JoinToken{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// JoinAgent 在同一事务中消耗一次加入令牌并创建Agent（继承令牌的标签），
+// 令牌无效、过期、已吊销或次数用尽时返回错误；创建失败时令牌次数不会被消耗
+func (s *PostgresStorage) JoinAgent(ctx context.Context, tokenHash string, agent *models.Agent) (*models.JoinToken, error) {
+	var token models.JoinToken
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ? AND revoked_at IS NULL AND expires_at > ? AND uses < max_uses", tokenHash, time.Now()).
+			First(&token).Error; err != nil {
+			return err
+		}
+
+		agent.Labels = token.Labels
+		if err := tx.Create(agent).Error; err != nil {
+			return err
+		}
+
+		token.Uses++
+		return tx.Model(&token).Update("uses", token.Uses).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
 // Task相关方法
 func (s *PostgresStorage) CreateTask(ctx context.Context, task *models.Task) error {
 	return s.db.WithContext(ctx).Create(task).Error
@@ -283,26 +697,389 @@ func (s *PostgresStorage) CreateUser(ctx context.Context, user *models.User) err
 	return s.db.WithContext(ctx).Create(user).Error
 }
 
-func (s *PostgresStorage) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
+func (s *PostgresStorage) GetUser(ctx context.Context, id uuid.UUID) (*models.User, error) {
 	var user models.User
-	if err := s.db.WithContext(ctx).First(&user, "username = ?", username).Error; err != nil {
+	if err := s.db.WithContext(ctx).First(&user, "id = ?", id).Error; err != nil {
 		return nil, err
 	}
 	return &user, nil
 }
 
-func (s *PostgresStorage) GetUserByToken(ctx context.Context, token string) (*models.User, error) {
+func (s *PostgresStorage) ListUsers(ctx context.Context) ([]*models.User, error) {
+	var users []*models.User
+	if err := s.db.WithContext(ctx).Order("created_at ASC").Find(&users).Error; err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (s *PostgresStorage) CountUsers(ctx context.Context) (int64, error) {
+	var count int64
+	if err := s.db.WithContext(ctx).Model(&models.User{}).Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (s *PostgresStorage) UpdateUser(ctx context.Context, user *models.User) error {
+	return s.db.WithContext(ctx).Save(user).Error
+}
+
+func (s *PostgresStorage) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	// 物理删除，释放用户名唯一索引，并一并删除该用户的API令牌和会话
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&models.APIToken{}, "user_id = ?", id).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&models.Session{}, "user_id = ?", id).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&models.User{}, "id = ?", id).Error
+	})
+}
+
+func (s *PostgresStorage) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
 	var user models.User
-	if err := s.db.WithContext(ctx).First(&user, "token = ?", token).Error; err != nil {
+	if err := s.db.WithContext(ctx).First(&user, "username = ?", username).Error; err != nil {
 		return nil, err
 	}
 	return &user, nil
 }
 
-func (s *PostgresStorage) UpdateUserToken(ctx context.Context, userID uuid.UUID, token string) error {
-	return s.db.WithContext(ctx).Model(&models.User{}).
-		Where("id = ?", userID).
-		Update("token", token).Error
+// Session相关方法
+func (s *PostgresStorage) CreateSession(ctx context.Context, session *models.Session) error {
+	return s.db.WithContext(ctx).Create(session).Error
+}
+
+func (s *PostgresStorage) GetSession(ctx context.Context, id uuid.UUID) (*models.Session, error) {
+	var session models.Session
+	if err := s.db.WithContext(ctx).First(&session, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// GetSessionByRefreshToken 按当前或上一个刷新令牌查找会话
+func (s *PostgresStorage) GetSessionByRefreshToken(ctx context.Context, tokenHash string) (*models.Session, error) {
+	var session models.Session
+	if err := s.db.WithContext(ctx).
+		Where("refresh_token_hash = ? OR previous_token_hash = ?", tokenHash, tokenHash).
+		First(&session).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (s *PostgresStorage) ListSessions(ctx context.Context, userID uuid.UUID) ([]*models.Session, error) {
+	var sessions []*models.Session
+	if err := s.db.WithContext(ctx).
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("created_at DESC").
+		Find(&sessions).Error; err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// RotateSessionRefreshToken 以旧刷新令牌为条件原子地轮换，并发刷新时只有一个请求成功
+func (s *PostgresStorage) RotateSessionRefreshToken(ctx context.Context, id uuid.UUID, oldHash, newHash string) error {
+	result := s.db.WithContext(ctx).Model(&models.Session{}).
+		Where("id = ? AND refresh_token_hash = ? AND revoked_at IS NULL", id, oldHash).
+		Updates(map[string]interface{}{
+			"refresh_token_hash":  newHash,
+			"previous_token_hash": oldHash,
+			"last_used_at":        time.Now(),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (s *PostgresStorage) RevokeSession(ctx context.Context, id uuid.UUID) error {
+	return s.db.WithContext(ctx).Model(&models.Session{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now()).Error
+}
+
+// RevokeUserSessions 吊销用户的全部会话，exceptID不为空时保留该会话
+func (s *PostgresStorage) RevokeUserSessions(ctx context.Context, userID uuid.UUID, exceptID uuid.UUID) (int64, error) {
+	result := s.db.WithContext(ctx).Model(&models.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL AND id <> ?", userID, exceptID).
+		Update("revoked_at", time.Now())
+	return result.RowsAffected, result.Error
+}
+
+// TerminalRecording相关方法
+func (s *PostgresStorage) CreateTerminalRecording(ctx context.Context, recording *models.TerminalRecording) error {
+	return s.db.WithContext(ctx).Create(recording).Error
+}
+
+func (s *PostgresStorage) UpdateTerminalRecording(ctx context.Context, recording *models.TerminalRecording) error {
+	return s.db.WithContext(ctx).Save(recording).Error
+}
+
+func (s *PostgresStorage) GetTerminalRecording(ctx context.Context, id uuid.UUID) (*models.TerminalRecording, error) {
+	var recording models.TerminalRecording
+	if err := s.db.WithContext(ctx).First(&recording, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &recording, nil
+}
+
+func (s *PostgresStorage) ListTerminalRecordings(ctx context.Context, filter TerminalRecordingFilter) ([]*models.TerminalRecording, int64, error) {
+	query := s.db.WithContext(ctx).Model(&models.TerminalRecording{})
+	if filter.UserID != nil {
+		query = query.Where("user_id = ?", *filter.UserID)
+	}
+	if filter.AgentID != nil {
+		query = query.Where("agent_id = ?", *filter.AgentID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var recordings []*models.TerminalRecording
+	if err := query.Order("started_at DESC").Limit(filter.Limit).Offset(filter.Offset).Find(&recordings).Error; err != nil {
+		return nil, 0, err
+	}
+	return recordings, total, nil
+}
+
+func (s *PostgresStorage) ListTerminalRecordingsBefore(ctx context.Context, before time.Time) ([]*models.TerminalRecording, error) {
+	var recordings []*models.TerminalRecording
+	if err := s.db.WithContext(ctx).Where("started_at < ?", before).Find(&recordings).Error; err != nil {
+		return nil, err
+	}
+	return recordings, nil
+}
+
+func (s *PostgresStorage) DeleteTerminalRecording(ctx context.Context, id uuid.UUID) error {
+	return s.db.WithContext(ctx).Delete(&models.TerminalRecording{}, "id = ?", id).Error
+}
+
+// Artifact相关方法
+func (s *PostgresStorage) CreateArtifact(ctx context.Context, artifact *models.Artifact) error {
+	return s.db.WithContext(ctx).Create(artifact).Error
+}
+
+func (s *PostgresStorage) GetArtifact(ctx context.Context, id uuid.UUID) (*models.Artifact, error) {
+	var artifact models.Artifact
+	if err := s.db.WithContext(ctx).First(&artifact, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &artifact, nil
+}
+
+func (s *PostgresStorage) GetLatestArtifactByName(ctx context.Context, name string) (*models.Artifact, error) {
+	var artifact models.Artifact
+	if err := s.db.WithContext(ctx).Where("name = ?", name).Order("created_at DESC").First(&artifact).Error; err != nil {
+		return nil, err
+	}
+	return &artifact, nil
+}
+
+func (s *PostgresStorage) ListArtifacts(ctx context.Context, filter ArtifactFilter) ([]*models.Artifact, int64, error) {
+	query := s.db.WithContext(ctx).Model(&models.Artifact{})
+	if filter.ExecutionID != nil {
+		query = query.Where("execution_id = ?", *filter.ExecutionID)
+	}
+	if filter.StepName != "" {
+		query = query.Where("step_name = ?", filter.StepName)
+	}
+	if filter.Name != "" {
+		query = query.Where("name = ?", filter.Name)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var artifacts []*models.Artifact
+	if err := query.Order("created_at DESC").Limit(filter.Limit).Offset(filter.Offset).Find(&artifacts).Error; err != nil {
+		return nil, 0, err
+	}
+	return artifacts, total, nil
+}
+
+func (s *PostgresStorage) ListArtifactsBefore(ctx context.Context, before time.Time) ([]*models.Artifact, error) {
+	var artifacts []*models.Artifact
+	if err := s.db.WithContext(ctx).Where("created_at < ?", before).Find(&artifacts).Error; err != nil {
+		return nil, err
+	}
+	return artifacts, nil
+}
+
+func (s *PostgresStorage) DeleteArtifact(ctx context.Context, id uuid.UUID) error {
+	return s.db.WithContext(ctx).Delete(&models.Artifact{}, "id = ?", id).Error
+}
+
+// AuditLog相关方法
+func (s *PostgresStorage) CreateAuditLog(ctx context.Context, entry *models.AuditLog) error {
+	return s.db.WithContext(ctx).Create(entry).Error
+}
+
+func (s *PostgresStorage) ListAuditLogs(ctx context.Context, filter AuditLogFilter) ([]*models.AuditLog, int64, error) {
+	query := s.db.WithContext(ctx).Model(&models.AuditLog{})
+	if filter.UserID != nil {
+		query = query.Where("user_id = ?", *filter.UserID)
+	}
+	if filter.Username != "" {
+		query = query.Where("username = ?", filter.Username)
+	}
+	if filter.Method != "" {
+		query = query.Where("method LIKE ?", filter.Method+"%")
+	}
+	if filter.TaskID != "" {
+		query = query.Where("task_id = ?", filter.TaskID)
+	}
+	if filter.AgentID != "" {
+		query = query.Where("agent_id = ?", filter.AgentID)
+	}
+	if filter.Result != "" {
+		query = query.Where("result = ?", filter.Result)
+	}
+	if filter.Since != nil {
+		query = query.Where("created_at >= ?", *filter.Since)
+	}
+	if filter.Until != nil {
+		query = query.Where("created_at < ?", *filter.Until)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var entries []*models.AuditLog
+	if err := query.Order("created_at DESC").Limit(filter.Limit).Offset(filter.Offset).Find(&entries).Error; err != nil {
+		return nil, 0, err
+	}
+	return entries, total, nil
+}
+
+// DeployJob相关方法
+func (s *PostgresStorage) CreateDeployJob(ctx context.Context, job *models.DeployJob) error {
+	// 同时创建 job.Targets
+	return s.db.WithContext(ctx).Create(job).Error
+}
+
+func (s *PostgresStorage) GetDeployJob(ctx context.Context, id uuid.UUID) (*models.DeployJob, error) {
+	var job models.DeployJob
+	if err := s.db.WithContext(ctx).
+		Preload("Targets", func(db *gorm.DB) *gorm.DB {
+			return db.Order("agent_name ASC")
+		}).
+		First(&job, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (s *PostgresStorage) ListDeployJobs(ctx context.Context, filter DeployJobFilter) ([]*models.DeployJob, int64, error) {
+	query := s.db.WithContext(ctx).Model(&models.DeployJob{})
+	if filter.AgentID != nil {
+		query = query.Where("id IN (?)", s.db.Model(&models.DeployTarget{}).Select("job_id").Where("agent_id = ?", *filter.AgentID))
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var jobs []*models.DeployJob
+	if err := query.
+		Preload("Targets", func(db *gorm.DB) *gorm.DB {
+			return db.Order("agent_name ASC")
+		}).
+		Order("created_at DESC").Limit(filter.Limit).Offset(filter.Offset).Find(&jobs).Error; err != nil {
+		return nil, 0, err
+	}
+	return jobs, total, nil
+}
+
+func (s *PostgresStorage) UpdateDeployJob(ctx context.Context, job *models.DeployJob) error {
+	return s.db.WithContext(ctx).Omit("Targets").Save(job).Error
+}
+
+func (s *PostgresStorage) UpdateDeployTarget(ctx context.Context, target *models.DeployTarget) error {
+	return s.db.WithContext(ctx).Save(target).Error
+}
+
+// FailInterruptedDeployJobs 服务重启后将未完成的部署任务及目标标记为失败
+func (s *PostgresStorage) FailInterruptedDeployJobs(ctx context.Context, reason string) (int64, error) {
+	var count int64
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Model(&models.DeployTarget{}).
+			Where("status IN ?", []string{"pending", "running"}).
+			Updates(map[string]interface{}{"status": "failed", "error": reason, "end_time": now}).Error; err != nil {
+			return err
+		}
+		result := tx.Model(&models.DeployJob{}).
+			Where("status IN ?", []string{"pending", "running"}).
+			Updates(map[string]interface{}{"status": "failed", "end_time": now})
+		count = result.RowsAffected
+		return result.Error
+	})
+	return count, err
+}
+
+// APIToken相关方法
+func (s *PostgresStorage) CreateAPIToken(ctx context.Context, token *models.APIToken) error {
+	return s.db.WithContext(ctx).Create(token).Error
+}
+
+func (s *PostgresStorage) GetAPIToken(ctx context.Context, id uuid.UUID) (*models.APIToken, error) {
+	var token models.APIToken
+	if err := s.db.WithContext(ctx).First(&token, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (s *PostgresStorage) GetAPITokenByHash(ctx context.Context, tokenHash string) (*models.APIToken, error) {
+	var token models.APIToken
+	if err := s.db.WithContext(ctx).First(&token, "token_hash = ?", tokenHash).Error; err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (s *PostgresStorage) ListAPITokens(ctx context.Context, userID uuid.UUID) ([]*models.APIToken, error) {
+	var tokens []*models.APIToken
+	if err := s.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at DESC").Find(&tokens).Error; err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func (s *PostgresStorage) RevokeAPIToken(ctx context.Context, id uuid.UUID) error {
+	result := s.db.WithContext(ctx).Model(&models.APIToken{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (s *PostgresStorage) TouchAPIToken(ctx context.Context, id uuid.UUID, usedAt time.Time) error {
+	return s.db.WithContext(ctx).Model(&models.APIToken{}).
+		Where("id = ?", id).
+		Update("last_used_at", usedAt).Error
 }
 
 func (s *PostgresStorage) Close() error {
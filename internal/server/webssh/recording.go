@@ -0,0 +1,279 @@
+package webssh
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/plumber/plumber/internal/server/audit"
+	"github.com/plumber/plumber/pkg/auth"
+	"github.com/plumber/plumber/pkg/models"
+)
+
+// castHeader asciicast v2 文件头
+type castHeader struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// castWriter 以asciicast v2格式记录终端会话
+// 每个事件一行：[相对时间(秒), 类型, 数据]，o为输出，i为输入，r为窗口大小变化
+type castWriter struct {
+	mu    sync.Mutex
+	file  *os.File
+	start time.Time
+	size  int64
+	err   error
+}
+
+func newCastWriter(path string, width, height int, title string) (*castWriter, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create recording directory: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create recording: %w", err)
+	}
+
+	c := &castWriter{file: file, start: time.Now()}
+	header, _ := json.Marshal(castHeader{
+		Version:   2,
+		Width:     width,
+		Height:    height,
+		Timestamp: c.start.Unix(),
+		Title:     title,
+		Env:       map[string]string{"TERM": "xterm"},
+	})
+	c.writeLine(header)
+	if c.err != nil {
+		file.Close()
+		return nil, c.err
+	}
+	return c, nil
+}
+
+// Output 记录终端输出
+func (c *castWriter) Output(data []byte) {
+	c.event("o", string(data))
+}
+
+// Input 记录用户输入
+func (c *castWriter) Input(data string) {
+	c.event("i", data)
+}
+
+// Resize 记录窗口大小变化
+func (c *castWriter) Resize(cols, rows int) {
+	c.event("r", fmt.Sprintf("%dx%d", cols, rows))
+}
+
+func (c *castWriter) event(kind, data string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elapsed := time.Since(c.start).Seconds()
+	line, err := json.Marshal([]interface{}{elapsed, kind, data})
+	if err != nil {
+		return
+	}
+	c.writeLine(line)
+}
+
+func (c *castWriter) writeLine(line []byte) {
+	if c.err != nil {
+		return
+	}
+	n, err := c.file.Write(append(line, '\n'))
+	c.size += int64(n)
+	if err != nil {
+		c.err = err
+		log.Printf("Failed to write terminal recording %s: %v", c.file.Name(), err)
+	}
+}
+
+// Close 关闭录像文件，返回文件大小
+func (c *castWriter) Close() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.file.Close(); err != nil {
+		log.Printf("Failed to close terminal recording %s: %v", c.file.Name(), err)
+	}
+	return c.size
+}
+
+// startRecording 为会话创建录像文件和记录
+func (h *WebSSHHandler) startRecording(ctx context.Context, user *models.User, agent *models.Agent, width, height int) (*models.TerminalRecording, *castWriter, error) {
+	recording := &models.TerminalRecording{
+		ID:        uuid.New(),
+		AgentID:   agent.ID,
+		AgentName: agent.Name,
+		StartedAt: time.Now(),
+	}
+	if user != nil {
+		recording.UserID = &user.ID
+		recording.Username = user.Username
+	}
+
+	// 按日期分目录存放
+	recording.FilePath = filepath.Join(h.options.RecordingDir, recording.StartedAt.Format("2006-01-02"), recording.ID.String()+".cast")
+
+	title := fmt.Sprintf("%s@%s", recording.Username, agent.Name)
+	writer, err := newCastWriter(recording.FilePath, width, height, title)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := h.storage.CreateTerminalRecording(ctx, recording); err != nil {
+		writer.Close()
+		os.Remove(recording.FilePath)
+		return nil, nil, fmt.Errorf("failed to save recording: %w", err)
+	}
+
+	return recording, writer, nil
+}
+
+// finishRecording 关闭录像文件并更新时长和大小
+func (h *WebSSHHandler) finishRecording(recording *models.TerminalRecording, writer *castWriter) {
+	size := writer.Close()
+
+	now := time.Now()
+	recording.EndedAt = &now
+	recording.DurationMs = now.Sub(recording.StartedAt).Milliseconds()
+	recording.Size = size
+
+	if err := h.storage.UpdateTerminalRecording(context.Background(), recording); err != nil {
+		log.Printf("Failed to update terminal recording %s: %v", recording.ID, err)
+	}
+}
+
+// StartRecordingRetention 定期删除超过保留期的终端录像，retention为0表示永久保留
+func (h *WebSSHHandler) StartRecordingRetention(retention time.Duration) {
+	if retention <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		h.purgeRecordings(time.Now().Add(-retention))
+		<-ticker.C
+	}
+}
+
+func (h *WebSSHHandler) purgeRecordings(before time.Time) {
+	ctx := context.Background()
+	recordings, err := h.storage.ListTerminalRecordingsBefore(ctx, before)
+	if err != nil {
+		log.Printf("Failed to list expired terminal recordings: %v", err)
+		return
+	}
+
+	for _, recording := range recordings {
+		if err := os.Remove(recording.FilePath); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to remove terminal recording %s: %v", recording.FilePath, err)
+			continue
+		}
+		if err := h.storage.DeleteTerminalRecording(ctx, recording.ID); err != nil {
+			log.Printf("Failed to delete terminal recording %s: %v", recording.ID, err)
+		}
+	}
+
+	if len(recordings) > 0 {
+		log.Printf("Removed %d expired terminal recordings", len(recordings))
+	}
+}
+
+// ServeRecording 下载会话录像（asciicast v2），供Web界面的播放器回放
+// 令牌通过Authorization头或token查询参数传递
+func (h *WebSSHHandler) ServeRecording(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Authorization")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" {
+		token = r.URL.Query().Get("token")
+	}
+	if token == "" {
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	ctx := r.Context()
+	recording, err := h.storage.GetTerminalRecording(ctx, id)
+	if err != nil {
+		http.Error(w, "recording not found", http.StatusNotFound)
+		return
+	}
+
+	params, _ := json.Marshal(map[string]string{"agent_id": recording.AgentID.String()})
+	user, err := h.authorizer.AuthorizeToken(ctx, token, auth.PermRecordRead, params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	file, err := os.Open(recording.FilePath)
+	if err != nil {
+		http.Error(w, "recording file not available", http.StatusNotFound)
+		return
+	}
+	defer file.Close()
+
+	h.recordPlayback(r, user, token, recording)
+
+	w.Header().Set("Content-Type", "application/x-asciicast")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", recording.ID.String()+".cast"))
+	http.ServeContent(w, r, "", recording.StartedAt, file)
+}
+
+// recordPlayback 记录录像回放的审计日志
+func (h *WebSSHHandler) recordPlayback(r *http.Request, user *models.User, token string, recording *models.TerminalRecording) {
+	entry := &models.AuditLog{
+		Via:       audit.ViaSession,
+		Method:    "webssh.recording.play",
+		AgentID:   recording.AgentID.String(),
+		TargetID:  recording.ID.String(),
+		Result:    audit.ResultSuccess,
+		ClientIP:  remoteIP(r),
+		UserAgent: r.UserAgent(),
+	}
+	if auth.IsAPIToken(token) {
+		entry.Via = audit.ViaAPIToken
+	}
+	if user != nil {
+		entry.UserID = &user.ID
+		entry.Username = user.Username
+	}
+	h.audit.Record(r.Context(), entry)
+}
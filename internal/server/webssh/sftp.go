@@ -0,0 +1,385 @@
+package webssh
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/sftp"
+	"github.com/plumber/plumber/internal/server/audit"
+	"github.com/plumber/plumber/pkg/auth"
+	"github.com/plumber/plumber/pkg/models"
+)
+
+// sftpOps 文件操作及所需权限，查询类使用GET，修改类使用POST
+var sftpOps = map[string]struct {
+	method     string
+	permission string
+}{
+	"list":     {http.MethodGet, auth.PermFileRead},
+	"download": {http.MethodGet, auth.PermFileRead},
+	"upload":   {http.MethodPost, auth.PermFileWrite},
+	"mkdir":    {http.MethodPost, auth.PermFileWrite},
+	"rename":   {http.MethodPost, auth.PermFileWrite},
+	"delete":   {http.MethodPost, auth.PermFileWrite},
+	"chmod":    {http.MethodPost, auth.PermFileWrite},
+}
+
+// FileEntry 目录项
+type FileEntry struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	Mode    string    `json:"mode"` // 八进制权限，如 0644
+	IsDir   bool      `json:"is_dir"`
+	IsLink  bool      `json:"is_link,omitempty"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// ServeSFTP 通过Agent的SSH凭据在目标主机上进行文件操作
+// GET  /api/webssh/sftp?agent_id=&op=list|download&path=
+// POST /api/webssh/sftp?agent_id=&op=upload|mkdir|rename|delete|chmod&path=[&to=][&mode=]
+// 上传内容为请求体；认证使用 Authorization: Bearer 或 token 查询参数
+func (h *WebSSHHandler) ServeSFTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	query := r.URL.Query()
+	op := query.Get("op")
+	spec, ok := sftpOps[op]
+	if !ok {
+		http.Error(w, "unknown op", http.StatusBadRequest)
+		return
+	}
+	if r.Method != spec.method {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	agentID, err := uuid.Parse(query.Get("agent_id"))
+	if err != nil {
+		http.Error(w, "invalid agent_id", http.StatusBadRequest)
+		return
+	}
+	target := query.Get("path")
+	if target == "" && op != "list" {
+		http.Error(w, "path is required", http.StatusBadRequest)
+		return
+	}
+
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" {
+		token = query.Get("token")
+	}
+	if token == "" {
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	ctx := r.Context()
+	start := time.Now()
+	details := map[string]interface{}{"path": target}
+	params, _ := json.Marshal(map[string]string{"agent_id": agentID.String()})
+	user, err := h.authorizer.AuthorizeToken(ctx, token, spec.permission, params)
+	if err != nil {
+		h.recordFileAudit(r, op, user, token, agentID, details, start, audit.ResultDenied, err)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	agent, err := h.storage.GetAgent(ctx, agentID)
+	if err != nil {
+		http.Error(w, "agent not found", http.StatusNotFound)
+		return
+	}
+
+	// 文件传输可能超过服务器默认的读写超时
+	rc := http.NewResponseController(w)
+	rc.SetReadDeadline(time.Time{})
+	rc.SetWriteDeadline(time.Time{})
+
+	sshClient, err := h.dialer.Dial(ctx, agent)
+	if err != nil {
+		h.recordFileAudit(r, op, user, token, agentID, details, start, audit.ResultError, err)
+		http.Error(w, fmt.Sprintf("Failed to connect: %v", err), http.StatusBadGateway)
+		return
+	}
+	defer sshClient.Close()
+
+	client, err := sftp.NewClient(sshClient)
+	if err != nil {
+		h.recordFileAudit(r, op, user, token, agentID, details, start, audit.ResultError, err)
+		http.Error(w, fmt.Sprintf("Failed to start sftp: %v", err), http.StatusBadGateway)
+		return
+	}
+	defer client.Close()
+
+	var result interface{}
+	switch op {
+	case "list":
+		result, err = sftpList(client, target)
+	case "download":
+		// 下载直接写入响应，出错前未写入任何内容时返回错误状态
+		var size int64
+		size, err = h.sftpDownload(w, client, target)
+		details["size"] = size
+		if err == nil {
+			h.recordFileAudit(r, op, user, token, agentID, details, start, audit.ResultSuccess, nil)
+			return
+		}
+		// 传输中断时响应头已发送，只记录审计，不再写入错误响应
+		if errors.Is(err, errDownloadInterrupted) {
+			h.recordFileAudit(r, op, user, token, agentID, details, start, audit.ResultError, err)
+			return
+		}
+	case "upload":
+		var size int64
+		size, err = h.sftpUpload(w, r, client, target, query.Get("mode"))
+		details["size"] = size
+		result = map[string]interface{}{"path": target, "size": size}
+	case "mkdir":
+		err = client.MkdirAll(target)
+		result = map[string]interface{}{"path": target}
+	case "rename":
+		to := query.Get("to")
+		details["to"] = to
+		if to == "" {
+			err = badRequest("to is required")
+			break
+		}
+		err = client.Rename(target, to)
+		result = map[string]interface{}{"path": to}
+	case "delete":
+		err = sftpDelete(client, target)
+		result = map[string]interface{}{"path": target}
+	case "chmod":
+		details["mode"] = query.Get("mode")
+		var mode os.FileMode
+		if mode, err = parseFileMode(query.Get("mode")); err == nil {
+			err = client.Chmod(target, mode)
+		}
+		result = map[string]interface{}{"path": target, "mode": fmt.Sprintf("%04o", mode)}
+	}
+
+	// 目录浏览不记录审计，其余操作无论成功失败都记录
+	if op != "list" {
+		resultStatus := audit.ResultSuccess
+		if err != nil {
+			resultStatus = audit.ResultError
+		}
+		h.recordFileAudit(r, op, user, token, agentID, details, start, resultStatus, err)
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), fileErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// sftpList 列出目录内容，目录在前并按名称排序
+func sftpList(client *sftp.Client, dir string) (interface{}, error) {
+	if dir == "" {
+		dir = "."
+	}
+	abs, err := client.RealPath(dir)
+	if err != nil {
+		return nil, err
+	}
+	infos, err := client.ReadDir(abs)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]FileEntry, 0, len(infos))
+	for _, info := range infos {
+		entries = append(entries, FileEntry{
+			Name:    info.Name(),
+			Size:    info.Size(),
+			Mode:    fmt.Sprintf("%04o", info.Mode().Perm()),
+			IsDir:   info.IsDir(),
+			IsLink:  info.Mode()&os.ModeSymlink != 0,
+			ModTime: info.ModTime(),
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].IsDir != entries[j].IsDir {
+			return entries[i].IsDir
+		}
+		return entries[i].Name < entries[j].Name
+	})
+
+	return map[string]interface{}{
+		"path":    abs,
+		"entries": entries,
+	}, nil
+}
+
+// sftpDownload 下载单个文件，超过大小上限时拒绝
+func (h *WebSSHHandler) sftpDownload(w http.ResponseWriter, client *sftp.Client, file string) (int64, error) {
+	info, err := client.Stat(file)
+	if err != nil {
+		return 0, err
+	}
+	if info.IsDir() {
+		return 0, badRequest("path is a directory")
+	}
+	if h.options.MaxDownload > 0 && info.Size() > h.options.MaxDownload {
+		return info.Size(), &fileError{status: http.StatusRequestEntityTooLarge,
+			msg: fmt.Sprintf("file size %d exceeds download limit %d", info.Size(), h.options.MaxDownload)}
+	}
+
+	f, err := client.Open(file)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", path.Base(file)))
+	w.Header().Set("Content-Length", strconv.FormatInt(info.Size(), 10))
+	n, err := io.Copy(w, f)
+	if err != nil {
+		// 响应头已发送，只能中断连接
+		log.Printf("SFTP download of %s interrupted after %d bytes: %v", file, n, err)
+		return n, fmt.Errorf("%w after %d bytes: %v", errDownloadInterrupted, n, err)
+	}
+	return n, nil
+}
+
+// sftpUpload 上传请求体到目标文件，超过大小上限时中止并删除不完整的文件
+func (h *WebSSHHandler) sftpUpload(w http.ResponseWriter, r *http.Request, client *sftp.Client, file, modeStr string) (int64, error) {
+	if h.options.MaxUpload > 0 {
+		if r.ContentLength > h.options.MaxUpload {
+			return 0, &fileError{status: http.StatusRequestEntityTooLarge,
+				msg: fmt.Sprintf("upload size %d exceeds limit %d", r.ContentLength, h.options.MaxUpload)}
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, h.options.MaxUpload)
+	}
+
+	f, err := client.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(f, r.Body)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		client.Remove(file)
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			return n, &fileError{status: http.StatusRequestEntityTooLarge,
+				msg: fmt.Sprintf("upload exceeds limit %d", maxErr.Limit)}
+		}
+		return n, err
+	}
+
+	if modeStr != "" {
+		mode, err := parseFileMode(modeStr)
+		if err != nil {
+			return n, err
+		}
+		if err := client.Chmod(file, mode); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// sftpDelete 删除文件或空目录
+func sftpDelete(client *sftp.Client, target string) error {
+	info, err := client.Lstat(target)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return client.RemoveDirectory(target)
+	}
+	return client.Remove(target)
+}
+
+func parseFileMode(s string) (os.FileMode, error) {
+	if s == "" {
+		return 0, badRequest("mode is required")
+	}
+	mode, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || mode > 0o7777 {
+		return 0, badRequest("invalid mode, use octal like 0644")
+	}
+	return os.FileMode(mode), nil
+}
+
+// errDownloadInterrupted 下载在响应头发送后中断
+var errDownloadInterrupted = errors.New("download interrupted")
+
+// fileError 带HTTP状态码的文件操作错误
+type fileError struct {
+	status int
+	msg    string
+}
+
+func (e *fileError) Error() string {
+	return e.msg
+}
+
+func badRequest(msg string) error {
+	return &fileError{status: http.StatusBadRequest, msg: msg}
+}
+
+func fileErrorStatus(err error) int {
+	var fe *fileError
+	switch {
+	case errors.As(err, &fe):
+		return fe.status
+	case errors.Is(err, fs.ErrNotExist):
+		return http.StatusNotFound
+	case errors.Is(err, fs.ErrPermission):
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// recordFileAudit 记录文件操作审计
+func (h *WebSSHHandler) recordFileAudit(r *http.Request, op string, user *models.User, token string, agentID uuid.UUID, details map[string]interface{}, start time.Time, result string, err error) {
+	entry := &models.AuditLog{
+		Via:        audit.ViaSession,
+		Method:     "sftp." + op,
+		AgentID:    agentID.String(),
+		Params:     details,
+		Result:     result,
+		ClientIP:   remoteIP(r),
+		UserAgent:  r.UserAgent(),
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	if auth.IsAPIToken(token) {
+		entry.Via = audit.ViaAPIToken
+	}
+	if user != nil {
+		entry.UserID = &user.ID
+		entry.Username = user.Username
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	h.audit.Record(r.Context(), entry)
+}
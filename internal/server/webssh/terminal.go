@@ -0,0 +1,245 @@
+package webssh
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/plumber/plumber/pkg/models"
+	"golang.org/x/crypto/ssh"
+)
+
+// 终端模式
+const (
+	ModeSSH   = "ssh"   // 服务端使用保存的SSH凭据连接目标主机
+	ModeAgent = "agent" // Agent连回服务端，在本机PTY中启动shell，无需SSH凭据和入站端口
+)
+
+// agentConnectTimeout 等待Agent连回的时间，Agent每秒心跳一次
+const agentConnectTimeout = 15 * time.Second
+
+// terminalBackend 终端后端，浏览器侧的消息处理、录像和超时控制与后端无关
+type terminalBackend interface {
+	// Start 启动shell并开始推送输出，errorf用于向浏览器提示后端错误
+	Start(output func([]byte), errorf func(string)) error
+	Input(data string) error
+	Resize(cols, rows int) error
+	Close() error
+	// Wait 阻塞直到终端结束
+	Wait() error
+}
+
+// defaultMode 配置了SSH凭据时默认使用SSH，否则使用Agent终端
+func defaultMode(agent *models.Agent) string {
+	if agent.SSHHost != "" && (agent.SSHAuthType == "password" || agent.SSHAuthType == "key") {
+		return ModeSSH
+	}
+	return ModeAgent
+}
+
+func (h *WebSSHHandler) openTerminal(ctx context.Context, mode string, agent *models.Agent) (terminalBackend, error) {
+	if mode == ModeAgent {
+		conn, err := h.broker.Open(ctx, agent.ID, 40, 80, agentConnectTimeout)
+		if err != nil {
+			return nil, err
+		}
+		return newAgentTerminal(conn), nil
+	}
+	return h.openSSHTerminal(ctx, agent)
+}
+
+// sshTerminal 通过SSH会话提供的终端
+type sshTerminal struct {
+	client  *ssh.Client
+	session *ssh.Session
+	stdin   io.WriteCloser
+	stdout  io.Reader
+	stderr  io.Reader
+	once    sync.Once
+}
+
+func (h *WebSSHHandler) openSSHTerminal(ctx context.Context, agent *models.Agent) (*sshTerminal, error) {
+	client, err := h.dialer.Dial(ctx, agent)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &sshTerminal{client: client}
+	if err := t.init(); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *sshTerminal) init() error {
+	session, err := t.client.NewSession()
+	if err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+	t.session = session
+
+	// 设置终端模式
+	modes := ssh.TerminalModes{
+		ssh.ECHO:          1,
+		ssh.TTY_OP_ISPEED: 14400,
+		ssh.TTY_OP_OSPEED: 14400,
+	}
+	if err := session.RequestPty("xterm", 40, 80, modes); err != nil {
+		return fmt.Errorf("failed to request pty: %w", err)
+	}
+
+	if t.stdin, err = session.StdinPipe(); err != nil {
+		return fmt.Errorf("failed to get stdin: %w", err)
+	}
+	if t.stdout, err = session.StdoutPipe(); err != nil {
+		return fmt.Errorf("failed to get stdout: %w", err)
+	}
+	if t.stderr, err = session.StderrPipe(); err != nil {
+		return fmt.Errorf("failed to get stderr: %w", err)
+	}
+	return nil
+}
+
+func (t *sshTerminal) Start(output func([]byte), errorf func(string)) error {
+	if err := t.session.Shell(); err != nil {
+		return err
+	}
+	go copyOutput(t.stdout, "stdout", output)
+	go copyOutput(t.stderr, "stderr", output)
+	return nil
+}
+
+func (t *sshTerminal) Input(data string) error {
+	_, err := t.stdin.Write([]byte(data))
+	return err
+}
+
+func (t *sshTerminal) Resize(cols, rows int) error {
+	return t.session.WindowChange(rows, cols)
+}
+
+func (t *sshTerminal) Close() error {
+	t.once.Do(func() {
+		t.session.Close()
+		t.client.Close()
+	})
+	return nil
+}
+
+func (t *sshTerminal) Wait() error {
+	return t.session.Wait()
+}
+
+func copyOutput(reader io.Reader, source string, output func([]byte)) {
+	buf := make([]byte, 4096)
+	for {
+		n, err := reader.Read(buf)
+		if n > 0 {
+			output(buf[:n])
+		}
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("Read error from %s: %v", source, err)
+			}
+			return
+		}
+	}
+}
+
+// agentTerminal Agent连回的终端，Agent与服务端之间使用与浏览器相同的WebSocketMessage协议
+// 服务端 -> Agent：data（输入）、resize；Agent -> 服务端：data（输出）、error、exit
+type agentTerminal struct {
+	conn *safeConn
+	done chan struct{}
+	once sync.Once
+}
+
+func newAgentTerminal(conn *websocket.Conn) *agentTerminal {
+	return &agentTerminal{
+		conn: &safeConn{Conn: conn},
+		done: make(chan struct{}),
+	}
+}
+
+func (t *agentTerminal) Start(output func([]byte), errorf func(string)) error {
+	go func() {
+		defer t.Close()
+		for {
+			var msg WebSocketMessage
+			if err := t.conn.ReadJSON(&msg); err != nil {
+				if !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+					log.Printf("Agent terminal read error: %v", err)
+				}
+				return
+			}
+			switch msg.Type {
+			case "data":
+				output([]byte(msg.Data))
+			case "error":
+				errorf(msg.Data)
+			case "exit":
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (t *agentTerminal) Input(data string) error {
+	return t.conn.WriteJSON(WebSocketMessage{Type: "data", Data: data})
+}
+
+func (t *agentTerminal) Resize(cols, rows int) error {
+	return t.conn.WriteJSON(WebSocketMessage{Type: "resize", Rows: rows, Cols: cols})
+}
+
+func (t *agentTerminal) Close() error {
+	t.once.Do(func() {
+		t.conn.Close()
+		close(t.done)
+	})
+	return nil
+}
+
+func (t *agentTerminal) Wait() error {
+	<-t.done
+	return nil
+}
+
+// ServeAgentTerminal Agent领取终端请求后连回此接口，与等待中的浏览器会话配对
+// GET /api/agent/terminal?session_id=，使用Agent令牌或客户端证书认证
+func (h *WebSSHHandler) ServeAgentTerminal(w http.ResponseWriter, r *http.Request) {
+	agent, err := h.authorizer.AuthenticateAgent(r)
+	if err != nil {
+		http.Error(w, "invalid or missing agent credentials", http.StatusUnauthorized)
+		return
+	}
+
+	sessionID, err := uuid.Parse(r.URL.Query().Get("session_id"))
+	if err != nil {
+		http.Error(w, "invalid session_id", http.StatusBadRequest)
+		return
+	}
+
+	var upgrader websocket.Upgrader
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("Agent terminal upgrade error: %v", err)
+		return
+	}
+
+	// 配对成功后连接由浏览器会话负责关闭
+	if err := h.broker.Attach(sessionID, agent.ID, conn); err != nil {
+		conn.WriteJSON(WebSocketMessage{Type: "error", Data: err.Error()})
+		conn.Close()
+		return
+	}
+	log.Printf("Agent %s attached to terminal session %s", agent.ID, sessionID)
+}
@@ -2,36 +2,71 @@ package webssh
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
-	"io"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"github.com/plumber/plumber/internal/server/audit"
+	"github.com/plumber/plumber/internal/server/relay"
+	"github.com/plumber/plumber/internal/server/sshdial"
 	"github.com/plumber/plumber/internal/server/storage"
+	"github.com/plumber/plumber/pkg/auth"
 	"github.com/plumber/plumber/pkg/models"
-	"github.com/plumber/plumber/pkg/util"
-	"golang.org/x/crypto/ssh"
 )
 
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		return true // 允许跨域，生产环境需要限制
-	},
+// subprotocol 浏览器无法为WebSocket设置请求头，令牌通过子协议传递：
+// new WebSocket(url, ["plumber", token])，服务端回应 plumber 子协议
+const subprotocol = "plumber"
+
+// Authorizer 校验用户令牌，并按权限和参数中的目标资源授权；Agent回连终端时校验Agent身份
+type Authorizer interface {
+	AuthorizeToken(ctx context.Context, token, permission string, params json.RawMessage) (*models.User, error)
+	AuthenticateAgent(r *http.Request) (*models.Agent, error)
+}
+
+// Options WebSSH连接限制
+type Options struct {
+	AllowedOrigins []string      // 允许的页面来源，为空只允许同源，包含"*"时允许任意来源
+	IdleTimeout    time.Duration // 无输入自动断开
+	MaxDuration    time.Duration // 单次会话最长时长
+	RecordingDir   string        // 会话录像存放目录
+	MaxUpload      int64         // SFTP单个文件上传上限（字节）
+	MaxDownload    int64         // SFTP单个文件下载上限（字节）
 }
 
 type WebSSHHandler struct {
-	storage       storage.Storage
-	encryptionKey []byte
+	storage    storage.Storage
+	dialer     *sshdial.Dialer
+	broker     *relay.Broker
+	audit      *audit.Recorder
+	authorizer Authorizer
+	options    Options
+	upgrader   websocket.Upgrader
 }
 
-func NewWebSSHHandler(storage storage.Storage, encryptionKey []byte) *WebSSHHandler {
-	return &WebSSHHandler{
-		storage:       storage,
-		encryptionKey: encryptionKey,
+func NewWebSSHHandler(storage storage.Storage, dialer *sshdial.Dialer, broker *relay.Broker, authorizer Authorizer, options Options) *WebSSHHandler {
+	h := &WebSSHHandler{
+		storage:    storage,
+		dialer:     dialer,
+		broker:     broker,
+		audit:      audit.NewRecorder(storage),
+		authorizer: authorizer,
+		options:    options,
+	}
+	h.upgrader = websocket.Upgrader{
+		CheckOrigin:  h.checkOrigin,
+		Subprotocols: []string{subprotocol},
 	}
+	return h
 }
 
 type WebSocketMessage struct {
@@ -55,77 +90,106 @@ func (h *WebSSHHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 获取 Agent 信息
-	ctx := context.Background()
-	agent, err := h.storage.GetAgent(ctx, agentID)
-	if err != nil {
-		http.Error(w, "agent not found", http.StatusNotFound)
+	// 升级前完成来源、认证和授权检查
+	if !h.checkOrigin(r) {
+		http.Error(w, "origin not allowed", http.StatusForbidden)
 		return
 	}
 
-	// 升级到 WebSocket
-	conn, err := upgrader.Upgrade(w, r, nil)
-	if err != nil {
-		log.Printf("WebSocket upgrade error: %v", err)
+	token := requestToken(r)
+	if token == "" {
+		http.Error(w, "authentication required", http.StatusUnauthorized)
 		return
 	}
-	defer conn.Close()
 
-	// 创建 SSH 连接
-	sshConn, err := h.createSSHConnection(agent)
+	ctx := r.Context()
+	start := time.Now()
+	params, _ := json.Marshal(map[string]string{"agent_id": agentID.String()})
+	user, err := h.authorizer.AuthorizeToken(ctx, token, auth.PermTerminal, params)
 	if err != nil {
-		h.sendError(conn, fmt.Sprintf("Failed to connect: %v", err))
+		h.recordAudit(r, "webssh.open", user, token, &models.Agent{ID: agentID}, "", start, audit.ResultDenied, err)
+		http.Error(w, err.Error(), http.StatusForbidden)
 		return
 	}
-	defer sshConn.Close()
 
-	// 创建 SSH 会话
-	session, err := sshConn.NewSession()
+	// 获取 Agent 信息
+	agent, err := h.storage.GetAgent(ctx, agentID)
 	if err != nil {
-		h.sendError(conn, fmt.Sprintf("Failed to create session: %v", err))
+		http.Error(w, "agent not found", http.StatusNotFound)
 		return
 	}
-	defer session.Close()
 
-	// 设置终端模式
-	modes := ssh.TerminalModes{
-		ssh.ECHO:          1,
-		ssh.TTY_OP_ISPEED: 14400,
-		ssh.TTY_OP_OSPEED: 14400,
+	// 终端模式：ssh 使用服务端保存的SSH凭据，agent 由Agent在本机PTY中启动shell
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = defaultMode(agent)
 	}
-
-	if err := session.RequestPty("xterm", 40, 80, modes); err != nil {
-		h.sendError(conn, fmt.Sprintf("Failed to request pty: %v", err))
+	if mode != ModeSSH && mode != ModeAgent {
+		http.Error(w, "invalid mode", http.StatusBadRequest)
 		return
 	}
 
-	// 获取标准输入输出
-	stdin, err := session.StdinPipe()
+	// 升级到 WebSocket
+	wsConn, err := h.upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		h.sendError(conn, fmt.Sprintf("Failed to get stdin: %v", err))
+		log.Printf("WebSocket upgrade error: %v", err)
 		return
 	}
+	defer wsConn.Close()
+	conn := &safeConn{Conn: wsConn}
 
-	stdout, err := session.StdoutPipe()
+	term, err := h.openTerminal(ctx, mode, agent)
 	if err != nil {
-		h.sendError(conn, fmt.Sprintf("Failed to get stdout: %v", err))
+		h.recordAudit(r, "webssh.open", user, token, agent, mode, start, audit.ResultError, err)
+		h.sendError(conn, fmt.Sprintf("Failed to connect: %v", err))
 		return
 	}
+	defer term.Close()
 
-	stderr, err := session.StderrPipe()
+	// 会话必须录像，无法录像时拒绝打开终端
+	recording, cast, err := h.startRecording(ctx, user, agent, 80, 40)
 	if err != nil {
-		h.sendError(conn, fmt.Sprintf("Failed to get stderr: %v", err))
+		h.recordAudit(r, "webssh.open", user, token, agent, mode, start, audit.ResultError, err)
+		h.sendError(conn, "Failed to start session recording")
+		log.Printf("Failed to start terminal recording: %v", err)
 		return
 	}
+	defer h.finishRecording(recording, cast)
+
+	h.recordAudit(r, "webssh.open", user, token, agent, mode, start, audit.ResultSuccess, nil)
+	// 超时断开的原因，记录到关闭审计中
+	closeReason := make(chan error, 1)
+	defer func() {
+		var reason error
+		select {
+		case reason = <-closeReason:
+		default:
+		}
+		h.recordAudit(r, "webssh.close", user, token, agent, mode, start, audit.ResultSuccess, reason)
+	}()
 
-	// 启动 shell
-	if err := session.Shell(); err != nil {
+	// 终端输出 -> 录像 + WebSocket 发送
+	err = term.Start(func(data []byte) {
+		cast.Output(data)
+		if err := conn.WriteJSON(WebSocketMessage{Type: "data", Data: string(data)}); err != nil {
+			log.Printf("WebSocket write error: %v", err)
+		}
+	}, func(message string) {
+		h.sendError(conn, message)
+	})
+	if err != nil {
 		h.sendError(conn, fmt.Sprintf("Failed to start shell: %v", err))
 		return
 	}
 
-	// WebSocket 读取 -> SSH 写入
+	// 最近一次用户输入时间，用于空闲超时
+	var lastInput atomic.Int64
+	lastInput.Store(time.Now().UnixNano())
+
+	// WebSocket 读取 -> 终端写入
 	go func() {
+		// 浏览器断开时结束终端会话
+		defer term.Close()
 		for {
 			var msg WebSocketMessage
 			if err := conn.ReadJSON(&msg); err != nil {
@@ -135,125 +199,139 @@ func (h *WebSSHHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 			switch msg.Type {
 			case "data":
-				if _, err := stdin.Write([]byte(msg.Data)); err != nil {
-					log.Printf("SSH write error: %v", err)
+				lastInput.Store(time.Now().UnixNano())
+				cast.Input(msg.Data)
+				if err := term.Input(msg.Data); err != nil {
+					log.Printf("Terminal write error: %v", err)
 					return
 				}
 			case "resize":
 				if msg.Rows > 0 && msg.Cols > 0 {
-					session.WindowChange(msg.Rows, msg.Cols)
+					cast.Resize(msg.Cols, msg.Rows)
+					term.Resize(msg.Cols, msg.Rows)
 				}
 			}
 		}
 	}()
 
-	// SSH 输出 -> WebSocket 发送
-	go h.copyOutput(conn, stdout, "stdout")
-	go h.copyOutput(conn, stderr, "stderr")
+	// 空闲超时和最长会话时长
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(time.Second * 10)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				var reason error
+				if h.options.MaxDuration > 0 && now.Sub(start) > h.options.MaxDuration {
+					reason = fmt.Errorf("maximum session duration of %s reached", h.options.MaxDuration)
+				} else if h.options.IdleTimeout > 0 && now.Sub(time.Unix(0, lastInput.Load())) > h.options.IdleTimeout {
+					reason = fmt.Errorf("idle for more than %s", h.options.IdleTimeout)
+				}
+				if reason != nil {
+					closeReason <- reason
+					h.sendError(conn, fmt.Sprintf("Session closed: %v", reason))
+					term.Close()
+					return
+				}
+			}
+		}
+	}()
 
 	// 等待会话结束
-	if err := session.Wait(); err != nil {
+	if err := term.Wait(); err != nil {
 		log.Printf("Session ended: %v", err)
 	}
 }
 
-func (h *WebSSHHandler) createSSHConnection(agent *models.Agent) (*ssh.Client, error) {
-	if agent.SSHUser == "" {
-		return nil, fmt.Errorf("SSH user is required")
-	}
-	if agent.SSHHost == "" {
-		return nil, fmt.Errorf("SSH host is required")
+// checkOrigin 校验浏览器页面来源，非浏览器客户端不携带Origin时放行（仍需令牌）
+func (h *WebSSHHandler) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
 	}
 
-	config := &ssh.ClientConfig{
-		User:            agent.SSHUser,
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(), // 生产环境应该验证主机密钥
-		Timeout:         10 * time.Second,
+	if len(h.options.AllowedOrigins) == 0 {
+		u, err := url.Parse(origin)
+		return err == nil && strings.EqualFold(u.Host, r.Host)
 	}
 
-	var authMethods []ssh.AuthMethod
-
-	// 根据认证类型配置
-	switch agent.SSHAuthType {
-	case "password":
-		if agent.SSHPassword == "" {
-			return nil, fmt.Errorf("password is required for password authentication")
+	for _, allowed := range h.options.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(strings.TrimRight(allowed, "/"), origin) {
+			return true
 		}
-		password := agent.SSHPassword
-		// 如果密码是加密的，尝试解密
-		if len(h.encryptionKey) == 32 {
-			if decrypted, err := util.Decrypt(password, h.encryptionKey); err == nil {
-				password = decrypted
-			}
-		}
-		log.Printf("Using password authentication for user: %s", agent.SSHUser)
-		authMethods = append(authMethods, ssh.Password(password))
+	}
+	return false
+}
 
-	case "key":
-		if agent.SSHPrivateKey == "" {
-			return nil, fmt.Errorf("private key is required for key authentication")
+// requestToken 从子协议或查询参数中获取访问令牌
+// 推荐使用子协议，查询参数中的令牌可能出现在代理的访问日志中
+func requestToken(r *http.Request) string {
+	for _, protocol := range websocket.Subprotocols(r) {
+		if protocol != subprotocol {
+			return protocol
 		}
-		privateKey := agent.SSHPrivateKey
-		// 如果私钥是加密的，尝试解密
-		if len(h.encryptionKey) == 32 {
-			if decrypted, err := util.Decrypt(privateKey, h.encryptionKey); err == nil {
-				privateKey = decrypted
-			}
-		}
-		signer, err := ssh.ParsePrivateKey([]byte(privateKey))
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse private key: %w", err)
-		}
-		log.Printf("Using key authentication for user: %s", agent.SSHUser)
-		authMethods = append(authMethods, ssh.PublicKeys(signer))
-
-	default:
-		return nil, fmt.Errorf("authentication type '%s' is not supported. Use 'password' or 'key'", agent.SSHAuthType)
 	}
+	return r.URL.Query().Get("token")
+}
 
-	if len(authMethods) == 0 {
-		return nil, fmt.Errorf("no authentication method configured")
+// recordAudit 记录终端会话的打开和关闭，关闭记录的耗时即会话时长
+func (h *WebSSHHandler) recordAudit(r *http.Request, method string, user *models.User, token string, agent *models.Agent, mode string, start time.Time, result string, err error) {
+	entry := &models.AuditLog{
+		Via:        audit.ViaSession,
+		Method:     method,
+		AgentID:    agent.ID.String(),
+		Result:     result,
+		ClientIP:   remoteIP(r),
+		UserAgent:  r.UserAgent(),
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	if auth.IsAPIToken(token) {
+		entry.Via = audit.ViaAPIToken
+	}
+	if user != nil {
+		entry.UserID = &user.ID
+		entry.Username = user.Username
+	}
+	if mode != "" {
+		entry.Params = map[string]interface{}{"mode": mode}
+	}
+	if mode == ModeSSH && agent.SSHHost != "" {
+		entry.Params["ssh_host"] = agent.SSHHost
+		entry.Params["ssh_user"] = agent.SSHUser
+	}
+	if err != nil {
+		entry.Error = err.Error()
 	}
 
-	config.Auth = authMethods
-
-	addr := fmt.Sprintf("%s:%d", agent.SSHHost, agent.SSHPort)
-	log.Printf("Connecting to SSH server: %s@%s", agent.SSHUser, addr)
+	h.audit.Record(r.Context(), entry)
+}
 
-	client, err := ssh.Dial("tcp", addr, config)
+// remoteIP 获取请求来源IP
+func remoteIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
 	if err != nil {
-		return nil, fmt.Errorf("SSH connection failed: %w", err)
+		return r.RemoteAddr
 	}
-
-	log.Printf("SSH connection established successfully")
-	return client, nil
+	return ip
 }
 
-func (h *WebSSHHandler) copyOutput(conn *websocket.Conn, reader io.Reader, source string) {
-	buf := make([]byte, 4096)
-	for {
-		n, err := reader.Read(buf)
-		if err != nil {
-			if err != io.EOF {
-				log.Printf("Read error from %s: %v", source, err)
-			}
-			return
-		}
+// safeConn 串行化WebSocket写入，gorilla/websocket不支持并发写
+type safeConn struct {
+	*websocket.Conn
+	mu sync.Mutex
+}
 
-		if n > 0 {
-			msg := WebSocketMessage{
-				Type: "data",
-				Data: string(buf[:n]),
-			}
-			if err := conn.WriteJSON(msg); err != nil {
-				log.Printf("WebSocket write error: %v", err)
-				return
-			}
-		}
-	}
+func (c *safeConn) WriteJSON(v interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.Conn.WriteJSON(v)
 }
 
-func (h *WebSSHHandler) sendError(conn *websocket.Conn, message string) {
+func (h *WebSSHHandler) sendError(conn *safeConn, message string) {
 	msg := WebSocketMessage{
 		Type: "error",
 		Data: message,
@@ -0,0 +1,65 @@
+package agentupdate
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+)
+
+// 自更新结果，由Agent通过 plumber.agent.reportUpdate 上报
+const (
+	StatusSuccess    = "success"     // 新版本启动并重新注册
+	StatusFailed     = "failed"      // 下载、校验或替换失败，仍运行原版本
+	StatusRolledBack = "rolled_back" // 新版本未能正常启动，已恢复原二进制
+)
+
+// Offer 服务端在心跳响应中下发的自更新信息
+type Offer struct {
+	Version   string `json:"version"`
+	OS        string `json:"os"`
+	Arch      string `json:"arch"`
+	Size      int64  `json:"size"`
+	SHA256    string `json:"sha256"`    // 二进制的SHA-256（十六进制）
+	Signature string `json:"signature"` // 服务端对 SignedMessage 的Ed25519签名（base64）
+	URL       string `json:"url"`       // 下载路径，相对服务端地址
+}
+
+// SignedMessage 签名内容，覆盖平台、版本和摘要，防止二进制被替换或装到其他平台。
+// 目标版本由服务端决定（可以有意指定较旧的版本），签名不防止降级
+func (o *Offer) SignedMessage() []byte {
+	return []byte(fmt.Sprintf("plumber-agent-update\n%s/%s\n%s\n%s\n", o.OS, o.Arch, o.Version, o.SHA256))
+}
+
+// Sign 使用服务端私钥签名
+func Sign(key ed25519.PrivateKey, offer *Offer) {
+	offer.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, offer.SignedMessage()))
+}
+
+// Verify 使用 agent.json 中的公钥校验签名
+func Verify(key ed25519.PublicKey, offer *Offer) error {
+	signature, err := base64.StdEncoding.DecodeString(offer.Signature)
+	if err != nil {
+		return fmt.Errorf("invalid signature encoding: %w", err)
+	}
+	if !ed25519.Verify(key, offer.SignedMessage(), signature) {
+		return fmt.Errorf("signature verification failed")
+	}
+	return nil
+}
+
+// EncodePublicKey 公钥编码为base64，写入 agent.json 的 update_public_key
+func EncodePublicKey(key ed25519.PublicKey) string {
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+// ParsePublicKey 解析 EncodePublicKey 生成的公钥
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key encoding: %w", err)
+	}
+	if len(data) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid public key size %d", len(data))
+	}
+	return ed25519.PublicKey(data), nil
+}
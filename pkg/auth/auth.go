@@ -2,8 +2,11 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -15,32 +18,73 @@ var (
 	ErrExpiredToken = errors.New("expired token")
 )
 
+// APITokenPrefix 个人API令牌前缀，用于与JWT区分
+const APITokenPrefix = "plb_"
+
+// DefaultKeyID 未配置密钥ID时使用的签名密钥ID，也用于校验不带kid的旧令牌
+const DefaultKeyID = "default"
+
 // Claims JWT声明
 type Claims struct {
-	UserID   string `json:"user_id"`
-	Username string `json:"username"`
+	UserID    string `json:"user_id"`
+	Username  string `json:"username"`
+	SessionID string `json:"sid,omitempty"` // 所属登录会话，会话吊销后令牌立即失效
 	jwt.RegisteredClaims
 }
 
 // JWTManager JWT管理器
+// 支持多个签名密钥：使用当前密钥签发，按令牌头中的kid选择密钥校验，便于密钥轮换
 type JWTManager struct {
-	secretKey     string
+	keys          map[string][]byte
+	activeKeyID   string
 	tokenDuration time.Duration
 }
 
-// NewJWTManager 创建JWT管理器
+// NewJWTManager 创建JWT管理器，secretKey作为ID为DefaultKeyID的签名密钥
 func NewJWTManager(secretKey string, tokenDuration time.Duration) *JWTManager {
-	return &JWTManager{
-		secretKey:     secretKey,
+	m := &JWTManager{
+		keys:          make(map[string][]byte),
 		tokenDuration: tokenDuration,
 	}
+	if secretKey != "" {
+		m.AddKey(DefaultKeyID, secretKey)
+	}
+	return m
+}
+
+// AddKey 添加校验密钥，第一个添加的密钥同时作为签名密钥
+func (m *JWTManager) AddKey(keyID, secret string) {
+	m.keys[keyID] = []byte(secret)
+	if m.activeKeyID == "" {
+		m.activeKeyID = keyID
+	}
+}
+
+// SetSigningKey 指定用于签发新令牌的密钥
+func (m *JWTManager) SetSigningKey(keyID string) error {
+	if _, ok := m.keys[keyID]; !ok {
+		return fmt.Errorf("unknown JWT key id: %s", keyID)
+	}
+	m.activeKeyID = keyID
+	return nil
 }
 
-// Generate 生成JWT令牌
-func (m *JWTManager) Generate(userID, username string) (string, error) {
+// TokenDuration 访问令牌有效期
+func (m *JWTManager) TokenDuration() time.Duration {
+	return m.tokenDuration
+}
+
+// Generate 生成属于指定会话的JWT访问令牌
+func (m *JWTManager) Generate(userID, username, sessionID string) (string, error) {
+	secret, ok := m.keys[m.activeKeyID]
+	if !ok {
+		return "", fmt.Errorf("no JWT signing key configured")
+	}
+
 	claims := Claims{
-		UserID:   userID,
-		Username: username,
+		UserID:    userID,
+		Username:  username,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(m.tokenDuration)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -48,7 +92,8 @@ func (m *JWTManager) Generate(userID, username string) (string, error) {
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(m.secretKey))
+	token.Header["kid"] = m.activeKeyID
+	return token.SignedString(secret)
 }
 
 // Verify 验证JWT令牌
@@ -57,11 +102,25 @@ func (m *JWTManager) Verify(tokenString string) (*Claims, error) {
 		tokenString,
 		&Claims{},
 		func(token *jwt.Token) (interface{}, error) {
-			return []byte(m.secretKey), nil
+			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+				return nil, ErrInvalidToken
+			}
+			keyID, _ := token.Header["kid"].(string)
+			if keyID == "" {
+				keyID = DefaultKeyID
+			}
+			secret, ok := m.keys[keyID]
+			if !ok {
+				return nil, ErrInvalidToken
+			}
+			return secret, nil
 		},
 	)
 
 	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, ErrExpiredToken
+		}
 		return nil, ErrInvalidToken
 	}
 
@@ -70,7 +129,7 @@ func (m *JWTManager) Verify(tokenString string) (*Claims, error) {
 		return nil, ErrInvalidToken
 	}
 
-	if claims.ExpiresAt.Before(time.Now()) {
+	if claims.ExpiresAt == nil || claims.ExpiresAt.Before(time.Now()) {
 		return nil, ErrExpiredToken
 	}
 
@@ -97,3 +156,15 @@ func GenerateToken(length int) (string, error) {
 	}
 	return hex.EncodeToString(bytes), nil
 }
+
+// IsAPIToken 判断Bearer令牌是否为个人API令牌
+func IsAPIToken(token string) bool {
+	return strings.HasPrefix(token, APITokenPrefix)
+}
+
+// HashToken 计算随机令牌的SHA-256摘要（十六进制）
+// 适用于高熵的随机令牌，可直接按摘要查询；用户密码仍应使用 HashPassword
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,85 @@
+package auth
+
+// 角色
+const (
+	RoleAdmin    = "admin"    // 全部权限
+	RoleOperator = "operator" // 查看、编辑并执行任务，使用终端
+	RoleViewer   = "viewer"   // 只读
+)
+
+// 权限
+const (
+	PermAgentRead   = "agent:read"   // 查看Agent
+	PermAgentWrite  = "agent:write"  // 创建/修改/删除Agent，管理Agent凭证
+	PermAgentDeploy = "agent:deploy" // 通过SSH部署Agent
+	PermTaskRead    = "task:read"    // 查看任务和执行记录
+	PermTaskWrite   = "task:write"   // 创建/修改任务
+	PermTaskRun     = "task:run"     // 执行任务
+	PermTerminal    = "terminal"     // 打开WebSSH终端
+	PermUserAdmin   = "user:admin"   // 管理用户
+	PermUserSelf    = "user:self"    // 管理自己的账号（修改密码等）
+	PermAuditRead   = "audit:read"   // 查看审计日志
+	PermRecordRead  = "record:read"  // 查看和回放终端录像
+	PermFileRead    = "file:read"    // 通过SFTP浏览和下载目标主机文件
+	PermFileWrite   = "file:write"   // 通过SFTP上传、重命名、删除文件和修改权限
+)
+
+// rolePermissions 角色拥有的权限，管理员拥有全部权限
+var rolePermissions = map[string]map[string]bool{
+	RoleOperator: {
+		PermAgentRead: true,
+		PermTaskRead:  true,
+		PermTaskWrite: true,
+		PermTaskRun:   true,
+		PermTerminal:  true,
+		PermFileRead:  true,
+		PermFileWrite: true,
+		PermUserSelf:  true,
+	},
+	RoleViewer: {
+		PermAgentRead: true,
+		PermTaskRead:  true,
+		PermUserSelf:  true,
+	},
+}
+
+// allPermissions 全部已知权限
+var allPermissions = []string{
+	PermAgentRead,
+	PermAgentWrite,
+	PermAgentDeploy,
+	PermTaskRead,
+	PermTaskWrite,
+	PermTaskRun,
+	PermTerminal,
+	PermUserAdmin,
+	PermUserSelf,
+	PermAuditRead,
+	PermRecordRead,
+	PermFileRead,
+	PermFileWrite,
+}
+
+// ValidPermission 判断权限是否存在
+func ValidPermission(permission string) bool {
+	for _, p := range allPermissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidRole 判断角色是否存在
+func ValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok || role == RoleAdmin
+}
+
+// HasPermission 判断角色是否拥有指定权限
+func HasPermission(role, permission string) bool {
+	if role == RoleAdmin {
+		return true
+	}
+	return rolePermissions[role][permission]
+}
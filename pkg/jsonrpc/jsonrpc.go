@@ -36,13 +36,24 @@ const (
 	MethodNotFound = -32601
 	InvalidParams  = -32602
 	InternalError  = -32603
+
+	// 服务端自定义错误代码
+	Unauthenticated  = -32001 // 缺少凭证或凭证无效/过期
+	PermissionDenied = -32003
+)
+
+// 特殊权限：不需要用户权限判断的方法
+const (
+	PermissionPublic = "public" // 无需认证（如登录、Agent加入）
+	PermissionAgent  = "agent"  // 需要Agent凭证（Agent主动调用）
 )
 
 // Method JSON-RPC方法接口
 type Method interface {
 	Name() string
 	Execute(ctx context.Context, params json.RawMessage) (interface{}, error)
-	RequireAuth() bool
+	// Permission 调用该方法所需的权限，PermissionPublic/PermissionAgent 之外的值需要用户认证并由角色授权
+	Permission() string
 }
 
 // Router JSON-RPC路由器
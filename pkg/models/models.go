@@ -1,6 +1,8 @@
 package models
 
 import (
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -9,21 +11,83 @@ import (
 
 // Agent 代理服务器信息
 type Agent struct {
-	ID            uuid.UUID      `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
-	Name          string         `gorm:"size:255;not null" json:"name"`           // Agent名称
-	SSHHost       string         `gorm:"size:255" json:"ssh_host,omitempty"`      // SSH主机地址
-	SSHPort       int            `gorm:"default:22" json:"ssh_port,omitempty"`    // SSH端口
-	SSHUser       string         `gorm:"size:100" json:"ssh_user,omitempty"`      // SSH用户名
-	SSHAuthType   string         `gorm:"size:20;default:'none'" json:"ssh_auth_type,omitempty"` // 认证类型：password/key/none
-	SSHPassword   string         `gorm:"size:255" json:"ssh_password,omitempty"`  // SSH密码（明文存储）
-	SSHPrivateKey string         `gorm:"type:text" json:"ssh_private_key,omitempty"` // SSH私钥（明文存储）
-	Hostname      string         `gorm:"size:255" json:"hostname,omitempty"`      // 实际主机名（Agent上报）
-	IP            string         `gorm:"size:50" json:"ip,omitempty"`             // 实际IP（Agent上报）
-	Status        string         `gorm:"size:20;not null;default:'offline'" json:"status"` // online/offline
-	LastHeartbeat *time.Time     `json:"last_heartbeat,omitempty"`
-	CreatedAt     time.Time      `json:"created_at"`
-	UpdatedAt     time.Time      `json:"updated_at"`
-	DeletedAt     gorm.DeletedAt `gorm:"index" json:"-"`
+	ID               uuid.UUID         `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	Name             string            `gorm:"size:255;not null" json:"name"`                         // Agent名称
+	SSHHost          string            `gorm:"size:255" json:"ssh_host,omitempty"`                    // SSH主机地址
+	SSHPort          int               `gorm:"default:22" json:"ssh_port,omitempty"`                  // SSH端口
+	SSHUser          string            `gorm:"size:100" json:"ssh_user,omitempty"`                    // SSH用户名
+	SSHAuthType      string            `gorm:"size:20;default:'none'" json:"ssh_auth_type,omitempty"` // 认证类型：password/key/none
+	SSHPassword      string            `gorm:"type:text" json:"-"`                                    // SSH密码（信封加密存储，不对外返回）
+	SSHPrivateKey    string            `gorm:"type:text" json:"-"`                                    // SSH私钥（信封加密存储，不对外返回）
+	SSHHostKey       string            `gorm:"type:text" json:"ssh_host_key,omitempty"`               // 固定的SSH主机公钥（authorized_keys格式）
+	SSHHostKeyFP     string            `gorm:"size:100" json:"ssh_host_key_fingerprint,omitempty"`    // 主机公钥SHA256指纹
+	SSHHostKeyAt     *time.Time        `json:"ssh_host_key_at,omitempty"`                             // 主机公钥固定时间
+	SSHBastionID     *uuid.UUID        `gorm:"type:uuid;index" json:"ssh_bastion_id,omitempty"`       // 经由的跳板机，为空表示直连
+	Hostname         string            `gorm:"size:255" json:"hostname,omitempty"`                    // 实际主机名（Agent上报）
+	IP               string            `gorm:"size:50" json:"ip,omitempty"`                           // 实际IP（Agent上报）
+	Status           string            `gorm:"size:20;not null;default:'offline'" json:"status"`      // online/offline/decommissioned（已卸载）
+	Labels           map[string]string `gorm:"serializer:json;type:jsonb" json:"labels,omitempty"`    // 标签（如 team=a）
+	Version          string            `gorm:"size:50" json:"version,omitempty"`                      // Agent版本（Agent上报）
+	OS               string            `gorm:"size:20" json:"os,omitempty"`                           // 操作系统（Agent上报）
+	Arch             string            `gorm:"size:20" json:"arch,omitempty"`                         // CPU架构（Agent上报）
+	RegisteredAt     *time.Time        `json:"registered_at,omitempty"`                               // 最近一次注册（Agent进程启动）时间
+	InstallDir       string            `gorm:"size:255" json:"install_dir,omitempty"`                 // 部署时的安装目录，升级和卸载使用
+	DesiredVersion   string            `gorm:"size:50" json:"desired_version,omitempty"`              // 自更新目标版本，latest表示跟随服务端托管的二进制，为空不自更新
+	UpdateVersion    string            `gorm:"size:50" json:"update_version,omitempty"`               // 最近一次自更新的目标版本
+	UpdateStatus     string            `gorm:"size:20" json:"update_status,omitempty"`                // 最近一次自更新结果：success/failed/rolled_back
+	UpdateMessage    string            `gorm:"type:text" json:"update_message,omitempty"`             // 自更新失败原因
+	UpdateReportedAt *time.Time        `json:"update_reported_at,omitempty"`                          // 自更新结果上报时间
+	LastHeartbeat    *time.Time        `json:"last_heartbeat,omitempty"`
+	TokenHash        string            `gorm:"size:255" json:"-"`         // Agent令牌哈希（bcrypt），为空表示未签发或已吊销
+	TokenIssuedAt    *time.Time        `json:"token_issued_at,omitempty"` // 令牌签发时间
+	CreatedAt        time.Time         `json:"created_at"`
+	UpdatedAt        time.Time         `json:"updated_at"`
+	DeletedAt        gorm.DeletedAt    `gorm:"index" json:"-"`
+}
+
+// Bastion SSH跳板机，Agent的SSH配置可以引用它；跳板机本身也可以经由另一台跳板机连接（多级跳转）
+type Bastion struct {
+	ID          uuid.UUID      `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	Name        string         `gorm:"size:255;not null" json:"name"`
+	Host        string         `gorm:"size:255;not null" json:"host"`
+	Port        int            `gorm:"default:22" json:"port"`
+	User        string         `gorm:"size:100;not null" json:"user"`
+	AuthType    string         `gorm:"size:20;not null" json:"auth_type"`                // password/key
+	Password    string         `gorm:"type:text" json:"-"`                               // 信封加密存储
+	PrivateKey  string         `gorm:"type:text" json:"-"`                               // 信封加密存储
+	HostKey     string         `gorm:"type:text" json:"host_key,omitempty"`              // 固定的主机公钥
+	HostKeyFP   string         `gorm:"size:100" json:"host_key_fingerprint,omitempty"`   // 主机公钥SHA256指纹
+	HostKeyAt   *time.Time     `json:"host_key_at,omitempty"`                            // 主机公钥固定时间
+	JumpID      *uuid.UUID     `gorm:"type:uuid;index" json:"jump_bastion_id,omitempty"` // 连接本跳板机时经由的上一级跳板机
+	Description string         `gorm:"size:255" json:"description,omitempty"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// AgentCertificate Agent客户端证书记录（mTLS）
+type AgentCertificate struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	AgentID   uuid.UUID  `gorm:"type:uuid;not null;index" json:"agent_id"`
+	Serial    string     `gorm:"size:64;uniqueIndex;not null" json:"serial"` // 证书序列号（十六进制）
+	NotBefore time.Time  `json:"not_before"`
+	NotAfter  time.Time  `json:"not_after"`
+	RevokedAt *time.Time `gorm:"index" json:"revoked_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// JoinToken Agent注册用的一次性/限次加入令牌
+type JoinToken struct {
+	ID          uuid.UUID         `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	Description string            `gorm:"size:255" json:"description"`
+	TokenHash   string            `gorm:"size:64;uniqueIndex;not null" json:"-"` // 令牌SHA-256哈希
+	MaxUses     int               `gorm:"not null;default:1" json:"max_uses"`
+	Uses        int               `gorm:"not null;default:0" json:"uses"`
+	Labels      map[string]string `gorm:"serializer:json;type:jsonb" json:"labels,omitempty"` // 加入的Agent自动带上的标签
+	ExpiresAt   time.Time         `gorm:"not null" json:"expires_at"`
+	RevokedAt   *time.Time        `json:"revoked_at,omitempty"`
+	CreatedBy   string            `gorm:"size:100" json:"created_by"`
+	CreatedAt   time.Time         `json:"created_at"`
 }
 
 // Task 任务定义
@@ -31,45 +95,48 @@ type Task struct {
 	ID          uuid.UUID      `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
 	Name        string         `gorm:"size:255;not null" json:"name"`
 	Description string         `gorm:"type:text" json:"description"`
-	Config      string         `gorm:"type:text;not null" json:"config"` // TOML配置
+	Config      string         `gorm:"type:text;not null" json:"config"`                 // TOML配置
 	Status      string         `gorm:"size:20;not null;default:'pending'" json:"status"` // pending/running/success/failed
 	CreatedAt   time.Time      `json:"created_at"`
 	UpdatedAt   time.Time      `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
 
-	Executions  []TaskExecution `gorm:"foreignKey:TaskID" json:"executions,omitempty"`
+	Executions []TaskExecution `gorm:"foreignKey:TaskID" json:"executions,omitempty"`
 }
 
 // TaskExecution 任务执行记录
 type TaskExecution struct {
-	ID          uuid.UUID      `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
-	TaskID      uuid.UUID      `gorm:"type:uuid;not null;index" json:"task_id"`
-	Status      string         `gorm:"size:20;not null;default:'pending'" json:"status"` // pending/running/success/failed
-	StartTime   *time.Time     `json:"start_time,omitempty"`
-	EndTime     *time.Time     `json:"end_time,omitempty"`
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"updated_at"`
-	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+	ID        uuid.UUID      `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	TaskID    uuid.UUID      `gorm:"type:uuid;not null;index" json:"task_id"`
+	Status    string         `gorm:"size:20;not null;default:'pending'" json:"status"` // pending/running/success/failed
+	StartTime *time.Time     `json:"start_time,omitempty"`
+	EndTime   *time.Time     `json:"end_time,omitempty"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 
-	Steps       []StepExecution `gorm:"foreignKey:ExecutionID" json:"steps,omitempty"`
+	Steps []StepExecution `gorm:"foreignKey:ExecutionID" json:"steps,omitempty"`
 }
 
 // StepExecution 步骤执行记录
 type StepExecution struct {
-	ID          uuid.UUID      `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
-	ExecutionID uuid.UUID      `gorm:"type:uuid;not null;index" json:"execution_id"`
-	StepIndex   int            `gorm:"not null" json:"step_index"`
-	AgentID     uuid.UUID      `gorm:"type:uuid;not null;index" json:"agent_id"`
-	Path        string         `gorm:"size:500" json:"path"`
-	Command     string         `gorm:"type:text;not null" json:"command"`
-	Status      string         `gorm:"size:20;not null;default:'pending'" json:"status"` // pending/running/success/failed
-	Assigned    bool           `gorm:"default:false;index" json:"assigned"` // 是否已分配给agent
-	ExitCode    *int           `json:"exit_code,omitempty"`
-	Output      string         `gorm:"type:text" json:"output,omitempty"`
-	StartTime   *time.Time     `json:"start_time,omitempty"`
-	EndTime     *time.Time     `json:"end_time,omitempty"`
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"updated_at"`
+	ID          uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	ExecutionID uuid.UUID  `gorm:"type:uuid;not null;index" json:"execution_id"`
+	StepIndex   int        `gorm:"not null" json:"step_index"`
+	Name        string     `gorm:"size:100" json:"name,omitempty"` // 步骤名称，供后续步骤通过use_artifacts引用
+	AgentID     uuid.UUID  `gorm:"type:uuid;not null;index" json:"agent_id"`
+	Path        string     `gorm:"size:500" json:"path"`
+	Type        string     `gorm:"size:20;not null;default:'shell'" json:"type"` // shell/script/http/template/wait/container/check/upload/download
+	Command     string     `gorm:"type:text;not null" json:"command"`            // shell/script/wait为命令，其他类型为步骤描述
+	Spec        StepSpec   `gorm:"serializer:json;type:jsonb" json:"spec"`
+	Status      string     `gorm:"size:20;not null;default:'pending'" json:"status"` // pending/running/success/failed
+	Assigned    bool       `gorm:"default:false;index" json:"assigned"`              // 是否已分配给agent
+	ExitCode    *int       `json:"exit_code,omitempty"`
+	Output      string     `gorm:"type:text" json:"output,omitempty"`
+	StartTime   *time.Time `json:"start_time,omitempty"`
+	EndTime     *time.Time `json:"end_time,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
 }
 
 // User 用户表（用于认证）
@@ -77,20 +144,324 @@ type User struct {
 	ID        uuid.UUID      `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
 	Username  string         `gorm:"size:100;uniqueIndex;not null" json:"username"`
 	Password  string         `gorm:"size:255;not null" json:"-"`
-	Token     string         `gorm:"size:500;index" json:"token,omitempty"`
+	Disabled  bool           `gorm:"not null;default:false" json:"disabled"`        // 禁用后无法登录，已签发的令牌立即失效
+	Role      string         `gorm:"size:20;not null;default:'viewer'" json:"role"` // admin/operator/viewer
+	Scope     UserScope      `gorm:"serializer:json;type:jsonb" json:"scope"`       // 可选的任务/Agent范围限制
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
+// UserScope 用户可访问的资源范围，字段为空表示不限制
+type UserScope struct {
+	TaskIDs     []string          `json:"task_ids,omitempty"`     // 允许访问的任务ID
+	AgentLabels map[string]string `json:"agent_labels,omitempty"` // Agent必须包含全部这些标签
+}
+
+// IsEmpty 是否没有任何范围限制
+func (s UserScope) IsEmpty() bool {
+	return len(s.TaskIDs) == 0 && len(s.AgentLabels) == 0
+}
+
+// AllowsTaskID 任务是否在范围内
+func (s UserScope) AllowsTaskID(taskID string) bool {
+	if len(s.TaskIDs) == 0 {
+		return true
+	}
+	for _, id := range s.TaskIDs {
+		if id == taskID {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsAgent Agent标签是否满足范围要求
+func (s UserScope) AllowsAgent(agent *Agent) bool {
+	for key, value := range s.AgentLabels {
+		if agent.Labels[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// Session 用户登录会话
+// 访问令牌(JWT)携带会话ID，吊销会话即可让其访问令牌和刷新令牌全部失效
+type Session struct {
+	ID                uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID            uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	RefreshTokenHash  string     `gorm:"size:64;uniqueIndex;not null" json:"-"` // 当前刷新令牌SHA-256哈希
+	PreviousTokenHash string     `gorm:"size:64;index" json:"-"`                // 上一个刷新令牌，再次出现视为泄露
+	UserAgent         string     `gorm:"size:255" json:"user_agent"`
+	IP                string     `gorm:"size:50" json:"ip"`
+	ExpiresAt         time.Time  `gorm:"not null" json:"expires_at"`
+	LastUsedAt        *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt         *time.Time `gorm:"index" json:"revoked_at,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+}
+
+// APIToken 用户的个人API令牌，用于自动化和CI
+type APIToken struct {
+	ID          uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID      uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	Name        string     `gorm:"size:255;not null" json:"name"`
+	Prefix      string     `gorm:"size:20" json:"prefix"`                                   // 令牌前几位，便于识别
+	TokenHash   string     `gorm:"size:64;uniqueIndex;not null" json:"-"`                   // 令牌SHA-256哈希
+	Permissions []string   `gorm:"serializer:json;type:jsonb" json:"permissions,omitempty"` // 为空表示继承用户角色的全部权限
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`                                    // 为空表示永不过期
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// AllowsPermission 令牌的权限范围是否包含指定权限
+func (t *APIToken) AllowsPermission(permission string) bool {
+	if len(t.Permissions) == 0 {
+		return true
+	}
+	for _, p := range t.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// AuditLog 审计日志，只追加不修改
+type AuditLog struct {
+	ID          uuid.UUID              `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID      *uuid.UUID             `gorm:"type:uuid;index" json:"user_id,omitempty"`
+	Username    string                 `gorm:"size:100;index" json:"username,omitempty"`
+	Via         string                 `gorm:"size:20" json:"via"`                    // session/api_token/agent/public
+	Method      string                 `gorm:"size:100;not null;index" json:"method"` // RPC方法名或webssh.open等
+	TaskID      string                 `gorm:"size:36;index" json:"task_id,omitempty"`
+	AgentID     string                 `gorm:"size:36;index" json:"agent_id,omitempty"`
+	ExecutionID string                 `gorm:"size:36" json:"execution_id,omitempty"`
+	TargetID    string                 `gorm:"size:36" json:"target_id,omitempty"`                 // 其他目标（用户、令牌等）
+	Params      map[string]interface{} `gorm:"serializer:json;type:jsonb" json:"params,omitempty"` // 脱敏后的参数
+	Result      string                 `gorm:"size:20;not null;index" json:"result"`               // success/error/denied
+	Error       string                 `gorm:"type:text" json:"error,omitempty"`
+	ClientIP    string                 `gorm:"size:50" json:"client_ip"`
+	UserAgent   string                 `gorm:"size:255" json:"user_agent,omitempty"`
+	DurationMs  int64                  `json:"duration_ms"`
+	CreatedAt   time.Time              `gorm:"index" json:"created_at"`
+}
+
+// TerminalRecording WebSSH会话录像（asciicast v2格式）
+type TerminalRecording struct {
+	ID         uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID     *uuid.UUID `gorm:"type:uuid;index" json:"user_id,omitempty"`
+	Username   string     `gorm:"size:100" json:"username"`
+	AgentID    uuid.UUID  `gorm:"type:uuid;not null;index" json:"agent_id"`
+	AgentName  string     `gorm:"size:255" json:"agent_name"`
+	FilePath   string     `gorm:"size:500;not null" json:"-"` // 录像文件路径
+	Size       int64      `json:"size"`                       // 文件大小（字节）
+	StartedAt  time.Time  `gorm:"not null;index" json:"started_at"`
+	EndedAt    *time.Time `json:"ended_at,omitempty"`
+	DurationMs int64      `json:"duration_ms"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// Artifact 服务端保存的制品文件，由用户上传或由download步骤从Agent收集
+type Artifact struct {
+	ID          uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	Name        string     `gorm:"size:255;not null;index" json:"name"`
+	Size        int64      `json:"size"`
+	SHA256      string     `gorm:"size:64;not null" json:"sha256"`
+	FilePath    string     `gorm:"size:500;not null" json:"-"`
+	ExecutionID *uuid.UUID `gorm:"type:uuid;index" json:"execution_id,omitempty"` // 步骤收集的制品所属执行记录
+	StepID      *uuid.UUID `gorm:"type:uuid" json:"step_id,omitempty"`
+	StepName    string     `gorm:"size:100" json:"step_name,omitempty"` // 收集该制品的步骤名称
+	AgentID     *uuid.UUID `gorm:"type:uuid" json:"agent_id,omitempty"`
+	UserID      *uuid.UUID `gorm:"type:uuid;index" json:"user_id,omitempty"` // 用户上传时为上传者
+	Username    string     `gorm:"size:100" json:"username,omitempty"`
+	CreatedAt   time.Time  `gorm:"index" json:"created_at"`
+}
+
+// MaxArtifactNameLength 制品名称长度上限，与Name列的长度一致
+const MaxArtifactNameLength = 255
+
+// ValidateArtifactName 校验制品名称，名称只用于展示和按名称查找，不作为文件路径
+func ValidateArtifactName(name string) error {
+	if name == "" || len(name) > MaxArtifactNameLength {
+		return fmt.Errorf("artifact name must be 1-%d characters", MaxArtifactNameLength)
+	}
+	if strings.ContainsAny(name, "/\\\x00\r\n") {
+		return fmt.Errorf("invalid artifact name %q", name)
+	}
+	return nil
+}
+
+// DeployJob Agent部署任务（部署、升级、卸载），异步执行，一次可处理多个Agent
+type DeployJob struct {
+	ID          uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	Kind        string     `gorm:"size:20;not null;default:'deploy'" json:"kind"` // deploy/upgrade/uninstall
+	Method      string     `gorm:"size:20;not null" json:"method"`                // offline/script，升级和卸载为offline
+	Version     string     `gorm:"size:50" json:"version,omitempty"`              // 升级的目标版本
+	ScriptURL   string     `gorm:"size:500" json:"script_url,omitempty"`
+	InstallDir  string     `gorm:"size:255;not null" json:"install_dir"`
+	Parallelism int        `gorm:"not null;default:1" json:"parallelism"`            // 同时部署的Agent数量上限
+	Status      string     `gorm:"size:20;not null;default:'pending'" json:"status"` // pending/running/success/failed
+	RetryOf     *uuid.UUID `gorm:"type:uuid;index" json:"retry_of,omitempty"`        // 重试来源任务
+	UserID      *uuid.UUID `gorm:"type:uuid;index" json:"user_id,omitempty"`
+	Username    string     `gorm:"size:100" json:"username"`
+	StartTime   *time.Time `json:"start_time,omitempty"`
+	EndTime     *time.Time `json:"end_time,omitempty"`
+	CreatedAt   time.Time  `gorm:"index" json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+
+	Targets []DeployTarget `gorm:"foreignKey:JobID" json:"targets,omitempty"`
+}
+
+// DeployTarget 部署任务中单个Agent的部署进度和结果
+type DeployTarget struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	JobID     uuid.UUID  `gorm:"type:uuid;not null;index" json:"job_id"`
+	AgentID   uuid.UUID  `gorm:"type:uuid;not null;index" json:"agent_id"`
+	AgentName string     `gorm:"size:255" json:"agent_name"`
+	Status    string     `gorm:"size:20;not null;default:'pending'" json:"status"` // pending/running/success/failed/skipped
+	Stage     string     `gorm:"size:20" json:"stage,omitempty"`                   // 当前阶段，失败时为失败所在阶段
+	OS        string     `gorm:"size:20" json:"os,omitempty"`
+	Arch      string     `gorm:"size:20" json:"arch,omitempty"`
+	Output    string     `gorm:"type:text" json:"output,omitempty"`
+	Error     string     `gorm:"type:text" json:"error,omitempty"`
+	StartTime *time.Time `json:"start_time,omitempty"`
+	EndTime   *time.Time `json:"end_time,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
 // TaskConfig TOML任务配置
 type TaskConfig struct {
 	Steps []TaskStep `toml:"step"`
 }
 
+// 步骤时限，Agent和服务端共用
+const (
+	// MaxStepTimeout 步骤执行（不含制品传输）的时间上限，步骤的Timeout和Duration不能超过
+	MaxStepTimeout = 10 * time.Minute
+	// MaxStepTransferTime 一个步骤执行前下载引用的制品和执行后收集制品的总时间上限
+	MaxStepTransferTime = 10 * time.Minute
+)
+
+// 步骤类型
+const (
+	StepTypeShell     = "shell"     // 在Path目录执行CMD（默认）
+	StepTypeScript    = "script"    // 将CMD写入临时脚本，用Interpreter或脚本的shebang执行
+	StepTypeHTTP      = "http"      // 发送HTTP请求并检查状态码和响应内容
+	StepTypeTemplate  = "template"  // 使用Params渲染模板（Go text/template）写入Dest
+	StepTypeWait      = "wait"      // 等待Duration，或每隔Interval执行CMD直到成功
+	StepTypeContainer = "container" // 在Image容器中执行CMD，Path挂载为容器的工作目录
+	StepTypeCheck     = "check"     // 每隔Interval探测一次，连续Successes次成功后结束
+	StepTypeUpload    = "upload"    // 服务端制品 -> Agent上的Dest
+	StepTypeDownload  = "download"  // Agent上的Src -> 服务端制品，关联到本次执行
+)
+
 // TaskStep 任务步骤
 type TaskStep struct {
 	ServerID string `toml:"ServerID" json:"server_id"`
+	Name     string `toml:"Name" json:"name,omitempty"` // 步骤名称，同一任务内唯一
+	Type     string `toml:"Type" json:"type,omitempty"` // 为空时为shell
 	Path     string `toml:"Path" json:"path"`
-	CMD      string `toml:"CMD" json:"cmd"`
+	CMD      string `toml:"CMD" json:"cmd"` // shell/script为命令或脚本内容，wait为轮询的条件命令
+
+	// Artifacts 步骤成功后从Path收集的文件（glob，如 "dist/*.tar.gz"），保存为本次执行的制品
+	// UseArtifacts 执行前将之前步骤（按Name引用）收集的制品下载到Path
+	Artifacts    []string `toml:"artifacts" json:"artifacts,omitempty"`
+	UseArtifacts []string `toml:"use_artifacts" json:"use_artifacts,omitempty"`
+
+	// upload：Artifact为制品ID或名称（同名取最新），写入Dest，可选Mode（如"0644"）和Owner（user或user:group）
+	// download：收集Src文件，Artifact为制品名称，默认为文件名
+	// template：渲染Template（内联）或Src（Agent上的模板文件），写入Dest，可选Mode和Owner
+	Artifact string `toml:"Artifact" json:"artifact,omitempty"`
+	Src      string `toml:"Src" json:"src,omitempty"`
+	Dest     string `toml:"Dest" json:"dest,omitempty"`
+	Mode     string `toml:"Mode" json:"mode,omitempty"`
+	Owner    string `toml:"Owner" json:"owner,omitempty"`
+
+	Interpreter string `toml:"Interpreter" json:"interpreter,omitempty"` // script：解释器，如 python3，为空时使用shebang，没有shebang时使用sh
+
+	// http：ExpectStatus为空时要求2xx，ExpectBody为响应内容需匹配的正则
+	URL          string            `toml:"URL" json:"url,omitempty"`
+	Method       string            `toml:"Method" json:"method,omitempty"`
+	Headers      map[string]string `toml:"Headers" json:"headers,omitempty"`
+	Body         string            `toml:"Body" json:"body,omitempty"`
+	ExpectStatus int               `toml:"ExpectStatus" json:"expect_status,omitempty"`
+	ExpectBody   string            `toml:"ExpectBody" json:"expect_body,omitempty"`
+
+	Template string            `toml:"Template" json:"template,omitempty"`
+	Params   map[string]string `toml:"Params" json:"params,omitempty"`
+
+	// 时长格式如 "30s"、"5m"；Timeout用于http请求和wait轮询
+	Duration string `toml:"Duration" json:"duration,omitempty"`
+	Interval string `toml:"Interval" json:"interval,omitempty"`
+	Timeout  string `toml:"Timeout" json:"timeout,omitempty"`
+
+	// container：CMD为空时执行镜像的默认命令；Volumes格式为 "宿主机路径:容器路径[:ro]"，
+	// Network为 bridge/host/none 或已有网络名称，为空时使用运行时默认网络
+	Image   string            `toml:"Image" json:"image,omitempty"`
+	Volumes []string          `toml:"Volumes" json:"volumes,omitempty"`
+	Env     map[string]string `toml:"Env" json:"env,omitempty"`
+	User    string            `toml:"User" json:"user,omitempty"`
+	Network string            `toml:"Network" json:"network,omitempty"`
+
+	// check：Probe为 http（URL、Method、Headers、ExpectStatus、ExpectBody）、tcp（Address，如 "127.0.0.1:5432"）、
+	// cmd（CMD退出码为0）或 file（File存在），Timeout为整体超时，Successes为需要连续成功的次数，默认1
+	Probe     string `toml:"Probe" json:"probe,omitempty"`
+	Address   string `toml:"Address" json:"address,omitempty"`
+	File      string `toml:"File" json:"file,omitempty"`
+	Successes int    `toml:"Successes" json:"successes,omitempty"`
+}
+
+// StepSpec 下发给Agent的步骤参数，shell/script的命令或脚本内容在StepExecution.Command中
+type StepSpec struct {
+	Collect []string       `json:"collect,omitempty"` // 步骤成功后收集的文件glob
+	Use     []StepArtifact `json:"use,omitempty"`     // 执行前下载到工作目录的制品
+
+	ArtifactID string `json:"artifact_id,omitempty"` // upload：要下载的制品
+	Name       string `json:"name,omitempty"`        // download：保存的制品名称
+	SHA256     string `json:"sha256,omitempty"`      // upload：校验下载内容
+	Size       int64  `json:"size,omitempty"`
+	Src        string `json:"src,omitempty"`
+	Dest       string `json:"dest,omitempty"`
+	Mode       string `json:"mode,omitempty"`
+	Owner      string `json:"owner,omitempty"`
+
+	Interpreter string `json:"interpreter,omitempty"`
+
+	URL          string            `json:"url,omitempty"`
+	Method       string            `json:"method,omitempty"`
+	Headers      map[string]string `json:"headers,omitempty"`
+	Body         string            `json:"body,omitempty"`
+	ExpectStatus int               `json:"expect_status,omitempty"`
+	ExpectBody   string            `json:"expect_body,omitempty"`
+
+	Template string            `json:"template,omitempty"`
+	Params   map[string]string `json:"params,omitempty"`
+
+	Duration string `json:"duration,omitempty"`
+	Until    string `json:"until,omitempty"` // wait：轮询的条件命令，退出码为0时结束等待
+	Interval string `json:"interval,omitempty"`
+	Timeout  string `json:"timeout,omitempty"`
+
+	Image   string            `json:"image,omitempty"`
+	Run     string            `json:"run,omitempty"` // container：容器内执行的命令，为空时执行镜像的默认命令；check：cmd探测的命令
+	Volumes []string          `json:"volumes,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+	User    string            `json:"user,omitempty"`
+	Network string            `json:"network,omitempty"`
+
+	Probe     string `json:"probe,omitempty"`
+	Address   string `json:"address,omitempty"`
+	File      string `json:"file,omitempty"`
+	Successes int    `json:"successes,omitempty"`
+}
+
+// StepArtifact 步骤执行前需要下载的制品
+type StepArtifact struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
 }
@@ -0,0 +1,98 @@
+package taskconfig
+
+import (
+	"regexp"
+	"strings"
+)
+
+// position 配置中的位置，从1开始
+type position struct {
+	line   int
+	column int
+}
+
+// locator 记录每个 [[step]] 和键所在的行列，用于给校验错误附加位置。
+// TOML解析库不提供键的位置，这里按行扫描，只识别每行开头的键
+type locator struct {
+	top   map[string]position
+	steps []stepLocation
+}
+
+type stepLocation struct {
+	header position
+	keys   map[string]position
+}
+
+var (
+	stepHeaderPattern  = regexp.MustCompile(`^\[\[\s*step\s*\]\]`)
+	tableHeaderPattern = regexp.MustCompile(`^\[`)
+	keyPattern         = regexp.MustCompile(`^([A-Za-z0-9_-]+|"[^"]*")\s*=`)
+)
+
+func newLocator(config string) *locator {
+	l := &locator{top: make(map[string]position)}
+	current := l.top
+	inTable := false
+	multiline := ""
+	for i, line := range strings.Split(config, "\n") {
+		if multiline != "" {
+			if strings.Count(line, multiline)%2 == 1 {
+				multiline = ""
+			}
+			continue
+		}
+
+		trimmed := strings.TrimLeft(line, " \t")
+		column := len(line) - len(trimmed) + 1
+		switch {
+		case stepHeaderPattern.MatchString(trimmed):
+			l.steps = append(l.steps, stepLocation{
+				header: position{line: i + 1, column: column},
+				keys:   make(map[string]position),
+			})
+			current = l.steps[len(l.steps)-1].keys
+			inTable = false
+		case tableHeaderPattern.MatchString(trimmed):
+			// 其他表（如 [step.Params]）中的键不参与定位
+			inTable = true
+		default:
+			if match := keyPattern.FindStringSubmatch(trimmed); match != nil && !inTable {
+				key := strings.Trim(match[1], `"`)
+				if _, ok := current[key]; !ok {
+					current[key] = position{line: i + 1, column: column}
+				}
+			}
+		}
+
+		for _, quote := range []string{`"""`, `'''`} {
+			if strings.Count(line, quote)%2 == 1 {
+				multiline = quote
+				break
+			}
+		}
+	}
+	return l
+}
+
+// step 步骤中键的位置，键不存在时为步骤表头的位置；index从0开始
+func (l *locator) step(index int, key string) position {
+	if index < 0 || index >= len(l.steps) {
+		return position{}
+	}
+	if pos, ok := l.steps[index].keys[key]; ok && key != "" {
+		return pos
+	}
+	return l.steps[index].header
+}
+
+// stepAt 行所在的步骤序号（从1开始），不在任何步骤中时为0
+func (l *locator) stepAt(line int) int {
+	index := 0
+	for i, step := range l.steps {
+		if step.header.line > line {
+			break
+		}
+		index = i + 1
+	}
+	return index
+}
@@ -0,0 +1,226 @@
+package taskconfig
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/google/uuid"
+	"github.com/plumber/plumber/pkg/models"
+)
+
+// Error 任务配置中的一处错误，Line和Column从1开始，无法定位时为0
+type Error struct {
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
+	Step    int    `json:"step,omitempty"` // 步骤序号，从1开始，与步骤无关时为0
+	Key     string `json:"key,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e Error) Error() string {
+	var b strings.Builder
+	if e.Line > 0 {
+		fmt.Fprintf(&b, "line %d, column %d: ", e.Line, e.Column)
+	}
+	if e.Step > 0 {
+		fmt.Fprintf(&b, "step %d: ", e.Step)
+	}
+	b.WriteString(e.Message)
+	return b.String()
+}
+
+// Errors 校验发现的全部错误
+type Errors []Error
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Sort 按位置排序，无法定位的错误排在最后
+func (e Errors) Sort() {
+	sort.SliceStable(e, func(i, j int) bool {
+		if (e[i].Line == 0) != (e[j].Line == 0) {
+			return e[j].Line == 0
+		}
+		if e[i].Line != e[j].Line {
+			return e[i].Line < e[j].Line
+		}
+		return e[i].Column < e[j].Column
+	})
+}
+
+// Result 校验结果，供调用方继续检查引用（如Agent是否存在）并追加错误
+type Result struct {
+	Config  *models.TaskConfig
+	Errors  Errors
+	locator *locator
+}
+
+// StepError 追加步骤上的错误，定位到key所在行，key不存在时定位到步骤表头；index从0开始
+func (r *Result) StepError(index int, key, message string) {
+	pos := r.locator.step(index, key)
+	r.Errors = append(r.Errors, Error{
+		Line:    pos.line,
+		Column:  pos.column,
+		Step:    index + 1,
+		Key:     key,
+		Message: message,
+	})
+}
+
+// Validate 解析TOML任务配置，检查语法、未知的键和每个步骤的参数，返回全部错误。
+// 语法错误时Config为nil
+func Validate(config string) *Result {
+	result := &Result{locator: newLocator(config)}
+
+	var taskConfig models.TaskConfig
+	meta, err := toml.Decode(config, &taskConfig)
+	if err != nil {
+		result.Errors = append(result.Errors, result.parseError(config, err))
+		return result
+	}
+	result.Config = &taskConfig
+
+	// 表数组中每个步骤出现的同一未知键都会列出一次，unknownKey已按步骤逐个报告，这里去重
+	reported := make(map[string]bool)
+	for _, key := range meta.Undecoded() {
+		if reported[key.String()] {
+			continue
+		}
+		reported[key.String()] = true
+		result.unknownKey(key)
+	}
+	if len(taskConfig.Steps) == 0 {
+		result.Errors = append(result.Errors, Error{Line: 1, Column: 1, Message: "no [[step]] defined"})
+	}
+
+	for i := range taskConfig.Steps {
+		step := &taskConfig.Steps[i]
+		if _, err := uuid.Parse(step.ServerID); err != nil {
+			result.StepError(i, "ServerID", fmt.Sprintf("ServerID must be an agent ID, got %q", step.ServerID))
+		}
+
+		stepType := step.Type
+		if stepType == "" {
+			stepType = models.StepTypeShell
+		}
+		validate, ok := stepValidators[stepType]
+		if !ok {
+			result.StepError(i, "Type", fmt.Sprintf("unknown step type %q", step.Type))
+			continue
+		}
+		if err := validate(step); err != nil {
+			result.stepErr(i, err)
+		}
+	}
+	validateArtifactRefs(taskConfig.Steps, result.stepErr)
+	result.Errors.Sort()
+	return result
+}
+
+// Parse 解析任务配置用于执行，只拒绝让步骤无法执行的错误：语法错误、未知的步骤类型和缺少的必填参数。
+// 未知的键和其他参数问题在保存任务时由Validate报告，不影响之前保存的任务执行
+func Parse(config string) (*models.TaskConfig, error) {
+	result := &Result{locator: newLocator(config)}
+
+	var taskConfig models.TaskConfig
+	if _, err := toml.Decode(config, &taskConfig); err != nil {
+		return nil, Errors{result.parseError(config, err)}
+	}
+
+	for i := range taskConfig.Steps {
+		step := &taskConfig.Steps[i]
+		stepType := step.Type
+		if stepType == "" {
+			stepType = models.StepTypeShell
+		}
+		required, ok := requiredFields[stepType]
+		if !ok {
+			result.StepError(i, "Type", fmt.Sprintf("unknown step type %q", step.Type))
+			continue
+		}
+		if err := required(step); err != nil {
+			result.stepErr(i, err)
+		}
+	}
+	if len(result.Errors) > 0 {
+		result.Errors.Sort()
+		return nil, result.Errors
+	}
+	return &taskConfig, nil
+}
+
+func (r *Result) stepErr(index int, err error) {
+	var field *fieldError
+	if errors.As(err, &field) {
+		r.StepError(index, field.key, field.message)
+		return
+	}
+	r.StepError(index, "", err.Error())
+}
+
+// unknownKey 报告未知的键；[[step]] 是表数组，解析库不区分是哪个步骤，这里报告每个出现该键的步骤
+func (r *Result) unknownKey(key toml.Key) {
+	switch {
+	case len(key) == 2 && key[0] == "step":
+		found := false
+		for i, step := range r.locator.steps {
+			if _, ok := step.keys[key[1]]; ok {
+				r.StepError(i, key[1], fmt.Sprintf("unknown key %q", key[1]))
+				found = true
+			}
+		}
+		if found {
+			return
+		}
+	case len(key) == 1:
+		if pos, ok := r.locator.top[key[0]]; ok {
+			r.Errors = append(r.Errors, Error{Line: pos.line, Column: pos.column, Key: key[0], Message: fmt.Sprintf("unknown key %q", key[0])})
+			return
+		}
+	case len(key) > 2 && key[0] == "step":
+		// 未知键下的子键（如内联表），只报告未知的父键
+		return
+	}
+	r.Errors = append(r.Errors, Error{Key: key.String(), Message: fmt.Sprintf("unknown key %q", key.String())})
+}
+
+// decodeErrorPattern 类型不匹配等解码错误只有文本，形如 toml: line 6 (last key "step.Successes"): ...
+var decodeErrorPattern = regexp.MustCompile(`^toml: (?:line (\d+) )?\(last key "([^"]*)"\): (.*)$`)
+
+// parseError 转换TOML语法或类型错误，附带行列；步骤中的键与其他错误一致，不带 step. 前缀
+func (r *Result) parseError(config string, err error) Error {
+	var parseErr toml.ParseError
+	if errors.As(err, &parseErr) {
+		return Error{
+			Line:    parseErr.Position.Line,
+			Column:  parseErr.Position.Col,
+			Step:    r.locator.stepAt(parseErr.Position.Line),
+			Key:     strings.TrimPrefix(parseErr.LastKey, "step."),
+			Message: parseErr.Message,
+		}
+	}
+
+	match := decodeErrorPattern.FindStringSubmatch(err.Error())
+	if match == nil {
+		return Error{Message: err.Error()}
+	}
+	e := Error{Key: strings.TrimPrefix(match[2], "step."), Message: match[3]}
+	if line, _ := strconv.Atoi(match[1]); line > 0 {
+		e.Line = line
+		e.Step = r.locator.stepAt(line)
+		if lines := strings.Split(config, "\n"); line <= len(lines) {
+			e.Column = len(lines[line-1]) - len(strings.TrimLeft(lines[line-1], " \t")) + 1
+		}
+	}
+	return e
+}
@@ -0,0 +1,251 @@
+package taskconfig
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testAgentID = "11111111-1111-1111-1111-111111111111"
+
+// config 以行拼接配置，{agent} 替换为测试Agent ID
+func config(lines ...string) string {
+	return strings.ReplaceAll(strings.Join(lines, "\n")+"\n", "{agent}", testAgentID)
+}
+
+func TestValidatePositions(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		want   Errors
+	}{
+		{
+			name: "valid",
+			config: config(
+				`[[step]]`,
+				`ServerID = "{agent}"`,
+				`CMD = "echo hello"`,
+			),
+			want: nil,
+		},
+		{
+			name: "syntax error",
+			config: config(
+				`[[step]]`,
+				`ServerID = "{agent}"`,
+				`CMD = "echo`,
+			),
+			want: Errors{{Line: 3, Column: 12, Step: 1, Key: "CMD", Message: "strings cannot contain newlines"}},
+		},
+		{
+			name: "type mismatch",
+			config: config(
+				`[[step]]`,
+				`ServerID = "{agent}"`,
+				`Type = "check"`,
+				`Probe = "tcp"`,
+				`Address = "127.0.0.1:80"`,
+				`  Successes = "three"`,
+			),
+			want: Errors{{Line: 6, Column: 3, Step: 1, Key: "Successes",
+				Message: "incompatible types: TOML value has type string; destination has type integer"}},
+		},
+		{
+			name: "unknown top-level key",
+			config: config(
+				`name = "deploy"`,
+				``,
+				`[[step]]`,
+				`ServerID = "{agent}"`,
+				`CMD = "echo"`,
+			),
+			want: Errors{{Line: 1, Column: 1, Key: "name", Message: `unknown key "name"`}},
+		},
+		{
+			name: "unknown key in step",
+			config: config(
+				`[[step]]`,
+				`ServerID = "{agent}"`,
+				`  Command = "echo"`,
+			),
+			want: Errors{
+				{Line: 1, Column: 1, Step: 1, Key: "CMD", Message: "CMD is required"},
+				{Line: 3, Column: 3, Step: 1, Key: "Command", Message: `unknown key "Command"`},
+			},
+		},
+		{
+			name: "same unknown key in two steps",
+			config: config(
+				`[[step]]`,
+				`ServerID = "{agent}"`,
+				`CMD = "a"`,
+				`Retry = 1`,
+				``,
+				`[[step]]`,
+				`ServerID = "{agent}"`,
+				`CMD = "b"`,
+				``,
+				`[[step]]`,
+				`ServerID = "{agent}"`,
+				`CMD = "c"`,
+				`Retry = 2`,
+			),
+			want: Errors{
+				{Line: 4, Column: 1, Step: 1, Key: "Retry", Message: `unknown key "Retry"`},
+				{Line: 13, Column: 1, Step: 3, Key: "Retry", Message: `unknown key "Retry"`},
+			},
+		},
+		{
+			name: "multi-line strings are not scanned for keys",
+			config: config(
+				`[[step]]`,
+				`ServerID = "{agent}"`,
+				`CMD = """`,
+				`Color = 1`,
+				`[[step]]`,
+				`"""`,
+				`Color = "red"`,
+				`Body = '''`,
+				`x = 1'''`,
+				`Shade = 2`,
+			),
+			want: Errors{
+				{Line: 7, Column: 1, Step: 1, Key: "Color", Message: `unknown key "Color"`},
+				{Line: 10, Column: 1, Step: 1, Key: "Shade", Message: `unknown key "Shade"`},
+			},
+		},
+		{
+			name: "keys in step.Params subtable are not step keys",
+			config: config(
+				`[[step]]`,
+				`ServerID = "{agent}"`,
+				`Type = "template"`,
+				`Template = "{{.name}}"`,
+				``,
+				`[step.Params]`,
+				`Dest = "ignored"`,
+				``,
+				`[[step]]`,
+				`ServerID = "{agent}"`,
+				`Type = "bogus"`,
+			),
+			want: Errors{
+				{Line: 1, Column: 1, Step: 1, Key: "Dest", Message: "Dest is required"},
+				{Line: 11, Column: 1, Step: 2, Key: "Type", Message: `unknown step type "bogus"`},
+			},
+		},
+		{
+			name: "use_artifacts forward reference",
+			config: config(
+				`[[step]]`,
+				`Name = "test"`,
+				`ServerID = "{agent}"`,
+				`CMD = "make test"`,
+				`use_artifacts = ["build"]`,
+				``,
+				`[[step]]`,
+				`Name = "build"`,
+				`ServerID = "{agent}"`,
+				`CMD = "make"`,
+				`artifacts = ["dist/*"]`,
+			),
+			want: Errors{{Line: 5, Column: 1, Step: 1, Key: "use_artifacts",
+				Message: `use_artifacts references "build", which is not an earlier step with artifacts`}},
+		},
+		{
+			name: "duplicate step names",
+			config: config(
+				`[[step]]`,
+				`Name = "build"`,
+				`ServerID = "{agent}"`,
+				`CMD = "a"`,
+				``,
+				`[[step]]`,
+				`ServerID = "{agent}"`,
+				`CMD = "b"`,
+				`Name = "build"`,
+			),
+			want: Errors{{Line: 9, Column: 1, Step: 2, Key: "Name", Message: `duplicate step name "build"`}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Validate(tt.config).Errors
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("errors mismatch\n got: %#v\nwant: %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseIsLenient(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		wantErr string
+	}{
+		{
+			name: "unknown keys are ignored",
+			config: config(
+				`name = "legacy"`,
+				`[[step]]`,
+				`ServerID = "{agent}"`,
+				`CMD = "echo"`,
+				`Retry = 3`,
+			),
+		},
+		{
+			name: "lint errors are ignored",
+			config: config(
+				`[[step]]`,
+				`ServerID = "{agent}"`,
+				`Type = "http"`,
+				`URL = "http://localhost"`,
+				`ExpectBody = "("`,
+			),
+		},
+		{
+			name: "syntax error",
+			config: config(
+				`[[step]]`,
+				`CMD = "echo`,
+			),
+			wantErr: "line 2, column 12: step 1: strings cannot contain newlines",
+		},
+		{
+			name: "unknown step type",
+			config: config(
+				`[[step]]`,
+				`ServerID = "{agent}"`,
+				`Type = "bogus"`,
+			),
+			wantErr: `line 3, column 1: step 1: unknown step type "bogus"`,
+		},
+		{
+			name: "missing required field",
+			config: config(
+				`[[step]]`,
+				`ServerID = "{agent}"`,
+				`Type = "upload"`,
+				`Artifact = "app.tar.gz"`,
+			),
+			wantErr: "line 1, column 1: step 1: Dest is required",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.config)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,301 @@
+package taskconfig
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/plumber/plumber/pkg/models"
+)
+
+// stepValidators 各步骤类型的参数校验，不在此表中的类型在保存和执行任务时被拒绝。
+// 返回fieldError时错误定位到对应的键，否则定位到步骤表头
+var stepValidators = map[string]func(step *models.TaskStep) error{
+	models.StepTypeShell:     validateShellStep,
+	models.StepTypeScript:    validateShellStep,
+	models.StepTypeHTTP:      validateHTTPStep,
+	models.StepTypeTemplate:  validateTemplateStep,
+	models.StepTypeWait:      validateWaitStep,
+	models.StepTypeContainer: validateContainerStep,
+	models.StepTypeCheck:     validateCheckStep,
+	models.StepTypeUpload:    validateUploadStep,
+	models.StepTypeDownload:  validateDownloadStep,
+}
+
+// requiredFields 各步骤类型执行所必需的参数，执行任务时只检查这些
+var requiredFields = map[string]func(step *models.TaskStep) error{
+	models.StepTypeShell:  validateShellStep,
+	models.StepTypeScript: validateShellStep,
+	models.StepTypeHTTP: func(step *models.TaskStep) error {
+		return requireField("URL", step.URL)
+	},
+	models.StepTypeTemplate: func(step *models.TaskStep) error {
+		if step.Template == "" && step.Src == "" {
+			return fieldErrorf("Template", "Template or Src is required")
+		}
+		return requireField("Dest", step.Dest)
+	},
+	models.StepTypeWait: func(step *models.TaskStep) error {
+		if step.Duration == "" && step.CMD == "" {
+			return fieldErrorf("Duration", "Duration or CMD is required")
+		}
+		return nil
+	},
+	models.StepTypeContainer: func(step *models.TaskStep) error {
+		return requireField("Image", step.Image)
+	},
+	models.StepTypeCheck: func(step *models.TaskStep) error {
+		return requireField("Probe", step.Probe)
+	},
+	models.StepTypeUpload: func(step *models.TaskStep) error {
+		if err := requireField("Artifact", step.Artifact); err != nil {
+			return err
+		}
+		return requireField("Dest", step.Dest)
+	},
+	models.StepTypeDownload: func(step *models.TaskStep) error {
+		return requireField("Src", step.Src)
+	},
+}
+
+func requireField(key, value string) error {
+	if value == "" {
+		return fieldErrorf(key, "%s is required", key)
+	}
+	return nil
+}
+
+func validateShellStep(step *models.TaskStep) error {
+	if step.CMD == "" {
+		return fieldErrorf("CMD", "CMD is required")
+	}
+	return nil
+}
+
+func validateHTTPStep(step *models.TaskStep) error {
+	if err := validateHTTPRequest(step); err != nil {
+		return err
+	}
+	return validateDurations(step)
+}
+
+// validateHTTPRequest 校验http步骤和http探测的请求及预期结果
+func validateHTTPRequest(step *models.TaskStep) error {
+	u, err := url.Parse(step.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fieldErrorf("URL", "URL must be an absolute http or https URL")
+	}
+	if step.Method != "" && !validHTTPMethods[step.Method] {
+		return fieldErrorf("Method", "invalid Method %q", step.Method)
+	}
+	if step.ExpectStatus != 0 && (step.ExpectStatus < 100 || step.ExpectStatus > 599) {
+		return fieldErrorf("ExpectStatus", "invalid ExpectStatus %d", step.ExpectStatus)
+	}
+	if _, err := regexp.Compile(step.ExpectBody); err != nil {
+		return fieldErrorf("ExpectBody", "invalid ExpectBody: %v", err)
+	}
+	return nil
+}
+
+var validHTTPMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodOptions: true,
+}
+
+func validateTemplateStep(step *models.TaskStep) error {
+	if (step.Template == "") == (step.Src == "") {
+		return fieldErrorf("Template", "exactly one of Template and Src is required")
+	}
+	if step.Dest == "" {
+		return fieldErrorf("Dest", "Dest is required")
+	}
+	if step.Template != "" {
+		if _, err := template.New("step").Parse(step.Template); err != nil {
+			return fieldErrorf("Template", "invalid Template: %v", err)
+		}
+	}
+	return validateFileMode(step.Mode)
+}
+
+func validateWaitStep(step *models.TaskStep) error {
+	if step.Duration == "" && step.CMD == "" {
+		return fieldErrorf("Duration", "Duration or CMD is required")
+	}
+	return validateDurations(step)
+}
+
+func validateCheckStep(step *models.TaskStep) error {
+	switch step.Probe {
+	case "http":
+		if err := validateHTTPRequest(step); err != nil {
+			return err
+		}
+	case "tcp":
+		_, port, err := net.SplitHostPort(step.Address)
+		if err != nil {
+			return fieldErrorf("Address", "invalid Address %q, expected host:port", step.Address)
+		}
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return fieldErrorf("Address", "invalid port in Address %q", step.Address)
+		}
+	case "cmd":
+		if step.CMD == "" {
+			return fieldErrorf("CMD", "CMD is required")
+		}
+	case "file":
+		if step.File == "" {
+			return fieldErrorf("File", "File is required")
+		}
+	default:
+		return fieldErrorf("Probe", "Probe must be one of http, tcp, cmd and file")
+	}
+	if step.Successes < 0 {
+		return fieldErrorf("Successes", "invalid Successes %d", step.Successes)
+	}
+	return validateDurations(step)
+}
+
+// imagePattern 镜像引用，如 golang:1.25、registry.example.com/team/app@sha256:...
+var imagePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._/:@-]*$`)
+
+// networkPattern 网络名称
+var networkPattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+func validateContainerStep(step *models.TaskStep) error {
+	if !imagePattern.MatchString(step.Image) {
+		return fieldErrorf("Image", "invalid Image %q", step.Image)
+	}
+	for _, volume := range step.Volumes {
+		parts := strings.Split(volume, ":")
+		if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || !path.IsAbs(parts[1]) {
+			return fieldErrorf("Volumes", "invalid volume %q, expected host:container[:ro]", volume)
+		}
+		if len(parts) == 3 && parts[2] != "ro" && parts[2] != "rw" {
+			return fieldErrorf("Volumes", "invalid volume option %q", parts[2])
+		}
+	}
+	for key := range step.Env {
+		if key == "" || strings.ContainsAny(key, "=\x00") {
+			return fieldErrorf("Env", "invalid Env name %q", key)
+		}
+	}
+	if step.Network != "" && !networkPattern.MatchString(step.Network) {
+		return fieldErrorf("Network", "invalid Network %q", step.Network)
+	}
+	return nil
+}
+
+func validateUploadStep(step *models.TaskStep) error {
+	if step.Artifact == "" || step.Dest == "" {
+		return fieldErrorf("Artifact", "Artifact and Dest are required")
+	}
+	return validateFileMode(step.Mode)
+}
+
+func validateDownloadStep(step *models.TaskStep) error {
+	if step.Src == "" {
+		return fieldErrorf("Src", "Src is required")
+	}
+	if err := models.ValidateArtifactName(DownloadArtifactName(step)); err != nil {
+		if step.Artifact == "" {
+			return fieldErrorf("Src", "%v", err)
+		}
+		return fieldErrorf("Artifact", "%v", err)
+	}
+	return nil
+}
+
+// DownloadArtifactName download步骤保存的制品名称，默认为文件名
+func DownloadArtifactName(step *models.TaskStep) string {
+	if step.Artifact != "" {
+		return step.Artifact
+	}
+	return path.Base(step.Src)
+}
+
+// validateDurations 校验Duration、Interval和Timeout，Duration和Timeout不能超过步骤的执行时限
+func validateDurations(step *models.TaskStep) error {
+	fields := []struct{ key, value string }{
+		{"Duration", step.Duration},
+		{"Interval", step.Interval},
+		{"Timeout", step.Timeout},
+	}
+	for _, field := range fields {
+		if field.value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(field.value)
+		if err != nil || d < 0 {
+			return fieldErrorf(field.key, "invalid %s %q", field.key, field.value)
+		}
+		if field.key != "Interval" && d > models.MaxStepTimeout {
+			return fieldErrorf(field.key, "%s %s exceeds the step time limit of %s", field.key, field.value, models.MaxStepTimeout)
+		}
+	}
+	return nil
+}
+
+// validateFileMode 校验八进制文件权限，如 0644，不支持setuid等特殊位
+func validateFileMode(mode string) error {
+	if mode == "" {
+		return nil
+	}
+	if value, err := strconv.ParseUint(mode, 8, 32); err != nil || value > 0777 {
+		return fieldErrorf("Mode", "invalid file mode %q", mode)
+	}
+	return nil
+}
+
+// validateArtifactRefs 检查步骤名称唯一，use_artifacts只能引用之前收集了制品的步骤
+func validateArtifactRefs(steps []models.TaskStep, report func(index int, err error)) {
+	collecting := make(map[string]bool)
+	names := make(map[string]bool)
+	for i, step := range steps {
+		for _, ref := range step.UseArtifacts {
+			if !collecting[ref] {
+				report(i, fieldErrorf("use_artifacts", "use_artifacts references %q, which is not an earlier step with artifacts", ref))
+			}
+		}
+		for _, pattern := range step.Artifacts {
+			if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+				report(i, fieldErrorf("artifacts", "invalid artifacts pattern %q", pattern))
+			}
+		}
+
+		if step.Name == "" {
+			continue
+		}
+		if names[step.Name] {
+			report(i, fieldErrorf("Name", "duplicate step name %q", step.Name))
+			continue
+		}
+		names[step.Name] = true
+		collecting[step.Name] = len(step.Artifacts) > 0
+	}
+}
+
+// fieldError 指向某个键的校验错误
+type fieldError struct {
+	key     string
+	message string
+}
+
+func (e *fieldError) Error() string {
+	return e.message
+}
+
+func fieldErrorf(key, format string, args ...interface{}) error {
+	return &fieldError{key: key, message: fmt.Sprintf(format, args...)}
+}
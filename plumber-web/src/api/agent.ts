@@ -8,11 +8,16 @@ export interface Agent {
   ssh_port?: number
   ssh_user?: string
   ssh_auth_type?: 'none' | 'password' | 'key'
-  ssh_password?: string
-  ssh_private_key?: string
+  ssh_bastion_id?: string
   hostname?: string
   ip?: string
-  status: 'online' | 'offline'
+  status: 'online' | 'offline' | 'decommissioned'
+  version?: string
+  os?: string
+  arch?: string
+  desired_version?: string
+  update_status?: 'success' | 'failed' | 'rolled_back'
+  update_message?: string
   last_heartbeat?: string
   created_at: string
   updated_at: string
@@ -45,6 +50,7 @@ export interface CreateAgentResponse {
 export interface GetAgentConfigResponse {
   config: string
   filename: string
+  token_rotated: boolean
 }
 
 // 获取 Agent 列表
@@ -57,9 +63,9 @@ export function createAgent(params: CreateAgentParams) {
   return callRPC<CreateAgentResponse>('plumber.agent.create', params)
 }
 
-// 获取 Agent 配置文件
-export function getAgentConfig(agentId: string) {
-  return callRPC<GetAgentConfigResponse>('plumber.agent.getConfig', { agent_id: agentId })
+// 获取 Agent 配置文件，rotate 为 true 时签发新令牌，运行中的 Agent 持有的旧令牌失效
+export function getAgentConfig(agentId: string, rotate = false) {
+  return callRPC<GetAgentConfigResponse>('plumber.agent.getConfig', { agent_id: agentId, rotate })
 }
 
 // 更新 Agent
@@ -85,18 +91,56 @@ export function deleteAgent(agentId: string) {
 
 // 部署 Agent 参数
 export interface DeployAgentParams {
-  agent_id: string
-  script_url: string
+  agent_id?: string
+  agent_ids?: string[]
+  labels?: Record<string, string>
+  method?: 'offline' | 'script' // 留空时提供了 script_url 为 script，否则为 offline
+  script_url?: string
   install_dir: string
+  parallelism?: number
 }
 
-// 部署 Agent 响应
+// 部署 Agent 响应（部署在后台执行）
 export interface DeployAgentResponse {
   status: string
-  output: string
+  job_id: string
+  targets: number
+}
+
+// 部署任务中单个 Agent 的进度
+export interface DeployTarget {
+  id: string
+  agent_id: string
+  agent_name: string
+  status: 'pending' | 'running' | 'success' | 'failed' | 'skipped'
+  stage?: string
+  os?: string
+  arch?: string
+  output?: string
+  error?: string
+}
+
+// 部署任务
+export interface DeployJob {
+  id: string
+  kind: 'deploy' | 'upgrade' | 'uninstall'
+  version?: string
+  method: string
+  install_dir: string
+  parallelism: number
+  status: 'pending' | 'running' | 'success' | 'failed'
+  retry_of?: string
+  username: string
+  created_at: string
+  targets: DeployTarget[]
 }
 
 // 部署 Agent
 export function deployAgent(params: DeployAgentParams) {
   return callRPC<DeployAgentResponse>('plumber.agent.deploy', params)
 }
+
+// 查询部署任务
+export function getDeployJob(jobId: string) {
+  return callRPC<{ job: DeployJob }>('plumber.deploy.get', { job_id: jobId })
+}
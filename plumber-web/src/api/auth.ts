@@ -9,6 +9,8 @@ export interface LoginParams {
 // 登录响应
 export interface LoginResponse {
   token: string
+  refresh_token: string
+  expires_in: number
   username: string
   user_id: string
 }
@@ -17,3 +19,8 @@ export interface LoginResponse {
 export function login(params: LoginParams) {
   return callRPC<LoginResponse>('plumber.user.login', params)
 }
+
+// 退出登录（吊销当前会话）
+export function logout() {
+  return callRPC('plumber.user.logout')
+}
@@ -57,10 +57,50 @@ instance.interceptors.response.use(
   }
 )
 
+// 认证失败错误码（访问令牌过期或会话被吊销）
+const UNAUTHENTICATED = -32001
+
+// 正在进行的刷新请求，避免并发请求重复刷新
+let refreshing: Promise<boolean> | null = null
+
+// 使用刷新令牌换取新的访问令牌
+async function refreshAccessToken(): Promise<boolean> {
+  const refreshToken = localStorage.getItem('refreshToken')
+  if (!refreshToken) {
+    return false
+  }
+
+  if (!refreshing) {
+    refreshing = instance
+      .post<JSONRPCResponse>('/api/rpc', {
+        jsonrpc: '2.0',
+        method: 'plumber.user.refresh',
+        params: { refresh_token: refreshToken },
+        id: Date.now(),
+      })
+      .then((response) => {
+        const result = response.data.result
+        if (response.data.error || !result?.token) {
+          return false
+        }
+        localStorage.setItem('token', result.token)
+        localStorage.setItem('refreshToken', result.refresh_token)
+        return true
+      })
+      .catch(() => false)
+      .finally(() => {
+        refreshing = null
+      })
+  }
+
+  return refreshing
+}
+
 // JSON-RPC 调用封装
 export async function callRPC<T = any>(
   method: string,
-  params?: any
+  params?: any,
+  retried = false
 ): Promise<T> {
   const request: JSONRPCRequest = {
     jsonrpc: '2.0',
@@ -73,6 +113,15 @@ export async function callRPC<T = any>(
     const response = await instance.post<JSONRPCResponse<T>>('/api/rpc', request)
     const data = response.data
 
+    if (data.error?.code === UNAUTHENTICATED && !retried && localStorage.getItem('token')) {
+      if (await refreshAccessToken()) {
+        return callRPC<T>(method, params, true)
+      }
+      localStorage.removeItem('token')
+      localStorage.removeItem('refreshToken')
+      window.location.href = '/login'
+    }
+
     if (data.error) {
       throw new Error(data.error.message)
     }
@@ -16,9 +16,12 @@ export interface StepExecution {
   id: string
   execution_id: string
   step_index: number
+  name?: string
   agent_id: string
   path: string
+  type: 'shell' | 'script' | 'http' | 'template' | 'wait' | 'container' | 'check' | 'upload' | 'download'
   command: string
+  spec?: StepSpec
   status: 'pending' | 'running' | 'success' | 'failed'
   exit_code?: number
   output?: string
@@ -28,6 +31,73 @@ export interface StepExecution {
   updated_at: string
 }
 
+// 步骤参数（制品收集和使用、文件传输）
+export interface StepSpec {
+  collect?: string[]
+  use?: { id: string; name: string; size: number; sha256: string }[]
+  artifact_id?: string
+  name?: string
+  sha256?: string
+  size?: number
+  src?: string
+  dest?: string
+  mode?: string
+  owner?: string
+  interpreter?: string
+  url?: string
+  method?: string
+  headers?: Record<string, string>
+  body?: string
+  expect_status?: number
+  expect_body?: string
+  template?: string
+  params?: Record<string, string>
+  duration?: string
+  until?: string
+  interval?: string
+  timeout?: string
+  image?: string
+  run?: string
+  volumes?: string[]
+  env?: Record<string, string>
+  user?: string
+  network?: string
+  probe?: 'http' | 'tcp' | 'cmd' | 'file'
+  address?: string
+  file?: string
+  successes?: number
+}
+
+// 制品信息，内容通过 /api/artifacts?id=... 下载
+export interface Artifact {
+  id: string
+  name: string
+  size: number
+  sha256: string
+  execution_id?: string
+  step_id?: string
+  step_name?: string
+  agent_id?: string
+  user_id?: string
+  username?: string
+  created_at: string
+}
+
+// 获取制品列表参数
+export interface ListArtifactsParams {
+  execution_id?: string
+  step_name?: string
+  name?: string
+  limit?: number
+  offset?: number
+}
+
+// 获取制品列表响应
+export interface ListArtifactsResponse {
+  artifacts: Artifact[]
+  total: number
+}
+
 // 任务执行信息
 export interface TaskExecution {
   id: string
@@ -50,6 +120,7 @@ export interface CreateTaskParams {
   name: string
   description: string
   config: string
+  skip_validation?: boolean
 }
 
 // 创建任务响应
@@ -64,6 +135,7 @@ export interface UpdateTaskParams {
   name: string
   description: string
   config: string
+  skip_validation?: boolean
 }
 
 // 更新任务响应
@@ -72,6 +144,22 @@ export interface UpdateTaskResponse {
   message: string
 }
 
+// 任务配置错误，line/column从1开始，无法定位时为空
+export interface TaskConfigError {
+  line?: number
+  column?: number
+  step?: number
+  key?: string
+  message: string
+}
+
+// 校验任务配置响应
+export interface ValidateTaskResponse {
+  valid: boolean
+  steps: number
+  errors: TaskConfigError[]
+}
+
 // 运行任务参数
 export interface RunTaskParams {
   task_id: string
@@ -118,6 +206,11 @@ export function updateTask(params: UpdateTaskParams) {
   return callRPC<UpdateTaskResponse>('plumber.task.update', params)
 }
 
+// 校验任务配置
+export function validateTask(config: string) {
+  return callRPC<ValidateTaskResponse>('plumber.task.validate', { config })
+}
+
 // 运行任务
 export function runTask(params: RunTaskParams) {
   return callRPC<RunTaskResponse>('plumber.task.run', params)
@@ -132,3 +225,13 @@ export function getExecution(params: GetExecutionParams) {
 export function listExecutions(params: ListExecutionsParams) {
   return callRPC<ListExecutionsResponse>('plumber.execution.list', params)
 }
+
+// 获取制品列表
+export function listArtifacts(params: ListArtifactsParams) {
+  return callRPC<ListArtifactsResponse>('plumber.artifact.list', params)
+}
+
+// 删除制品
+export function deleteArtifact(id: string) {
+  return callRPC<{ status: string }>('plumber.artifact.delete', { id })
+}
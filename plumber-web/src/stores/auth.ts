@@ -1,6 +1,6 @@
 import { defineStore } from 'pinia'
 import { ref, computed } from 'vue'
-import { login as apiLogin, type LoginParams } from '@/api/auth'
+import { login as apiLogin, logout as apiLogout, type LoginParams } from '@/api/auth'
 
 export const useAuthStore = defineStore('auth', () => {
   const token = ref<string>(localStorage.getItem('token') || '')
@@ -17,18 +17,25 @@ export const useAuthStore = defineStore('auth', () => {
     userId.value = result.user_id
 
     localStorage.setItem('token', result.token)
+    localStorage.setItem('refreshToken', result.refresh_token)
     localStorage.setItem('username', result.username)
     localStorage.setItem('userId', result.user_id)
 
     return result
   }
 
-  function logout() {
+  async function logout() {
+    // 通知服务端吊销会话，失败时也要清理本地状态
+    if (token.value) {
+      await apiLogout().catch(() => {})
+    }
+
     token.value = ''
     username.value = ''
     userId.value = ''
 
     localStorage.removeItem('token')
+    localStorage.removeItem('refreshToken')
     localStorage.removeItem('username')
     localStorage.removeItem('userId')
   }